@@ -5,10 +5,12 @@
 package action
 
 import (
+	"strings"
 	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/tracing"
 )
 
 // Result is the value returned by Forward. It is used in the call of the next
@@ -37,6 +39,10 @@ type FWContext struct {
 
 	// List of parameters given to the executor.
 	Params []interface{}
+
+	// Span tracing the action, used to start spans of the operations run
+	// by the action. It's nil when tracing is disabled.
+	Span *tracing.Span
 }
 
 // BWContext is the context used in calls to Backward functions (backward
@@ -47,6 +53,10 @@ type BWContext struct {
 
 	// List of parameters given to the executor.
 	Params []interface{}
+
+	// Span tracing the rollback of the action. It's nil when tracing is
+	// disabled.
+	Span *tracing.Span
 }
 
 // Action defines actions that should be . It is composed of two functions:
@@ -132,14 +142,19 @@ func (p *Pipeline) Result() Result {
 //
 // After rolling back all completed actions, it returns the original error
 // returned by the action that failed.
-func (p *Pipeline) Execute(params ...interface{}) error {
-	var (
-		r   Result
-		err error
-	)
+//
+// The pipeline is traced as a child of the span carried by the first param
+// holding one, see tracing.SpanOf, or in a new trace otherwise.
+func (p *Pipeline) Execute(params ...interface{}) (err error) {
+	var r Result
 	if len(p.actions) == 0 {
 		return ErrPipelineNoActions
 	}
+	span := startPipelineSpan(params)
+	span.SetTag("actions", p.names())
+	defer func() {
+		span.Finish(err)
+	}()
 	fwCtx := FWContext{Params: params}
 	for i, a := range p.actions {
 		log.Debugf("[pipeline] running the Forward for the %s action", a.Name)
@@ -148,7 +163,7 @@ func (p *Pipeline) Execute(params ...interface{}) error {
 		} else if len(fwCtx.Params) < a.MinParams {
 			err = ErrPipelineFewParameters
 		} else {
-			r, err = a.Forward(fwCtx)
+			r, err = a.forward(fwCtx, span)
 			a.rMutex.Lock()
 			a.result = r
 			a.rMutex.Unlock()
@@ -159,20 +174,49 @@ func (p *Pipeline) Execute(params ...interface{}) error {
 			if a.OnError != nil {
 				a.OnError(fwCtx, err)
 			}
-			p.rollback(i-1, params)
+			p.rollback(i-1, params, span)
 			return err
 		}
 	}
 	return nil
 }
 
-func (p *Pipeline) rollback(index int, params []interface{}) {
+func (p *Pipeline) rollback(index int, params []interface{}, span *tracing.Span) {
 	bwCtx := BWContext{Params: params}
 	for i := index; i >= 0; i-- {
 		log.Debugf("[pipeline] running Backward for %s action", p.actions[i].Name)
 		if p.actions[i].Backward != nil {
 			bwCtx.FWResult = p.actions[i].result
+			bwCtx.Span = span.StartChild("rollback " + p.actions[i].Name)
 			p.actions[i].Backward(bwCtx)
+			bwCtx.Span.Finish(nil)
+		}
+	}
+}
+
+func startPipelineSpan(params []interface{}) *tracing.Span {
+	for _, param := range params {
+		if parent := tracing.SpanOf(param); parent != nil {
+			return parent.StartChild("pipeline")
 		}
 	}
+	return tracing.StartSpan("pipeline")
+}
+
+func (p *Pipeline) names() string {
+	names := make([]string, len(p.actions))
+	for i, a := range p.actions {
+		names[i] = a.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// forward calls the Forward function of the action inside its own span,
+// child of the pipeline span.
+func (a *Action) forward(ctx FWContext, pipelineSpan *tracing.Span) (r Result, err error) {
+	ctx.Span = pipelineSpan.StartChild("action " + a.Name)
+	defer func() {
+		ctx.Span.Finish(err)
+	}()
+	return a.Forward(ctx)
 }
@@ -5,9 +5,15 @@
 package action
 
 import (
+	"bufio"
+	"encoding/json"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/check.v1"
 )
 
@@ -173,3 +179,66 @@ func (s *S) TestActionOnError(c *check.C) {
 	c.Assert(err, check.Equals, returnedErr)
 	c.Assert(called, check.Equals, true)
 }
+
+func (s *S) TestExecuteTracing(c *check.C) {
+	path := filepath.Join(c.MkDir(), "spans.json")
+	config.Set("tracing:exporter", "file")
+	config.Set("tracing:file:path", path)
+	defer config.Unset("tracing")
+	err := tracing.Initialize()
+	c.Assert(err, check.IsNil)
+	defer tracing.Stop()
+	pipeline := NewPipeline(&helloAction, &errorAction)
+	err = pipeline.Execute()
+	c.Assert(err, check.NotNil)
+	tracing.Stop()
+	f, err := os.Open(path)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	var names, errs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		span := &tracing.Span{}
+		err = json.Unmarshal(scanner.Bytes(), span)
+		c.Assert(err, check.IsNil)
+		names = append(names, span.Name)
+		errs = append(errs, span.Error)
+	}
+	c.Assert(names, check.DeepEquals, []string{"action hello", "action error", "rollback hello", "pipeline"})
+	c.Assert(errs, check.DeepEquals, []string{"", "Failed to execute.", "", "Failed to execute."})
+}
+
+func (s *S) TestExecuteTracingChildOfParamSpan(c *check.C) {
+	path := filepath.Join(c.MkDir(), "spans.json")
+	config.Set("tracing:exporter", "file")
+	config.Set("tracing:file:path", path)
+	defer config.Unset("tracing")
+	err := tracing.Initialize()
+	c.Assert(err, check.IsNil)
+	defer tracing.Stop()
+	parent := tracing.StartRemoteSpan("POST /apps", "", "req-1")
+	pipeline := NewPipeline(&helloAction)
+	err = pipeline.Execute("hello", parent)
+	c.Assert(err, check.IsNil)
+	tracing.Stop()
+	f, err := os.Open(path)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	var spans []*tracing.Span
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		span := &tracing.Span{}
+		err = json.Unmarshal(scanner.Bytes(), span)
+		c.Assert(err, check.IsNil)
+		spans = append(spans, span)
+	}
+	c.Assert(spans, check.HasLen, 2)
+	c.Assert(spans[0].Name, check.Equals, "action hello")
+	c.Assert(spans[1].Name, check.Equals, "pipeline")
+	c.Assert(spans[1].ParentID, check.Equals, parent.SpanID)
+	c.Assert(spans[0].ParentID, check.Equals, spans[1].SpanID)
+	for _, span := range spans {
+		c.Assert(span.TraceID, check.Equals, parent.TraceID)
+		c.Assert(span.RequestID, check.Equals, "req-1")
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// title: app alert list
+// path: /apps/{app}/alerts
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func appAlertList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppReadAlert,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	rules, err := app.ListAlertRules(a.Name)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(rules)
+}
+
+// title: app alert set
+// path: /apps/{app}/alerts
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Alert set
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+//   404: App not found
+func appAlertSet(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateAlertSet,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	if r.FormValue("webhook") != "" && !permission.Check(t, permission.PermAppAdminAlertWebhook) {
+		return &tsuruErrors.HTTP{Code: http.StatusForbidden, Message: "You don't have permission to set alert webhooks."}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateAlertSet,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	rule := app.AlertRule{
+		App:     a.Name,
+		Name:    r.FormValue("name"),
+		Kind:    app.AlertKind(r.FormValue("kind")),
+		Emails:  r.Form["email"],
+		Webhook: r.FormValue("webhook"),
+	}
+	if rule.Name == "" || rule.Kind == "" {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "Name and kind are required."}
+	}
+	if value := r.FormValue("threshold"); value != "" {
+		rule.Threshold, err = strconv.Atoi(value)
+		if err != nil {
+			return &tsuruErrors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid %q value %q, it must be an integer.", "threshold", value),
+			}
+		}
+	}
+	if value := r.FormValue("window"); value != "" {
+		rule.Window, err = time.ParseDuration(value)
+		if err != nil {
+			return &tsuruErrors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid %q value %q, it must be a duration, like 10m.", "window", value),
+			}
+		}
+	}
+	err = checkAlertRecipients(&a, rule.Emails)
+	if err != nil {
+		return err
+	}
+	err = app.SetAlertRule(&rule)
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(rule)
+}
+
+// checkAlertRecipients ensures alerts are only emailed to users allowed to
+// read the alerts of the app.
+func checkAlertRecipients(a *app.App, emails []string) error {
+	for _, email := range emails {
+		u, err := auth.GetUserByEmail(email)
+		if err != nil {
+			if _, ok := err.(*tsuruErrors.ValidationError); !ok && err != auth.ErrUserNotFound {
+				return err
+			}
+			u = nil
+		}
+		if u == nil || !permission.Check(u, permission.PermAppReadAlert, contextsForApp(a)...) {
+			return &tsuruErrors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("%q is not a user allowed to read the alerts of the app.", email),
+			}
+		}
+	}
+	return nil
+}
+
+// title: app alert remove
+// path: /apps/{app}/alerts/{name}
+// method: DELETE
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: App or alert not found
+func appAlertRemove(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateAlertRemove,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateAlertRemove,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = app.RemoveAlertRule(a.Name, r.URL.Query().Get(":name"))
+	if err == app.ErrAlertRuleNotFound {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAppAlertSet(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("name=crashloop&kind=unit-restarts&threshold=3&window=10m&email=" + s.user.Email + "&webhook=http://example.com/hook")
+	request, err := http.NewRequest("POST", "/apps/myapp/alerts", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var rule app.AlertRule
+	err = json.Unmarshal(recorder.Body.Bytes(), &rule)
+	c.Assert(err, check.IsNil)
+	c.Assert(rule.Name, check.Equals, "crashloop")
+	rules, err := app.ListAlertRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 1)
+	c.Assert(rules[0].Kind, check.Equals, app.AlertUnitRestarts)
+	c.Assert(rules[0].Threshold, check.Equals, 3)
+	c.Assert(rules[0].Window, check.Equals, 10*time.Minute)
+	c.Assert(rules[0].Emails, check.DeepEquals, []string{s.user.Email})
+	c.Assert(rules[0].Webhook, check.Equals, "http://example.com/hook")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget("myapp"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.alert.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "crashloop"},
+			{"name": "kind", "value": "unit-restarts"},
+			{"name": "threshold", "value": "3"},
+			{"name": "window", "value": "10m"},
+			{"name": "email", "value": s.user.Email},
+			{"name": "webhook", "value": "http://example.com/hook"},
+			{"name": ":app", "value": "myapp"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppAlertSetInvalid(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		body    string
+		message string
+	}{
+		{"kind=error-logs&window=1m", "Name and kind are required.\n"},
+		{"name=errors&kind=error-logs&threshold=x&window=1m", "Invalid \"threshold\" value \"x\", it must be an integer.\n"},
+		{"name=errors&kind=error-logs&window=x", "Invalid \"window\" value \"x\", it must be a duration, like 10m.\n"},
+		{"name=errors&kind=cpu&window=1m", "invalid alert kind \"cpu\", it must be one of [unit-restarts no-started-units healthcheck-failures error-logs]\n"},
+		{"name=errors&kind=error-logs", "alert window must be greater than zero\n"},
+		{"name=errors&kind=error-logs&window=1m&email=someone@example.com", "\"someone@example.com\" is not a user allowed to read the alerts of the app.\n"},
+	}
+	for _, t := range tests {
+		request, err := http.NewRequest("POST", "/apps/myapp/alerts", strings.NewReader(t.body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		RunServer(true).ServeHTTP(recorder, request)
+		c.Check(recorder.Code, check.Equals, http.StatusBadRequest)
+		c.Check(recorder.Body.String(), check.Equals, t.message)
+	}
+}
+
+func (s *S) TestAppAlertSetRequiresPermission(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "reader", permission.Permission{
+		Scheme:  permission.PermAppReadAlert,
+		Context: permission.Context(permission.CtxApp, "myapp"),
+	})
+	body := strings.NewReader("name=errors&kind=error-logs&window=1m")
+	request, err := http.NewRequest("POST", "/apps/myapp/alerts", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAppAlertSetWebhookRequiresGlobalPermission(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "alerter", permission.Permission{
+		Scheme:  permission.PermApp,
+		Context: permission.Context(permission.CtxApp, "myapp"),
+	})
+	body := strings.NewReader("name=errors&kind=error-logs&window=1m&webhook=http://example.com/hook")
+	request, err := http.NewRequest("POST", "/apps/myapp/alerts", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), check.Equals, "You don't have permission to set alert webhooks.\n")
+	rules, err := app.ListAlertRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 0)
+}
+
+func (s *S) TestAppAlertList(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myapp/alerts", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	err = app.SetAlertRule(&app.AlertRule{App: "myapp", Name: "errors", Kind: app.AlertErrorLogs, Threshold: 10, Window: time.Minute})
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var rules []app.AlertRule
+	err = json.Unmarshal(recorder.Body.Bytes(), &rules)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 1)
+	c.Assert(rules[0].Name, check.Equals, "errors")
+	c.Assert(rules[0].Threshold, check.Equals, 10)
+	c.Assert(rules[0].State.Firing, check.Equals, false)
+}
+
+func (s *S) TestAppAlertRemove(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = app.SetAlertRule(&app.AlertRule{App: "myapp", Name: "errors", Kind: app.AlertErrorLogs, Window: time.Minute})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/myapp/alerts/errors", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	rules, err := app.ListAlertRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget("myapp"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.alert.remove",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": "myapp"},
+			{"name": ":name", "value": "errors"},
+		},
+	}, eventtest.HasEvent)
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ajg/form"
@@ -47,6 +48,7 @@ func getAppFromContext(name string, r *http.Request) (app.App, error) {
 		}
 		context.SetApp(r, a)
 	}
+	a.SetSpan(context.GetSpan(r))
 	return *a, nil
 }
 
@@ -218,8 +220,40 @@ func appInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if !canRead {
 		return permission.ErrUnauthorized
 	}
+	var metrics []provision.UnitMetrics
+	if permission.Check(t, permission.PermAppReadMetric, contextsForApp(&a)...) {
+		metrics, err = a.LastUnitMetrics()
+		if err != nil {
+			return err
+		}
+	}
+	var alerts []app.AlertRule
+	if permission.Check(t, permission.PermAppReadAlert, contextsForApp(&a)...) {
+		alerts, err = app.ListAlertRules(a.Name)
+		if err != nil {
+			return err
+		}
+		for i := range alerts {
+			alerts[i].Webhook = ""
+		}
+	}
+	data, err := json.Marshal(&a)
+	if err != nil {
+		return err
+	}
+	var result map[string]interface{}
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return err
+	}
+	if len(metrics) > 0 {
+		result["unitsmetrics"] = metrics
+	}
+	if len(alerts) > 0 {
+		result["alerts"] = alerts
+	}
 	w.Header().Set("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(&a)
+	return json.NewEncoder(w).Encode(result)
 }
 
 type inputApp struct {
@@ -264,6 +298,7 @@ func createApp(w http.ResponseWriter, r *http.Request, t auth.Token) (err error)
 		RouterOpts:  ia.RouterOpts,
 		Router:      ia.Router,
 	}
+	a.SetSpan(context.GetSpan(r))
 	if a.TeamOwner == "" {
 		a.TeamOwner, err = permission.TeamForPermission(t, permission.PermAppCreate)
 		if err != nil {
@@ -1062,21 +1097,51 @@ func unsetCName(w http.ResponseWriter, r *http.Request, t auth.Token) (err error
 func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	var err error
 	var lines int
-	if l := r.URL.Query().Get("lines"); l != "" {
+	query := r.URL.Query()
+	filter := app.LogFilter{
+		Source: query.Get("source"),
+		Unit:   query.Get("unit"),
+		Grep:   query.Get("grep"),
+	}
+	if since := query.Get("since"); since != "" {
+		filter.Since, err = parseLogTime(since)
+		if err != nil {
+			msg := `Parameter "since" must be a duration, like 1h, or a RFC3339 date.`
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		filter.Until, err = parseLogTime(until)
+		if err != nil {
+			msg := `Parameter "until" must be a duration, like 1h, or a RFC3339 date.`
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+	}
+	if l := query.Get("lines"); l != "" {
 		lines, err = strconv.Atoi(l)
 		if err != nil {
 			msg := `Parameter "lines" must be an integer.`
 			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
 		}
-	} else {
+	} else if filter.Since.IsZero() {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: `Parameter "lines" is mandatory.`}
 	}
+	filter.Lines = lines
+	for _, f := range query["filter"] {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			msg := fmt.Sprintf("Invalid filter %q, it must be in the key=value format.", f)
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: msg}
+		}
+		filter.SetField(parts[0], parts[1])
+	}
+	err = filter.Validate()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
 	w.Header().Set("Content-Type", "application/x-json-stream")
-	source := r.URL.Query().Get("source")
-	unit := r.URL.Query().Get("unit")
-	follow := r.URL.Query().Get("follow")
-	appName := r.URL.Query().Get(":app")
-	filterLog := app.Applog{Source: source, Unit: unit}
+	follow := query.Get("follow")
+	appName := query.Get(":app")
 	a, err := getAppFromContext(appName, r)
 	if err != nil {
 		return err
@@ -1087,10 +1152,16 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
-	logs, err := a.LastLogs(lines, filterLog)
+	logs, err := a.SearchLogs(filter)
 	if err != nil {
 		return err
 	}
+	truncatedAt, err := a.LogsTruncatedAt(logs, filter)
+	if err != nil {
+		log.Errorf("unable to check whether logs of app %s were truncated: %s", a.Name, err)
+	} else if !truncatedAt.IsZero() {
+		logs = append([]app.Applog{a.LogsTruncatedNotice(truncatedAt)}, logs...)
+	}
 	encoder := json.NewEncoder(w)
 	err = encoder.Encode(logs)
 	if err != nil {
@@ -1105,7 +1176,7 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	} else {
 		closeChan = make(chan bool)
 	}
-	l, err := app.NewLogListener(&a, filterLog)
+	l, err := app.NewLogListenerFilter(&a, filter)
 	if err != nil {
 		return err
 	}
@@ -1117,12 +1188,13 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	logChan := l.ListenChan()
 	for {
 		var logMsg app.Applog
+		var ok bool
 		select {
 		case <-closeChan:
 			return nil
-		case logMsg = <-logChan:
+		case logMsg, ok = <-logChan:
 		}
-		if logMsg == (app.Applog{}) {
+		if !ok {
 			break
 		}
 		err := encoder.Encode([]app.Applog{logMsg})
@@ -1133,6 +1205,15 @@ func appLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return nil
 }
 
+// parseLogTime parses times used to filter logs, either durations before the
+// current time, like 1h, or RFC3339 dates.
+func parseLogTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().UTC().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 func getServiceInstance(serviceName, instanceName, appName string) (*service.ServiceInstance, *app.App, error) {
 	var app app.App
 	conn, err := db.Conn()
@@ -1393,7 +1474,7 @@ func addLog(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	}
 	unit := r.FormValue("unit")
 	for _, log := range logs {
-		err := a.Log(log, source, unit)
+		err := a.LogThrottled(log, source, unit)
 		if err != nil {
 			return err
 		}
@@ -1693,6 +1774,62 @@ func appMetricEnvs(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return json.NewEncoder(w).Encode(metricMap)
 }
 
+// title: unit metrics
+// path: /apps/{app}/metrics
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func appUnitMetrics(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppReadMetric,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	var from time.Time
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = parseMetricsFrom(value)
+		if err != nil {
+			return err
+		}
+	}
+	metrics, err := a.UnitMetrics(r.URL.Query().Get("process"), from)
+	if err != nil {
+		return err
+	}
+	if len(metrics) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(metrics)
+}
+
+// parseMetricsFrom parses the start of the unit metrics window, either as a
+// time in the RFC 3339 format or as a duration before the current time.
+func parseMetricsFrom(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	from, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Invalid %q value %q, it must be a time, like 2017-05-10T12:00:00Z, or a duration, like 30m.", "from", value),
+		}
+	}
+	return from, nil
+}
+
 // title: rebuild routes
 // path: /apps/{app}/routes
 // method: POST
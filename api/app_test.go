@@ -591,6 +591,68 @@ func (s *S) TestAppInfo(c *check.C) {
 	c.Assert(myApp["repository"], check.Equals, "git@"+repositorytest.ServerHost+":"+expectedApp.Name+".git")
 }
 
+func (s *S) TestAppInfoWithUnitMetricsAndAlerts(c *check.C) {
+	config.Set("unit-metrics:enabled", true)
+	defer config.Unset("unit-metrics:enabled")
+	a := app.App{Name: "new-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.conn.UnitMetrics().Insert(provision.UnitMetrics{ID: "u1", AppName: a.Name, CPU: 7, Date: time.Now().UTC()})
+	c.Assert(err, check.IsNil)
+	err = app.SetAlertRule(&app.AlertRule{App: a.Name, Name: "errors", Kind: app.AlertErrorLogs, Window: time.Minute, Webhook: "http://example.com/hook"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var info struct {
+		Name         string
+		UnitsMetrics []provision.UnitMetrics
+		Alerts       []app.AlertRule
+	}
+	err = json.Unmarshal(recorder.Body.Bytes(), &info)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Name, check.Equals, a.Name)
+	c.Assert(info.UnitsMetrics, check.HasLen, 1)
+	c.Assert(info.UnitsMetrics[0].CPU, check.Equals, float64(7))
+	c.Assert(info.Alerts, check.HasLen, 1)
+	c.Assert(info.Alerts[0].Name, check.Equals, "errors")
+	c.Assert(info.Alerts[0].State.Firing, check.Equals, false)
+	c.Assert(info.Alerts[0].Webhook, check.Equals, "")
+}
+
+func (s *S) TestAppInfoWithoutUnitMetricsAndAlertsPermissions(c *check.C) {
+	config.Set("unit-metrics:enabled", true)
+	defer config.Unset("unit-metrics:enabled")
+	a := app.App{Name: "new-app", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = s.conn.UnitMetrics().Insert(provision.UnitMetrics{ID: "u1", AppName: a.Name, CPU: 7, Date: time.Now().UTC()})
+	c.Assert(err, check.IsNil)
+	err = app.SetAlertRule(&app.AlertRule{App: a.Name, Name: "errors", Kind: app.AlertErrorLogs, Window: time.Minute})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name, nil)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppRead,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var info map[string]interface{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &info)
+	c.Assert(err, check.IsNil)
+	c.Assert(info["name"], check.Equals, a.Name)
+	c.Assert(info["unitsmetrics"], check.IsNil)
+	c.Assert(info["alerts"], check.IsNil)
+}
+
 func (s *S) TestAppInfoReturnsForbiddenWhenTheUserDoesNotHaveAccessToTheApp(c *check.C) {
 	expectedApp := app.App{Name: "new-app", Platform: "zend"}
 	err := s.conn.Apps().Insert(expectedApp)
@@ -3776,6 +3838,99 @@ func (s *S) TestAppLogSelectByUnit(c *check.C) {
 	c.Assert(logs[0].Unit, check.Equals, "caliban")
 }
 
+func (s *S) TestAppLogSelectByStructuredFields(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.Log(`{"level": "ERROR", "msg": "db timeout", "request_id": "r1", "path": "/users"}`, "app", "unit1")
+	c.Assert(err, check.IsNil)
+	err = a.Log(`{"level": "error", "msg": "cache timeout", "request_id": "r2", "path": "/teams"}`, "app", "unit1")
+	c.Assert(err, check.IsNil)
+	err = a.Log(`{"level": "info", "msg": "db ok", "request_id": "r3", "path": "/users"}`, "app", "unit1")
+	c.Assert(err, check.IsNil)
+	err = a.Log("plain db message", "app", "unit1")
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	url := fmt.Sprintf("/apps/%s/log/?:app=%s&lines=10&filter=level=error&filter=path=/users&grep=^db", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var logs []app.Applog
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "db timeout")
+	c.Assert(logs[0].Level, check.Equals, "error")
+	c.Assert(logs[0].RequestID, check.Equals, "r1")
+	c.Assert(logs[0].Fields, check.DeepEquals, map[string]string{"path": "/users"})
+}
+
+func (s *S) TestAppLogSelectBySince(c *check.C) {
+	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	coll := s.logConn.Logs(a.Name)
+	defer coll.DropCollection()
+	for i := 0; i < 5; i++ {
+		l := app.Applog{
+			Date:    now.Add(-time.Duration(i) * time.Hour),
+			Message: strconv.Itoa(i),
+			Source:  "source",
+			AppName: a.Name,
+		}
+		coll.Insert(l)
+	}
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	url := fmt.Sprintf("/apps/%s/log/?:app=%s&since=150m", a.Name, a.Name)
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	err = appLog(recorder, request, token)
+	c.Assert(err, check.IsNil)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var logs []app.Applog
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Assert(logs[0].Message, check.Equals, "2")
+	c.Assert(logs[1].Message, check.Equals, "1")
+	c.Assert(logs[2].Message, check.Equals, "0")
+}
+
+func (s *S) TestAppLogReturnsBadRequestIfFilterIsInvalid(c *check.C) {
+	tests := []struct {
+		query string
+		msg   string
+	}{
+		{"lines=10&filter=level", `Invalid filter "level", it must be in the key=value format.`},
+		{"lines=10&since=yesterday", `Parameter "since" must be a duration, like 1h, or a RFC3339 date.`},
+		{"lines=10&until=tomorrow", `Parameter "until" must be a duration, like 1h, or a RFC3339 date.`},
+		{"lines=10&grep=(db", `invalid grep pattern "\(db": .*`},
+	}
+	for _, t := range tests {
+		url := "/apps/something/log/?:app=doesntmatter&" + t.query
+		request, err := http.NewRequest("GET", url, nil)
+		c.Assert(err, check.IsNil)
+		recorder := httptest.NewRecorder()
+		err = appLog(recorder, request, s.token)
+		c.Assert(err, check.NotNil)
+		e, ok := err.(*errors.HTTP)
+		c.Assert(ok, check.Equals, true)
+		c.Assert(e.Code, check.Equals, http.StatusBadRequest)
+		c.Assert(e.Message, check.Matches, t.msg)
+	}
+}
+
 func (s *S) TestAppLogSelectByLinesShouldReturnTheLastestEntries(c *check.C) {
 	a := app.App{Name: "lost", Platform: "zend", TeamOwner: s.team.Name}
 	err := app.CreateApp(&a, s.user)
@@ -5314,6 +5469,85 @@ func (s *S) TestMEtricEnvsWhenAppDoesNotExist(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Matches, "^App .* not found.\n$")
 }
 
+func (s *S) TestAppUnitMetrics(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC().Truncate(time.Second)
+	err = s.conn.UnitMetrics().Insert(
+		provision.UnitMetrics{ID: "u1", AppName: "myappx", ProcessName: "web", Date: now.Add(-time.Hour), CPU: 5},
+		provision.UnitMetrics{ID: "u1", AppName: "myappx", ProcessName: "web", Date: now.Add(-time.Minute), CPU: 12.5, Memory: 1024},
+		provision.UnitMetrics{ID: "u2", AppName: "myappx", ProcessName: "worker", Date: now.Add(-time.Minute), CPU: 3},
+	)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myappx/metrics?process=web&from=10m", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var metrics []provision.UnitMetrics
+	err = json.Unmarshal(recorder.Body.Bytes(), &metrics)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 1)
+	c.Assert(metrics[0].ID, check.Equals, "u1")
+	c.Assert(metrics[0].CPU, check.Equals, 12.5)
+	c.Assert(metrics[0].Memory, check.Equals, uint64(1024))
+	c.Assert(metrics[0].Date.Equal(now.Add(-time.Minute)), check.Equals, true)
+	from := now.Add(-2 * time.Hour).Format(time.RFC3339)
+	request, err = http.NewRequest("GET", "/apps/myappx/metrics?from="+from, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	err = json.Unmarshal(recorder.Body.Bytes(), &metrics)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 3)
+}
+
+func (s *S) TestAppUnitMetricsNoContent(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myappx/metrics", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestAppUnitMetricsInvalidFrom(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myappx/metrics?from=yesterday", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Invalid \"from\" value \"yesterday\", it must be a time, like 2017-05-10T12:00:00Z, or a duration, like 30m.\n")
+}
+
+func (s *S) TestAppUnitMetricsWhenUserDoesNotHaveAccess(c *check.C) {
+	a := app.App{Name: "myappx", Platform: "zend"}
+	err := s.conn.Apps().Insert(&a)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadMetric,
+		Context: permission.Context(permission.CtxApp, "-invalid-"),
+	})
+	request, err := http.NewRequest("GET", "/apps/myappx/metrics", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *S) TestRebuildRoutes(c *check.C) {
 	a := app.App{Name: "myappx", Platform: "zend", TeamOwner: s.team.Name, Router: "fake"}
 	err := app.CreateApp(&a, s.user)
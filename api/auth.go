@@ -124,8 +124,14 @@ func login(w http.ResponseWriter, r *http.Request) (err error) {
 	}
 	token, err := app.AuthScheme.Login(params)
 	if err != nil {
+		if err == auth.ErrTwoFactorRequired {
+			w.Header().Set(twoFactorHeader, "required")
+		}
 		return handleAuthError(err)
 	}
+	if isRestrictedToken(token) {
+		w.Header().Set(twoFactorHeader, "enroll")
+	}
 	return json.NewEncoder(w).Encode(map[string]string{"token": token.GetValue()})
 }
 
@@ -605,8 +611,12 @@ func regenerateAPIToken(w http.ResponseWriter, r *http.Request, t auth.Token) (e
 // responses:
 //   200: OK
 //   401: Unauthorized
+//   403: Two-factor authentication enrollment required
 //   404: User not found
 func showAPIToken(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if isRestrictedToken(t) {
+		return errTwoFactorEnrollment
+	}
 	u, err := t.User()
 	if err != nil {
 		return err
@@ -665,12 +675,15 @@ func createAPIUser(perms []permission.Permission, user *auth.User, roleMap map[s
 		}
 		rolePerms := make([]rolePermissionData, len(permissions))
 		for i, p := range permissions {
-			if perms != nil && allPermsMatch && !permission.CheckFromPermList(perms, p.Scheme, p.Context) {
+			name := p.Scheme.FullName()
+			if p.Deny {
+				name = "!" + name
+			} else if perms != nil && allPermsMatch && !permission.CheckFromPermList(perms, p.Scheme, p.Context) {
 				allPermsMatch = false
 				break
 			}
 			rolePerms[i] = rolePermissionData{
-				Name:         p.Scheme.FullName(),
+				Name:         name,
 				ContextType:  string(p.Context.CtxType),
 				ContextValue: p.Context.Value,
 			}
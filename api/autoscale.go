@@ -197,3 +197,301 @@ func autoScaleRunHandler(w http.ResponseWriter, r *http.Request, t auth.Token) (
 	}
 	return autoscale.RunOnce(writer)
 }
+
+// title: autoscale pre-provision report
+// path: /autoscale/preprovision
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+func autoScalePreProvisionReport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermNodeAutoscaleRead) {
+		return permission.ErrUnauthorized
+	}
+	reports, err := autoscale.PreProvisionReports()
+	if err != nil {
+		return err
+	}
+	if len(reports) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(reports)
+}
+
+// title: list app autoscale policies
+// path: /apps/{app}/autoscale
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func appAutoScaleList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppReadAutoscale,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	policies, err := autoscale.ListAppPolicies(a.Name)
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(policies)
+}
+
+// title: set app autoscale policy
+// path: /apps/{app}/autoscale
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func appAutoScaleSet(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateAutoscaleSet,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateAutoscaleSet,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	policy := autoscale.AppPolicy{
+		App:     a.Name,
+		Process: r.FormValue("process"),
+	}
+	if policy.Process == "" {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "Process is required."}
+	}
+	intFields := []struct {
+		name  string
+		value *int
+	}{
+		{"min", &policy.MinUnits},
+		{"max", &policy.MaxUnits},
+		{"scaleupcooldown", &policy.ScaleUpCooldown},
+		{"scaledowncooldown", &policy.ScaleDownCooldown},
+	}
+	for _, field := range intFields {
+		if r.FormValue(field.name) == "" {
+			continue
+		}
+		*field.value, err = strconv.Atoi(r.FormValue(field.name))
+		if err != nil {
+			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "Invalid " + field.name + " value"}
+		}
+	}
+	floatFields := []struct {
+		name  string
+		value *float64
+	}{
+		{"cpu", &policy.CPU},
+		{"memory", &policy.Memory},
+		{"requests", &policy.RequestRate},
+	}
+	for _, field := range floatFields {
+		if r.FormValue(field.name) == "" {
+			continue
+		}
+		*field.value, err = strconv.ParseFloat(r.FormValue(field.name), 64)
+		if err != nil {
+			return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "Invalid " + field.name + " value"}
+		}
+	}
+	err = autoscale.SetAppPolicy(policy)
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return nil
+}
+
+// title: unset app autoscale policy
+// path: /apps/{app}/autoscale/{process}
+// method: DELETE
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: App or policy not found
+func appAutoScaleUnset(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateAutoscaleUnset,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateAutoscaleUnset,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = autoscale.RemoveAppPolicy(a.Name, r.URL.Query().Get(":process"))
+	if err == autoscale.ErrAppPolicyNotFound {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
+// title: list app scale schedules
+// path: /apps/{app}/autoscale/schedules
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+//   404: App not found
+func appScaleScheduleList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppReadAutoscale,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	schedules, err := autoscale.ListAppSchedules(a.Name)
+	if err != nil {
+		return err
+	}
+	if len(schedules) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(schedules)
+}
+
+// title: add app scale schedule
+// path: /apps/{app}/autoscale/schedules
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Schedule created
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func appScaleScheduleAdd(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateAutoscaleScheduleAdd,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateAutoscaleScheduleAdd,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	schedule := autoscale.AppSchedule{
+		App:      a.Name,
+		Process:  r.FormValue("process"),
+		Cron:     r.FormValue("cron"),
+		Timezone: r.FormValue("timezone"),
+	}
+	if schedule.Process == "" || schedule.Cron == "" {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "Process and cron are required."}
+	}
+	schedule.Units, err = strconv.Atoi(r.FormValue("units"))
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "Invalid units value"}
+	}
+	err = autoscale.AddAppSchedule(&schedule)
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(schedule)
+}
+
+// title: remove app scale schedule
+// path: /apps/{app}/autoscale/schedules/{id}
+// method: DELETE
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: App or schedule not found
+func appScaleScheduleRemove(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateAutoscaleScheduleRemove,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateAutoscaleScheduleRemove,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = autoscale.RemoveAppSchedule(a.Name, r.URL.Query().Get(":id"))
+	if err == autoscale.ErrAppScheduleNotFound {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/ajg/form"
 	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/autoscale"
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/event/eventtest"
@@ -114,6 +115,55 @@ func (s *S) TestAutoScaleRunHandler(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestAutoScalePreProvisionReport(c *check.C) {
+	s.provisioner.AddNode(provision.AddNodeOptions{
+		Address:  "localhost:1999",
+		Metadata: map[string]string{"pool": "pool1"},
+	})
+	rule := autoscale.Rule{MetadataFilter: "pool1", Enabled: true, MaxContainerCount: 2, SpareNodes: 1}
+	err := rule.Update()
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/node/autoscale/preprovision", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var reports []autoscale.PreProvisionReport
+	err = json.Unmarshal(recorder.Body.Bytes(), &reports)
+	c.Assert(err, check.IsNil)
+	c.Assert(reports, check.DeepEquals, []autoscale.PreProvisionReport{
+		{Pool: "pool1", Nodes: 1, SpareNodes: 1},
+	})
+}
+
+func (s *S) TestAutoScalePreProvisionReportNoSpareNodes(c *check.C) {
+	s.provisioner.AddNode(provision.AddNodeOptions{
+		Address:  "localhost:1999",
+		Metadata: map[string]string{"pool": "pool1"},
+	})
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/node/autoscale/preprovision", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestAutoScalePreProvisionReportUnauthorized(c *check.C) {
+	token := userWithPermission(c)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/node/autoscale/preprovision", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *S) TestAutoScaleConfigHandler(c *check.C) {
 	config.Set("docker:auto-scale:enabled", true)
 	defer config.Unset("docker:auto-scale:enabled")
@@ -146,7 +196,7 @@ func (s *S) TestAutoScaleListRulesEmpty(c *check.C) {
 	err = json.Unmarshal(recorder.Body.Bytes(), &rules)
 	c.Assert(err, check.IsNil)
 	c.Assert(rules, check.DeepEquals, []autoscale.Rule{
-		{Enabled: true, ScaleDownRatio: 1.333, Error: "invalid rule, either memory information or max container count must be set"},
+		{Enabled: true, ScaleDownRatio: 1.333, Error: "invalid rule, either memory information, cpu information or max container count must be set"},
 	})
 }
 
@@ -225,7 +275,7 @@ func (s *S) TestAutoScaleSetRule(c *check.C) {
 	rules, err := autoscale.ListRules()
 	c.Assert(err, check.IsNil)
 	c.Assert(rules, check.DeepEquals, []autoscale.Rule{
-		{Enabled: true, ScaleDownRatio: 1.333, Error: "invalid rule, either memory information or max container count must be set"},
+		{Enabled: true, ScaleDownRatio: 1.333, Error: "invalid rule, either memory information, cpu information or max container count must be set"},
 		rule,
 	})
 	c.Assert(eventtest.EventDesc{
@@ -304,7 +354,7 @@ func (s *S) TestAutoScaleDeleteRule(c *check.C) {
 	rules, err := autoscale.ListRules()
 	c.Assert(err, check.IsNil)
 	c.Assert(rules, check.DeepEquals, []autoscale.Rule{
-		{Enabled: true, ScaleDownRatio: 1.333, Error: "invalid rule, either memory information or max container count must be set"},
+		{Enabled: true, ScaleDownRatio: 1.333, Error: "invalid rule, either memory information, cpu information or max container count must be set"},
 	})
 	c.Assert(eventtest.EventDesc{
 		Target: event.Target{Type: event.TargetTypePool, Value: ""},
@@ -327,7 +377,7 @@ func (s *S) TestAutoScaleDeleteRuleNonDefault(c *check.C) {
 	rules, err := autoscale.ListRules()
 	c.Assert(err, check.IsNil)
 	c.Assert(rules, check.DeepEquals, []autoscale.Rule{
-		{Enabled: true, ScaleDownRatio: 1.333, Error: "invalid rule, either memory information or max container count must be set"},
+		{Enabled: true, ScaleDownRatio: 1.333, Error: "invalid rule, either memory information, cpu information or max container count must be set"},
 	})
 	c.Assert(eventtest.EventDesc{
 		Target: event.Target{Type: event.TargetTypePool, Value: "mypool"},
@@ -352,3 +402,264 @@ func (s *S) TestAutoScaleDeleteRuleNotFound(c *check.C) {
 		ErrorMatches: `rule not found`,
 	}, eventtest.HasEvent)
 }
+
+func (s *S) TestAppAutoScaleSet(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("process=web&min=1&max=5&cpu=70&scaleupcooldown=60")
+	request, err := http.NewRequest("PUT", "/apps/myapp/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	policies, err := autoscale.ListAppPolicies("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.DeepEquals, []autoscale.AppPolicy{
+		{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, CPU: 70, ScaleUpCooldown: 60},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget("myapp"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.autoscale.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": "process", "value": "web"},
+			{"name": "min", "value": "1"},
+			{"name": "max", "value": "5"},
+			{"name": "cpu", "value": "70"},
+			{"name": "scaleupcooldown", "value": "60"},
+			{"name": ":app", "value": "myapp"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppAutoScaleSetInvalid(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		body    string
+		message string
+	}{
+		{"min=1&max=5", "Process is required.\n"},
+		{"process=web&min=x&max=5", "Invalid min value\n"},
+		{"process=web&min=1&max=5&cpu=x", "Invalid cpu value\n"},
+		{"process=web&min=5&max=1", "max units must be greater than or equal to min units\n"},
+	}
+	for _, t := range tests {
+		request, err := http.NewRequest("PUT", "/apps/myapp/autoscale", strings.NewReader(t.body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		RunServer(true).ServeHTTP(recorder, request)
+		c.Check(recorder.Code, check.Equals, http.StatusBadRequest)
+		c.Check(recorder.Body.String(), check.Equals, t.message)
+	}
+}
+
+func (s *S) TestAppAutoScaleSetRequiresPermission(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "reader", permission.Permission{
+		Scheme:  permission.PermAppReadAutoscale,
+		Context: permission.Context(permission.CtxApp, "myapp"),
+	})
+	body := strings.NewReader("process=web&min=1&max=5")
+	request, err := http.NewRequest("PUT", "/apps/myapp/autoscale", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAppAutoScaleList(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myapp/autoscale", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	err = autoscale.SetAppPolicy(autoscale.AppPolicy{App: "myapp", Process: "web", MinUnits: 2, MaxUnits: 4, Memory: 80})
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var policies []autoscale.AppPolicy
+	err = json.Unmarshal(recorder.Body.Bytes(), &policies)
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.DeepEquals, []autoscale.AppPolicy{
+		{App: "myapp", Process: "web", MinUnits: 2, MaxUnits: 4, Memory: 80},
+	})
+}
+
+func (s *S) TestAppAutoScaleUnset(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = autoscale.SetAppPolicy(autoscale.AppPolicy{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 2})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/myapp/autoscale/web", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	policies, err := autoscale.ListAppPolicies("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget("myapp"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.autoscale.unset",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": "myapp"},
+			{"name": ":process", "value": "web"},
+		},
+	}, eventtest.HasEvent)
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestAppScaleScheduleAdd(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("process=web&cron=0+8+*+*+1-5&units=10&timezone=America/Sao_Paulo")
+	request, err := http.NewRequest("POST", "/apps/myapp/autoscale/schedules", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var schedule autoscale.AppSchedule
+	err = json.Unmarshal(recorder.Body.Bytes(), &schedule)
+	c.Assert(err, check.IsNil)
+	c.Assert(schedule.ID.Valid(), check.Equals, true)
+	schedules, err := autoscale.ListAppSchedules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules, check.HasLen, 1)
+	c.Assert(schedules[0].ID, check.Equals, schedule.ID)
+	c.Assert(schedules[0].Process, check.Equals, "web")
+	c.Assert(schedules[0].Cron, check.Equals, "0 8 * * 1-5")
+	c.Assert(schedules[0].Units, check.Equals, 10)
+	c.Assert(schedules[0].Timezone, check.Equals, "America/Sao_Paulo")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget("myapp"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.autoscale.schedule.add",
+		StartCustomData: []map[string]interface{}{
+			{"name": "process", "value": "web"},
+			{"name": "cron", "value": "0 8 * * 1-5"},
+			{"name": "units", "value": "10"},
+			{"name": "timezone", "value": "America/Sao_Paulo"},
+			{"name": ":app", "value": "myapp"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppScaleScheduleAddInvalid(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		body    string
+		message string
+	}{
+		{"cron=0+8+*+*+*&units=1", "Process and cron are required.\n"},
+		{"process=web&cron=0+8+*+*+*&units=x", "Invalid units value\n"},
+		{"process=web&cron=0+8+*+*&units=1", "invalid cron expression \"0 8 * *\", it must have 5 fields\n"},
+	}
+	for _, t := range tests {
+		request, err := http.NewRequest("POST", "/apps/myapp/autoscale/schedules", strings.NewReader(t.body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		RunServer(true).ServeHTTP(recorder, request)
+		c.Check(recorder.Code, check.Equals, http.StatusBadRequest)
+		c.Check(recorder.Body.String(), check.Equals, t.message)
+	}
+}
+
+func (s *S) TestAppScaleScheduleList(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myapp/autoscale/schedules", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	err = autoscale.AddAppSchedule(&autoscale.AppSchedule{App: "myapp", Process: "web", Cron: "0 20 * * *", Units: 2})
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var schedules []autoscale.AppSchedule
+	err = json.Unmarshal(recorder.Body.Bytes(), &schedules)
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules, check.HasLen, 1)
+	c.Assert(schedules[0].Cron, check.Equals, "0 20 * * *")
+}
+
+func (s *S) TestAppScaleScheduleRemove(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	schedule := autoscale.AppSchedule{App: "myapp", Process: "web", Cron: "0 20 * * *", Units: 2}
+	err = autoscale.AddAppSchedule(&schedule)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/myapp/autoscale/schedules/"+schedule.ID.Hex(), nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	schedules, err := autoscale.ListAppSchedules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules, check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget("myapp"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.autoscale.schedule.remove",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": "myapp"},
+			{"name": ":id", "value": schedule.ID.Hex()},
+		},
+	}, eventtest.HasEvent)
+	recorder = httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestAppScaleScheduleAddRequiresPermission(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "reader", permission.Permission{
+		Scheme:  permission.PermAppUpdateAutoscaleSet,
+		Context: permission.Context(permission.CtxApp, "myapp"),
+	})
+	body := strings.NewReader("process=web&cron=0+8+*+*+*&units=10")
+	request, err := http.NewRequest("POST", "/apps/myapp/autoscale/schedules", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
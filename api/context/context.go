@@ -11,6 +11,7 @@ import (
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/tracing"
 )
 
 const (
@@ -19,6 +20,7 @@ const (
 	delayedHandlerKey
 	preventUnlockKey
 	appContextKey
+	spanContextKey
 )
 
 func Clear(r *http.Request) {
@@ -99,3 +101,17 @@ func GetRequestID(r *http.Request, requestIDHeader string) string {
 	}
 	return requestID.(string)
 }
+
+// SetSpan stores the span tracing the request.
+func SetSpan(r *http.Request, span *tracing.Span) {
+	context.Set(r, spanContextKey, span)
+}
+
+// GetSpan returns the span tracing the request, or nil when the request is
+// not traced.
+func GetSpan(r *http.Request) *tracing.Span {
+	if v := context.Get(r, spanContextKey); v != nil {
+		return v.(*tracing.Span)
+	}
+	return nil
+}
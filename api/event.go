@@ -8,15 +8,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/ajg/form"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/stream"
 	"github.com/tsuru/tsuru/permission"
 	"gopkg.in/mgo.v2/bson"
 )
 
+var eventStreamKeepAlive = 30 * time.Second
+
 // title: event list
 // path: /events
 // method: GET
@@ -25,6 +29,23 @@ import (
 //   200: OK
 //   204: No content
 func eventList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	filter, err := eventFilter(r, t)
+	if err != nil {
+		return err
+	}
+	events, err := event.List(filter)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Add("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(events)
+}
+
+func eventFilter(r *http.Request, t auth.Token) (*event.Filter, error) {
 	r.ParseForm()
 	filter := &event.Filter{}
 	dec := form.NewDecoder(nil)
@@ -32,23 +53,77 @@ func eventList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	dec.IgnoreCase(true)
 	err := dec.DecodeValues(&filter, r.Form)
 	if err != nil {
-		return &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("unable to parse event filters: %s", err)}
 	}
 	filter.PruneUserValues()
 	filter.Permissions, err = t.Permissions()
+	if err != nil {
+		return nil, err
+	}
+	filter.Source = permission.TokenSource(t)
+	return filter, nil
+}
+
+// title: event stream
+// path: /events/stream
+// method: GET
+// produce: text/event-stream
+// responses:
+//   200: OK
+//   400: Invalid filter
+//   401: Unauthorized
+func eventStream(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	filter, err := eventFilter(r, t)
 	if err != nil {
 		return err
 	}
-	events, err := event.List(filter)
+	l, err := stream.NewListener(filter)
 	if err != nil {
 		return err
 	}
-	if len(events) == 0 {
-		w.WriteHeader(http.StatusNoContent)
-		return nil
+	defer l.Close()
+	var closeChan <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closeChan = notifier.CloseNotify()
+	} else {
+		closeChan = make(chan bool)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	evtChan := l.ListenChan()
+	for {
+		select {
+		case <-closeChan:
+			return nil
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case evt, ok := <-evtChan:
+			if !ok {
+				return nil
+			}
+			err = writeStreamEvent(w, evt)
+		}
+		if err != nil {
+			return nil
+		}
 	}
-	w.Header().Add("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(events)
+}
+
+func writeStreamEvent(w http.ResponseWriter, evt *event.Event) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	name := "started"
+	if !evt.Running {
+		name = "finished"
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", evt.UniqueID.Hex(), name, data)
+	return err
 }
 
 // title: kind list
@@ -5,18 +5,22 @@
 package api
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/auth/native"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
 	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/stream"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/repository/repositorytest"
 	"github.com/tsuru/tsuru/router/routertest"
@@ -139,6 +143,27 @@ func (s *EventSuite) TestEventList(c *check.C) {
 	c.Assert(result, check.HasLen, 10)
 }
 
+func (s *EventSuite) TestEventListRestrictedToken(c *check.C) {
+	_, err := s.insertEvents("app", c)
+	c.Assert(err, check.IsNil)
+	token := native.Token{
+		Token:      "restricted-token",
+		Creation:   time.Now(),
+		Expires:    time.Hour,
+		UserEmail:  s.user.Email,
+		Restricted: true,
+	}
+	err = s.conn.Tokens().Insert(token)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/events", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
 func (s *EventSuite) TestEventListFilterByTarget(c *check.C) {
 	_, err := s.insertEvents("app", c)
 	c.Assert(err, check.IsNil)
@@ -443,3 +468,80 @@ func (s *EventSuite) TestEventCancelWithoutPermission(c *check.C) {
 	server.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
 }
+
+func (s *EventSuite) TestEventStream(c *check.C) {
+	server := httptest.NewServer(RunServer(true))
+	defer server.Close()
+	request, err := http.NewRequest("GET", server.URL+"/events/stream?target.type=app", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	resp, err := http.DefaultClient.Do(request)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(resp.Header.Get("Content-Type"), check.Equals, "text/event-stream")
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	c.Assert(err, check.IsNil)
+	c.Assert(line, check.Equals, ": connected\n")
+	appEvts, err := s.insertEvents("app", c)
+	c.Assert(err, check.IsNil)
+	nodeEvts, err := s.insertEvents("node", c)
+	c.Assert(err, check.IsNil)
+	err = stream.Publish(nodeEvts[0])
+	c.Assert(err, check.IsNil)
+	err = stream.Publish(appEvts[1])
+	c.Assert(err, check.IsNil)
+	var lines []string
+	for len(lines) < 3 {
+		line, err = reader.ReadString('\n')
+		c.Assert(err, check.IsNil)
+		if line != "\n" {
+			lines = append(lines, line)
+		}
+	}
+	c.Assert(lines[0], check.Equals, "id: "+appEvts[1].UniqueID.Hex()+"\n")
+	c.Assert(lines[1], check.Equals, "event: finished\n")
+	c.Assert(strings.HasPrefix(lines[2], "data: "), check.Equals, true)
+	var result event.Event
+	err = json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.UniqueID, check.Equals, appEvts[1].UniqueID)
+}
+
+func (s *EventSuite) TestEventStreamFilterByPermission(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppReadEvents,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	server := httptest.NewServer(RunServer(true))
+	defer server.Close()
+	request, err := http.NewRequest("GET", server.URL+"/events/stream", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	resp, err := http.DefaultClient.Do(request)
+	c.Assert(err, check.IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.StatusCode, check.Equals, http.StatusOK)
+	reader := bufio.NewReader(resp.Body)
+	_, err = reader.ReadString('\n')
+	c.Assert(err, check.IsNil)
+	appEvts, err := s.insertEvents("app", c)
+	c.Assert(err, check.IsNil)
+	nodeEvts, err := s.insertEvents("node", c)
+	c.Assert(err, check.IsNil)
+	err = stream.Publish(nodeEvts[2])
+	c.Assert(err, check.IsNil)
+	err = stream.Publish(appEvts[2])
+	c.Assert(err, check.IsNil)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		c.Assert(err, check.IsNil)
+		if line != "\n" {
+			lines = append(lines, line)
+		}
+	}
+	c.Assert(lines[0], check.Equals, "id: "+appEvts[2].UniqueID.Hex()+"\n")
+	c.Assert(lines[1], check.Equals, "event: started\n")
+}
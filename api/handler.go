@@ -5,8 +5,11 @@
 package api
 
 import (
+	"net"
 	"net/http"
+	"strings"
 
+	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/api/context"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
@@ -33,6 +36,77 @@ func (fn AuthorizationRequiredHandler) ServeHTTP(w http.ResponseWriter, r *http.
 		w.Header().Set("WWW-Authenticate", "Bearer realm=\"tsuru\" scope=\"tsuru\"")
 		context.AddRequestError(r, tokenRequiredErr)
 	} else {
-		context.AddRequestError(r, fn(w, r, t))
+		context.AddRequestError(r, fn(w, r, newRequestToken(t, r)))
 	}
 }
+
+// requestToken wraps the token used in a request, allowing events created
+// by handlers to record the request address and id, and permission checks
+// to evaluate the source conditions of roles.
+type requestToken struct {
+	auth.Token
+	remoteAddr string
+	requestID  string
+}
+
+func newRequestToken(t auth.Token, r *http.Request) auth.Token {
+	requestIDHeader, _ := config.GetString("request-id-header")
+	var requestID string
+	if requestIDHeader != "" {
+		requestID = context.GetRequestID(r, requestIDHeader)
+	}
+	return &requestToken{Token: t, remoteAddr: clientAddr(r), requestID: requestID}
+}
+
+// clientAddr returns the address of the client sending the request. When the
+// request comes from one of the proxies in the server:trusted-proxies
+// setting, the address is taken from the X-Forwarded-For header, skipping
+// the trusted proxies appended to it.
+func clientAddr(r *http.Request) string {
+	proxies, _ := config.GetList("server:trusted-proxies")
+	addr := r.RemoteAddr
+	if len(proxies) == 0 {
+		return addr
+	}
+	forwarded := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0 && isTrustedProxy(proxies, addr); i-- {
+		next := strings.TrimSpace(forwarded[i])
+		if next == "" {
+			break
+		}
+		addr = next
+	}
+	return addr
+}
+
+func isTrustedProxy(proxies []string, addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		_, network, err := net.ParseCIDR(proxy)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unwrap returns the token sent in the request. Handlers must check the
+// concrete type of tokens with auth.UnwrapToken.
+func (t *requestToken) Unwrap() auth.Token {
+	return t.Token
+}
+
+func (t *requestToken) RemoteAddr() string {
+	return t.remoteAddr
+}
+
+func (t *requestToken) RequestID() string {
+	return t.requestID
+}
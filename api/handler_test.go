@@ -15,6 +15,7 @@ import (
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/repository/repositorytest"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
@@ -219,6 +220,55 @@ func (s *HandlerSuite) TestAuthorizationRequiredHandlerShouldReturnTheHandlerRes
 	c.Assert(recorder.Body.String(), check.Equals, "success")
 }
 
+func (s *HandlerSuite) TestAuthorizationRequiredHandlerRequestToken(c *check.C) {
+	config.Set("request-id-header", "Request-ID")
+	defer config.Unset("request-id-header")
+	var token auth.Token
+	handler := func(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+		token = t
+		return nil
+	}
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, check.IsNil)
+	request.RemoteAddr = "10.0.0.1:51234"
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Request-ID", "my-request")
+	RegisterHandler("/apps", "GET", AuthorizationRequiredHandler(handler))
+	defer resetHandlers()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(token.GetValue(), check.Equals, s.token.GetValue())
+	reqOwner, ok := token.(event.RequestOwner)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(reqOwner.RemoteAddr(), check.Equals, "10.0.0.1:51234")
+	c.Assert(reqOwner.RequestID(), check.Equals, "my-request")
+	unwrapped := auth.UnwrapToken(token)
+	_, ok = unwrapped.(*requestToken)
+	c.Assert(ok, check.Equals, false)
+	c.Assert(unwrapped.GetValue(), check.Equals, s.token.GetValue())
+}
+
+func (s *HandlerSuite) TestClientAddr(c *check.C) {
+	request, err := http.NewRequest("GET", "/apps", nil)
+	c.Assert(err, check.IsNil)
+	request.RemoteAddr = "10.0.0.1:51234"
+	request.Header.Add("X-Forwarded-For", "1.1.1.1, 192.168.0.5")
+	request.Header.Add("X-Forwarded-For", "10.0.0.2")
+	c.Assert(clientAddr(request), check.Equals, "10.0.0.1:51234")
+	config.Set("server:trusted-proxies", []interface{}{"10.0.0.0/8"})
+	defer config.Unset("server:trusted-proxies")
+	c.Assert(clientAddr(request), check.Equals, "192.168.0.5")
+	config.Set("server:trusted-proxies", []interface{}{"10.0.0.0/8", "192.168.0.0/16"})
+	c.Assert(clientAddr(request), check.Equals, "1.1.1.1")
+	request.RemoteAddr = "172.16.0.1:51234"
+	c.Assert(clientAddr(request), check.Equals, "172.16.0.1:51234")
+	request.RemoteAddr = "10.0.0.1:51234"
+	request.Header.Del("X-Forwarded-For")
+	c.Assert(clientAddr(request), check.Equals, "10.0.0.1:51234")
+}
+
 func (s *HandlerSuite) TestAuthorizationRequiredHandlerShouldSetVersionHeaders(c *check.C) {
 	recorder := httptest.NewRecorder()
 	request, err := http.NewRequest("GET", "/apps", nil)
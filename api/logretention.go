@@ -0,0 +1,132 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// parseLogRetention reads the log retention from the form values with the
+// given prefix, accepting sizes like 10M and durations like 72h.
+func parseLogRetention(r *http.Request, prefix string) (app.LogRetention, error) {
+	var retention app.LogRetention
+	if value := r.FormValue(prefix + "max-bytes"); value != "" {
+		retention.MaxBytes = getSize(value)
+		if retention.MaxBytes <= 0 {
+			return retention, &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid %q value %q, it must be a size, like 10M.", prefix+"max-bytes", value),
+			}
+		}
+	}
+	if value := r.FormValue(prefix + "max-age"); value != "" {
+		var err error
+		retention.MaxAge, err = time.ParseDuration(value)
+		if err != nil || retention.MaxAge <= 0 {
+			return retention, &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid %q value %q, it must be a duration, like 72h.", prefix+"max-age", value),
+			}
+		}
+	}
+	return retention, nil
+}
+
+// title: app log retention set
+// path: /apps/{app}/log-retention
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func appLogRetentionSet(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	a, err := getAppFromContext(r.URL.Query().Get(":app"), r)
+	if err != nil {
+		return err
+	}
+	allowed := permission.Check(t, permission.PermAppUpdateLogRetention,
+		contextsForApp(&a)...,
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	retention, err := parseLogRetention(r, "")
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(a.Name),
+		Kind:       permission.PermAppUpdateLogRetention,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermAppReadEvents, contextsForApp(&a)...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = a.SetLogRetention(retention)
+	if err == app.ErrAppNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return nil
+}
+
+// title: log usage report
+// path: /logs/usage
+// method: GET
+// produce: application/json, text/csv
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   403: Forbidden
+func logUsageReport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	team := r.URL.Query().Get("team")
+	var allowed bool
+	if team == "" {
+		allowed = permission.Check(t, permission.PermTeamReadUsage)
+	} else {
+		allowed = permission.Check(t, permission.PermTeamReadUsage,
+			permission.Context(permission.CtxTeam, team),
+		)
+	}
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	usage, err := app.LogUsageReport(&app.Filter{TeamOwner: team})
+	if err != nil {
+		return err
+	}
+	if r.URL.Query().Get("group") == "team" {
+		usage = app.LogUsageByTeam(usage)
+	}
+	if r.URL.Query().Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		w.Header().Set("Content-Type", "text/csv")
+		return app.WriteLogUsageCSV(w, usage)
+	}
+	if len(usage) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(usage)
+}
@@ -0,0 +1,218 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAppLogRetentionSet(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("max-bytes=10M&max-age=72h")
+	request, err := http.NewRequest("PUT", "/apps/myapp/log-retention", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	dbApp, err := app.GetByName("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.LogRetention, check.Equals, app.LogRetention{MaxBytes: 10 * 1024 * 1024, MaxAge: 72 * time.Hour})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget("myapp"),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.log-retention",
+		StartCustomData: []map[string]interface{}{
+			{"name": "max-bytes", "value": "10M"},
+			{"name": "max-age", "value": "72h"},
+			{"name": ":app", "value": "myapp"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAppLogRetentionSetInvalid(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		body    string
+		message string
+	}{
+		{"max-bytes=lots", "Invalid \"max-bytes\" value \"lots\", it must be a size, like 10M.\n"},
+		{"max-age=forever", "Invalid \"max-age\" value \"forever\", it must be a duration, like 72h.\n"},
+		{"max-bytes=100", "log retention must have at least 4096 bytes\n"},
+	}
+	for _, t := range tests {
+		request, err := http.NewRequest("PUT", "/apps/myapp/log-retention", strings.NewReader(t.body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		RunServer(true).ServeHTTP(recorder, request)
+		c.Check(recorder.Code, check.Equals, http.StatusBadRequest)
+		c.Check(recorder.Body.String(), check.Equals, t.message)
+	}
+}
+
+func (s *S) TestAppLogRetentionSetRequiresPermission(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "logreader", permission.Permission{
+		Scheme:  permission.PermAppReadLog,
+		Context: permission.Context(permission.CtxApp, "myapp"),
+	})
+	request, err := http.NewRequest("PUT", "/apps/myapp/log-retention", strings.NewReader("max-bytes=10M"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestPlanAddWithLogRetention(c *check.C) {
+	body := strings.NewReader("name=xyz&cpushare=100&log-max-bytes=1M&log-max-age=24h")
+	request, err := http.NewRequest("POST", "/plans", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	defer s.conn.Plans().RemoveAll(nil)
+	var plans []app.Plan
+	err = s.conn.Plans().Find(nil).All(&plans)
+	c.Assert(err, check.IsNil)
+	c.Assert(plans, check.DeepEquals, []app.Plan{
+		{Name: "xyz", CpuShare: 100, LogRetention: app.LogRetention{MaxBytes: 1024 * 1024, MaxAge: 24 * time.Hour}},
+	})
+}
+
+func (s *S) TestPlanAddWithInvalidLogRetention(c *check.C) {
+	body := strings.NewReader("name=xyz&cpushare=100&log-max-age=1d")
+	request, err := http.NewRequest("POST", "/plans", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Invalid \"log-max-age\" value \"1d\", it must be a duration, like 72h.\n")
+}
+
+func (s *S) logUsageRequest(c *check.C, url, token string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token)
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *S) TestLogUsageReport(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.Log("msg1\nmsg2", "app", "unit1")
+	c.Assert(err, check.IsNil)
+	recorder := s.logUsageRequest(c, "/logs/usage", s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var usage []app.LogUsage
+	err = json.NewDecoder(recorder.Body).Decode(&usage)
+	c.Assert(err, check.IsNil)
+	c.Assert(usage, check.HasLen, 1)
+	c.Assert(usage[0].App, check.Equals, "myapp")
+	c.Assert(usage[0].Team, check.Equals, s.team.Name)
+	c.Assert(usage[0].Lines, check.Equals, int64(2))
+	recorder = s.logUsageRequest(c, "/logs/usage?group=team&format=csv&team="+s.team.Name, s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/csv")
+	c.Assert(recorder.Body.String(), check.Matches, "team,app,lines,bytes,maxbytes,maxage,full\n"+s.team.Name+",,2,\\d+,1000000,,false\n")
+}
+
+func (s *S) TestLogUsageReportNoContent(c *check.C) {
+	recorder := s.logUsageRequest(c, "/logs/usage", s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestLogUsageReportTeamPermission(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamReadUsage,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	recorder := s.logUsageRequest(c, "/logs/usage?team="+s.team.Name, token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	recorder = s.logUsageRequest(c, "/logs/usage", token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAddLogThrottled(c *check.C) {
+	config.Set("app-logs:throttle:max-lines", 2)
+	defer config.Unset("app-logs:throttle")
+	a := app.App{Name: "throttledapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	v := url.Values{}
+	v.Add("message", "message 1")
+	v.Add("message", "message 2")
+	v.Add("message", "message 3")
+	request, err := http.NewRequest("POST", "/apps/throttledapp/log", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	logs, err := a.SearchLogs(app.LogFilter{Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Assert(logs[0].Message, check.Equals, "message 1")
+	c.Assert(logs[1].Message, check.Equals, "message 2")
+	c.Assert(logs[2].Source, check.Equals, "tsuru")
+	c.Assert(logs[2].Message, check.Matches, "the app exceeded the limit of 2 log lines per 1m0s, .*")
+}
+
+func (s *S) TestAppLogShowsTruncatedLogs(c *check.C) {
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetLogRetention(app.LogRetention{MaxAge: time.Hour})
+	c.Assert(err, check.IsNil)
+	err = s.logConn.Logs(a.Name).Insert(
+		app.Applog{Date: time.Now().UTC().Add(-2 * time.Hour), Message: "old", Source: "app", AppName: a.Name},
+		app.Applog{Date: time.Now().UTC(), Message: "new", Source: "app", AppName: a.Name},
+	)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/myapp/log?lines=10", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var logs []app.Applog
+	err = json.Unmarshal(recorder.Body.Bytes(), &logs)
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Source, check.Equals, "tsuru")
+	c.Assert(logs[0].Message, check.Matches, `logs before .* are not available, the log retention of the app keeps up to 1000000 bytes and 1h0m0s`)
+	c.Assert(logs[1].Message, check.Equals, "new")
+}
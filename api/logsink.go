@@ -0,0 +1,207 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+const logSinkConfigPrefix = "config."
+
+// logSinkEventOpts checks whether the token is allowed to change the log
+// sink and returns the options of the event tracking the change. Log sinks of
+// apps require the app permission, while log sinks of pools, or of every
+// app, require the permission to update the logs of the pool.
+func logSinkEventOpts(t auth.Token, sink *app.LogSinkConfig, appPerm *permission.PermissionScheme) (*event.Opts, error) {
+	if sink.App != "" {
+		a, err := app.GetByName(sink.App)
+		if err != nil {
+			if err == app.ErrAppNotFound {
+				return nil, &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+			}
+			return nil, err
+		}
+		if !permission.Check(t, appPerm, contextsForApp(a)...) {
+			return nil, permission.ErrUnauthorized
+		}
+		return &event.Opts{
+			Target:  appTarget(a.Name),
+			Kind:    appPerm,
+			Owner:   t,
+			Allowed: event.Allowed(permission.PermAppReadEvents, contextsForApp(a)...),
+		}, nil
+	}
+	var ctxs []permission.PermissionContext
+	if sink.Pool != "" {
+		ctxs = append(ctxs, permission.Context(permission.CtxPool, sink.Pool))
+	}
+	if !permission.Check(t, permission.PermPoolUpdateLogs, ctxs...) {
+		return nil, permission.ErrUnauthorized
+	}
+	return &event.Opts{
+		Target:      event.Target{Type: event.TargetTypePool, Value: sink.Pool},
+		Kind:        permission.PermPoolUpdateLogs,
+		Owner:       t,
+		DisableLock: true,
+		Allowed:     event.Allowed(permission.PermPoolReadEvents, ctxs...),
+	}, nil
+}
+
+// logSinkCustomData returns the data of the sink stored in events, with its
+// credentials redacted.
+func logSinkCustomData(sink *app.LogSinkConfig) []map[string]interface{} {
+	redacted := sink.Redacted()
+	form := url.Values{}
+	for key, value := range map[string]string{"name": redacted.Name, "kind": redacted.Kind, "app": redacted.App, "pool": redacted.Pool} {
+		if value != "" {
+			form.Set(key, value)
+		}
+	}
+	for key, value := range redacted.Config {
+		form.Set(logSinkConfigPrefix+key, value)
+	}
+	return event.FormToCustomData(form)
+}
+
+func canReadLogSink(t auth.Token, sink *app.LogSinkConfig) bool {
+	if sink.App != "" {
+		a, err := app.GetByName(sink.App)
+		if err != nil {
+			return false
+		}
+		return permission.Check(t, permission.PermAppReadLog, contextsForApp(a)...)
+	}
+	var ctxs []permission.PermissionContext
+	if sink.Pool != "" {
+		ctxs = append(ctxs, permission.Context(permission.CtxPool, sink.Pool))
+	}
+	return permission.Check(t, permission.PermPoolUpdateLogs, ctxs...)
+}
+
+// title: log sink list
+// path: /log-sinks
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+func logSinkList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	sinks, err := app.ListLogSinks()
+	if err != nil {
+		return err
+	}
+	var allowed []app.LogSinkConfig
+	for i := range sinks {
+		if canReadLogSink(t, &sinks[i]) {
+			allowed = append(allowed, sinks[i].Redacted())
+		}
+	}
+	if len(allowed) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(allowed)
+}
+
+// title: log sink set
+// path: /log-sinks
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Log sink set
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func logSinkSet(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	sink := app.LogSinkConfig{
+		Name: r.FormValue("name"),
+		Kind: r.FormValue("kind"),
+		App:  r.FormValue("app"),
+		Pool: r.FormValue("pool"),
+	}
+	for key := range r.Form {
+		if strings.HasPrefix(key, logSinkConfigPrefix) {
+			if sink.Config == nil {
+				sink.Config = make(map[string]string)
+			}
+			configKey := strings.TrimPrefix(key, logSinkConfigPrefix)
+			sink.Config[configKey] = r.Form.Get(key)
+		}
+	}
+	if sink.Name == "" || sink.Kind == "" {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: "Name and kind are required."}
+	}
+	opts, err := logSinkEventOpts(t, &sink, permission.PermAppUpdateLogSinkAdd)
+	if err != nil {
+		return err
+	}
+	opts.CustomData = logSinkCustomData(&sink)
+	evt, err := event.New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	current, err := app.GetLogSink(sink.Name)
+	if err == nil {
+		if _, err = logSinkEventOpts(t, current, permission.PermAppUpdateLogSinkAdd); err != nil {
+			return err
+		}
+	} else if err != app.ErrLogSinkNotFound {
+		return err
+	}
+	err = app.SetLogSink(sink)
+	if err != nil {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(sink.Redacted())
+}
+
+// title: log sink remove
+// path: /log-sinks/{name}
+// method: DELETE
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: Log sink not found
+func logSinkRemove(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	sink, err := app.GetLogSink(r.URL.Query().Get(":name"))
+	if err == app.ErrLogSinkNotFound {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	opts, err := logSinkEventOpts(t, sink, permission.PermAppUpdateLogSinkRemove)
+	if err != nil {
+		return err
+	}
+	opts.CustomData = event.FormToCustomData(r.Form)
+	evt, err := event.New(opts)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = app.RemoveLogSink(sink.Name)
+	if err == app.ErrLogSinkNotFound {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"reflect"
+	"strconv"
 	"time"
 
 	"github.com/codegangsta/negroni"
@@ -23,6 +24,7 @@ import (
 	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/tracing"
 )
 
 const (
@@ -34,7 +36,7 @@ const (
 func validate(token string, r *http.Request) (auth.Token, error) {
 	t, err := app.AuthScheme.Auth(token)
 	if err != nil {
-		t, err = auth.APIAuth(token)
+		t, err = userTokenAuth(token)
 		if err != nil {
 			return nil, err
 		}
@@ -57,6 +59,32 @@ func validate(token string, r *http.Request) (auth.Token, error) {
 	return t, nil
 }
 
+// userTokenAuth validates API keys and personal tokens, which are rejected
+// while the user is required to enroll in two-factor authentication and
+// haven't enrolled yet, like the tokens issued by the auth scheme.
+func userTokenAuth(token string) (auth.Token, error) {
+	var t auth.Token
+	t, err := auth.APIAuth(token)
+	if err != nil {
+		t, err = auth.PersonalTokenAuth(token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	u, err := t.User()
+	if err != nil {
+		return nil, err
+	}
+	pending, err := twoFactorEnrollmentPending(u)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, errTwoFactorEnrollment
+	}
+	return t, nil
+}
+
 func contextClearerMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	defer context.Clear(r)
 	next(w, r)
@@ -92,6 +120,46 @@ func setRequestIDHeaderMiddleware(w http.ResponseWriter, r *http.Request, next h
 	next(w, r)
 }
 
+func tracingMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if !tracing.Enabled() {
+		next(w, r)
+		return
+	}
+	requestIDHeader, _ := config.GetString("request-id-header")
+	var requestID string
+	if requestIDHeader != "" {
+		requestID = context.GetRequestID(r, requestIDHeader)
+	}
+	span := tracing.StartRemoteSpan(r.Method+" "+r.URL.Path, r.Header.Get("traceparent"), requestID)
+	span.SetTag("method", r.Method)
+	span.SetTag("path", r.URL.Path)
+	context.SetSpan(r, span)
+	defer func() {
+		appName := r.URL.Query().Get(":app")
+		if appName == "" {
+			appName = r.URL.Query().Get(":appname")
+		}
+		if appName != "" {
+			span.SetTag("app", appName)
+		}
+		if status := responseStatus(w); status != 0 {
+			span.SetTag("status", strconv.Itoa(status))
+		}
+		span.Finish(context.GetRequestError(r))
+	}()
+	next(w, r)
+}
+
+func responseStatus(w http.ResponseWriter) int {
+	if fw, ok := w.(*io.FlushingWriter); ok {
+		w = fw.ResponseWriter
+	}
+	if rw, ok := w.(negroni.ResponseWriter); ok {
+		return rw.Status()
+	}
+	return 0
+}
+
 func setVersionHeadersMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	w.Header().Set("Supported-Tsuru", tsuruMin)
 	w.Header().Set("Supported-Crane", craneMin)
@@ -6,10 +6,14 @@ package api
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,6 +24,7 @@ import (
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/io"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -109,6 +114,62 @@ func (s *S) TestSetRequestIDHeaderMiddlewareNoConfig(c *check.C) {
 	c.Assert(reqID, check.Equals, "")
 }
 
+func (s *S) TestTracingMiddleware(c *check.C) {
+	path := filepath.Join(c.MkDir(), "spans.json")
+	config.Set("request-id-header", "Request-ID")
+	config.Set("tracing:exporter", "file")
+	config.Set("tracing:file:path", path)
+	defer config.Unset("request-id-header")
+	defer config.Unset("tracing")
+	err := tracing.Initialize()
+	c.Assert(err, check.IsNil)
+	defer tracing.Stop()
+	request, err := http.NewRequest("POST", "/apps/myapp/restart?:app=myapp", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	context.SetRequestID(request, "Request-ID", "req-1")
+	w := &io.FlushingWriter{ResponseWriter: negroni.NewResponseWriter(httptest.NewRecorder())}
+	var child *tracing.Span
+	h := func(w http.ResponseWriter, r *http.Request) {
+		child = context.GetSpan(r).StartChild("mongodb insert")
+		child.Finish(nil)
+		w.WriteHeader(http.StatusNotFound)
+		context.AddRequestError(r, &errors.HTTP{Code: http.StatusNotFound, Message: "app not found"})
+	}
+	tracingMiddleware(w, request, h)
+	c.Assert(child, check.NotNil)
+	tracing.Stop()
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, check.IsNil)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	c.Assert(lines, check.HasLen, 2)
+	var span tracing.Span
+	err = json.Unmarshal([]byte(lines[1]), &span)
+	c.Assert(err, check.IsNil)
+	c.Assert(span.Name, check.Equals, "POST /apps/myapp/restart")
+	c.Assert(span.TraceID, check.Equals, "0af7651916cd43dd8448eb211c80319c")
+	c.Assert(span.ParentID, check.Equals, "b7ad6b7169203331")
+	c.Assert(span.SpanID, check.Equals, child.ParentID)
+	c.Assert(span.RequestID, check.Equals, "req-1")
+	c.Assert(span.Error, check.Equals, "app not found")
+	c.Assert(span.Tags, check.DeepEquals, map[string]string{
+		"method": "POST",
+		"path":   "/apps/myapp/restart",
+		"app":    "myapp",
+		"status": "404",
+	})
+}
+
+func (s *S) TestTracingMiddlewareDisabled(c *check.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/", nil)
+	c.Assert(err, check.IsNil)
+	h, log := doHandler()
+	tracingMiddleware(recorder, request, h)
+	c.Assert(log.called, check.Equals, true)
+	c.Assert(context.GetSpan(request), check.IsNil)
+}
+
 func (s *S) TestSetVersionHeadersMiddleware(c *check.C) {
 	recorder := httptest.NewRecorder()
 	request, err := http.NewRequest("GET", "/", nil)
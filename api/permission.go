@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
@@ -191,9 +193,11 @@ func deployableApps(u *auth.User, rolesCache map[string]*permission.Role) ([]str
 	if err != nil {
 		return nil, err
 	}
-	appNames := make([]string, len(apps))
+	appNames := make([]string, 0, len(apps))
 	for i := range apps {
-		appNames[i] = apps[i].GetName()
+		if permission.CheckFromPermList(perms, permission.PermAppDeploy, contextsForApp(&apps[i])...) {
+			appNames = append(appNames, apps[i].GetName())
+		}
 	}
 	return appNames, nil
 }
@@ -294,7 +298,11 @@ func addPermissions(w http.ResponseWriter, r *http.Request, t auth.Token) (err e
 	if err != nil {
 		return err
 	}
+	deny, _ := strconv.ParseBool(r.FormValue("deny"))
 	err = runWithPermSync(users, func() error {
+		if deny {
+			return role.AddDenyPermissions(r.Form["permission"]...)
+		}
 		return role.AddPermissions(r.Form["permission"]...)
 	})
 	if err == permission.ErrInvalidPermissionName {
@@ -357,12 +365,73 @@ func removePermissions(w http.ResponseWriter, r *http.Request, t auth.Token) (er
 	if err != nil {
 		return err
 	}
+	deny, _ := strconv.ParseBool(r.URL.Query().Get("deny"))
 	err = runWithPermSync(users, func() error {
+		if deny {
+			return role.RemoveDenyPermissions(permName)
+		}
 		return role.RemovePermissions(permName)
 	})
 	return err
 }
 
+// title: update role conditions
+// path: /roles/{name}/conditions
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Role not found
+func updateRoleConditions(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	if !permission.Check(t, permission.PermRoleUpdateConditions) {
+		return permission.ErrUnauthorized
+	}
+	roleName := r.URL.Query().Get(":name")
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeRole, Value: roleName},
+		Kind:       permission.PermRoleUpdateConditions,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermRoleReadEvents),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	role, err := permission.FindRole(roleName)
+	if err == permission.ErrRoleNotFound {
+		return &errors.HTTP{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}
+	}
+	if err != nil {
+		return err
+	}
+	conditions := &permission.Conditions{
+		TimeWindow:  r.FormValue("timewindow"),
+		SourceCIDRs: r.Form["sourcecidr"],
+		Pools:       r.Form["pool"],
+	}
+	users, err := auth.ListUsersWithRole(roleName)
+	if err != nil {
+		return err
+	}
+	err = conditions.Validate()
+	if err != nil {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+	return runWithPermSync(users, func() error {
+		return role.SetConditions(conditions)
+	})
+}
+
 func canUseRole(t auth.Token, roleName, contextValue string) error {
 	role, err := permission.FindRole(roleName)
 	if err != nil {
@@ -380,6 +449,9 @@ func canUseRole(t auth.Token, roleName, contextValue string) error {
 	}
 	perms := role.PermissionsFor(contextValue)
 	for _, p := range perms {
+		if p.Deny {
+			continue
+		}
 		if !permission.CheckFromPermList(userPerms, p.Scheme, p.Context) {
 			return &errors.HTTP{
 				Code:    http.StatusForbidden,
@@ -507,6 +579,130 @@ func listPermissions(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	return json.NewEncoder(w).Encode(permList)
 }
 
+func permissionQuery(r *http.Request) (*permission.PermissionScheme, []permission.PermissionContext, error) {
+	permName := r.URL.Query().Get("permission")
+	if permName == "" {
+		return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "Permission is required."}
+	}
+	scheme, err := permission.SafeGet(permName)
+	if err != nil {
+		return nil, nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("Invalid permission %q.", permName)}
+	}
+	ctx := r.URL.Query().Get("context")
+	if ctx == "" || ctx == string(permission.CtxGlobal) {
+		return scheme, []permission.PermissionContext{permission.Context(permission.CtxGlobal, "")}, nil
+	}
+	parts := strings.SplitN(ctx, ":", 2)
+	ctxType, err := permission.ParseContext(parts[0])
+	if err != nil || len(parts) < 2 || parts[1] == "" {
+		return nil, nil, &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Invalid context %q, it must be in the <type>:<value> format.", ctx),
+		}
+	}
+	allowedCtx := false
+	for _, t := range scheme.AllowedContexts() {
+		if t == ctxType {
+			allowedCtx = true
+			break
+		}
+	}
+	if !allowedCtx {
+		return nil, nil, &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("Permission %q can't be used with the %q context.", scheme.FullName(), ctxType),
+		}
+	}
+	if ctxType != permission.CtxApp {
+		return scheme, []permission.PermissionContext{permission.Context(ctxType, parts[1])}, nil
+	}
+	a, err := app.GetByName(parts[1])
+	if err == app.ErrAppNotFound {
+		return nil, nil, &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return scheme, contextsForApp(a), nil
+}
+
+type permissionCheckResult struct {
+	Allowed bool                `json:"allowed"`
+	Roles   []auth.RoleInstance `json:"roles"`
+}
+
+// title: check permission
+// path: /permissions/check
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: User or app not found
+func checkPermission(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	email := r.URL.Query().Get("user")
+	if email == "" {
+		email = t.GetUserName()
+	}
+	allowed := permission.Check(t, permission.PermUserReadPermissions, permission.Context(permission.CtxUser, email))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	scheme, contexts, err := permissionQuery(r)
+	if err != nil {
+		return err
+	}
+	user, err := auth.GetUserByEmail(email)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	roles, allowed, err := user.RolesGranting(scheme, contexts...)
+	if err != nil {
+		return err
+	}
+	if roles == nil {
+		roles = []auth.RoleInstance{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(permissionCheckResult{Allowed: allowed, Roles: roles})
+}
+
+// title: list users with permission
+// path: /permissions/who
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   400: Invalid data
+//   401: Unauthorized
+//   404: App not found
+func listUsersWhoCan(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermUserReadPermissions) {
+		return permission.ErrUnauthorized
+	}
+	scheme, contexts, err := permissionQuery(r)
+	if err != nil {
+		return err
+	}
+	grants, err := auth.ListUsersWhoCan(scheme, contexts...)
+	if err != nil {
+		return err
+	}
+	if len(grants) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	for i := range grants {
+		if grants[i].Roles == nil {
+			grants[i].Roles = []auth.RoleInstance{}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(grants)
+}
+
 // title: add default role
 // path: /role/default
 // method: POST
@@ -861,3 +861,254 @@ func (s *S) BenchmarkAddPermissionToRoleWithoutDeploy(c *check.C) {
 	sort.Strings(users)
 	c.Assert(users, check.DeepEquals, []string{s.user.Email})
 }
+
+func (s *S) TestCheckPermission(c *check.C) {
+	role, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "deployer")
+	user, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = user.AddRole("deployer", s.team.Name)
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		query    string
+		expected permissionCheckResult
+	}{
+		{"permission=app.deploy&context=app:myapp", permissionCheckResult{
+			Allowed: true,
+			Roles:   []auth.RoleInstance{{Name: "deployer", ContextValue: s.team.Name}},
+		}},
+		{"permission=app.deploy&context=team:otherteam", permissionCheckResult{Allowed: false, Roles: []auth.RoleInstance{}}},
+		{"permission=app.delete&context=app:myapp", permissionCheckResult{Allowed: false, Roles: []auth.RoleInstance{}}},
+		{"permission=user.update.token&context=user:deployer@groundcontrol.com", permissionCheckResult{Allowed: true, Roles: []auth.RoleInstance{}}},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/permissions/check?"+tt.query, nil)
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Authorization", "bearer "+token.GetValue())
+		RunServer(true).ServeHTTP(rec, req)
+		c.Assert(rec.Code, check.Equals, http.StatusOK, check.Commentf("query %q", tt.query))
+		var result permissionCheckResult
+		err = json.Unmarshal(rec.Body.Bytes(), &result)
+		c.Assert(err, check.IsNil)
+		c.Assert(result, check.DeepEquals, tt.expected, check.Commentf("query %q", tt.query))
+	}
+}
+
+func (s *S) TestCheckPermissionOtherUserRequiresPermission(c *check.C) {
+	token := customUserWithPermission(c, "nosy")
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/check?user="+s.user.Email+"&permission=app.deploy", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	RunServer(true).ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestCheckPermissionInvalidQuery(c *check.C) {
+	tests := []struct {
+		query   string
+		code    int
+		message string
+	}{
+		{"", http.StatusBadRequest, "Permission is required.\n"},
+		{"permission=app.unknown", http.StatusBadRequest, "Invalid permission \"app.unknown\".\n"},
+		{"permission=app.deploy&context=app", http.StatusBadRequest, "Invalid context \"app\", it must be in the <type>:<value> format.\n"},
+		{"permission=app.deploy&context=node:n1", http.StatusBadRequest, "Invalid context \"node:n1\", it must be in the <type>:<value> format.\n"},
+		{"permission=team.create&context=team:myteam", http.StatusBadRequest, "Permission \"team.create\" can't be used with the \"team\" context.\n"},
+		{"permission=app.deploy&context=app:unknown", http.StatusNotFound, "App not found.\n"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("GET", "/permissions/check?"+tt.query, nil)
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		RunServer(true).ServeHTTP(rec, req)
+		c.Assert(rec.Code, check.Equals, tt.code, check.Commentf("query %q", tt.query))
+		c.Assert(rec.Body.String(), check.Equals, tt.message, check.Commentf("query %q", tt.query))
+	}
+}
+
+func (s *S) TestListUsersWhoCan(c *check.C) {
+	role, err := permission.NewRole("deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "deployer")
+	user, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = user.AddRole("deployer", "foo")
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "foo", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/who?permission=app.deploy&context=app:foo", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	RunServer(true).ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	c.Assert(rec.Header().Get("Content-Type"), check.Equals, "application/json")
+	var grants []auth.PermissionGrant
+	err = json.Unmarshal(rec.Body.Bytes(), &grants)
+	c.Assert(err, check.IsNil)
+	c.Assert(grants, check.DeepEquals, []auth.PermissionGrant{
+		{Email: "deployer@groundcontrol.com", Roles: []auth.RoleInstance{{Name: "deployer", ContextValue: "foo"}}},
+		{Email: s.user.Email, Roles: []auth.RoleInstance{{Name: "super-root-toremove"}}},
+	})
+}
+
+func (s *S) TestListUsersWhoCanRequiresPermission(c *check.C) {
+	token := customUserWithPermission(c, "nosy", permission.Permission{
+		Scheme:  permission.PermUserReadPermissions,
+		Context: permission.Context(permission.CtxUser, "someone@groundcontrol.com"),
+	})
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/who?permission=app.deploy", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	RunServer(true).ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestAddDenyPermissionsToARole(c *check.C) {
+	role, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	b := bytes.NewBufferString(`permission=app.update.env&deny=true`)
+	req, err := http.NewRequest("POST", "/roles/test/permissions", b)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermRoleUpdate,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	r, err := permission.FindRole("test")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.SchemeNames, check.DeepEquals, []string{"app"})
+	c.Assert(r.DenySchemeNames, check.DeepEquals, []string{"app.update.env"})
+}
+
+func (s *S) TestRemoveDenyPermissionsFromRole(c *check.C) {
+	role, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	err = role.AddDenyPermissions("app.update.env")
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("DELETE", "/roles/test/permissions/app.update.env?deny=true", nil)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermRoleUpdate,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	r, err := permission.FindRole("test")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.SchemeNames, check.DeepEquals, []string{"app"})
+	c.Assert(r.DenySchemeNames, check.HasLen, 0)
+}
+
+func (s *S) TestUpdateRoleConditions(c *check.C) {
+	_, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	b := bytes.NewBufferString(`timewindow=09:00-18:00&sourcecidr=10.0.0.0/8&sourcecidr=192.168.0.0/16&pool=dev`)
+	req, err := http.NewRequest("PUT", "/roles/test/conditions", b)
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermRoleUpdateConditions,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	r, err := permission.FindRole("test")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Conditions, check.DeepEquals, &permission.Conditions{
+		TimeWindow:  "09:00-18:00",
+		SourceCIDRs: []string{"10.0.0.0/8", "192.168.0.0/16"},
+		Pools:       []string{"dev"},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeRole, Value: "test"},
+		Owner:  token.GetUserName(),
+		Kind:   "role.update.conditions",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": "test"},
+			{"name": "timewindow", "value": "09:00-18:00"},
+			{"name": "sourcecidr", "value": []string{"10.0.0.0/8", "192.168.0.0/16"}},
+			{"name": "pool", "value": "dev"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestUpdateRoleConditionsInvalid(c *check.C) {
+	_, err := permission.NewRole("test", "team", "")
+	c.Assert(err, check.IsNil)
+	tests := []struct {
+		role, body, message string
+		code                int
+	}{
+		{"test", "timewindow=9h", `invalid time window "9h", it must be in the HH:MM-HH:MM format` + "\n", http.StatusBadRequest},
+		{"test", "sourcecidr=10.0.0.1", `invalid source CIDR "10.0.0.1"` + "\n", http.StatusBadRequest},
+		{"unknown", "pool=dev", permission.ErrRoleNotFound.Error() + "\n", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		req, err := http.NewRequest("PUT", "/roles/"+tt.role+"/conditions", bytes.NewBufferString(tt.body))
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		RunServer(true).ServeHTTP(rec, req)
+		c.Assert(rec.Code, check.Equals, tt.code)
+		c.Assert(rec.Body.String(), check.Equals, tt.message)
+	}
+}
+
+func (s *S) TestDeniedPermissionOverridesRoles(c *check.C) {
+	role, err := permission.NewRole("no-env", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddDenyPermissions("app.update.env")
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "denied", permission.Permission{
+		Scheme:  permission.PermApp,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	user, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = user.AddRole("no-env", s.team.Name)
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "myapp", Platform: "zend", TeamOwner: s.team.Name}
+	err = app.CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/permissions/check?permission=app.update.env.set&context=app:myapp", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+token.GetValue())
+	RunServer(true).ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	var result permissionCheckResult
+	err = json.Unmarshal(rec.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Allowed, check.Equals, false)
+	c.Assert(result.Roles, check.DeepEquals, []auth.RoleInstance{{Name: "deniedapp" + s.team.Name, ContextValue: s.team.Name}})
+}
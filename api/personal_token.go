@@ -0,0 +1,209 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// parseTokenScopes parses scopes in the <permission> or
+// <permission>:<context type>:<context value> formats, checking that the
+// token used in the request holds each of them.
+func parseTokenScopes(values []string, r *http.Request, t auth.Token) ([]auth.TokenScope, error) {
+	perms, err := t.Permissions()
+	if err != nil {
+		return nil, err
+	}
+	scopes := make([]auth.TokenScope, 0, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 3)
+		if len(parts) == 2 {
+			return nil, &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid scope %q, scopes must be in the <permission> or <permission>:<context type>:<context value> formats.", value),
+			}
+		}
+		scheme, err := permission.SafeGet(parts[0])
+		if err != nil {
+			return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: fmt.Sprintf("Invalid permission %q.", parts[0])}
+		}
+		scope := auth.TokenScope{
+			Permission: parts[0],
+			Context:    permission.Context(permission.CtxGlobal, ""),
+		}
+		if len(parts) == 3 {
+			ctxType, err := permission.ParseContext(parts[1])
+			if err != nil {
+				return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+			}
+			allowed := false
+			for _, allowedType := range scheme.AllowedContexts() {
+				allowed = allowed || allowedType == ctxType
+			}
+			if !allowed {
+				return nil, &errors.HTTP{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("Permission %q can't be used in the %q context.", parts[0], parts[1]),
+				}
+			}
+			scope.Context = permission.Context(ctxType, parts[2])
+			scope.CheckContexts = []permission.PermissionContext{scope.Context}
+			if ctxType == permission.CtxApp {
+				a, err := getAppFromContext(parts[2], r)
+				if err != nil {
+					return nil, err
+				}
+				scope.CheckContexts = contextsForApp(&a)
+			}
+		}
+		if !permission.CheckFromPermList(perms, scheme, scope.CheckContexts...) {
+			return nil, &errors.HTTP{
+				Code:    http.StatusForbidden,
+				Message: fmt.Sprintf("You don't have the permission required by scope %q.", value),
+			}
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+// title: personal token create
+// path: /users/personal-tokens
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Token created
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+//   409: Token already exists
+func createPersonalToken(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	if _, ok := auth.UnwrapToken(t).(*auth.PersonalToken); ok {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: "Personal tokens can't be used to create other tokens."}
+	}
+	email := t.GetUserName()
+	allowed := permission.Check(t, permission.PermUserUpdateToken,
+		permission.Context(permission.CtxUser, email),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	var expiration time.Duration
+	if days := r.FormValue("expires"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "Invalid expiration, it must be a positive number of days."}
+		}
+		expiration = time.Duration(n) * 24 * time.Hour
+	}
+	scopes, err := parseTokenScopes(r.Form["scope"], r, t)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     userTarget(email),
+		Kind:       permission.PermUserUpdateToken,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermUserReadEvents, permission.Context(permission.CtxUser, email)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	token, err := auth.CreatePersonalToken(u, r.FormValue("name"), expiration, scopes)
+	if err != nil {
+		return handleAuthError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(token)
+}
+
+// title: personal token list
+// path: /users/personal-tokens
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   204: No content
+//   401: Unauthorized
+//   403: Forbidden
+func listPersonalTokens(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	email := r.URL.Query().Get("user")
+	if email == "" {
+		email = t.GetUserName()
+	}
+	allowed := permission.Check(t, permission.PermUserUpdateToken,
+		permission.Context(permission.CtxUser, email),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	tokens, err := auth.ListPersonalTokens(email)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(tokens)
+}
+
+// title: personal token revoke
+// path: /users/personal-tokens/{name}
+// method: DELETE
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   403: Forbidden
+//   404: Not found
+func revokePersonalToken(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	email := r.URL.Query().Get("user")
+	if email == "" {
+		email = t.GetUserName()
+	}
+	allowed := permission.Check(t, permission.PermUserUpdateToken,
+		permission.Context(permission.CtxUser, email),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     userTarget(email),
+		Kind:       permission.PermUserUpdateToken,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermUserReadEvents, permission.Context(permission.CtxUser, email)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = auth.RevokePersonalToken(email, r.URL.Query().Get(":name"))
+	if err == auth.ErrPersonalTokenNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *AuthSuite) personalTokenRequest(c *check.C, method, url, body string, token string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token)
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *AuthSuite) TestCreatePersonalToken(c *check.C) {
+	token := customUserWithPermission(c, "ciuser", permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(app.App{Name: "myapp", Teams: []string{s.team.Name}, Pool: "test1"})
+	c.Assert(err, check.IsNil)
+	recorder := s.personalTokenRequest(c, "POST", "/users/personal-tokens", "name=ci&expires=10&scope=app.deploy:app:myapp", token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var created auth.PersonalToken
+	err = json.NewDecoder(recorder.Body).Decode(&created)
+	c.Assert(err, check.IsNil)
+	c.Assert(created.Name, check.Equals, "ci")
+	c.Assert(created.Token, check.Not(check.Equals), "")
+	c.Assert(created.ExpiresAt.Sub(created.CreatedAt), check.Equals, 10*24*time.Hour)
+	personal, err := auth.PersonalTokenAuth("bearer " + created.Token)
+	c.Assert(err, check.IsNil)
+	c.Assert(permission.Check(personal, permission.PermAppDeploy, permission.Context(permission.CtxApp, "myapp")), check.Equals, true)
+	c.Assert(permission.Check(personal, permission.PermAppDeploy, permission.Context(permission.CtxTeam, s.team.Name)), check.Equals, false)
+	c.Assert(eventtest.EventDesc{
+		Target: userTarget(token.GetUserName()),
+		Owner:  token.GetUserName(),
+		Kind:   "user.update.token",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "ci"},
+			{"name": "expires", "value": "10"},
+			{"name": "scope", "value": "app.deploy:app:myapp"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *AuthSuite) TestCreatePersonalTokenScopeNotHeld(c *check.C) {
+	token := customUserWithPermission(c, "ciuser", permission.Permission{
+		Scheme:  permission.PermAppDeploy,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(app.App{Name: "otherapp", Teams: []string{s.team2.Name}, Pool: "test1"})
+	c.Assert(err, check.IsNil)
+	recorder := s.personalTokenRequest(c, "POST", "/users/personal-tokens", "name=ci&scope=app.deploy:app:otherapp", token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), check.Equals, "You don't have the permission required by scope \"app.deploy:app:otherapp\".\n")
+	recorder = s.personalTokenRequest(c, "POST", "/users/personal-tokens", "name=ci&scope=app.deploy", token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *AuthSuite) TestCreatePersonalTokenInvalidScope(c *check.C) {
+	tests := []struct {
+		scope   string
+		message string
+	}{
+		{"app.deploy:app", "Invalid scope \"app.deploy:app\", scopes must be in the <permission> or <permission>:<context type>:<context value> formats.\n"},
+		{"app.invalid", "Invalid permission \"app.invalid\".\n"},
+		{"app.deploy:invalid:x", "invalid context type \"invalid\"\n"},
+		{"pool.create:app:myapp", "Permission \"pool.create\" can't be used in the \"app\" context.\n"},
+	}
+	for _, tt := range tests {
+		recorder := s.personalTokenRequest(c, "POST", "/users/personal-tokens", "name=ci&scope="+tt.scope, s.token.GetValue())
+		c.Check(recorder.Code, check.Equals, http.StatusBadRequest)
+		c.Check(recorder.Body.String(), check.Equals, tt.message)
+	}
+}
+
+func (s *AuthSuite) TestCreatePersonalTokenWithPersonalToken(c *check.C) {
+	created, err := auth.CreatePersonalToken(s.user, "ci", 0, nil)
+	c.Assert(err, check.IsNil)
+	recorder := s.personalTokenRequest(c, "POST", "/users/personal-tokens", "name=other", created.Token)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), check.Equals, "Personal tokens can't be used to create other tokens.\n")
+}
+
+func (s *AuthSuite) TestListPersonalTokens(c *check.C) {
+	recorder := s.personalTokenRequest(c, "GET", "/users/personal-tokens", "", s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	_, err := auth.CreatePersonalToken(s.user, "ci", 0, nil)
+	c.Assert(err, check.IsNil)
+	recorder = s.personalTokenRequest(c, "GET", "/users/personal-tokens", "", s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var tokens []auth.PersonalToken
+	err = json.NewDecoder(recorder.Body).Decode(&tokens)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 1)
+	c.Assert(tokens[0].Name, check.Equals, "ci")
+	c.Assert(tokens[0].Token, check.Equals, "")
+}
+
+func (s *AuthSuite) TestListPersonalTokensOtherUserForbidden(c *check.C) {
+	token := customUserWithPermission(c, "ciuser")
+	recorder := s.personalTokenRequest(c, "GET", "/users/personal-tokens?user="+s.user.Email, "", token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *AuthSuite) TestRevokePersonalToken(c *check.C) {
+	created, err := auth.CreatePersonalToken(s.user, "ci", 0, nil)
+	c.Assert(err, check.IsNil)
+	recorder := s.personalTokenRequest(c, "DELETE", "/users/personal-tokens/ci", "", s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = auth.PersonalTokenAuth("bearer " + created.Token)
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+	recorder = s.personalTokenRequest(c, "DELETE", "/users/personal-tokens/ci", "", s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(eventtest.EventDesc{
+		Target: userTarget(s.user.Email),
+		Owner:  s.user.Email,
+		Kind:   "user.update.token",
+	}, eventtest.HasEvent)
+}
+
+func (s *AuthSuite) TestPersonalTokenExpiredIsRejected(c *check.C) {
+	created, err := auth.CreatePersonalToken(s.user, "ci", 0, nil)
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.PersonalTokens().UpdateId(created.Hash, map[string]interface{}{
+		"$set": map[string]interface{}{"expiresat": time.Now().Add(-time.Minute)},
+	})
+	c.Assert(err, check.IsNil)
+	recorder := s.personalTokenRequest(c, "GET", "/users/personal-tokens", "", created.Token)
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+}
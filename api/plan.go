@@ -41,6 +41,10 @@ func addPlan(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
+	plan.LogRetention, err = parseLogRetention(r, "log-")
+	if err != nil {
+		return err
+	}
 	evt, err := event.New(&event.Opts{
 		Target:     event.Target{Type: event.TargetTypePlan, Value: plan.Name},
 		Kind:       permission.PermPlanCreate,
@@ -353,3 +353,76 @@ func poolConstraintSet(w http.ResponseWriter, r *http.Request, t auth.Token) (er
 	}
 	return provision.SetPoolConstraint(&poolConstraint)
 }
+
+// title: pool team quota
+// path: /pools/{name}/quota
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Pool updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Pool not found
+func poolTeamQuotaHandler(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	allowed := permission.Check(t, permission.PermPoolUpdate)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	poolName := r.URL.Query().Get(":name")
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypePool, Value: poolName},
+		Kind:       permission.PermPoolUpdate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermPoolReadEvents, permission.Context(permission.CtxPool, poolName)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	q := provision.PoolTeamQuota{
+		Team:  r.FormValue("team"),
+		Limit: provision.PoolResources{Units: -1, Memory: -1},
+	}
+	intFields := []struct {
+		name  string
+		value *int
+	}{
+		{"units", &q.Limit.Units},
+		{"reservedunits", &q.Reserved.Units},
+	}
+	for _, field := range intFields {
+		if r.FormValue(field.name) == "" {
+			continue
+		}
+		*field.value, err = strconv.Atoi(r.FormValue(field.name))
+		if err != nil {
+			return &terrors.HTTP{Code: http.StatusBadRequest, Message: "Invalid " + field.name + " value"}
+		}
+	}
+	int64Fields := []struct {
+		name  string
+		value *int64
+	}{
+		{"memory", &q.Limit.Memory},
+		{"reservedmemory", &q.Reserved.Memory},
+	}
+	for _, field := range int64Fields {
+		if r.FormValue(field.name) == "" {
+			continue
+		}
+		*field.value, err = strconv.ParseInt(r.FormValue(field.name), 10, 64)
+		if err != nil {
+			return &terrors.HTTP{Code: http.StatusBadRequest, Message: "Invalid " + field.name + " value"}
+		}
+	}
+	err = provision.SetPoolTeamQuota(poolName, q)
+	if err == provision.ErrPoolNotFound {
+		return &terrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err != nil {
+		return &terrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return nil
+}
@@ -643,3 +643,74 @@ func (s *S) TestPoolConstraintSetRequiresPoolExpr(c *check.C) {
 	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
 	c.Assert(rec.Body.String(), check.Equals, "You must provide a Pool Expression\n")
 }
+
+func (s *S) TestPoolTeamQuotaHandler(c *check.C) {
+	err := provision.AddPool(provision.AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer provision.RemovePool("pool1")
+	b := bytes.NewBufferString("team=tsuruteam&units=10&reservedunits=2&reservedmemory=1024")
+	req, err := http.NewRequest("PUT", "/pools/pool1/quota", b)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rec := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	p, err := provision.GetPoolByName("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.TeamQuotas, check.DeepEquals, []provision.PoolTeamQuota{{
+		Team:     "tsuruteam",
+		Limit:    provision.PoolResources{Units: 10, Memory: -1},
+		Reserved: provision.PoolResources{Units: 2, Memory: 1024},
+	}})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypePool, Value: "pool1"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "pool.update",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": "pool1"},
+			{"name": "team", "value": "tsuruteam"},
+			{"name": "units", "value": "10"},
+			{"name": "reservedunits", "value": "2"},
+			{"name": "reservedmemory", "value": "1024"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestPoolTeamQuotaHandlerInvalidValues(c *check.C) {
+	err := provision.AddPool(provision.AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer provision.RemovePool("pool1")
+	tests := []struct {
+		body    string
+		message string
+	}{
+		{"team=tsuruteam&units=ten", "Invalid units value\n"},
+		{"team=tsuruteam&reservedmemory=1G", "Invalid reservedmemory value\n"},
+		{"units=10", "Team is required.\n"},
+		{"team=tsuruteam&units=1&reservedunits=2", "Reservations can't be greater than limits.\n"},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("PUT", "/pools/pool1/quota", bytes.NewBufferString(tt.body))
+		c.Assert(err, check.IsNil)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		rec := httptest.NewRecorder()
+		m := RunServer(true)
+		m.ServeHTTP(rec, req)
+		c.Check(rec.Code, check.Equals, http.StatusBadRequest)
+		c.Check(rec.Body.String(), check.Equals, tt.message)
+	}
+}
+
+func (s *S) TestPoolTeamQuotaHandlerPoolNotFound(c *check.C) {
+	req, err := http.NewRequest("PUT", "/pools/unknown/quota", bytes.NewBufferString("team=tsuruteam&units=1"))
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rec := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusNotFound)
+}
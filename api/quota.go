@@ -151,3 +151,107 @@ func changeAppQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err e
 	}
 	return app.ChangeQuota(&a, limit)
 }
+
+// title: team quota
+// path: /teams/{name}/quota
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   401: Unauthorized
+//   404: Team not found
+func getTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamReadQuota, permission.Context(permission.CtxTeam, name))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	teamQuota, err := auth.GetTeamQuota(name)
+	if err == auth.ErrTeamNotFound {
+		return &errors.HTTP{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(teamQuota)
+}
+
+// title: update team quota
+// path: /teams/{name}/quota
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Quota updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Team not found
+func changeTeamQuota(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamUpdateQuota)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	team, err := auth.GetTeam(name)
+	if err == auth.ErrTeamNotFound {
+		return &errors.HTTP{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}
+	} else if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamUpdateQuota,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, name)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	limit := team.QuotaLimit()
+	fields := []struct {
+		name  string
+		value *int
+	}{
+		{"apps", &limit.Apps},
+		{"units", &limit.Units},
+		{"serviceinstances", &limit.ServiceInstances},
+	}
+	for _, field := range fields {
+		if r.FormValue(field.name) == "" {
+			continue
+		}
+		*field.value, err = strconv.Atoi(r.FormValue(field.name))
+		if err != nil {
+			return &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid " + field.name + " limit",
+			}
+		}
+	}
+	if r.FormValue("memory") != "" {
+		limit.Memory, err = strconv.ParseInt(r.FormValue("memory"), 10, 64)
+		if err != nil {
+			return &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: "Invalid memory limit",
+			}
+		}
+	}
+	err = auth.ChangeTeamQuota(team, limit)
+	if err != nil {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
@@ -394,3 +394,159 @@ func (s *QuotaSuite) TestChangeAppQuotaAppNotFound(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
 	c.Assert(recorder.Body.String(), check.Equals, app.ErrAppNotFound.Error()+"\n")
 }
+
+func (s *QuotaSuite) TestGetTeamQuota(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(app.App{
+		Name:      "myapp",
+		TeamOwner: s.team.Name,
+		Plan:      app.Plan{Name: "small", Memory: 512},
+		Quota:     quota.Quota{Limit: -1, InUse: 3},
+	})
+	c.Assert(err, check.IsNil)
+	err = auth.ChangeTeamQuota(s.team, auth.TeamResources{Apps: 5, Units: 10, Memory: -1, ServiceInstances: -1})
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "teamquota", permission.Permission{
+		Scheme:  permission.PermTeamReadQuota,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, _ := http.NewRequest("GET", "/teams/superteam/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result auth.TeamQuota
+	err = json.NewDecoder(recorder.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, auth.TeamQuota{
+		Limit: auth.TeamResources{Apps: 5, Units: 10, Memory: -1, ServiceInstances: -1},
+		InUse: auth.TeamResources{Apps: 1, Units: 3, Memory: 3 * 512},
+	})
+}
+
+func (s *QuotaSuite) TestGetTeamQuotaRequiresPermission(c *check.C) {
+	token := userWithPermission(c)
+	request, _ := http.NewRequest("GET", "/teams/superteam/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *QuotaSuite) TestGetTeamQuotaTeamNotFound(c *check.C) {
+	token := customUserWithPermission(c, "teamquota", permission.Permission{
+		Scheme:  permission.PermTeamReadQuota,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, _ := http.NewRequest("GET", "/teams/unknown/quota", nil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrTeamNotFound.Error()+"\n")
+}
+
+func (s *QuotaSuite) TestChangeTeamQuota(c *check.C) {
+	token := customUserWithPermission(c, "teamquota", permission.Permission{
+		Scheme:  permission.PermTeamUpdateQuota,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	body := bytes.NewBufferString("apps=3&memory=1073741824")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	team, err := auth.GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota, check.DeepEquals, &auth.TeamResources{Apps: 3, Units: -1, Memory: 1 << 30, ServiceInstances: -1})
+	c.Assert(eventtest.EventDesc{
+		Target: teamTarget(s.team.Name),
+		Owner:  token.GetUserName(),
+		Kind:   "team.update.quota",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": s.team.Name},
+			{"name": "apps", "value": "3"},
+			{"name": "memory", "value": "1073741824"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaRequiresPermission(c *check.C) {
+	token := userWithPermission(c)
+	body := bytes.NewBufferString("apps=3")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaRequiresGlobalPermission(c *check.C) {
+	token := customUserWithPermission(c, "teamadmin", permission.Permission{
+		Scheme:  permission.PermTeam,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := bytes.NewBufferString("apps=3")
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", body)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaInvalidLimitValue(c *check.C) {
+	token := customUserWithPermission(c, "teamquota", permission.Permission{
+		Scheme:  permission.PermTeamUpdateQuota,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	tests := []struct {
+		body    string
+		message string
+	}{
+		{"units=four", "Invalid units limit\n"},
+		{"memory=1G", "Invalid memory limit\n"},
+	}
+	for _, tt := range tests {
+		request, _ := http.NewRequest("PUT", "/teams/superteam/quota", bytes.NewBufferString(tt.body))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+token.GetValue())
+		recorder := httptest.NewRecorder()
+		handler := RunServer(true)
+		handler.ServeHTTP(recorder, request)
+		c.Check(recorder.Code, check.Equals, http.StatusBadRequest)
+		c.Check(recorder.Body.String(), check.Equals, tt.message)
+	}
+}
+
+func (s *QuotaSuite) TestChangeTeamQuotaLesserThanInUse(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Apps().Insert(app.App{Name: "myapp", TeamOwner: s.team.Name})
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "teamquota", permission.Permission{
+		Scheme:  permission.PermTeamUpdateQuota,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	request, _ := http.NewRequest("PUT", "/teams/superteam/quota", bytes.NewBufferString("apps=0"))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	handler := RunServer(true)
+	handler.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "new apps limit is lesser than the current allocated value\n")
+}
@@ -21,17 +21,26 @@ import (
 	"github.com/tsuru/tsuru/api/shutdown"
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
+	_ "github.com/tsuru/tsuru/auth/ldap"
 	_ "github.com/tsuru/tsuru/auth/native"
 	_ "github.com/tsuru/tsuru/auth/oauth"
+	_ "github.com/tsuru/tsuru/auth/oidc"
 	_ "github.com/tsuru/tsuru/auth/saml"
 	"github.com/tsuru/tsuru/autoscale"
 	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event/audit"
+	"github.com/tsuru/tsuru/event/retention"
+	"github.com/tsuru/tsuru/event/stream"
+	"github.com/tsuru/tsuru/event/webhook"
 	"github.com/tsuru/tsuru/hc"
 	"github.com/tsuru/tsuru/healer"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/metering"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/rebuild"
+	"github.com/tsuru/tsuru/service"
+	"github.com/tsuru/tsuru/tracing"
 	"golang.org/x/net/websocket"
 	"gopkg.in/tylerb/graceful.v1"
 )
@@ -143,6 +152,15 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Delete", "/apps/{app}/lock", forceDeleteLockHandler)
 	m.Add("1.0", "Put", "/apps/{app}/units", AuthorizationRequiredHandler(addUnits))
 	m.Add("1.0", "Delete", "/apps/{app}/units", AuthorizationRequiredHandler(removeUnits))
+	m.Add("1.0", "Get", "/apps/{app}/autoscale", AuthorizationRequiredHandler(appAutoScaleList))
+	m.Add("1.0", "Put", "/apps/{app}/autoscale", AuthorizationRequiredHandler(appAutoScaleSet))
+	m.Add("1.0", "Delete", "/apps/{app}/autoscale/{process}", AuthorizationRequiredHandler(appAutoScaleUnset))
+	m.Add("1.0", "Get", "/apps/{app}/autoscale/schedules", AuthorizationRequiredHandler(appScaleScheduleList))
+	m.Add("1.0", "Post", "/apps/{app}/autoscale/schedules", AuthorizationRequiredHandler(appScaleScheduleAdd))
+	m.Add("1.0", "Delete", "/apps/{app}/autoscale/schedules/{id}", AuthorizationRequiredHandler(appScaleScheduleRemove))
+	m.Add("1.0", "Get", "/apps/{app}/alerts", AuthorizationRequiredHandler(appAlertList))
+	m.Add("1.0", "Post", "/apps/{app}/alerts", AuthorizationRequiredHandler(appAlertSet))
+	m.Add("1.0", "Delete", "/apps/{app}/alerts/{name}", AuthorizationRequiredHandler(appAlertRemove))
 	registerUnitHandler := AuthorizationRequiredHandler(registerUnit)
 	m.Add("1.0", "Post", "/apps/{app}/units/register", registerUnitHandler)
 	setUnitStatusHandler := AuthorizationRequiredHandler(setUnitStatus)
@@ -152,8 +170,14 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/apps/{app}/log", AuthorizationRequiredHandler(appLog))
 	logPostHandler := AuthorizationRequiredHandler(addLog)
 	m.Add("1.0", "Post", "/apps/{app}/log", logPostHandler)
+	m.Add("1.0", "Put", "/apps/{app}/log-retention", AuthorizationRequiredHandler(appLogRetentionSet))
+	m.Add("1.0", "Get", "/logs/usage", AuthorizationRequiredHandler(logUsageReport))
+	m.Add("1.0", "Get", "/log-sinks", AuthorizationRequiredHandler(logSinkList))
+	m.Add("1.0", "Post", "/log-sinks", AuthorizationRequiredHandler(logSinkSet))
+	m.Add("1.0", "Delete", "/log-sinks/{name}", AuthorizationRequiredHandler(logSinkRemove))
 	m.Add("1.0", "Post", "/apps/{appname}/deploy/rollback", AuthorizationRequiredHandler(deployRollback))
 	m.Add("1.0", "Get", "/apps/{app}/metric/envs", AuthorizationRequiredHandler(appMetricEnvs))
+	m.Add("1.0", "Get", "/apps/{app}/metrics", AuthorizationRequiredHandler(appUnitMetrics))
 	m.Add("1.0", "Post", "/apps/{app}/routes", AuthorizationRequiredHandler(appRebuildRoutes))
 	m.Add("1.2", "Get", "/apps/{app}/certificate", AuthorizationRequiredHandler(listCertificates))
 	m.Add("1.2", "Put", "/apps/{app}/certificate", AuthorizationRequiredHandler(setCertificate))
@@ -166,6 +190,13 @@ func RunServer(dry bool) http.Handler {
 
 	m.Add("1.1", "Get", "/events", AuthorizationRequiredHandler(eventList))
 	m.Add("1.1", "Get", "/events/kinds", AuthorizationRequiredHandler(kindList))
+	m.Add("1.3", "Get", "/events/stream", AuthorizationRequiredHandler(eventStream))
+	m.Add("1.3", "Get", "/events/webhooks", AuthorizationRequiredHandler(webhookList))
+	m.Add("1.3", "Post", "/events/webhooks", AuthorizationRequiredHandler(webhookCreate))
+	m.Add("1.3", "Get", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookInfo))
+	m.Add("1.3", "Put", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookUpdate))
+	m.Add("1.3", "Delete", "/events/webhooks/{name}", AuthorizationRequiredHandler(webhookDelete))
+	m.Add("1.3", "Get", "/events/webhooks/{name}/deliveries", AuthorizationRequiredHandler(webhookDeliveries))
 	m.Add("1.1", "Get", "/events/{uuid}", AuthorizationRequiredHandler(eventInfo))
 	m.Add("1.1", "Post", "/events/{uuid}/cancel", AuthorizationRequiredHandler(eventCancel))
 
@@ -207,12 +238,27 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Delete", "/users/keys/{key}", AuthorizationRequiredHandler(removeKeyFromUser))
 	m.Add("1.0", "Get", "/users/api-key", AuthorizationRequiredHandler(showAPIToken))
 	m.Add("1.0", "Post", "/users/api-key", AuthorizationRequiredHandler(regenerateAPIToken))
+	m.Add("1.0", "Get", "/users/personal-tokens", AuthorizationRequiredHandler(listPersonalTokens))
+	m.Add("1.0", "Post", "/users/personal-tokens", AuthorizationRequiredHandler(createPersonalToken))
+	m.Add("1.0", "Delete", "/users/personal-tokens/{name}", AuthorizationRequiredHandler(revokePersonalToken))
+	m.Add("1.0", "Get", "/users/2fa", AuthorizationRequiredHandler(twoFactorStatus))
+	m.Add("1.0", "Post", "/users/2fa", AuthorizationRequiredHandler(startTwoFactorEnrollment))
+	m.Add("1.0", "Delete", "/users/2fa", AuthorizationRequiredHandler(disableTwoFactor))
+	m.Add("1.0", "Post", "/users/2fa/confirm", AuthorizationRequiredHandler(confirmTwoFactorEnrollment))
+	m.Add("1.0", "Post", "/users/2fa/recovery-codes", AuthorizationRequiredHandler(regenerateRecoveryCodes))
+	m.Add("1.0", "Delete", "/users/{email}/2fa", AuthorizationRequiredHandler(resetTwoFactor))
 
 	m.Add("1.0", "Get", "/logs", websocket.Handler(addLogs))
 
 	m.Add("1.0", "Get", "/teams", AuthorizationRequiredHandler(teamList))
+	m.Add("1.0", "Get", "/usage", AuthorizationRequiredHandler(usageReport))
 	m.Add("1.0", "Post", "/teams", AuthorizationRequiredHandler(createTeam))
 	m.Add("1.0", "Delete", "/teams/{name}", AuthorizationRequiredHandler(removeTeam))
+	m.Add("1.0", "Get", "/teams/{name}/quota", AuthorizationRequiredHandler(getTeamQuota))
+	m.Add("1.0", "Put", "/teams/{name}/quota", AuthorizationRequiredHandler(changeTeamQuota))
+	m.Add("1.0", "Get", "/teams/{name}/members", AuthorizationRequiredHandler(listTeamMembers))
+	m.Add("1.0", "Post", "/teams/{name}/members", AuthorizationRequiredHandler(addTeamMember))
+	m.Add("1.0", "Delete", "/teams/{name}/members/{email}", AuthorizationRequiredHandler(removeTeamMember))
 
 	m.Add("1.0", "Post", "/swap", AuthorizationRequiredHandler(swap))
 
@@ -234,6 +280,7 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Post", "/pools", AuthorizationRequiredHandler(addPoolHandler))
 	m.Add("1.0", "Delete", "/pools/{name}", AuthorizationRequiredHandler(removePoolHandler))
 	m.Add("1.0", "Put", "/pools/{name}", AuthorizationRequiredHandler(poolUpdateHandler))
+	m.Add("1.0", "Put", "/pools/{name}/quota", AuthorizationRequiredHandler(poolTeamQuotaHandler))
 	m.Add("1.0", "Post", "/pools/{name}/team", AuthorizationRequiredHandler(addTeamToPoolHandler))
 	m.Add("1.0", "Delete", "/pools/{name}/team", AuthorizationRequiredHandler(removeTeamToPoolHandler))
 
@@ -246,12 +293,15 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Delete", "/roles/{name}", AuthorizationRequiredHandler(removeRole))
 	m.Add("1.0", "Post", "/roles/{name}/permissions", AuthorizationRequiredHandler(addPermissions))
 	m.Add("1.0", "Delete", "/roles/{name}/permissions/{permission}", AuthorizationRequiredHandler(removePermissions))
+	m.Add("1.0", "Put", "/roles/{name}/conditions", AuthorizationRequiredHandler(updateRoleConditions))
 	m.Add("1.0", "Post", "/roles/{name}/user", AuthorizationRequiredHandler(assignRole))
 	m.Add("1.0", "Delete", "/roles/{name}/user/{email}", AuthorizationRequiredHandler(dissociateRole))
 	m.Add("1.0", "Get", "/role/default", AuthorizationRequiredHandler(listDefaultRoles))
 	m.Add("1.0", "Post", "/role/default", AuthorizationRequiredHandler(addDefaultRole))
 	m.Add("1.0", "Delete", "/role/default", AuthorizationRequiredHandler(removeDefaultRole))
 	m.Add("1.0", "Get", "/permissions", AuthorizationRequiredHandler(listPermissions))
+	m.Add("1.0", "Get", "/permissions/check", AuthorizationRequiredHandler(checkPermission))
+	m.Add("1.0", "Get", "/permissions/who", AuthorizationRequiredHandler(listUsersWhoCan))
 
 	m.Add("1.0", "Get", "/debug/goroutines", AuthorizationRequiredHandler(dumpGoroutines))
 	m.Add("1.0", "Get", "/debug/pprof/", AuthorizationRequiredHandler(indexHandler))
@@ -267,6 +317,7 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.3", "GET", "/node/autoscale", AuthorizationRequiredHandler(autoScaleHistoryHandler))
 	m.Add("1.3", "GET", "/node/autoscale/config", AuthorizationRequiredHandler(autoScaleGetConfig))
 	m.Add("1.3", "POST", "/node/autoscale/run", AuthorizationRequiredHandler(autoScaleRunHandler))
+	m.Add("1.3", "GET", "/node/autoscale/preprovision", AuthorizationRequiredHandler(autoScalePreProvisionReport))
 	m.Add("1.3", "GET", "/node/autoscale/rules", AuthorizationRequiredHandler(autoScaleListRules))
 	m.Add("1.3", "POST", "/node/autoscale/rules", AuthorizationRequiredHandler(autoScaleSetRule))
 	m.Add("1.3", "DELETE", "/node/autoscale/rules", AuthorizationRequiredHandler(autoScaleDeleteRule))
@@ -337,6 +388,7 @@ func RunServer(dry bool) http.Handler {
 	n.UseHandler(m)
 	n.Use(negroni.HandlerFunc(flushingWriterMiddleware))
 	n.Use(negroni.HandlerFunc(setRequestIDHeaderMiddleware))
+	n.Use(negroni.HandlerFunc(tracingMiddleware))
 	n.Use(negroni.HandlerFunc(errorHandlingMiddleware))
 	n.Use(negroni.HandlerFunc(setVersionHeadersMiddleware))
 	n.Use(negroni.HandlerFunc(authTokenMiddleware))
@@ -415,6 +467,10 @@ func startServer(handler http.Handler) {
 		srv.Stop(srv.Timeout)
 	}()
 	var startupMessage string
+	err = tracing.Initialize()
+	if err != nil {
+		fatal(err)
+	}
 	err = router.Initialize()
 	if err != nil {
 		fatal(err)
@@ -471,6 +527,46 @@ func startServer(handler http.Handler) {
 	if err != nil {
 		fatal(err)
 	}
+	err = autoscale.InitializeApps()
+	if err != nil {
+		fatal(err)
+	}
+	err = autoscale.InitializeAppSchedules()
+	if err != nil {
+		fatal(err)
+	}
+	err = service.InitializeEndpointMonitor()
+	if err != nil {
+		fatal(err)
+	}
+	err = webhook.Initialize()
+	if err != nil {
+		fatal(err)
+	}
+	err = stream.Initialize()
+	if err != nil {
+		fatal(err)
+	}
+	err = retention.Initialize()
+	if err != nil {
+		fatal(err)
+	}
+	err = metering.Initialize()
+	if err != nil {
+		fatal(err)
+	}
+	err = app.InitializeUnitMetrics()
+	if err != nil {
+		fatal(err)
+	}
+	err = app.InitializeAlerts()
+	if err != nil {
+		fatal(err)
+	}
+	err = audit.Initialize(Version)
+	if err != nil {
+		fatal(err)
+	}
 	fmt.Println("Checking components status:")
 	results := hc.Check()
 	for _, result := range results {
@@ -308,6 +308,7 @@ func serviceInstances(w http.ResponseWriter, r *http.Request, t auth.Token) erro
 			servicesMap[s.Name] = &service.ServiceModel{
 				Service:   s.Name,
 				Instances: []string{},
+				Status:    service.EndpointStatus(s.Name),
 			}
 		}
 	}
@@ -1023,8 +1023,8 @@ func (s *ConsumptionSuite) TestServicesInstancesHandler(c *check.C) {
 	err = json.Unmarshal(recorder.Body.Bytes(), &instances)
 	c.Assert(err, check.IsNil)
 	expected := []service.ServiceModel{
-		{Service: "mongodb", Instances: []string{"mongodb-other"}, Plans: []string{""}},
-		{Service: "redis", Instances: []string{"redis-globo"}, Plans: []string{""}},
+		{Service: "mongodb", Instances: []string{"mongodb-other"}, Plans: []string{""}, Status: "unknown"},
+		{Service: "redis", Instances: []string{"redis-globo"}, Plans: []string{""}, Status: "unknown"},
 	}
 	sort.Sort(ServiceModelList(instances))
 	c.Assert(instances, check.DeepEquals, expected)
@@ -1064,8 +1064,8 @@ func (s *ConsumptionSuite) TestServicesInstancesHandlerAppFilter(c *check.C) {
 	err = json.Unmarshal(recorder.Body.Bytes(), &instances)
 	c.Assert(err, check.IsNil)
 	expected := []service.ServiceModel{
-		{Service: "mongodb", Instances: []string{"mongodb-other"}, Plans: []string{""}},
-		{Service: "redis", Instances: []string{}, Plans: []string(nil)},
+		{Service: "mongodb", Instances: []string{"mongodb-other"}, Plans: []string{""}, Status: "unknown"},
+		{Service: "redis", Instances: []string{}, Plans: []string(nil), Status: "unknown"},
 	}
 	sort.Sort(ServiceModelList(instances))
 	c.Assert(instances, check.DeepEquals, expected)
@@ -1138,11 +1138,11 @@ func (s *ConsumptionSuite) TestServicesInstancesHandlerFilterInstancesPerService
 	c.Assert(err, check.IsNil)
 	sort.Sort(ServiceModelList(instances))
 	expected := []service.ServiceModel{
-		{Service: "memcached", Instances: []string{"memcached1", "memcached2"}, Plans: []string{"", ""}},
-		{Service: "mysql", Instances: []string{}, Plans: []string(nil)},
-		{Service: "oracle", Instances: []string{}, Plans: []string(nil)},
-		{Service: "pgsql", Instances: []string{"pgsql1", "pgsql2"}, Plans: []string{"", ""}},
-		{Service: "redis", Instances: []string{"redis1", "redis2"}, Plans: []string{"", ""}},
+		{Service: "memcached", Instances: []string{"memcached1", "memcached2"}, Plans: []string{"", ""}, Status: "unknown"},
+		{Service: "mysql", Instances: []string{}, Plans: []string(nil), Status: "unknown"},
+		{Service: "oracle", Instances: []string{}, Plans: []string(nil), Status: "unknown"},
+		{Service: "pgsql", Instances: []string{"pgsql1", "pgsql2"}, Plans: []string{"", ""}, Status: "unknown"},
+		{Service: "redis", Instances: []string{"redis1", "redis2"}, Plans: []string{"", ""}, Status: "unknown"},
 	}
 	c.Assert(instances, check.DeepEquals, expected)
 }
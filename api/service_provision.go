@@ -59,6 +59,7 @@ func serviceList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	results := make([]service.ServiceModel, len(services))
 	for i, s := range services {
 		results[i].Service = s.Name
+		results[i].Status = service.EndpointStatus(s.Name)
 		for _, si := range sInstances {
 			if si.ServiceName == s.Name {
 				results[i].Instances = append(results[i].Instances, si.Name)
@@ -95,7 +95,7 @@ func (s *ProvisionSuite) TestServiceListGetAllServicesFromUsersTeam(c *check.C)
 	err := json.Unmarshal(recorder.Body.Bytes(), &services)
 	c.Assert(err, check.IsNil)
 	expected := []service.ServiceModel{
-		{Service: "mongodb", Instances: []string{"my_nosql"}},
+		{Service: "mongodb", Instances: []string{"my_nosql"}, Status: "unknown"},
 	}
 	c.Assert(services, check.DeepEquals, expected)
 	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
@@ -0,0 +1,191 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+func getTeamOr404(name string) (*auth.Team, error) {
+	team, err := auth.GetTeam(name)
+	if err == auth.ErrTeamNotFound {
+		return nil, &errors.HTTP{
+			Code:    http.StatusNotFound,
+			Message: err.Error(),
+		}
+	}
+	return team, err
+}
+
+// title: list team members
+// path: /teams/{name}/members
+// method: GET
+// produce: application/json
+// responses:
+//   200: List members
+//   204: No content
+//   401: Unauthorized
+//   404: Team not found
+func listTeamMembers(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamReadMembers, permission.Context(permission.CtxTeam, name))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	team, err := getTeamOr404(name)
+	if err != nil {
+		return err
+	}
+	members, err := team.Members()
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(members)
+}
+
+// title: add team member
+// path: /teams/{name}/members
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Member added
+//   201: Member invited
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Role not allowed
+//   404: Team or role not found
+func addTeamMember(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamUpdateMembersAdd, permission.Context(permission.CtxTeam, name))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	team, err := getTeamOr404(name)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamUpdateMembersAdd,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, name)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	email := r.FormValue("email")
+	roleName := r.FormValue("role")
+	if email == "" || roleName == "" {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "Email and role are required.",
+		}
+	}
+	err = canUseRole(t, roleName, name)
+	if err != nil {
+		return err
+	}
+	user, err := auth.GetUserByEmail(email)
+	switch err.(type) {
+	case nil:
+		err = runWithPermSync([]auth.User{*user}, func() error {
+			_, addErr := team.AddMember(email, roleName, t.GetUserName())
+			return addErr
+		})
+	case *errors.ValidationError:
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	default:
+		if err != auth.ErrUserNotFound {
+			return err
+		}
+		_, err = team.AddMember(email, roleName, t.GetUserName())
+		if err == nil {
+			w.WriteHeader(http.StatusCreated)
+		}
+	}
+	if err == auth.ErrInvalidMemberRole {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+// title: remove team member
+// path: /teams/{name}/members/{email}
+// method: DELETE
+// responses:
+//   200: Member removed
+//   401: Unauthorized
+//   403: Role not allowed
+//   404: Team or member not found
+func removeTeamMember(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	r.ParseForm()
+	name := r.URL.Query().Get(":name")
+	allowed := permission.Check(t, permission.PermTeamUpdateMembersRemove, permission.Context(permission.CtxTeam, name))
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	team, err := getTeamOr404(name)
+	if err != nil {
+		return err
+	}
+	evt, err := event.New(&event.Opts{
+		Target:     teamTarget(name),
+		Kind:       permission.PermTeamUpdateMembersRemove,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermTeamReadEvents, permission.Context(permission.CtxTeam, name)),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	email := r.URL.Query().Get(":email")
+	members, err := team.Members()
+	if err != nil {
+		return err
+	}
+	var member *auth.TeamMember
+	for i := range members {
+		if members[i].Email == email {
+			member = &members[i]
+			break
+		}
+	}
+	if member == nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: auth.ErrMemberNotFound.Error()}
+	}
+	for _, roleName := range member.Roles {
+		err = canUseRole(t, roleName, name)
+		if err != nil {
+			return err
+		}
+	}
+	if member.Invited {
+		_, err = team.RemoveMember(email)
+		return err
+	}
+	user, err := auth.GetUserByEmail(email)
+	if err != nil {
+		return err
+	}
+	return runWithPermSync([]auth.User{*user}, func() error {
+		_, removeErr := team.RemoveMember(email)
+		return removeErr
+	})
+}
@@ -0,0 +1,206 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/repository/repositorytest"
+	"gopkg.in/check.v1"
+)
+
+type TeamMemberSuite struct {
+	team  *auth.Team
+	admin auth.Token
+}
+
+var _ = check.Suite(&TeamMemberSuite{})
+
+func (s *TeamMemberSuite) SetUpSuite(c *check.C) {
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_api_team_member_test")
+	config.Set("auth:hash-cost", 4)
+	config.Set("repo-manager", "fake")
+}
+
+func (s *TeamMemberSuite) SetUpTest(c *check.C) {
+	conn, _ := db.Conn()
+	defer conn.Close()
+	dbtest.ClearAllCollections(conn.Apps().Database)
+	repositorytest.Reset()
+	s.team = &auth.Team{Name: "superteam"}
+	err := conn.Teams().Insert(s.team)
+	c.Assert(err, check.IsNil)
+	role, err := permission.NewRole("team-admin", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("team.read.members", "team.update.members", "app.deploy")
+	c.Assert(err, check.IsNil)
+	role, err = permission.NewRole("team-deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	role, err = permission.NewRole("team-destroyer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.delete")
+	c.Assert(err, check.IsNil)
+	s.admin = customUserWithPermission(c, "teamadmin")
+	admin, err := s.admin.User()
+	c.Assert(err, check.IsNil)
+	err = admin.AddRole("team-admin", s.team.Name)
+	c.Assert(err, check.IsNil)
+	app.AuthScheme = nativeScheme
+}
+
+func (s *TeamMemberSuite) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Apps().Database.DropDatabase()
+}
+
+func (s *TeamMemberSuite) serve(method, url, body string, token auth.Token) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, url, bytes.NewBufferString(body))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *TeamMemberSuite) TestListTeamMembers(c *check.C) {
+	recorder := s.serve("GET", "/teams/superteam/members", "", s.admin)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var members []auth.TeamMember
+	err := json.Unmarshal(recorder.Body.Bytes(), &members)
+	c.Assert(err, check.IsNil)
+	c.Assert(members, check.DeepEquals, []auth.TeamMember{
+		{Email: "teamadmin@groundcontrol.com", Roles: []string{"team-admin"}},
+	})
+}
+
+func (s *TeamMemberSuite) TestListTeamMembersRequiresPermission(c *check.C) {
+	token := userWithPermission(c)
+	recorder := s.serve("GET", "/teams/superteam/members", "", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *TeamMemberSuite) TestListTeamMembersTeamNotFound(c *check.C) {
+	token := customUserWithPermission(c, "reader", permission.Permission{
+		Scheme:  permission.PermTeamReadMembers,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	recorder := s.serve("GET", "/teams/unknown/members", "", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *TeamMemberSuite) TestAddTeamMember(c *check.C) {
+	token := customUserWithPermission(c, "member")
+	recorder := s.serve("POST", "/teams/superteam/members", "email=member@groundcontrol.com&role=team-deployer", s.admin)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	user, err := token.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.DeepEquals, []auth.RoleInstance{{Name: "team-deployer", ContextValue: "superteam"}})
+	c.Assert(eventtest.EventDesc{
+		Target: teamTarget(s.team.Name),
+		Owner:  s.admin.GetUserName(),
+		Kind:   "team.update.members.add",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": s.team.Name},
+			{"name": "email", "value": "member@groundcontrol.com"},
+			{"name": "role", "value": "team-deployer"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *TeamMemberSuite) TestAddTeamMemberInvite(c *check.C) {
+	recorder := s.serve("POST", "/teams/superteam/members", "email=newcomer@groundcontrol.com&role=team-deployer", s.admin)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	invites, err := s.team.Invites()
+	c.Assert(err, check.IsNil)
+	c.Assert(invites, check.HasLen, 1)
+	c.Assert(invites[0].Email, check.Equals, "newcomer@groundcontrol.com")
+	c.Assert(invites[0].InvitedBy, check.Equals, s.admin.GetUserName())
+}
+
+func (s *TeamMemberSuite) TestAddTeamMemberRoleNotAllowed(c *check.C) {
+	customUserWithPermission(c, "member")
+	recorder := s.serve("POST", "/teams/superteam/members", "email=member@groundcontrol.com&role=team-destroyer", s.admin)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), check.Matches, "User not authorized to use permission app.delete.*\n")
+}
+
+func (s *TeamMemberSuite) TestAddTeamMemberInvalidRoleContext(c *check.C) {
+	_, err := permission.NewRole("global-role", "global", "")
+	c.Assert(err, check.IsNil)
+	recorder := s.serve("POST", "/teams/superteam/members", "email=member@groundcontrol.com&role=global-role", s.admin)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, auth.ErrInvalidMemberRole.Error()+"\n")
+}
+
+func (s *TeamMemberSuite) TestAddTeamMemberMissingFields(c *check.C) {
+	recorder := s.serve("POST", "/teams/superteam/members", "email=member@groundcontrol.com", s.admin)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Email and role are required.\n")
+}
+
+func (s *TeamMemberSuite) TestAddTeamMemberRequiresPermission(c *check.C) {
+	token := customUserWithPermission(c, "reader", permission.Permission{
+		Scheme:  permission.PermTeamReadMembers,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	recorder := s.serve("POST", "/teams/superteam/members", "email=member@groundcontrol.com&role=team-deployer", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *TeamMemberSuite) TestRemoveTeamMember(c *check.C) {
+	token := customUserWithPermission(c, "member")
+	user, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = user.AddRole("team-deployer", s.team.Name)
+	c.Assert(err, check.IsNil)
+	recorder := s.serve("DELETE", "/teams/superteam/members/member@groundcontrol.com", "", s.admin)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	user, err = token.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target: teamTarget(s.team.Name),
+		Owner:  s.admin.GetUserName(),
+		Kind:   "team.update.members.remove",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":name", "value": s.team.Name},
+			{"name": ":email", "value": "member@groundcontrol.com"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *TeamMemberSuite) TestRemoveTeamMemberRoleNotAllowed(c *check.C) {
+	token := customUserWithPermission(c, "member")
+	user, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = user.AddRole("team-destroyer", s.team.Name)
+	c.Assert(err, check.IsNil)
+	recorder := s.serve("DELETE", "/teams/superteam/members/member@groundcontrol.com", "", s.admin)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	user, err = token.User()
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.HasLen, 1)
+}
+
+func (s *TeamMemberSuite) TestRemoveTeamMemberNotFound(c *check.C) {
+	recorder := s.serve("DELETE", "/teams/superteam/members/nobody@groundcontrol.com", "", s.admin)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
@@ -0,0 +1,259 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// twoFactorHeader is sent on login responses to tell clients that a
+// two-factor authentication code is required, or that the user must enroll
+// before the issued token gets any permission.
+const twoFactorHeader = "X-Tsuru-Two-Factor"
+
+var errTwoFactorEnrollment = &errors.HTTP{
+	Code:    http.StatusForbidden,
+	Message: "You must enroll in two-factor authentication before using API keys and personal tokens.",
+}
+
+func twoFactorScheme() (auth.TwoFactorScheme, error) {
+	scheme, ok := app.AuthScheme.(auth.TwoFactorScheme)
+	if !ok {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: nonManagedSchemeMsg}
+	}
+	return scheme, nil
+}
+
+// isRestrictedToken checks whether the token was issued to a user required
+// to enroll in two-factor authentication that haven't enrolled yet.
+func isRestrictedToken(t auth.Token) bool {
+	restricted, ok := auth.UnwrapToken(t).(auth.RestrictedToken)
+	return ok && restricted.IsRestricted()
+}
+
+// twoFactorEnrollmentPending checks whether the user is required to enroll
+// in two-factor authentication and haven't enrolled yet.
+func twoFactorEnrollmentPending(u *auth.User) (bool, error) {
+	scheme, ok := app.AuthScheme.(auth.TwoFactorScheme)
+	if !ok {
+		return false, nil
+	}
+	status, err := scheme.TwoFactorStatus(u)
+	if err != nil {
+		return false, err
+	}
+	return status.Required && !status.Enabled, nil
+}
+
+func twoFactorEvent(t auth.Token, email string) (*event.Event, error) {
+	return event.New(&event.Opts{
+		Target:  userTarget(email),
+		Kind:    permission.PermUserUpdateTwoFactor,
+		Owner:   t,
+		Allowed: event.Allowed(permission.PermUserReadEvents, permission.Context(permission.CtxUser, email)),
+	})
+}
+
+// title: two-factor status
+// path: /users/2fa
+// method: GET
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+func twoFactorStatus(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	scheme, err := twoFactorScheme()
+	if err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	status, err := scheme.TwoFactorStatus(u)
+	if err != nil {
+		return handleAuthError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(status)
+}
+
+// title: two-factor enrollment start
+// path: /users/2fa
+// method: POST
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Two-factor authentication already enabled
+func startTwoFactorEnrollment(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme()
+	if err != nil {
+		return err
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	evt, err := twoFactorEvent(t, u.Email)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	enrollment, err := scheme.StartTwoFactorEnrollment(u)
+	if err != nil {
+		return handleAuthError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(enrollment)
+}
+
+// title: two-factor enrollment confirm
+// path: /users/2fa/confirm
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Two-factor authentication already enabled
+func confirmTwoFactorEnrollment(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme()
+	if err != nil {
+		return err
+	}
+	code := r.FormValue("code")
+	if code == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "The two-factor authentication code is required."}
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	evt, err := twoFactorEvent(t, u.Email)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	codes, err := scheme.ConfirmTwoFactorEnrollment(u, code)
+	if err != nil {
+		return handleAuthError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(codes)
+}
+
+// title: two-factor recovery codes regenerate
+// path: /users/2fa/recovery-codes
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+func regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme()
+	if err != nil {
+		return err
+	}
+	code := r.FormValue("code")
+	if code == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "The two-factor authentication code is required."}
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	evt, err := twoFactorEvent(t, u.Email)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	codes, err := scheme.RegenerateRecoveryCodes(u, code)
+	if err != nil {
+		return handleAuthError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(codes)
+}
+
+// title: two-factor disable
+// path: /users/2fa
+// method: DELETE
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+func disableTwoFactor(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme()
+	if err != nil {
+		return err
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "The two-factor authentication code is required."}
+	}
+	u, err := t.User()
+	if err != nil {
+		return err
+	}
+	evt, err := twoFactorEvent(t, u.Email)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = scheme.DisableTwoFactor(u, code)
+	if err != nil {
+		return handleAuthError(err)
+	}
+	return nil
+}
+
+// title: two-factor reset
+// path: /users/{email}/2fa
+// method: DELETE
+// responses:
+//   200: OK
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+//   404: User not found
+func resetTwoFactor(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	scheme, err := twoFactorScheme()
+	if err != nil {
+		return err
+	}
+	email := r.URL.Query().Get(":email")
+	if email == t.GetUserName() {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "Users must provide a two-factor authentication code to disable it."}
+	}
+	allowed := permission.Check(t, permission.PermUserUpdateTwoFactor,
+		permission.Context(permission.CtxUser, email),
+	)
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	evt, err := twoFactorEvent(t, email)
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	u, err := auth.GetUserByEmail(email)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return scheme.ResetTwoFactor(u)
+}
@@ -0,0 +1,183 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func totpCode(c *check.C, secret string, offset int64) string {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	c.Assert(err, check.IsNil)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30+offset))
+	h := hmac.New(sha1.New, key)
+	h.Write(msg[:])
+	sum := h.Sum(nil)
+	pos := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[pos:pos+4])&0x7fffffff)%1000000)
+}
+
+func (s *AuthSuite) createNativeUser(c *check.C, email string) auth.Token {
+	u := &auth.User{Email: email, Password: "123456"}
+	_, err := nativeScheme.Create(u)
+	c.Assert(err, check.IsNil)
+	token, err := nativeScheme.Login(map[string]string{"email": email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+	return token
+}
+
+func (s *AuthSuite) twoFactorRequest(c *check.C, method, url, body string, token auth.Token) *httptest.ResponseRecorder {
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *AuthSuite) enrollTwoFactor(c *check.C, token auth.Token) (string, []string) {
+	recorder := s.twoFactorRequest(c, "POST", "/users/2fa", "", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var enrollment auth.TwoFactorEnrollment
+	err := json.NewDecoder(recorder.Body).Decode(&enrollment)
+	c.Assert(err, check.IsNil)
+	c.Assert(enrollment.URI, check.Matches, `^otpauth://totp/tsuru:.*secret=`+enrollment.Secret+`.*`)
+	recorder = s.twoFactorRequest(c, "POST", "/users/2fa/confirm", "code="+totpCode(c, enrollment.Secret, 0), token)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var codes []string
+	err = json.NewDecoder(recorder.Body).Decode(&codes)
+	c.Assert(err, check.IsNil)
+	c.Assert(codes, check.HasLen, 10)
+	return enrollment.Secret, codes
+}
+
+func (s *AuthSuite) TestTwoFactorEnrollment(c *check.C) {
+	token := s.createNativeUser(c, "otp@tsuru.io")
+	s.enrollTwoFactor(c, token)
+	recorder := s.twoFactorRequest(c, "GET", "/users/2fa", "", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var status auth.TwoFactorStatus
+	err := json.NewDecoder(recorder.Body).Decode(&status)
+	c.Assert(err, check.IsNil)
+	c.Assert(status, check.DeepEquals, auth.TwoFactorStatus{Enabled: true, RecoveryCodesLeft: 10})
+	c.Assert(eventtest.EventDesc{
+		Target: userTarget("otp@tsuru.io"),
+		Owner:  "otp@tsuru.io",
+		Kind:   "user.update.two-factor",
+	}, eventtest.HasEvent)
+}
+
+func (s *AuthSuite) TestTwoFactorConfirmWithoutCode(c *check.C) {
+	token := s.createNativeUser(c, "otp@tsuru.io")
+	recorder := s.twoFactorRequest(c, "POST", "/users/2fa/confirm", "", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "The two-factor authentication code is required.\n")
+}
+
+func (s *AuthSuite) TestTwoFactorConfirmInvalidCode(c *check.C) {
+	token := s.createNativeUser(c, "otp@tsuru.io")
+	recorder := s.twoFactorRequest(c, "POST", "/users/2fa", "", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	recorder = s.twoFactorRequest(c, "POST", "/users/2fa/confirm", "code=abc", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+}
+
+func (s *AuthSuite) TestLoginTwoFactorRequired(c *check.C) {
+	token := s.createNativeUser(c, "otp@tsuru.io")
+	secret, _ := s.enrollTwoFactor(c, token)
+	request, err := http.NewRequest("POST", "/users/otp@tsuru.io/tokens", strings.NewReader("password=123456"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusUnauthorized)
+	c.Assert(recorder.Header().Get(twoFactorHeader), check.Equals, "required")
+	request, err = http.NewRequest("POST", "/users/otp@tsuru.io/tokens", strings.NewReader("password=123456&otp="+totpCode(c, secret, 1)))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get(twoFactorHeader), check.Equals, "")
+}
+
+func (s *AuthSuite) TestTwoFactorEnrollmentPendingRejectsAPIKey(c *check.C) {
+	config.Set("auth:two-factor:required-permissions", []interface{}{"pool.*"})
+	defer config.Unset("auth:two-factor:required-permissions")
+	role, err := permission.NewRole("otp-pool-admin", "global", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("pool.create")
+	c.Assert(err, check.IsNil)
+	u := &auth.User{Email: "otp@tsuru.io", Password: "123456", APIKey: "otp-api-key"}
+	_, err = nativeScheme.Create(u)
+	c.Assert(err, check.IsNil)
+	err = u.AddRole("otp-pool-admin", "")
+	c.Assert(err, check.IsNil)
+	token, err := nativeScheme.Login(map[string]string{"email": u.Email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+	recorder := s.twoFactorRequest(c, "GET", "/users/api-key", "", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), check.Equals, errTwoFactorEnrollment.Message+"\n")
+	apiToken := &auth.APIToken{Token: "otp-api-key"}
+	recorder = s.twoFactorRequest(c, "GET", "/users/api-key", "", apiToken)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(recorder.Body.String(), check.Equals, errTwoFactorEnrollment.Message+"\n")
+	s.enrollTwoFactor(c, token)
+	recorder = s.twoFactorRequest(c, "GET", "/users/api-key", "", apiToken)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+}
+
+func (s *AuthSuite) TestDisableTwoFactor(c *check.C) {
+	token := s.createNativeUser(c, "otp@tsuru.io")
+	_, codes := s.enrollTwoFactor(c, token)
+	recorder := s.twoFactorRequest(c, "DELETE", "/users/2fa", "", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	recorder = s.twoFactorRequest(c, "DELETE", "/users/2fa?code="+codes[0], "", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err := nativeScheme.Login(map[string]string{"email": "otp@tsuru.io", "password": "123456"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *AuthSuite) TestResetTwoFactor(c *check.C) {
+	token := s.createNativeUser(c, "otp@tsuru.io")
+	s.enrollTwoFactor(c, token)
+	recorder := s.twoFactorRequest(c, "DELETE", "/users/otp@tsuru.io/2fa", "", s.token)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	status, err := nativeScheme.(auth.TwoFactorScheme).TwoFactorStatus(&auth.User{Email: "otp@tsuru.io"})
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Enabled, check.Equals, false)
+}
+
+func (s *AuthSuite) TestResetTwoFactorForbidden(c *check.C) {
+	token := s.createNativeUser(c, "otp@tsuru.io")
+	other := customUserWithPermission(c, "otheruser", permission.Permission{
+		Scheme:  permission.PermUserUpdateTwoFactor,
+		Context: permission.Context(permission.CtxUser, "someone@tsuru.io"),
+	})
+	recorder := s.twoFactorRequest(c, "DELETE", "/users/otp@tsuru.io/2fa", "", other)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	recorder = s.twoFactorRequest(c, "DELETE", "/users/otp@tsuru.io/2fa", "", token)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
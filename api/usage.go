@@ -0,0 +1,91 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/metering"
+	"github.com/tsuru/tsuru/permission"
+)
+
+// parseUsageTime parses times in the RFC 3339 or YYYY-MM-DD formats.
+func parseUsageTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// title: usage report
+// path: /usage
+// method: GET
+// produce: application/json, text/csv
+// responses:
+//   200: OK
+//   204: No content
+//   400: Invalid data
+//   401: Unauthorized
+//   403: Forbidden
+func usageReport(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	filter := metering.ReportFilter{Team: r.URL.Query().Get("team")}
+	var allowed bool
+	if filter.Team == "" {
+		allowed = permission.Check(t, permission.PermTeamReadUsage)
+	} else {
+		allowed = permission.Check(t, permission.PermTeamReadUsage,
+			permission.Context(permission.CtxTeam, filter.Team),
+		)
+	}
+	if !allowed {
+		return permission.ErrUnauthorized
+	}
+	now := time.Now().UTC()
+	filter.From = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	filter.To = now
+	fields := []struct {
+		name  string
+		value *time.Time
+	}{
+		{"from", &filter.From},
+		{"to", &filter.To},
+	}
+	for _, field := range fields {
+		if r.URL.Query().Get(field.name) == "" {
+			continue
+		}
+		parsed, err := parseUsageTime(r.URL.Query().Get(field.name))
+		if err != nil {
+			return &errors.HTTP{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("Invalid %q time, it must be in the YYYY-MM-DD or RFC 3339 formats.", field.name),
+			}
+		}
+		*field.value = parsed
+	}
+	if !filter.From.Before(filter.To) {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: `The "from" time must be before the "to" time.`}
+	}
+	items, err := metering.Report(filter)
+	if err != nil {
+		return err
+	}
+	if r.URL.Query().Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		w.Header().Set("Content-Type", "text/csv")
+		return metering.WriteCSV(w, items)
+	}
+	if len(items) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(items)
+}
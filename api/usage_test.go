@@ -0,0 +1,90 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/metering"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) insertUsage(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	hour := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	err = conn.Usage().Insert(
+		metering.Record{Hour: hour, Kind: metering.KindUnit, Team: s.team.Name, App: "myapp", Plan: "small", Hours: 2},
+		metering.Record{Hour: hour, Kind: metering.KindUnit, Team: "otherteam", App: "otherapp", Plan: "small", Hours: 1},
+	)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) usageRequest(c *check.C, url, token string) *httptest.ResponseRecorder {
+	request, err := http.NewRequest("GET", url, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token)
+	recorder := httptest.NewRecorder()
+	RunServer(true).ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *S) TestUsageReport(c *check.C) {
+	s.insertUsage(c)
+	recorder := s.usageRequest(c, "/usage?from=2017-06-01&to=2017-06-02", s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var items []metering.ReportItem
+	err := json.NewDecoder(recorder.Body).Decode(&items)
+	c.Assert(err, check.IsNil)
+	c.Assert(items, check.HasLen, 2)
+}
+
+func (s *S) TestUsageReportCSV(c *check.C) {
+	s.insertUsage(c)
+	recorder := s.usageRequest(c, "/usage?team="+s.team.Name+"&from=2017-06-01&to=2017-06-02T00:00:00Z&format=csv", s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/csv")
+	c.Assert(recorder.Body.String(), check.Equals, "team,kind,app,service,instance,plan,memory,swap,cpushare,hours,price,cost\n"+
+		s.team.Name+",unit,myapp,,,small,0,0,0,2,0,0\n")
+}
+
+func (s *S) TestUsageReportNoContent(c *check.C) {
+	recorder := s.usageRequest(c, "/usage?from=2017-06-01&to=2017-06-02", s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *S) TestUsageReportTeamPermission(c *check.C) {
+	s.insertUsage(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermTeamReadUsage,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	recorder := s.usageRequest(c, "/usage?from=2017-06-01&to=2017-06-02", token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	recorder = s.usageRequest(c, "/usage?team=otherteam&from=2017-06-01&to=2017-06-02", token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	recorder = s.usageRequest(c, "/usage?team="+s.team.Name+"&from=2017-06-01&to=2017-06-02", token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var items []metering.ReportItem
+	err := json.NewDecoder(recorder.Body).Decode(&items)
+	c.Assert(err, check.IsNil)
+	c.Assert(items, check.HasLen, 1)
+	c.Assert(items[0].App, check.Equals, "myapp")
+}
+
+func (s *S) TestUsageReportInvalidPeriod(c *check.C) {
+	recorder := s.usageRequest(c, "/usage?from=yesterday", s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "Invalid \"from\" time, it must be in the YYYY-MM-DD or RFC 3339 formats.\n")
+	recorder = s.usageRequest(c, "/usage?from=2017-06-02&to=2017-06-01", s.token.GetValue())
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
@@ -0,0 +1,258 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/auth"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+)
+
+func webhookContexts(w *webhook.Webhook) []permission.PermissionContext {
+	if w.TeamOwner == "" {
+		return nil
+	}
+	return []permission.PermissionContext{permission.Context(permission.CtxTeam, w.TeamOwner)}
+}
+
+func webhookError(err error) error {
+	if err == webhook.ErrWebhookNotFound {
+		return &tsuruErrors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if err == webhook.ErrWebhookAlreadyExists {
+		return &tsuruErrors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+	}
+	if _, ok := err.(*webhook.ErrValidation); ok {
+		return &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return err
+}
+
+func decodeWebhook(r *http.Request) (*webhook.Webhook, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	dec.IgnoreCase(true)
+	var w webhook.Webhook
+	err = dec.DecodeValues(&w, r.Form)
+	if err != nil {
+		return nil, &tsuruErrors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return &w, nil
+}
+
+// removeWebhookSecrets removes the secret and the headers of the webhook from
+// the form, keeping them out of the event log.
+func removeWebhookSecrets(form url.Values) {
+	for key := range form {
+		lower := strings.ToLower(key)
+		if lower == "secret" || strings.HasPrefix(lower, "headers.") {
+			form.Del(key)
+		}
+	}
+}
+
+// title: webhook list
+// path: /events/webhooks
+// method: GET
+// produce: application/json
+// responses:
+//   200: List webhooks
+//   204: No content
+//   401: Unauthorized
+func webhookList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	teams, err := permission.ListContextValues(t, permission.PermWebhookRead, true)
+	if err != nil {
+		return err
+	}
+	webhooks, err := webhook.List(teams)
+	if err != nil {
+		return err
+	}
+	if len(webhooks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	for i := range webhooks {
+		webhooks[i] = webhooks[i].Redacted()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(webhooks)
+}
+
+// title: webhook info
+// path: /events/webhooks/{name}
+// method: GET
+// produce: application/json
+// responses:
+//   200: Show webhook
+//   401: Unauthorized
+//   404: Not found
+func webhookInfo(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	wh, err := webhook.Find(r.URL.Query().Get(":name"))
+	if err != nil {
+		return webhookError(err)
+	}
+	if !permission.Check(t, permission.PermWebhookRead, webhookContexts(wh)...) {
+		return permission.ErrUnauthorized
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(wh.Redacted())
+}
+
+// title: webhook create
+// path: /events/webhooks
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/json
+// responses:
+//   201: Webhook created
+//   400: Invalid data
+//   401: Unauthorized
+//   409: Webhook already exists
+func webhookCreate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	wh, err := decodeWebhook(r)
+	if err != nil {
+		return err
+	}
+	ctxs := webhookContexts(wh)
+	if !permission.Check(t, permission.PermWebhookCreate, ctxs...) {
+		return permission.ErrUnauthorized
+	}
+	removeWebhookSecrets(r.Form)
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeWebhook, Value: wh.Name},
+		Kind:       permission.PermWebhookCreate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermWebhookRead, ctxs...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	err = webhook.Create(wh)
+	if err != nil {
+		return webhookError(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(map[string]string{"secret": wh.Secret})
+}
+
+// title: webhook update
+// path: /events/webhooks/{name}
+// method: PUT
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Webhook updated
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func webhookUpdate(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	wh, err := decodeWebhook(r)
+	if err != nil {
+		return err
+	}
+	wh.Name = r.URL.Query().Get(":name")
+	current, err := webhook.Find(wh.Name)
+	if err != nil {
+		return webhookError(err)
+	}
+	if !permission.Check(t, permission.PermWebhookUpdate, webhookContexts(current)...) {
+		return permission.ErrUnauthorized
+	}
+	ctxs := webhookContexts(wh)
+	if !permission.Check(t, permission.PermWebhookUpdate, ctxs...) {
+		return permission.ErrUnauthorized
+	}
+	removeWebhookSecrets(r.Form)
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeWebhook, Value: wh.Name},
+		Kind:       permission.PermWebhookUpdate,
+		Owner:      t,
+		CustomData: event.FormToCustomData(r.Form),
+		Allowed:    event.Allowed(permission.PermWebhookRead, ctxs...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return webhookError(webhook.Update(wh))
+}
+
+// title: webhook delete
+// path: /events/webhooks/{name}
+// method: DELETE
+// responses:
+//   200: Webhook deleted
+//   401: Unauthorized
+//   404: Not found
+func webhookDelete(w http.ResponseWriter, r *http.Request, t auth.Token) (err error) {
+	wh, err := webhook.Find(r.URL.Query().Get(":name"))
+	if err != nil {
+		return webhookError(err)
+	}
+	ctxs := webhookContexts(wh)
+	if !permission.Check(t, permission.PermWebhookDelete, ctxs...) {
+		return permission.ErrUnauthorized
+	}
+	evt, err := event.New(&event.Opts{
+		Target:  event.Target{Type: event.TargetTypeWebhook, Value: wh.Name},
+		Kind:    permission.PermWebhookDelete,
+		Owner:   t,
+		Allowed: event.Allowed(permission.PermWebhookRead, ctxs...),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.Done(err) }()
+	return webhookError(webhook.Delete(wh.Name))
+}
+
+// title: webhook deliveries
+// path: /events/webhooks/{name}/deliveries
+// method: GET
+// produce: application/json
+// responses:
+//   200: List deliveries
+//   204: No content
+//   401: Unauthorized
+//   404: Not found
+func webhookDeliveries(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	wh, err := webhook.Find(r.URL.Query().Get(":name"))
+	if err != nil {
+		return webhookError(err)
+	}
+	if !permission.Check(t, permission.PermWebhookRead, webhookContexts(wh)...) {
+		return permission.ErrUnauthorized
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 20
+	}
+	deliveries, err := webhook.ListDeliveries(wh.Name, limit)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(deliveries)
+}
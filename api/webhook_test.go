@@ -0,0 +1,232 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/event/webhook"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestWebhookCreate(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := strings.NewReader("name=wh1&url=http://example.com/hook&teamowner=" + s.team.Name + "&eventfilter.kindnames.0=app.deploy")
+	request, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	var result map[string]string
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	wh, err := webhook.Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, map[string]string{"secret": wh.Secret})
+	c.Assert(wh.URL, check.Equals, "http://example.com/hook")
+	c.Assert(wh.TeamOwner, check.Equals, s.team.Name)
+	c.Assert(wh.EventFilter.KindNames, check.DeepEquals, []string{"app.deploy"})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeWebhook, Value: "wh1"},
+		Owner:  token.GetUserName(),
+		Kind:   "webhook.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "wh1"},
+			{"name": "url", "value": "http://example.com/hook"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestWebhookCreateKeepsSecretsOutOfEvent(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	body := strings.NewReader("name=wh1&url=http://example.com/hook&secret=s3cr3t&headers.Authorization=Bearer+abc")
+	request, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	wh, err := webhook.Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(wh.Secret, check.Equals, "s3cr3t")
+	c.Assert(wh.Headers, check.DeepEquals, map[string]string{"Authorization": "Bearer abc"})
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: event.TargetTypeWebhook, Value: "wh1"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	var data []map[string]interface{}
+	err = evts[0].StartData(&data)
+	c.Assert(err, check.IsNil)
+	for _, field := range data {
+		c.Assert(field["name"], check.Not(check.Equals), "secret")
+		c.Assert(field["name"], check.Not(check.Equals), "headers.Authorization")
+	}
+}
+
+func (s *S) TestWebhookCreateInvalid(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	})
+	body := strings.NewReader("name=wh1&url=invalid")
+	request, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "invalid webhook url \"invalid\"\n")
+}
+
+func (s *S) TestWebhookCreateGlobalWithoutPermission(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookCreate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := strings.NewReader("name=wh1&url=http://example.com/hook")
+	request, err := http.NewRequest("POST", "/events/webhooks", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	_, err = webhook.Find("wh1")
+	c.Assert(err, check.Equals, webhook.ErrWebhookNotFound)
+}
+
+func (s *S) TestWebhookList(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", URL: "http://a.com", TeamOwner: s.team.Name, Headers: map[string]string{"Authorization": "Bearer abc"}})
+	c.Assert(err, check.IsNil)
+	err = webhook.Create(&webhook.Webhook{Name: "wh2", URL: "http://a.com", TeamOwner: "other"})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookRead,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("GET", "/events/webhooks", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var webhooks []webhook.Webhook
+	err = json.Unmarshal(recorder.Body.Bytes(), &webhooks)
+	c.Assert(err, check.IsNil)
+	c.Assert(webhooks, check.HasLen, 1)
+	c.Assert(webhooks[0].Name, check.Equals, "wh1")
+	c.Assert(webhooks[0].Secret, check.Equals, "")
+	c.Assert(webhooks[0].Headers, check.DeepEquals, map[string]string{"Authorization": "xxxxx"})
+}
+
+func (s *S) TestWebhookInfoNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/events/webhooks/wh1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestWebhookUpdate(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", URL: "http://a.com", TeamOwner: s.team.Name})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookUpdate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := strings.NewReader("url=http://b.com&teamowner=" + s.team.Name)
+	request, err := http.NewRequest("PUT", "/events/webhooks/wh1", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	wh, err := webhook.Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(wh.URL, check.Equals, "http://b.com")
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeWebhook, Value: "wh1"},
+		Owner:  token.GetUserName(),
+		Kind:   "webhook.update",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestWebhookUpdateMoveToOtherTeamWithoutPermission(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", URL: "http://a.com", TeamOwner: s.team.Name})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookUpdate,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	body := strings.NewReader("url=http://b.com&teamowner=other")
+	request, err := http.NewRequest("PUT", "/events/webhooks/wh1", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestWebhookDelete(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", URL: "http://a.com", TeamOwner: s.team.Name})
+	c.Assert(err, check.IsNil)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermWebhookDelete,
+		Context: permission.Context(permission.CtxTeam, s.team.Name),
+	})
+	request, err := http.NewRequest("DELETE", "/events/webhooks/wh1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = webhook.Find("wh1")
+	c.Assert(err, check.Equals, webhook.ErrWebhookNotFound)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeWebhook, Value: "wh1"},
+		Owner:  token.GetUserName(),
+		Kind:   "webhook.delete",
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestWebhookDeliveriesEmpty(c *check.C) {
+	err := webhook.Create(&webhook.Webhook{Name: "wh1", URL: "http://a.com"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/events/webhooks/wh1/deliveries", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/tsuru/tsuru/repository"
 	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/rebuild"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -89,6 +90,7 @@ var insertApp = action.Action{
 			return nil, err
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		app.Quota = quota.Unlimited
 		var limit int
 		if limit, err = config.GetInt("quota:units-per-app"); err == nil {
@@ -108,6 +110,7 @@ var insertApp = action.Action{
 			return
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		conn.Apps().Remove(bson.M{"name": app.Name})
 	},
 	MinParams: 1,
@@ -209,6 +212,13 @@ var createRepository = action.Action{
 	MinParams: 1,
 }
 
+// startRouterSpan starts the span tracing a call to the router of the app, as
+// part of the span of the action.
+func startRouterSpan(parent *tracing.Span, app *App, op string) *tracing.Span {
+	routerName, _ := app.GetRouterName()
+	return router.StartSpan(parent, routerName, op)
+}
+
 var addRouterBackend = action.Action{
 	Name: "add-router-backend",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
@@ -223,11 +233,13 @@ var addRouterBackend = action.Action{
 		if err != nil {
 			return nil, err
 		}
+		span := startRouterSpan(ctx.Span, app, "add backend")
 		if optsRouter, ok := r.(router.OptsRouter); ok {
 			err = optsRouter.AddBackendOpts(app.GetName(), app.GetRouterOpts())
 		} else {
 			err = r.AddBackend(app.GetName())
 		}
+		span.Finish(err)
 		return app, err
 	},
 	Backward: func(ctx action.BWContext) {
@@ -237,7 +249,9 @@ var addRouterBackend = action.Action{
 			log.Errorf("[add-router-backend rollback] unable to get app router: %s", err)
 			return
 		}
+		span := startRouterSpan(ctx.Span, app, "remove backend")
 		err = r.RemoveBackend(app.GetName())
+		span.Finish(err)
 		if err != nil {
 			log.Errorf("[add-router-backend rollback] unable to remove router backend: %s", err)
 		}
@@ -290,6 +304,7 @@ var setAppIp = action.Action{
 			return nil, err
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		r, err := app.GetRouter()
 		if err != nil {
 			return nil, err
@@ -312,6 +327,7 @@ var setAppIp = action.Action{
 			log.Errorf("Error trying to get connection to rollback setAppIp action: %s", err)
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$unset": bson.M{"ip": ""}})
 		if err != nil {
 			log.Errorf("Error trying to update app to rollback setAppIp action: %s", err)
@@ -344,10 +360,23 @@ var reserveUnitsToAdd = action.Action{
 			return nil, err
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		app, err = GetByName(app.Name)
 		if err != nil {
 			return nil, ErrAppNotFound
 		}
+		releaseQuota, err := auth.ReserveTeamQuota(app.TeamOwner, auth.TeamResources{
+			Units:  n,
+			Memory: app.Plan.Memory * int64(n),
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer releaseQuota()
+		err = app.checkPoolTeamQuota(n)
+		if err != nil {
+			return nil, err
+		}
 		err = reserveUnits(app, n)
 		if err != nil {
 			return nil, err
@@ -440,13 +469,16 @@ var moveRouterUnits = action.Action{
 				return
 			}
 			defer conn.Close()
+			conn.SetSpan(ctx.Span)
 			conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"ip": app.Ip}})
 			r, err := result.app.GetRouter()
 			if err != nil {
 				log.Errorf("BACKWARD move router units - failed to retrieve router: %s", err)
 				return
 			}
+			span := startRouterSpan(ctx.Span, result.app, "remove backend")
 			err = r.RemoveBackend(result.app.Name)
+			span.Finish(err)
 			if err != nil {
 				log.Errorf("BACKWARD move router units - failed to remove backend: %s", err)
 			}
@@ -466,6 +498,7 @@ var saveApp = action.Action{
 			return nil, err
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		update := bson.M{"$set": bson.M{"plan": result.app.Plan, "routername": result.app.Router}}
 		err = conn.Apps().Update(bson.M{"name": result.app.Name}, update)
 		if err != nil {
@@ -481,6 +514,7 @@ var saveApp = action.Action{
 			return
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		update := bson.M{"$set": bson.M{"plan": *result.oldPlan, "routername": result.oldRouter}}
 		err = conn.Apps().Update(bson.M{"name": result.app.Name}, update)
 		if err != nil {
@@ -522,7 +556,9 @@ var removeOldBackend = action.Action{
 				log.Errorf("[IGNORED ERROR] failed to remove old backend: %s", err)
 				return nil, nil
 			}
+			span := router.StartSpan(ctx.Span, result.oldRouter, "remove backend")
 			err = r.RemoveBackend(result.app.Name)
+			span.Finish(err)
 			if err != nil {
 				log.Errorf("[IGNORED ERROR] failed to remove old backend: %s", err)
 			}
@@ -572,7 +608,9 @@ var setNewCNamesToProvisioner = action.Action{
 		}
 		var cnamesDone []string
 		for _, cname := range cnames {
+			span := startRouterSpan(ctx.Span, app, "set cname")
 			err := cnameRouter.SetCName(cname, app.Name)
+			span.Finish(err)
 			if err != nil {
 				for _, c := range cnamesDone {
 					cnameRouter.UnsetCName(c, app.Name)
@@ -616,6 +654,7 @@ var saveCNames = action.Action{
 			return nil, err
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		var cnamesDone []string
 		for _, cname := range cnames {
 			err = conn.Apps().Update(
@@ -644,6 +683,7 @@ var saveCNames = action.Action{
 			return
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		for _, c := range cnames {
 			err := conn.Apps().Update(
 				bson.M{"name": app.Name},
@@ -702,7 +742,9 @@ var unsetCNameFromProvisioner = action.Action{
 		}
 		var cnamesDone []string
 		for _, cname := range cnames {
+			span := startRouterSpan(ctx.Span, app, "unset cname")
 			err := cnameRouter.UnsetCName(cname, app.Name)
+			span.Finish(err)
 			if err != nil {
 				for _, c := range cnamesDone {
 					cnameRouter.SetCName(c, app.Name)
@@ -746,6 +788,7 @@ var removeCNameFromDatabase = action.Action{
 			return nil, err
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		var cnamesDone []string
 		for _, cname := range cnames {
 			err = conn.Apps().Update(
@@ -774,6 +817,7 @@ var removeCNameFromDatabase = action.Action{
 			return
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		for _, c := range cnames {
 			err := conn.Apps().Update(
 				bson.M{"name": app.Name},
@@ -796,6 +840,7 @@ var removeCNameFromApp = action.Action{
 			return nil, err
 		}
 		defer conn.Close()
+		conn.SetSpan(ctx.Span)
 		return nil, conn.Apps().Find(bson.M{"name": app.Name}).One(app)
 	},
 }
@@ -0,0 +1,611 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/auth/native"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/leader"
+	"github.com/tsuru/tsuru/log"
+	tsuruNet "github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/validation"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultAlertsInterval  = time.Minute
+	defaultAlertsRetention = 24 * time.Hour
+
+	alertNotificationsQueueSize = 1000
+	alertNotificationsWorkers   = 4
+)
+
+// alertRuleNameRegexp restricts the names of alert rules, which are used in
+// the subject of notification emails.
+var alertRuleNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,39}$`)
+
+// AlertKind is the condition checked by an alert rule.
+type AlertKind string
+
+const (
+	// AlertUnitRestarts fires when the units of the app restarted more
+	// than threshold times in the window. A unit restarts when it reports
+	// the starting or started status after reporting the started or error
+	// status, unless the app is being restarted or deployed.
+	AlertUnitRestarts = AlertKind("unit-restarts")
+
+	// AlertNoStartedUnits fires when the app has units not stopped nor
+	// asleep, but none of them has been started for the window.
+	AlertNoStartedUnits = AlertKind("no-started-units")
+
+	// AlertHealthcheckFailures fires when healthchecks of units of the app
+	// failed more than threshold times in the window.
+	AlertHealthcheckFailures = AlertKind("healthcheck-failures")
+
+	// AlertErrorLogs fires when the app logged more than threshold entries
+	// with an error level in the window.
+	AlertErrorLogs = AlertKind("error-logs")
+)
+
+var (
+	ErrAlertRuleNotFound = errors.New("alert rule not found")
+
+	alertKinds     = []AlertKind{AlertUnitRestarts, AlertNoStartedUnits, AlertHealthcheckFailures, AlertErrorLogs}
+	errorLogLevels = []string{"error", "err", "critical", "crit", "fatal", "panic"}
+
+	alertsEvaluatorInstance *alertsEvaluator
+	alertNotifications      = &alertNotifier{}
+
+	// unitRestartKinds matches the kinds of the events restarting units on
+	// purpose, whose status changes aren't unit restarts.
+	unitRestartKinds = fmt.Sprintf(`^(%s|%s)(\.|$)`,
+		strings.Replace(permission.PermAppDeploy.FullName(), ".", `\.`, -1),
+		strings.Replace(permission.PermAppUpdateRestart.FullName(), ".", `\.`, -1),
+	)
+)
+
+// AlertRule describes a condition on the health of an app, and who is
+// notified when the condition starts or stops being met.
+type AlertRule struct {
+	App       string        `json:"app"`
+	Name      string        `json:"name"`
+	Kind      AlertKind     `json:"kind"`
+	Threshold int           `json:"threshold"`
+	Window    time.Duration `json:"window"`
+	Emails    []string      `json:"emails,omitempty" bson:",omitempty"`
+	Webhook   string        `json:"webhook,omitempty" bson:",omitempty"`
+	State     AlertState    `json:"state"`
+}
+
+// AlertState is the result of the last evaluation of an alert rule. Since is
+// the time when the rule started or stopped firing.
+type AlertState struct {
+	Firing      bool      `json:"firing"`
+	Value       int       `json:"value"`
+	Message     string    `json:"message,omitempty" bson:",omitempty"`
+	Since       time.Time `json:"since"`
+	EvaluatedAt time.Time `json:"evaluatedat"`
+
+	// PendingSince is when the app was first seen without started units,
+	// used by no-started-units rules.
+	PendingSince time.Time `json:"-" bson:",omitempty"`
+}
+
+func alertsSettings() (time.Duration, time.Duration) {
+	interval, _ := config.GetDuration("alerts:interval")
+	if interval <= 0 {
+		interval = defaultAlertsInterval
+	}
+	retention, _ := config.GetDuration("alerts:retention")
+	if retention <= 0 {
+		retention = defaultAlertsRetention
+	}
+	return interval, retention
+}
+
+func alertsEnabled() bool {
+	enabled, _ := config.GetBool("alerts:enabled")
+	return enabled
+}
+
+func (r *AlertRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("alert rule name is mandatory")
+	}
+	if !alertRuleNameRegexp.MatchString(r.Name) {
+		return errors.Errorf("invalid alert rule name %q, it must start with a letter or number and contain only letters, numbers, underscores, dashes and dots, up to 40 characters", r.Name)
+	}
+	validKind := false
+	for _, k := range alertKinds {
+		if r.Kind == k {
+			validKind = true
+			break
+		}
+	}
+	if !validKind {
+		return errors.Errorf("invalid alert kind %q, it must be one of %v", r.Kind, alertKinds)
+	}
+	if r.Threshold < 0 {
+		return errors.New("alert threshold must not be negative")
+	}
+	if r.Window < 0 || (r.Window == 0 && r.Kind != AlertNoStartedUnits) {
+		return errors.New("alert window must be greater than zero")
+	}
+	_, retention := alertsSettings()
+	if r.Window > retention {
+		return errors.Errorf("alert window must not be longer than the alerts retention %s", retention)
+	}
+	for _, email := range r.Emails {
+		if !validation.ValidateEmail(email) {
+			return errors.Errorf("invalid email %q", email)
+		}
+	}
+	if r.Webhook != "" {
+		u, err := url.Parse(r.Webhook)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.Errorf("invalid webhook %q, it must be an http or https url", r.Webhook)
+		}
+	}
+	return nil
+}
+
+// SetAlertRule stores the alert rule, replacing the rule with the same name
+// in the app and resetting its state.
+func SetAlertRule(r *AlertRule) error {
+	err := r.Validate()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r.State = AlertState{}
+	_, err = conn.AlertRules().Upsert(bson.M{"app": r.App, "name": r.Name}, r)
+	return err
+}
+
+// ListAlertRules returns the alert rules of the app, sorted by name.
+func ListAlertRules(appName string) ([]AlertRule, error) {
+	return listAlertRules(bson.M{"app": appName})
+}
+
+func listAlertRules(query bson.M) ([]AlertRule, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var rules []AlertRule
+	err = conn.AlertRules().Find(query).Sort("app", "name").All(&rules)
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// RemoveAlertRule removes the alert rule with the given name from the app.
+func RemoveAlertRule(appName, name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.AlertRules().Remove(bson.M{"app": appName, "name": name})
+	if err == mgo.ErrNotFound {
+		return ErrAlertRuleNotFound
+	}
+	return err
+}
+
+func removeAppAlerts(appName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.AlertRules().RemoveAll(bson.M{"app": appName})
+	if err != nil {
+		return err
+	}
+	_, err = conn.UnitStatusChanges().RemoveAll(bson.M{"app": appName})
+	return err
+}
+
+type unitStatusChange struct {
+	App     string
+	Unit    string
+	Process string
+	From    provision.Status
+	To      provision.Status
+	Restart bool
+	Date    time.Time
+}
+
+func isUnitRestart(from, to provision.Status) bool {
+	return (to == provision.StatusStarting || to == provision.StatusStarted) &&
+		(from == provision.StatusStarted || from == provision.StatusError)
+}
+
+// restartingUnits returns whether a deploy or a restart of the app is
+// running.
+func (app *App) restartingUnits() (bool, error) {
+	running := true
+	evts, err := event.List(&event.Filter{
+		Target:  event.Target{Type: event.TargetTypeApp, Value: app.Name},
+		Running: &running,
+		Raw:     bson.M{"kind.name": bson.M{"$regex": unitRestartKinds}},
+		Limit:   1,
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(evts) > 0, nil
+}
+
+// recordUnitStatusChange stores the status change of the unit, used by alert
+// rules, when alerts are enabled.
+func (app *App) recordUnitStatusChange(unit provision.Unit, status provision.Status) error {
+	if !alertsEnabled() || unit.Status == status {
+		return nil
+	}
+	restart := isUnitRestart(unit.Status, status)
+	if restart {
+		restarting, err := app.restartingUnits()
+		if err != nil {
+			return err
+		}
+		restart = !restarting
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.UnitStatusChanges().Insert(unitStatusChange{
+		App:     app.Name,
+		Unit:    unit.ID,
+		Process: unit.ProcessName,
+		From:    unit.Status,
+		To:      status,
+		Restart: restart,
+		Date:    time.Now().UTC(),
+	})
+}
+
+// EvaluateAlerts evaluates the alert rules of every app at the given time,
+// notifying about rules that started or stopped firing, and removing unit
+// status changes older than the retention. Evaluations are run by a single
+// API instance at a time, holding the lease of the evaluator.
+func EvaluateAlerts(at time.Time, retention time.Duration) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	rules, err := listAlertRules(nil)
+	if err != nil {
+		return err
+	}
+	var a *App
+	for i := range rules {
+		r := &rules[i]
+		if a == nil || a.Name != r.App {
+			a, err = GetByName(r.App)
+			if err != nil {
+				log.Errorf("[alerts] unable to get app %q: %s", r.App, err)
+				a = nil
+				continue
+			}
+		}
+		err = r.evaluate(a, at.UTC())
+		if err != nil {
+			log.Errorf("[alerts] unable to evaluate alert %q of app %q: %s", r.Name, r.App, err)
+		}
+	}
+	minDate := at.UTC().Add(-retention)
+	_, err = conn.UnitStatusChanges().RemoveAll(bson.M{"date": bson.M{"$lt": minDate}})
+	return err
+}
+
+func (r *AlertRule) evaluate(a *App, now time.Time) error {
+	state := r.State
+	value, firing, err := r.check(a, &state, now)
+	if err != nil {
+		return err
+	}
+	changed := firing != state.Firing
+	state.Firing = firing
+	state.Value = value
+	state.Message = r.message(value)
+	state.EvaluatedAt = now
+	if changed || state.Since.IsZero() {
+		state.Since = now
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.AlertRules().Update(bson.M{"app": r.App, "name": r.Name}, bson.M{"$set": bson.M{"state": state}})
+	if err != nil {
+		return err
+	}
+	r.State = state
+	if changed {
+		alertNotifications.enqueue(*r)
+	}
+	return nil
+}
+
+// check returns the value measured by the rule and whether the rule is
+// firing.
+func (r *AlertRule) check(a *App, state *AlertState, now time.Time) (int, bool, error) {
+	since := now.Add(-r.Window)
+	switch r.Kind {
+	case AlertUnitRestarts:
+		conn, err := db.Conn()
+		if err != nil {
+			return 0, false, err
+		}
+		defer conn.Close()
+		n, err := conn.UnitStatusChanges().Find(bson.M{
+			"app":     a.Name,
+			"restart": true,
+			"date":    bson.M{"$gte": since},
+		}).Count()
+		return n, n > r.Threshold, err
+	case AlertHealthcheckFailures, AlertErrorLogs:
+		query := bson.M{"date": bson.M{"$gte": since}}
+		if r.Kind == AlertHealthcheckFailures {
+			query["source"] = provision.HealthcheckLogSource
+		} else {
+			query["level"] = bson.M{"$in": errorLogLevels}
+		}
+		conn, err := db.LogConn()
+		if err != nil {
+			return 0, false, err
+		}
+		defer conn.Close()
+		n, err := conn.Logs(a.Name).Find(query).Count()
+		return n, n > r.Threshold, err
+	case AlertNoStartedUnits:
+		units, err := a.Units()
+		if err != nil {
+			return 0, false, err
+		}
+		var active, started int
+		for _, u := range units {
+			switch u.Status {
+			case provision.StatusStarted:
+				started++
+				active++
+			case provision.StatusStopped, provision.StatusAsleep:
+			default:
+				active++
+			}
+		}
+		if active == 0 || started > 0 {
+			state.PendingSince = time.Time{}
+			return started, false, nil
+		}
+		if state.PendingSince.IsZero() {
+			state.PendingSince = now
+		}
+		return started, now.Sub(state.PendingSince) >= r.Window, nil
+	}
+	return 0, false, errors.Errorf("invalid alert kind %q", r.Kind)
+}
+
+func (r *AlertRule) message(value int) string {
+	switch r.Kind {
+	case AlertUnitRestarts:
+		return fmt.Sprintf("%d unit restarts in the last %s", value, r.Window)
+	case AlertHealthcheckFailures:
+		return fmt.Sprintf("%d healthcheck failures in the last %s", value, r.Window)
+	case AlertErrorLogs:
+		return fmt.Sprintf("%d error logs in the last %s", value, r.Window)
+	case AlertNoStartedUnits:
+		if value == 0 {
+			return "no started units"
+		}
+		return fmt.Sprintf("%d started units", value)
+	}
+	return ""
+}
+
+// alertNotification is the body posted to the webhook of alert rules.
+type alertNotification struct {
+	App       string    `json:"app"`
+	Rule      string    `json:"rule"`
+	Kind      AlertKind `json:"kind"`
+	Firing    bool      `json:"firing"`
+	Value     int       `json:"value"`
+	Threshold int       `json:"threshold"`
+	Message   string    `json:"message"`
+	Date      time.Time `json:"date"`
+}
+
+// alertNotifier sends the notifications of alert rules in the background,
+// so slow recipients don't delay the evaluation of other rules. When the
+// queue is full, notifications are dropped.
+type alertNotifier struct {
+	once    sync.Once
+	queue   chan AlertRule
+	pending sync.WaitGroup
+}
+
+func (n *alertNotifier) enqueue(r AlertRule) {
+	n.once.Do(func() {
+		n.queue = make(chan AlertRule, alertNotificationsQueueSize)
+		for i := 0; i < alertNotificationsWorkers; i++ {
+			go n.run()
+		}
+	})
+	n.pending.Add(1)
+	select {
+	case n.queue <- r:
+	default:
+		n.pending.Done()
+		log.Errorf("[alerts] dropping notification of alert %q of app %q, queue is full", r.Name, r.App)
+	}
+}
+
+func (n *alertNotifier) run() {
+	for r := range n.queue {
+		r.notify()
+		n.pending.Done()
+	}
+}
+
+// wait blocks until the queued notifications are sent.
+func (n *alertNotifier) wait() {
+	n.pending.Wait()
+}
+
+func (r *AlertRule) notify() {
+	if r.Webhook != "" {
+		err := r.postWebhook()
+		if err != nil {
+			log.Errorf("[alerts] unable to notify alert %q of app %q to %s: %s", r.Name, r.App, r.Webhook, err)
+		}
+	}
+	for _, email := range r.Emails {
+		err := native.SendEmail(email, r.emailMessage(email))
+		if err != nil {
+			log.Errorf("[alerts] unable to notify alert %q of app %q to %s: %s", r.Name, r.App, email, err)
+		}
+	}
+}
+
+func (r *AlertRule) postWebhook() error {
+	data, err := json.Marshal(alertNotification{
+		App:       r.App,
+		Rule:      r.Name,
+		Kind:      r.Kind,
+		Firing:    r.State.Firing,
+		Value:     r.State.Value,
+		Threshold: r.Threshold,
+		Message:   r.State.Message,
+		Date:      r.State.Since,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", r.Webhook, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rsp, err := tsuruNet.Dial5Full60ClientNoKeepAlive.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return errors.Errorf("invalid response %d: %s", rsp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (r *AlertRule) emailMessage(email string) []byte {
+	status := "resolved"
+	if r.State.Firing {
+		status = "firing"
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Subject: [tsuru] Alert %s of app %s is %s\n", r.Name, r.App, status)
+	fmt.Fprintf(&buf, "To: %s\n\n", email)
+	fmt.Fprintf(&buf, "The alert %s (%s) of the app %s is %s since %s: %s.\n",
+		r.Name, r.Kind, r.App, status, r.State.Since.Format(time.RFC1123), r.State.Message)
+	return buf.Bytes()
+}
+
+type alertsEvaluator struct {
+	interval  time.Duration
+	retention time.Duration
+	lease     *leader.Lease
+	done      chan struct{}
+	finished  chan struct{}
+}
+
+// InitializeAlerts starts the background evaluator of alert rules, when
+// it's enabled.
+func InitializeAlerts() error {
+	if alertsEvaluatorInstance != nil {
+		return errors.New("alerts evaluator already initialized")
+	}
+	if !alertsEnabled() {
+		return nil
+	}
+	interval, retention := alertsSettings()
+	if retention < interval {
+		return errors.Errorf("invalid alerts:retention %s, it must not be shorter than the interval %s", retention, interval)
+	}
+	alertsEvaluatorInstance = &alertsEvaluator{
+		interval:  interval,
+		retention: retention,
+		lease:     leader.NewLease("alerts-evaluator", 3*interval),
+		done:      make(chan struct{}),
+		finished:  make(chan struct{}),
+	}
+	go alertsEvaluatorInstance.run()
+	shutdown.Register(alertsEvaluatorInstance)
+	return nil
+}
+
+func (e *alertsEvaluator) run() {
+	defer close(e.finished)
+	for {
+		now := time.Now().UTC()
+		isLeader, err := e.lease.Acquire()
+		if err != nil {
+			log.Errorf("[alerts] unable to acquire lease: %s", err)
+		} else if isLeader {
+			if err = EvaluateAlerts(now, e.retention); err != nil {
+				log.Errorf("[alerts] unable to evaluate alerts: %s", err)
+			}
+		}
+		next := now.Truncate(e.interval).Add(e.interval)
+		select {
+		case <-e.done:
+			return
+		case <-time.After(next.Sub(now)):
+		}
+	}
+}
+
+func (e *alertsEvaluator) Shutdown() {
+	close(e.done)
+	<-e.finished
+	if err := e.lease.Release(); err != nil {
+		log.Errorf("[alerts] unable to release lease: %s", err)
+	}
+	alertNotifications.wait()
+}
+
+func (e *alertsEvaluator) String() string {
+	return "alerts evaluator"
+}
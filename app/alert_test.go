@@ -0,0 +1,375 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth/authtest"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) createAlertApp(c *check.C, units int) *App {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	if units > 0 {
+		err = a.AddUnits(uint(units), "web", nil)
+		c.Assert(err, check.IsNil)
+	}
+	return &a
+}
+
+func (s *S) TestAlertRuleValidate(c *check.C) {
+	var tests = []struct {
+		rule AlertRule
+		err  string
+	}{
+		{AlertRule{Name: "r", Kind: AlertUnitRestarts, Threshold: 3, Window: 10 * time.Minute}, ""},
+		{AlertRule{Name: "r", Kind: AlertNoStartedUnits}, ""},
+		{AlertRule{Name: "r", Kind: AlertErrorLogs, Window: time.Minute, Emails: []string{"ops@example.com"}, Webhook: "https://example.com/hook"}, ""},
+		{AlertRule{Kind: AlertUnitRestarts, Window: time.Minute}, "alert rule name is mandatory"},
+		{AlertRule{Name: "down\r\nBcc: x@example.com", Kind: AlertUnitRestarts, Window: time.Minute}, `invalid alert rule name "down\\r\\nBcc: x@example.com", .*`},
+		{AlertRule{Name: "-r", Kind: AlertUnitRestarts, Window: time.Minute}, `invalid alert rule name "-r", .*`},
+		{AlertRule{Name: "r", Kind: "cpu", Window: time.Minute}, `invalid alert kind "cpu", it must be one of \[unit-restarts no-started-units healthcheck-failures error-logs\]`},
+		{AlertRule{Name: "r", Kind: AlertUnitRestarts, Threshold: -1, Window: time.Minute}, "alert threshold must not be negative"},
+		{AlertRule{Name: "r", Kind: AlertUnitRestarts}, "alert window must be greater than zero"},
+		{AlertRule{Name: "r", Kind: AlertUnitRestarts, Window: 48 * time.Hour}, "alert window must not be longer than the alerts retention 24h0m0s"},
+		{AlertRule{Name: "r", Kind: AlertUnitRestarts, Window: time.Minute, Emails: []string{"ops"}}, `invalid email "ops"`},
+		{AlertRule{Name: "r", Kind: AlertUnitRestarts, Window: time.Minute, Webhook: "ftp://example.com"}, `invalid webhook "ftp://example.com", it must be an http or https url`},
+	}
+	for i, tt := range tests {
+		err := tt.rule.Validate()
+		if tt.err == "" {
+			c.Check(err, check.IsNil, check.Commentf("test %d", i))
+		} else {
+			c.Check(err, check.ErrorMatches, tt.err, check.Commentf("test %d", i))
+		}
+	}
+}
+
+func (s *S) TestSetListRemoveAlertRule(c *check.C) {
+	rule := AlertRule{App: "myapp", Name: "restarts", Kind: AlertUnitRestarts, Threshold: 3, Window: 10 * time.Minute}
+	err := SetAlertRule(&rule)
+	c.Assert(err, check.IsNil)
+	err = SetAlertRule(&AlertRule{App: "myapp", Name: "errors", Kind: AlertErrorLogs, Window: time.Minute})
+	c.Assert(err, check.IsNil)
+	err = SetAlertRule(&AlertRule{App: "other", Name: "errors", Kind: AlertErrorLogs, Window: time.Minute})
+	c.Assert(err, check.IsNil)
+	rule.Threshold = 5
+	err = SetAlertRule(&rule)
+	c.Assert(err, check.IsNil)
+	rules, err := ListAlertRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 2)
+	c.Assert(rules[0].Name, check.Equals, "errors")
+	c.Assert(rules[1].Name, check.Equals, "restarts")
+	c.Assert(rules[1].Threshold, check.Equals, 5)
+	err = RemoveAlertRule("myapp", "restarts")
+	c.Assert(err, check.IsNil)
+	err = RemoveAlertRule("myapp", "restarts")
+	c.Assert(err, check.Equals, ErrAlertRuleNotFound)
+	rules, err = ListAlertRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 1)
+}
+
+func (s *S) TestSetAlertRuleInvalid(c *check.C) {
+	err := SetAlertRule(&AlertRule{App: "myapp", Name: "restarts", Kind: AlertUnitRestarts})
+	c.Assert(err, check.ErrorMatches, "alert window must be greater than zero")
+	rules, err := ListAlertRules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 0)
+}
+
+func (s *S) TestSetUnitStatusRecordsStatusChanges(c *check.C) {
+	config.Set("alerts:enabled", true)
+	defer config.Unset("alerts")
+	a := s.createAlertApp(c, 1)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	err = a.SetUnitStatus(units[0].ID, provision.StatusError)
+	c.Assert(err, check.IsNil)
+	err = a.SetUnitStatus(units[0].ID, provision.StatusError)
+	c.Assert(err, check.IsNil)
+	err = a.SetUnitStatus(units[0].ID, provision.StatusStarted)
+	c.Assert(err, check.IsNil)
+	var changes []unitStatusChange
+	err = s.conn.UnitStatusChanges().Find(bson.M{"app": "myapp"}).Sort("date").All(&changes)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.HasLen, 2)
+	c.Assert(changes[0].Unit, check.Equals, units[0].ID)
+	c.Assert(changes[0].Process, check.Equals, "web")
+	c.Assert(changes[0].From, check.Equals, provision.StatusStarted)
+	c.Assert(changes[0].To, check.Equals, provision.StatusError)
+	c.Assert(changes[0].Restart, check.Equals, false)
+	c.Assert(changes[1].From, check.Equals, provision.StatusError)
+	c.Assert(changes[1].To, check.Equals, provision.StatusStarted)
+	c.Assert(changes[1].Restart, check.Equals, true)
+}
+
+func (s *S) TestSetUnitStatusIgnoresRestartsDuringDeploy(c *check.C) {
+	config.Set("alerts:enabled", true)
+	defer config.Unset("alerts")
+	a := s.createAlertApp(c, 1)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:     permission.PermAppUpdateRestart,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+		Allowed:  event.Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = a.SetUnitStatus(units[0].ID, provision.StatusStarting)
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	err = a.SetUnitStatus(units[0].ID, provision.StatusError)
+	c.Assert(err, check.IsNil)
+	err = a.SetUnitStatus(units[0].ID, provision.StatusStarting)
+	c.Assert(err, check.IsNil)
+	var changes []unitStatusChange
+	err = s.conn.UnitStatusChanges().Find(bson.M{"app": "myapp"}).Sort("date").All(&changes)
+	c.Assert(err, check.IsNil)
+	c.Assert(changes, check.HasLen, 3)
+	c.Assert(changes[0].To, check.Equals, provision.StatusStarting)
+	c.Assert(changes[0].Restart, check.Equals, false)
+	c.Assert(changes[2].To, check.Equals, provision.StatusStarting)
+	c.Assert(changes[2].Restart, check.Equals, true)
+}
+
+func (s *S) TestSetUnitStatusAlertsDisabled(c *check.C) {
+	a := s.createAlertApp(c, 1)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	err = a.SetUnitStatus(units[0].ID, provision.StatusError)
+	c.Assert(err, check.IsNil)
+	n, err := s.conn.UnitStatusChanges().Find(nil).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+}
+
+func (s *S) TestIsUnitRestart(c *check.C) {
+	c.Assert(isUnitRestart(provision.StatusError, provision.StatusStarted), check.Equals, true)
+	c.Assert(isUnitRestart(provision.StatusStarted, provision.StatusStarting), check.Equals, true)
+	c.Assert(isUnitRestart(provision.StatusError, provision.StatusStarting), check.Equals, true)
+	c.Assert(isUnitRestart(provision.StatusStarting, provision.StatusStarted), check.Equals, false)
+	c.Assert(isUnitRestart(provision.StatusCreated, provision.StatusStarting), check.Equals, false)
+	c.Assert(isUnitRestart(provision.StatusStopped, provision.StatusStarted), check.Equals, false)
+	c.Assert(isUnitRestart(provision.StatusStarted, provision.StatusError), check.Equals, false)
+}
+
+func (s *S) TestEvaluateAlertsUnitRestarts(c *check.C) {
+	var mu sync.Mutex
+	var notifications []alertNotification
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n alertNotification
+		data, _ := ioutil.ReadAll(r.Body)
+		c.Check(json.Unmarshal(data, &n), check.IsNil)
+		mu.Lock()
+		notifications = append(notifications, n)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	a := s.createAlertApp(c, 1)
+	err := SetAlertRule(&AlertRule{App: a.Name, Name: "crashloop", Kind: AlertUnitRestarts, Threshold: 1, Window: 10 * time.Minute, Webhook: srv.URL})
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	err = s.conn.UnitStatusChanges().Insert(
+		unitStatusChange{App: a.Name, Unit: "u1", Restart: true, Date: now.Add(-20 * time.Minute)},
+		unitStatusChange{App: a.Name, Unit: "u1", Restart: true, Date: now.Add(-5 * time.Minute)},
+		unitStatusChange{App: a.Name, Unit: "u1", Restart: false, Date: now.Add(-4 * time.Minute)},
+		unitStatusChange{App: a.Name, Unit: "u1", Restart: true, Date: now.Add(-time.Minute)},
+		unitStatusChange{App: "other", Unit: "u2", Restart: true, Date: now.Add(-time.Minute)},
+	)
+	c.Assert(err, check.IsNil)
+	err = EvaluateAlerts(now, time.Hour)
+	c.Assert(err, check.IsNil)
+	rules, err := ListAlertRules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 1)
+	c.Assert(rules[0].State.Firing, check.Equals, true)
+	c.Assert(rules[0].State.Value, check.Equals, 2)
+	c.Assert(rules[0].State.Message, check.Equals, "2 unit restarts in the last 10m0s")
+	alertNotifications.wait()
+	mu.Lock()
+	c.Assert(notifications, check.HasLen, 1)
+	c.Assert(notifications[0].App, check.Equals, "myapp")
+	c.Assert(notifications[0].Rule, check.Equals, "crashloop")
+	c.Assert(notifications[0].Firing, check.Equals, true)
+	c.Assert(notifications[0].Value, check.Equals, 2)
+	mu.Unlock()
+	err = EvaluateAlerts(now.Add(time.Minute), time.Hour)
+	c.Assert(err, check.IsNil)
+	alertNotifications.wait()
+	mu.Lock()
+	c.Assert(notifications, check.HasLen, 1)
+	mu.Unlock()
+	err = EvaluateAlerts(now.Add(20*time.Minute), time.Hour)
+	c.Assert(err, check.IsNil)
+	alertNotifications.wait()
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(notifications, check.HasLen, 2)
+	c.Assert(notifications[1].Firing, check.Equals, false)
+	c.Assert(notifications[1].Value, check.Equals, 0)
+}
+
+func (s *S) TestEvaluateAlertsRemovesOldStatusChanges(c *check.C) {
+	now := time.Now().UTC()
+	err := s.conn.UnitStatusChanges().Insert(
+		unitStatusChange{App: "myapp", Unit: "u1", Restart: true, Date: now.Add(-2 * time.Hour)},
+		unitStatusChange{App: "myapp", Unit: "u1", Restart: true, Date: now.Add(-time.Minute)},
+	)
+	c.Assert(err, check.IsNil)
+	err = EvaluateAlerts(now, time.Hour)
+	c.Assert(err, check.IsNil)
+	n, err := s.conn.UnitStatusChanges().Find(nil).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+}
+
+func (s *S) TestEvaluateAlertsNoStartedUnits(c *check.C) {
+	a := s.createAlertApp(c, 2)
+	err := SetAlertRule(&AlertRule{App: a.Name, Name: "down", Kind: AlertNoStartedUnits, Window: 5 * time.Minute})
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	err = EvaluateAlerts(now, time.Hour)
+	c.Assert(err, check.IsNil)
+	rules, err := ListAlertRules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules[0].State.Firing, check.Equals, false)
+	c.Assert(rules[0].State.Message, check.Equals, "2 started units")
+	for _, u := range units {
+		err = a.SetUnitStatus(u.ID, provision.StatusError)
+		c.Assert(err, check.IsNil)
+	}
+	err = EvaluateAlerts(now.Add(time.Minute), time.Hour)
+	c.Assert(err, check.IsNil)
+	rules, err = ListAlertRules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules[0].State.Firing, check.Equals, false)
+	c.Assert(rules[0].State.Message, check.Equals, "no started units")
+	err = EvaluateAlerts(now.Add(6*time.Minute), time.Hour)
+	c.Assert(err, check.IsNil)
+	rules, err = ListAlertRules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules[0].State.Firing, check.Equals, true)
+	c.Assert(rules[0].State.Since.Unix(), check.Equals, now.Add(6*time.Minute).Unix())
+}
+
+func (s *S) TestEvaluateAlertsNoStartedUnitsStoppedApp(c *check.C) {
+	a := s.createAlertApp(c, 1)
+	err := SetAlertRule(&AlertRule{App: a.Name, Name: "down", Kind: AlertNoStartedUnits})
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	err = a.SetUnitStatus(units[0].ID, provision.StatusStopped)
+	c.Assert(err, check.IsNil)
+	err = EvaluateAlerts(time.Now(), time.Hour)
+	c.Assert(err, check.IsNil)
+	rules, err := ListAlertRules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules[0].State.Firing, check.Equals, false)
+}
+
+func (s *S) TestEvaluateAlertsLogs(c *check.C) {
+	a := s.createAlertApp(c, 0)
+	err := SetAlertRule(&AlertRule{App: a.Name, Name: "errors", Kind: AlertErrorLogs, Threshold: 1, Window: 10 * time.Minute})
+	c.Assert(err, check.IsNil)
+	err = SetAlertRule(&AlertRule{App: a.Name, Name: "hc", Kind: AlertHealthcheckFailures, Window: 10 * time.Minute})
+	c.Assert(err, check.IsNil)
+	err = a.Log(`{"level": "error", "msg": "boom"}`, "app", "u1")
+	c.Assert(err, check.IsNil)
+	err = a.Log(`{"level": "info", "msg": "ok"}`, "app", "u1")
+	c.Assert(err, check.IsNil)
+	err = a.Log(`{"level": "fatal", "msg": "boom"}`, "app", "u1")
+	c.Assert(err, check.IsNil)
+	err = a.Log("healthcheck fail(u1): wrong status code, expected 200, got: 500", provision.HealthcheckLogSource, "u1")
+	c.Assert(err, check.IsNil)
+	err = EvaluateAlerts(time.Now(), time.Hour)
+	c.Assert(err, check.IsNil)
+	rules, err := ListAlertRules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 2)
+	c.Assert(rules[0].Name, check.Equals, "errors")
+	c.Assert(rules[0].State.Firing, check.Equals, true)
+	c.Assert(rules[0].State.Value, check.Equals, 2)
+	c.Assert(rules[1].Name, check.Equals, "hc")
+	c.Assert(rules[1].State.Firing, check.Equals, true)
+	c.Assert(rules[1].State.Value, check.Equals, 1)
+	c.Assert(rules[1].State.Message, check.Equals, "1 healthcheck failures in the last 10m0s")
+}
+
+func (s *S) TestEvaluateAlertsEmail(c *check.C) {
+	server, err := authtest.NewSMTPServer()
+	c.Assert(err, check.IsNil)
+	defer server.Stop()
+	config.Set("smtp:server", server.Addr())
+	config.Set("smtp:user", "tsuru@example.com")
+	defer config.Unset("smtp")
+	a := s.createAlertApp(c, 0)
+	err = SetAlertRule(&AlertRule{App: a.Name, Name: "errors", Kind: AlertErrorLogs, Window: 10 * time.Minute, Emails: []string{"ops@example.com"}})
+	c.Assert(err, check.IsNil)
+	err = a.Log(`{"level": "error", "msg": "boom"}`, "app", "u1")
+	c.Assert(err, check.IsNil)
+	err = EvaluateAlerts(time.Now(), time.Hour)
+	c.Assert(err, check.IsNil)
+	alertNotifications.wait()
+	server.RLock()
+	defer server.RUnlock()
+	c.Assert(server.MailBox, check.HasLen, 1)
+	c.Assert(server.MailBox[0].To, check.DeepEquals, []string{"ops@example.com"})
+	data := string(server.MailBox[0].Data)
+	c.Assert(strings.Contains(data, "Subject: [tsuru] Alert errors of app myapp is firing"), check.Equals, true)
+	c.Assert(strings.Contains(data, "1 error logs in the last 10m0s"), check.Equals, true)
+}
+
+func (s *S) TestDeleteRemovesAlerts(c *check.C) {
+	a := s.createAlertApp(c, 0)
+	err := SetAlertRule(&AlertRule{App: a.Name, Name: "errors", Kind: AlertErrorLogs, Window: time.Minute})
+	c.Assert(err, check.IsNil)
+	err = s.conn.UnitStatusChanges().Insert(unitStatusChange{App: a.Name, Unit: "u1", Date: time.Now()})
+	c.Assert(err, check.IsNil)
+	err = Delete(a, nil)
+	c.Assert(err, check.IsNil)
+	rules, err := ListAlertRules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.HasLen, 0)
+	n, err := s.conn.UnitStatusChanges().Find(nil).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+}
+
+func (s *S) TestInitializeAlertsDisabled(c *check.C) {
+	err := InitializeAlerts()
+	c.Assert(err, check.IsNil)
+	c.Assert(alertsEvaluatorInstance, check.IsNil)
+}
+
+func (s *S) TestInitializeAlertsInvalidRetention(c *check.C) {
+	config.Set("alerts:enabled", true)
+	config.Set("alerts:interval", "1h")
+	config.Set("alerts:retention", "10m")
+	defer config.Unset("alerts")
+	err := InitializeAlerts()
+	c.Assert(err, check.ErrorMatches, `invalid alerts:retention 10m0s, it must not be shorter than the interval 1h0m0s`)
+	c.Assert(alertsEvaluatorInstance, check.IsNil)
+}
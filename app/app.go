@@ -32,6 +32,7 @@ import (
 	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/rebuild"
 	"github.com/tsuru/tsuru/service"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -126,9 +127,26 @@ type App struct {
 	Router         string
 	RouterOpts     map[string]string
 	Deploys        uint
+	LogRetention   LogRetention `bson:",omitempty"`
 
 	quota.Quota
 	provisioner provision.Provisioner
+	span        *tracing.Span
+}
+
+// SetSpan sets the span of the operation handling the app, like an API
+// request. Pipelines run for the app are traced as its children.
+func (app *App) SetSpan(span *tracing.Span) {
+	app.span = span
+}
+
+// TracingSpan returns the span set by SetSpan, it's nil when the app isn't
+// handled in a traced operation.
+func (app *App) TracingSpan() *tracing.Span {
+	if app == nil {
+		return nil
+	}
+	return app.span
 }
 
 func (app *App) getProvisioner() (provision.Provisioner, error) {
@@ -190,16 +208,22 @@ func (app *App) MarshalJSON() ([]byte, error) {
 	}
 	result["router"] = app.Router
 	result["lock"] = app.Lock
+	if app.LogRetention != (LogRetention{}) {
+		result["logretention"] = app.LogRetention
+	}
 	return json.Marshal(&result)
 }
 
 // Applog represents a log entry.
 type Applog struct {
-	Date    time.Time
-	Message string
-	Source  string
-	AppName string
-	Unit    string
+	Date      time.Time
+	Message   string
+	Source    string
+	AppName   string
+	Unit      string
+	Level     string            `json:",omitempty" bson:",omitempty"`
+	RequestID string            `json:",omitempty" bson:",omitempty"`
+	Fields    map[string]string `json:",omitempty" bson:",omitempty"`
 }
 
 // AcquireApplicationLock acquires an application lock by setting the lock
@@ -301,6 +325,11 @@ func CreateApp(app *App, user *auth.User) error {
 	if err != nil {
 		return err
 	}
+	releaseQuota, err := auth.ReserveTeamQuota(app.TeamOwner, auth.TeamResources{Apps: 1})
+	if err != nil {
+		return err
+	}
+	defer releaseQuota()
 	app.Plan = *plan
 	err = app.SetPool()
 	if err != nil {
@@ -326,6 +355,12 @@ func CreateApp(app *App, user *auth.User) error {
 	if err != nil {
 		return &AppCreationError{app: app.Name, Err: err}
 	}
+	if app.Plan.LogRetention.MaxBytes > 0 {
+		err = app.applyLogRetention()
+		if err != nil {
+			log.Errorf("[app %s] unable to apply log retention: %s", app.Name, err)
+		}
+	}
 	return nil
 }
 
@@ -362,6 +397,25 @@ func (app *App) Update(updateData App, w io.Writer) error {
 		}
 		app.Plan = *plan
 	}
+	if teamOwner != "" && teamOwner != app.TeamOwner {
+		releaseQuota, err := auth.ReserveTeamQuota(teamOwner, auth.TeamResources{
+			Apps:   1,
+			Units:  app.InUse,
+			Memory: app.Plan.Memory * int64(app.InUse),
+		})
+		if err != nil {
+			return err
+		}
+		defer releaseQuota()
+	} else if app.Plan.Memory > oldPlan.Memory {
+		releaseQuota, err := auth.ReserveTeamQuota(app.TeamOwner, auth.TeamResources{
+			Memory: (app.Plan.Memory - oldPlan.Memory) * int64(app.InUse),
+		})
+		if err != nil {
+			return err
+		}
+		defer releaseQuota()
+	}
 	if app.Router != oldRouter || app.Plan != oldPlan {
 		actions := []*action.Action{
 			&moveRouterUnits,
@@ -391,7 +445,17 @@ func (app *App) Update(updateData App, w io.Writer) error {
 		return err
 	}
 	defer conn.Close()
-	return conn.Apps().Update(bson.M{"name": app.Name}, app)
+	err = conn.Apps().Update(bson.M{"name": app.Name}, app)
+	if err != nil {
+		return err
+	}
+	if app.LogRetention.MaxBytes == 0 && app.Plan.LogRetention.MaxBytes != oldPlan.LogRetention.MaxBytes {
+		err = app.applyLogRetention()
+		if err != nil {
+			log.Errorf("[app %s] unable to apply log retention: %s", app.Name, err)
+		}
+	}
+	return nil
 }
 
 // unbind takes all service instances that are bound to the app, and unbind
@@ -496,6 +560,18 @@ func Delete(app *App, w io.Writer) error {
 	if err != nil {
 		logErr("Unable to remove logs collection", err)
 	}
+	err = removeAppLogSinks(appName)
+	if err != nil {
+		logErr("Unable to remove log sinks", err)
+	}
+	err = removeAppUnitMetrics(appName)
+	if err != nil {
+		logErr("Unable to remove unit metrics", err)
+	}
+	err = removeAppAlerts(appName)
+	if err != nil {
+		logErr("Unable to remove alerts", err)
+	}
 	conn, err := db.Conn()
 	if err == nil {
 		defer conn.Close()
@@ -630,7 +706,15 @@ func (app *App) SetUnitStatus(unitName string, status provision.Status) error {
 			if !ok {
 				return nil
 			}
-			return unitProv.SetUnitStatus(unit, status)
+			err = unitProv.SetUnitStatus(unit, status)
+			if err != nil {
+				return err
+			}
+			err = app.recordUnitStatusChange(unit, status)
+			if err != nil {
+				log.Errorf("[alerts] unable to record status change of unit %s: %s", unit.ID, err)
+			}
+			return nil
 		}
 	}
 	return &provision.UnitNotFoundError{ID: unitName}
@@ -810,6 +894,22 @@ func (app *App) GetTeams() []auth.Team {
 	return teams
 }
 
+// checkPoolTeamQuota checks whether the team owning the app may add units to
+// the pool of the app.
+func (app *App) checkPoolTeamQuota(units int) error {
+	pool, err := provision.GetPoolByName(app.Pool)
+	if err == provision.ErrPoolNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return pool.CheckTeamQuota(app.TeamOwner, provision.PoolResources{
+		Units:  units,
+		Memory: app.Plan.Memory * int64(units),
+	})
+}
+
 func (app *App) validateTeamOwner() error {
 	_, err := auth.GetTeam(app.TeamOwner)
 	return err
@@ -1450,6 +1550,8 @@ func (app *App) Log(message, source, unit string) error {
 				AppName: app.Name,
 				Unit:    unit,
 			}
+			l.parseStructured()
+			logSinks.forward(&l)
 			logs = append(logs, l)
 		}
 	}
@@ -1468,6 +1570,18 @@ func (app *App) Log(message, source, unit string) error {
 // LastLogs returns a list of the last `lines` log of the app, matching the
 // fields in the log instance received as an example.
 func (app *App) LastLogs(lines int, filterLog Applog) ([]Applog, error) {
+	return app.SearchLogs(LogFilter{
+		Lines:     lines,
+		Source:    filterLog.Source,
+		Unit:      filterLog.Unit,
+		Level:     filterLog.Level,
+		RequestID: filterLog.RequestID,
+	})
+}
+
+// SearchLogs returns the logs of the app matching the filter, sorted by date,
+// up to the last `filter.Lines` logs.
+func (app *App) SearchLogs(filter LogFilter) ([]Applog, error) {
 	prov, err := app.getProvisioner()
 	if err != nil {
 		return nil, err
@@ -1484,20 +1598,45 @@ func (app *App) LastLogs(lines int, filterLog Applog) ([]Applog, error) {
 			return nil, errors.New(doc)
 		}
 	}
+	if since := app.logVisibleSince(); filter.Since.Before(since) {
+		filter.Since = since
+	}
+	q, err := filter.query()
+	if err != nil {
+		return nil, err
+	}
 	conn, err := db.LogConn()
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
 	logs := []Applog{}
-	q := bson.M{}
-	if filterLog.Source != "" {
-		q["source"] = filterLog.Source
-	}
-	if filterLog.Unit != "" {
-		q["unit"] = filterLog.Unit
+	sort := "-$natural"
+	if !filter.Since.IsZero() || !filter.Until.IsZero() {
+		sort = "-date"
+	}
+	limit := filter.limit()
+	query := conn.Logs(app.Name).Find(q).Sort(sort)
+	if filter.grepRE == nil {
+		err = query.Limit(limit).All(&logs)
+	} else {
+		iter := query.Limit(maxGrepScannedLogs).Iter()
+		var l Applog
+		var scanned int
+		var scannedUntil time.Time
+		for len(logs) < limit && iter.Next(&l) {
+			scanned++
+			scannedUntil = l.Date
+			if filter.grepRE.MatchString(l.Message) {
+				logs = append(logs, l)
+			}
+			l = Applog{}
+		}
+		err = iter.Close()
+		if err == nil && scanned == maxGrepScannedLogs && len(logs) < limit {
+			logs = append(logs, app.grepTruncatedNotice(scannedUntil))
+		}
 	}
-	err = conn.Logs(app.Name).Find(q).Sort("-$natural").Limit(lines).All(&logs)
 	if err != nil {
 		return nil, err
 	}
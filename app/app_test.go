@@ -294,6 +294,16 @@ func (s *S) TestCreateAppUserQuotaExceeded(c *check.C) {
 	c.Assert(ok, check.Equals, true)
 }
 
+func (s *S) TestCreateAppTeamQuotaExceeded(c *check.C) {
+	err := auth.ChangeTeamQuota(&s.team, auth.TeamResources{Apps: 0, Units: -1, Memory: -1, ServiceInstances: -1})
+	c.Assert(err, check.IsNil)
+	app := App{Name: "america", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&app, s.user)
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: "apps of team tsuruteam", Available: 0, Requested: 1})
+	_, err = GetByName(app.Name)
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
 func (s *S) TestCreateAppTeamOwner(c *check.C) {
 	app := App{Name: "america", Platform: "python", TeamOwner: "tsuruteam"}
 	err := CreateApp(&app, s.user)
@@ -566,6 +576,43 @@ func (s *S) TestAddUnitsQuotaExceeded(c *check.C) {
 	c.Assert(units, check.HasLen, 0)
 }
 
+func (s *S) TestAddUnitsTeamQuotaExceeded(c *check.C) {
+	app := App{
+		Name: "warpaint", Platform: "python",
+		TeamOwner: s.team.Name,
+	}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	err = auth.ChangeTeamQuota(&s.team, auth.TeamResources{Apps: -1, Units: -1, Memory: 2048, ServiceInstances: -1})
+	c.Assert(err, check.IsNil)
+	err = app.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = app.AddUnits(1, "web", nil)
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: "memory of team tsuruteam", Available: 0, Requested: 1024})
+	units := s.provisioner.GetUnits(&app)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestAddUnitsPoolTeamQuotaExceeded(c *check.C) {
+	app := App{
+		Name: "warpaint", Platform: "python",
+		TeamOwner: s.team.Name,
+	}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	err = provision.SetPoolTeamQuota(app.Pool, provision.PoolTeamQuota{
+		Team:  s.team.Name,
+		Limit: provision.PoolResources{Units: 2, Memory: -1},
+	})
+	c.Assert(err, check.IsNil)
+	err = app.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = app.AddUnits(1, "web", nil)
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: "units of team tsuruteam in pool pool1", Available: 0, Requested: 1})
+	units := s.provisioner.GetUnits(&app)
+	c.Assert(units, check.HasLen, 2)
+}
+
 func (s *S) TestAddUnitsMultiple(c *check.C) {
 	app := App{
 		Name: "warpaint", Platform: "ruby",
@@ -2395,6 +2442,79 @@ func (s *S) TestLastLogsEmpty(c *check.C) {
 	c.Assert(logs, check.DeepEquals, []Applog{})
 }
 
+func (s *S) TestSearchLogs(c *check.C) {
+	app := App{
+		Name:      "app3",
+		Platform:  "vougan",
+		TeamOwner: s.team.Name,
+	}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	app.Log(`{"level": "error", "msg": "db timeout", "request_id": "r1", "path": "/users"}`, "app", "rdaneel")
+	app.Log(`{"level": "error", "msg": "cache timeout", "request_id": "r2", "path": "/teams"}`, "app", "rdaneel")
+	app.Log(`{"level": "info", "msg": "db ok", "request_id": "r3", "path": "/users"}`, "app", "rdaneel")
+	app.Log("db plain", "tsuru", "rdaneel")
+	logs, err := app.SearchLogs(LogFilter{Lines: 10, Level: "error"})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Message, check.Equals, "db timeout")
+	c.Assert(logs[1].Message, check.Equals, "cache timeout")
+	logs, err = app.SearchLogs(LogFilter{Lines: 10, Fields: map[string]string{"path": "/users"}, Grep: "^db"})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].RequestID, check.Equals, "r1")
+	c.Assert(logs[1].RequestID, check.Equals, "r3")
+	logs, err = app.SearchLogs(LogFilter{Lines: 1, Grep: "timeout$"})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "cache timeout")
+	logs, err = app.SearchLogs(LogFilter{Lines: 10, Since: time.Now().Add(time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 0)
+	logs, err = app.SearchLogs(LogFilter{Since: time.Now().Add(-time.Hour), Source: "tsuru"})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "db plain")
+}
+
+func (s *S) TestSearchLogsGrepScanLimit(c *check.C) {
+	old := maxGrepScannedLogs
+	maxGrepScannedLogs = 2
+	defer func() { maxGrepScannedLogs = old }()
+	app := App{
+		Name:      "app3",
+		Platform:  "vougan",
+		TeamOwner: s.team.Name,
+	}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	app.Log("db timeout", "app", "rdaneel")
+	app.Log("cache timeout", "app", "rdaneel")
+	app.Log("db ok", "app", "rdaneel")
+	logs, err := app.SearchLogs(LogFilter{Lines: 10, Grep: "timeout"})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	c.Assert(logs[0].Source, check.Equals, "tsuru")
+	c.Assert(logs[0].Message, check.Matches, "logs before .* were not searched, grep stops after scanning 2 logs, .*")
+	c.Assert(logs[1].Message, check.Equals, "cache timeout")
+	logs, err = app.SearchLogs(LogFilter{Lines: 1, Grep: "timeout"})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "cache timeout")
+}
+
+func (s *S) TestSearchLogsInvalidGrep(c *check.C) {
+	app := App{
+		Name:      "app3",
+		Platform:  "vougan",
+		TeamOwner: s.team.Name,
+	}
+	err := CreateApp(&app, s.user)
+	c.Assert(err, check.IsNil)
+	_, err = app.SearchLogs(LogFilter{Lines: 10, Grep: "(db"})
+	c.Assert(err, check.ErrorMatches, `invalid grep pattern "\(db": .*`)
+}
+
 type logDisabledFakeProvisioner struct {
 	provisiontest.FakeProvisioner
 }
@@ -3944,6 +4064,25 @@ func (s *S) TestUpdatePlan(c *check.C) {
 	c.Assert(s.provisioner.Restarts(dbApp, ""), check.Equals, 1)
 }
 
+func (s *S) TestUpdatePlanTeamQuotaExceeded(c *check.C) {
+	plan := Plan{Name: "something", CpuShare: 100, Memory: 2048}
+	err := s.conn.Plans().Insert(plan)
+	c.Assert(err, check.IsNil)
+	a := App{Name: "my-test-app", Router: "fake", TeamOwner: s.team.Name}
+	err = CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = auth.ChangeTeamQuota(&s.team, auth.TeamResources{Apps: -1, Units: -1, Memory: 3072, ServiceInstances: -1})
+	c.Assert(err, check.IsNil)
+	updateData := App{Name: "my-test-app", Plan: Plan{Name: "something"}}
+	err = a.Update(updateData, new(bytes.Buffer))
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: "memory of team tsuruteam", Available: 1024, Requested: 2048})
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Plan, check.DeepEquals, s.defaultPlan)
+}
+
 func (s *S) TestUpdatePlanNoRouteChange(c *check.C) {
 	plan := Plan{Name: "something", CpuShare: 100, Memory: 268435456}
 	err := s.conn.Plans().Insert(plan)
@@ -6,6 +6,8 @@ package app
 
 import (
 	"encoding/json"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -13,6 +15,7 @@ import (
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/mgo.v2/bson"
 )
 
 var (
@@ -20,6 +23,10 @@ var (
 
 	bulkMaxWaitTime = time.Second
 
+	logLevelKeys     = []string{"level", "lvl", "severity"}
+	logRequestIDKeys = []string{"request_id", "requestId", "request-id", "requestid"}
+	logMessageKeys   = []string{"msg", "message"}
+
 	dispatchersCurrent = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "tsuru_logs_dispatchers_current",
 		Help: "The current number of log dispatchers running.",
@@ -54,6 +61,194 @@ func init() {
 	prometheus.MustRegister(logsQueueBlockedTotal)
 }
 
+// maxLogLines is the number of logs returned by SearchLogs when the filter
+// doesn't limit the number of lines.
+const maxLogLines = 10000
+
+// maxGrepScannedLogs is the number of logs scanned by SearchLogs matching the
+// grep pattern of the filter, as logs are matched in the API server.
+var maxGrepScannedLogs = 100000
+
+// LogFilter describes the logs returned by SearchLogs and sent to log
+// listeners. Fields are matched against the fields extracted from structured
+// log messages and Grep is a regular expression matched against the message.
+type LogFilter struct {
+	Lines     int
+	Source    string
+	Unit      string
+	Level     string
+	RequestID string
+	Fields    map[string]string
+	Grep      string
+	Since     time.Time
+	Until     time.Time
+	grepRE    *regexp.Regexp
+}
+
+// SetField sets the filter for a field, where the level, request_id, source
+// and unit keys filter the log attributes with the same name and any other
+// key filters the fields extracted from structured log messages.
+func (f *LogFilter) SetField(key, value string) {
+	switch key {
+	case "source":
+		f.Source = value
+	case "unit":
+		f.Unit = value
+	case "level":
+		f.Level = strings.ToLower(value)
+	case "request_id":
+		f.RequestID = value
+	default:
+		if f.Fields == nil {
+			f.Fields = make(map[string]string)
+		}
+		f.Fields[logFieldKey(key)] = value
+	}
+}
+
+func (f *LogFilter) compile() error {
+	if f.Grep == "" || f.grepRE != nil {
+		return nil
+	}
+	re, err := regexp.Compile(f.Grep)
+	if err != nil {
+		return errors.Errorf("invalid grep pattern %q: %s", f.Grep, err)
+	}
+	f.grepRE = re
+	return nil
+}
+
+// Validate returns an error if the grep pattern of the filter is not a valid
+// regular expression.
+func (f *LogFilter) Validate() error {
+	return f.compile()
+}
+
+func (f *LogFilter) limit() int {
+	if f.Lines <= 0 {
+		return maxLogLines
+	}
+	return f.Lines
+}
+
+func (f *LogFilter) query() (bson.M, error) {
+	err := f.compile()
+	if err != nil {
+		return nil, err
+	}
+	q := bson.M{}
+	if f.Source != "" {
+		q["source"] = f.Source
+	}
+	if f.Unit != "" {
+		q["unit"] = f.Unit
+	}
+	if f.Level != "" {
+		q["level"] = f.Level
+	}
+	if f.RequestID != "" {
+		q["requestid"] = f.RequestID
+	}
+	for k, v := range f.Fields {
+		q["fields."+k] = v
+	}
+	date := bson.M{}
+	if !f.Since.IsZero() {
+		date["$gte"] = f.Since
+	}
+	if !f.Until.IsZero() {
+		date["$lte"] = f.Until
+	}
+	if len(date) > 0 {
+		q["date"] = date
+	}
+	return q, nil
+}
+
+func (f *LogFilter) matches(l *Applog) bool {
+	if (f.Source != "" && f.Source != l.Source) ||
+		(f.Unit != "" && f.Unit != l.Unit) ||
+		(f.Level != "" && f.Level != l.Level) ||
+		(f.RequestID != "" && f.RequestID != l.RequestID) {
+		return false
+	}
+	for k, v := range f.Fields {
+		if l.Fields[k] != v {
+			return false
+		}
+	}
+	if f.grepRE != nil && !f.grepRE.MatchString(l.Message) {
+		return false
+	}
+	if (!f.Since.IsZero() && l.Date.Before(f.Since)) || (!f.Until.IsZero() && l.Date.After(f.Until)) {
+		return false
+	}
+	return true
+}
+
+// logFieldKey returns the key used to store a field extracted from a
+// structured log message, as MongoDB doesn't accept keys with dots or
+// starting with $.
+func logFieldKey(key string) string {
+	key = strings.Replace(key, ".", "_", -1)
+	if strings.HasPrefix(key, "$") {
+		key = "_" + key[1:]
+	}
+	return key
+}
+
+func popLogField(fields map[string]string, keys []string) (string, bool) {
+	for _, k := range keys {
+		if v, ok := fields[k]; ok {
+			delete(fields, k)
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// parseStructured extracts the level, the request id and other fields from
+// log messages in JSON format, like {"level": "error", "msg": "failed"},
+// replacing the message with the value in the msg or message keys.
+func (l *Applog) parseStructured() {
+	if l.Level != "" || l.RequestID != "" || l.Fields != nil {
+		return
+	}
+	msg := strings.TrimSpace(l.Message)
+	if !strings.HasPrefix(msg, "{") || !strings.HasSuffix(msg, "}") {
+		return
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(msg), &data); err != nil {
+		return
+	}
+	fields := make(map[string]string, len(data))
+	for k, v := range data {
+		var value string
+		switch v := v.(type) {
+		case string:
+			value = v
+		case nil:
+		default:
+			b, _ := json.Marshal(v)
+			value = string(b)
+		}
+		fields[logFieldKey(k)] = value
+	}
+	if v, ok := popLogField(fields, logLevelKeys); ok {
+		l.Level = strings.ToLower(v)
+	}
+	if v, ok := popLogField(fields, logRequestIDKeys); ok {
+		l.RequestID = v
+	}
+	if v, ok := popLogField(fields, logMessageKeys); ok {
+		l.Message = v
+	}
+	if len(fields) > 0 {
+		l.Fields = fields
+	}
+}
+
 type LogListener struct {
 	c <-chan Applog
 	q queue.PubSubQ
@@ -64,6 +259,22 @@ func logQueueName(appName string) string {
 }
 
 func NewLogListener(a *App, filterLog Applog) (*LogListener, error) {
+	return NewLogListenerFilter(a, LogFilter{
+		Source:    filterLog.Source,
+		Unit:      filterLog.Unit,
+		Level:     filterLog.Level,
+		RequestID: filterLog.RequestID,
+	})
+}
+
+// NewLogListenerFilter returns a listener for new logs of the app matching
+// the filter. Lines and Since are ignored.
+func NewLogListenerFilter(a *App, filter LogFilter) (*LogListener, error) {
+	err := filter.compile()
+	if err != nil {
+		return nil, err
+	}
+	filter.Since = time.Time{}
 	factory, err := queue.Factory()
 	if err != nil {
 		return nil, err
@@ -86,8 +297,7 @@ func NewLogListener(a *App, filterLog Applog) (*LogListener, error) {
 				log.Errorf("Unparsable log message, ignoring: %s", string(msg))
 				continue
 			}
-			if (filterLog.Source == "" || filterLog.Source == applog.Source) &&
-				(filterLog.Unit == "" || filterLog.Unit == applog.Unit) {
+			if filter.matches(&applog) {
 				c <- applog
 			}
 		}
@@ -163,6 +373,7 @@ func (d *logDispatcher) runWriter() {
 		logsInQueue.Dec()
 		notifyMessages[0] = msgWithDispatcher.msg
 		notify(msgWithDispatcher.msg.AppName, notifyMessages)
+		logSinks.forward(msgWithDispatcher.msg)
 		select {
 		case msgWithDispatcher.dispatcher.toFlush <- msgWithDispatcher.msg:
 		case <-msgWithDispatcher.dispatcher.done:
@@ -172,6 +383,17 @@ func (d *logDispatcher) runWriter() {
 }
 
 func (d *logDispatcher) Send(msg *Applog) {
+	ok, notice := logThrottle.allow(msg.AppName, time.Now())
+	if notice != nil {
+		d.send(notice)
+	}
+	if ok {
+		d.send(msg)
+	}
+}
+
+func (d *logDispatcher) send(msg *Applog) {
+	msg.parseStructured()
 	logsInQueue.Inc()
 	appName := msg.AppName
 	appD, ok := d.dispatchers[appName]
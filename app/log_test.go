@@ -178,6 +178,101 @@ func (s *S) TestNotifySendOnClosedChannel(c *check.C) {
 	notify(app.Name, ms)
 }
 
+func (s *S) TestApplogParseStructured(c *check.C) {
+	tests := []struct {
+		msg      string
+		expected Applog
+	}{
+		{"plain message", Applog{Message: "plain message"}},
+		{"{not json}", Applog{Message: "{not json}"}},
+		{
+			`{"level": "WARN", "msg": "slow", "request_id": "abc", "took": 1.5, "user.id": 10, "ok": true, "none": null}`,
+			Applog{
+				Message:   "slow",
+				Level:     "warn",
+				RequestID: "abc",
+				Fields:    map[string]string{"took": "1.5", "user_id": "10", "ok": "true", "none": ""},
+			},
+		},
+		{
+			` {"severity": "error", "message": "failed", "requestId": "xyz"} `,
+			Applog{Message: "failed", Level: "error", RequestID: "xyz"},
+		},
+		{
+			`{"path": "/"}`,
+			Applog{Message: `{"path": "/"}`, Fields: map[string]string{"path": "/"}},
+		},
+	}
+	for _, t := range tests {
+		l := Applog{Message: t.msg}
+		l.parseStructured()
+		c.Check(l, check.DeepEquals, t.expected)
+	}
+}
+
+func (s *S) TestLogFilterMatches(c *check.C) {
+	now := time.Now()
+	l := &Applog{
+		Date:      now,
+		Message:   "db timeout",
+		Source:    "web",
+		Unit:      "unit1",
+		Level:     "error",
+		RequestID: "r1",
+		Fields:    map[string]string{"path": "/users"},
+	}
+	tests := []struct {
+		filter   LogFilter
+		expected bool
+	}{
+		{LogFilter{}, true},
+		{LogFilter{Source: "web", Unit: "unit1", Level: "error", RequestID: "r1"}, true},
+		{LogFilter{Source: "worker"}, false},
+		{LogFilter{Level: "info"}, false},
+		{LogFilter{Fields: map[string]string{"path": "/users"}}, true},
+		{LogFilter{Fields: map[string]string{"path": "/teams"}}, false},
+		{LogFilter{Grep: "time.ut"}, true},
+		{LogFilter{Grep: "^timeout"}, false},
+		{LogFilter{Since: now.Add(time.Minute)}, false},
+		{LogFilter{Until: now.Add(-time.Minute)}, false},
+	}
+	for i, t := range tests {
+		err := t.filter.Validate()
+		c.Assert(err, check.IsNil)
+		c.Check(t.filter.matches(l), check.Equals, t.expected, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestLogFilterSetField(c *check.C) {
+	var f LogFilter
+	f.SetField("level", "ERROR")
+	f.SetField("request_id", "r1")
+	f.SetField("source", "web")
+	f.SetField("unit", "unit1")
+	f.SetField("user.id", "10")
+	c.Assert(f, check.DeepEquals, LogFilter{
+		Level:     "error",
+		RequestID: "r1",
+		Source:    "web",
+		Unit:      "unit1",
+		Fields:    map[string]string{"user_id": "10"},
+	})
+}
+
+func (s *S) TestNewLogListenerFilter(c *check.C) {
+	app := App{Name: "myapp"}
+	l, err := NewLogListenerFilter(&app, LogFilter{Level: "error", Grep: "^db"})
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	notify("myapp", []interface{}{
+		Applog{Message: "db ok", Level: "info"},
+		Applog{Message: "cache timeout", Level: "error"},
+		Applog{Message: "db timeout", Level: "error"},
+	})
+	logMsg := <-l.c
+	c.Assert(logMsg.Message, check.Equals, "db timeout")
+}
+
 func (s *S) TestLogDispatcherSend(c *check.C) {
 	app := App{Name: "myapp1", Platform: "zend", TeamOwner: s.team.Name}
 	err := CreateApp(&app, s.user)
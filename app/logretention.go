@@ -0,0 +1,295 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// MinLogRetentionBytes is the minimum size of the logs of an app.
+	MinLogRetentionBytes = 4096
+
+	defaultMaxAppLogRetentionBytes = 100 * 1024 * 1024
+)
+
+// LogRetention limits the logs of an app stored by tsuru, in bytes, and the
+// age of the logs shown. Logs are stored in capped collections, which don't
+// support removing documents, so MaxBytes bounds the storage while logs older
+// than MaxAge are only hidden, until replaced by new logs. Zero values fall
+// back to the plan of the app and then to the app-logs:retention settings.
+type LogRetention struct {
+	MaxBytes int64         `json:"maxbytes,omitempty" bson:"maxbytes,omitempty"`
+	MaxAge   time.Duration `json:"maxage,omitempty" bson:"maxage,omitempty"`
+}
+
+func (r *LogRetention) Validate() error {
+	if r.MaxBytes != 0 && r.MaxBytes < MinLogRetentionBytes {
+		return errors.Errorf("log retention must have at least %d bytes", MinLogRetentionBytes)
+	}
+	if r.MaxAge < 0 {
+		return errors.New("log retention age must not be negative")
+	}
+	return nil
+}
+
+func (r LogRetention) String() string {
+	if r.MaxAge == 0 {
+		return fmt.Sprintf("up to %d bytes", r.MaxBytes)
+	}
+	return fmt.Sprintf("up to %d bytes and %s", r.MaxBytes, r.MaxAge)
+}
+
+func defaultLogRetention() LogRetention {
+	maxAge, _ := config.GetDuration("app-logs:retention:max-age")
+	return LogRetention{
+		MaxBytes: db.DefaultLogsMaxBytes(),
+		MaxAge:   maxAge,
+	}
+}
+
+// EffectiveLogRetention returns the log retention of the app, merging the
+// values set in the app, in its plan and in the settings.
+func (app *App) EffectiveLogRetention() LogRetention {
+	retention := defaultLogRetention()
+	for _, r := range []LogRetention{app.Plan.LogRetention, app.LogRetention} {
+		if r.MaxBytes > 0 {
+			retention.MaxBytes = r.MaxBytes
+		}
+		if r.MaxAge > 0 {
+			retention.MaxAge = r.MaxAge
+		}
+	}
+	return retention
+}
+
+// maxAppLogRetentionBytes returns the largest log retention size that can
+// be set in apps, configured by app-logs:retention:max-app-bytes.
+func maxAppLogRetentionBytes() int64 {
+	maxBytes, _ := config.GetInt("app-logs:retention:max-app-bytes")
+	if maxBytes > 0 {
+		return int64(maxBytes)
+	}
+	return defaultMaxAppLogRetentionBytes
+}
+
+// SetLogRetention changes the log retention of the app, resizing its logs
+// collection when needed. The size can't exceed the limit set in the
+// app-logs:retention:max-app-bytes setting.
+func (app *App) SetLogRetention(retention LogRetention) error {
+	err := retention.Validate()
+	if err != nil {
+		return err
+	}
+	if limit := maxAppLogRetentionBytes(); retention.MaxBytes > limit {
+		return errors.Errorf("log retention must have at most %d bytes", limit)
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"logretention": retention}})
+	if err == mgo.ErrNotFound {
+		return ErrAppNotFound
+	}
+	if err != nil {
+		return err
+	}
+	app.LogRetention = retention
+	return app.applyLogRetention()
+}
+
+func (app *App) applyLogRetention() error {
+	conn, err := db.LogConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.SetLogsMaxBytes(app.Name, app.EffectiveLogRetention().MaxBytes)
+}
+
+// logVisibleSince returns the date of the oldest log shown according to the
+// log retention age of the app, or the zero time when every stored log is
+// shown. Older logs are kept in the logs collection until replaced by new
+// logs.
+func (app *App) logVisibleSince() time.Time {
+	maxAge := app.EffectiveLogRetention().MaxAge
+	if maxAge == 0 {
+		return time.Time{}
+	}
+	return time.Now().UTC().Add(-maxAge)
+}
+
+// LogsTruncatedAt returns the date before which logs matching the filter are
+// no longer available, because they were discarded by the log retention of
+// the app. The zero time is returned when the logs found include every log
+// matching the filter.
+func (app *App) LogsTruncatedAt(logs []Applog, filter LogFilter) (time.Time, error) {
+	var truncatedAt time.Time
+	if len(logs) >= filter.limit() {
+		return truncatedAt, nil
+	}
+	conn, err := db.LogConn()
+	if err != nil {
+		return truncatedAt, err
+	}
+	defer conn.Close()
+	stats, err := conn.LogsStats(app.Name)
+	if err != nil {
+		return truncatedAt, err
+	}
+	if stats.Full() {
+		var oldest Applog
+		err = conn.Logs(app.Name).Find(nil).Sort("$natural").One(&oldest)
+		if err != nil && err != mgo.ErrNotFound {
+			return truncatedAt, err
+		}
+		truncatedAt = oldest.Date
+	}
+	if since := app.logVisibleSince(); since.After(truncatedAt) {
+		n, err := conn.Logs(app.Name).Find(bson.M{"date": bson.M{"$lt": since}}).Limit(1).Count()
+		if err != nil {
+			return truncatedAt, err
+		}
+		if n > 0 {
+			truncatedAt = since
+		}
+	}
+	if !filter.Since.IsZero() && !filter.Since.Before(truncatedAt) {
+		return time.Time{}, nil
+	}
+	return truncatedAt, nil
+}
+
+// LogsTruncatedNotice returns a log entry telling that logs before the given
+// date were discarded by the log retention of the app.
+func (app *App) LogsTruncatedNotice(truncatedAt time.Time) Applog {
+	return Applog{
+		Date:    truncatedAt,
+		Source:  "tsuru",
+		AppName: app.Name,
+		Unit:    "api",
+		Message: fmt.Sprintf("logs before %s are not available, the log retention of the app keeps %s", truncatedAt.Format(time.RFC3339), app.EffectiveLogRetention()),
+	}
+}
+
+// grepTruncatedNotice returns a log entry telling that logs before the given
+// date were not matched against the grep pattern, because SearchLogs stopped
+// after scanning maxGrepScannedLogs logs.
+func (app *App) grepTruncatedNotice(scannedUntil time.Time) Applog {
+	return Applog{
+		Date:    scannedUntil,
+		Source:  "tsuru",
+		AppName: app.Name,
+		Unit:    "api",
+		Message: fmt.Sprintf("logs before %s were not searched, grep stops after scanning %d logs, use --since and --until to search older logs", scannedUntil.Format(time.RFC3339), maxGrepScannedLogs),
+	}
+}
+
+// LogUsage describes the storage used by the logs of an app, or of all apps
+// of a team when App is empty.
+type LogUsage struct {
+	Team     string        `json:"team"`
+	App      string        `json:"app,omitempty"`
+	Lines    int64         `json:"lines"`
+	Bytes    int64         `json:"bytes"`
+	MaxBytes int64         `json:"maxbytes"`
+	MaxAge   time.Duration `json:"maxage,omitempty"`
+	Full     bool          `json:"full,omitempty"`
+}
+
+type logUsageList []LogUsage
+
+func (l logUsageList) Len() int      { return len(l) }
+func (l logUsageList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l logUsageList) Less(i, j int) bool {
+	if l[i].Team == l[j].Team {
+		return l[i].App < l[j].App
+	}
+	return l[i].Team < l[j].Team
+}
+
+// LogUsageReport returns the storage used by the logs of the apps matching
+// the filter, sorted by team and app.
+func LogUsageReport(filter *Filter) ([]LogUsage, error) {
+	apps, err := List(filter)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.LogConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	usage := make([]LogUsage, 0, len(apps))
+	for _, a := range apps {
+		stats, err := conn.LogsStats(a.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read log stats of app %q", a.Name)
+		}
+		retention := a.EffectiveLogRetention()
+		usage = append(usage, LogUsage{
+			Team:     a.TeamOwner,
+			App:      a.Name,
+			Lines:    stats.Count,
+			Bytes:    stats.Size,
+			MaxBytes: retention.MaxBytes,
+			MaxAge:   retention.MaxAge,
+			Full:     stats.Full(),
+		})
+	}
+	sort.Sort(logUsageList(usage))
+	return usage, nil
+}
+
+// LogUsageByTeam sums the storage used by the logs of the apps of each team.
+func LogUsageByTeam(usage []LogUsage) []LogUsage {
+	var teams []LogUsage
+	for _, u := range usage {
+		if len(teams) == 0 || teams[len(teams)-1].Team != u.Team {
+			teams = append(teams, LogUsage{Team: u.Team})
+		}
+		t := &teams[len(teams)-1]
+		t.Lines += u.Lines
+		t.Bytes += u.Bytes
+		t.MaxBytes += u.MaxBytes
+	}
+	return teams
+}
+
+// WriteLogUsageCSV writes the log usage report in the CSV format.
+func WriteLogUsageCSV(w io.Writer, usage []LogUsage) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"team", "app", "lines", "bytes", "maxbytes", "maxage", "full"})
+	for _, u := range usage {
+		var maxAge string
+		if u.MaxAge > 0 {
+			maxAge = u.MaxAge.String()
+		}
+		writer.Write([]string{
+			u.Team,
+			u.App,
+			strconv.FormatInt(u.Lines, 10),
+			strconv.FormatInt(u.Bytes, 10),
+			strconv.FormatInt(u.MaxBytes, 10),
+			maxAge,
+			strconv.FormatBool(u.Full),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
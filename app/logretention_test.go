@@ -0,0 +1,214 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestLogRetentionValidate(c *check.C) {
+	tests := []struct {
+		retention LogRetention
+		err       string
+	}{
+		{LogRetention{}, ""},
+		{LogRetention{MaxBytes: 4096, MaxAge: time.Hour}, ""},
+		{LogRetention{MaxBytes: 100}, "log retention must have at least 4096 bytes"},
+		{LogRetention{MaxAge: -time.Hour}, "log retention age must not be negative"},
+	}
+	for _, t := range tests {
+		err := t.retention.Validate()
+		if t.err == "" {
+			c.Check(err, check.IsNil)
+		} else {
+			c.Check(err, check.ErrorMatches, t.err)
+		}
+	}
+}
+
+func (s *S) TestEffectiveLogRetention(c *check.C) {
+	a := App{Name: "myapp"}
+	c.Assert(a.EffectiveLogRetention(), check.Equals, LogRetention{MaxBytes: 200 * 5000})
+	config.Set("app-logs:retention:max-age", "24h")
+	defer config.Unset("app-logs:retention:max-age")
+	c.Assert(a.EffectiveLogRetention(), check.Equals, LogRetention{MaxBytes: 200 * 5000, MaxAge: 24 * time.Hour})
+	a.Plan.LogRetention = LogRetention{MaxBytes: 8192}
+	c.Assert(a.EffectiveLogRetention(), check.Equals, LogRetention{MaxBytes: 8192, MaxAge: 24 * time.Hour})
+	a.LogRetention = LogRetention{MaxAge: time.Hour}
+	c.Assert(a.EffectiveLogRetention(), check.Equals, LogRetention{MaxBytes: 8192, MaxAge: time.Hour})
+	a.LogRetention = LogRetention{MaxBytes: 16384}
+	c.Assert(a.EffectiveLogRetention(), check.Equals, LogRetention{MaxBytes: 16384, MaxAge: 24 * time.Hour})
+}
+
+func (s *S) TestSetLogRetention(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetLogRetention(LogRetention{MaxBytes: 8192, MaxAge: time.Hour})
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.LogRetention, check.Equals, LogRetention{MaxBytes: 8192, MaxAge: time.Hour})
+	stats, err := s.logConn.LogsStats(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(stats.MaxSize, check.Equals, int64(8192))
+	err = a.SetLogRetention(LogRetention{MaxBytes: 10})
+	c.Assert(err, check.ErrorMatches, "log retention must have at least 4096 bytes")
+}
+
+func (s *S) TestSetLogRetentionLimit(c *check.C) {
+	config.Set("app-logs:retention:max-app-bytes", 8192)
+	defer config.Unset("app-logs:retention:max-app-bytes")
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetLogRetention(LogRetention{MaxBytes: 8193})
+	c.Assert(err, check.ErrorMatches, "log retention must have at most 8192 bytes")
+	err = a.SetLogRetention(LogRetention{MaxBytes: 8192})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestSetLogRetentionAppNotFound(c *check.C) {
+	a := App{Name: "unknown"}
+	err := a.SetLogRetention(LogRetention{MaxBytes: 8192})
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
+func (s *S) TestCreateAppAppliesPlanLogRetention(c *check.C) {
+	plan := Plan{Name: "small-logs", CpuShare: 10, LogRetention: LogRetention{MaxBytes: 8192}}
+	err := plan.Save()
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Plan: Plan{Name: "small-logs"}}
+	err = CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	stats, err := s.logConn.LogsStats(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(stats.MaxSize, check.Equals, int64(8192))
+}
+
+func (s *S) TestPlanSaveInvalidLogRetention(c *check.C) {
+	plan := Plan{Name: "small-logs", CpuShare: 10, LogRetention: LogRetention{MaxBytes: 10}}
+	err := plan.Save()
+	c.Assert(err, check.Equals, PlanValidationError{"log retention"})
+}
+
+func (s *S) TestSearchLogsLogRetentionAge(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	err = s.logConn.Logs(a.Name).Insert(
+		Applog{Date: now.Add(-2 * time.Hour), Message: "old", AppName: a.Name},
+		Applog{Date: now.Add(-time.Minute), Message: "new", AppName: a.Name},
+	)
+	c.Assert(err, check.IsNil)
+	logs, err := a.SearchLogs(LogFilter{Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 2)
+	a.LogRetention = LogRetention{MaxAge: time.Hour}
+	logs, err = a.SearchLogs(LogFilter{Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 1)
+	c.Assert(logs[0].Message, check.Equals, "new")
+	truncatedAt, err := a.LogsTruncatedAt(logs, LogFilter{Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(truncatedAt.After(now.Add(-time.Hour-time.Minute)), check.Equals, true)
+	truncatedAt, err = a.LogsTruncatedAt(logs, LogFilter{Lines: 1})
+	c.Assert(err, check.IsNil)
+	c.Assert(truncatedAt.IsZero(), check.Equals, true)
+	truncatedAt, err = a.LogsTruncatedAt(logs, LogFilter{Since: now.Add(-10 * time.Minute)})
+	c.Assert(err, check.IsNil)
+	c.Assert(truncatedAt.IsZero(), check.Equals, true)
+}
+
+func (s *S) TestLogsTruncatedAtFullCollection(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.SetLogRetention(LogRetention{MaxBytes: 4096})
+	c.Assert(err, check.IsNil)
+	logs, err := a.SearchLogs(LogFilter{Lines: 10})
+	c.Assert(err, check.IsNil)
+	truncatedAt, err := a.LogsTruncatedAt(logs, LogFilter{Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(truncatedAt.IsZero(), check.Equals, true)
+	for i := 0; i < 100; i++ {
+		err = a.Log(strings.Repeat("x", 100), "app", "unit1")
+		c.Assert(err, check.IsNil)
+	}
+	var oldest Applog
+	err = s.logConn.Logs(a.Name).Find(nil).Sort("$natural").One(&oldest)
+	c.Assert(err, check.IsNil)
+	logs, err = a.SearchLogs(LogFilter{Lines: 1000})
+	c.Assert(err, check.IsNil)
+	c.Assert(len(logs) < 100, check.Equals, true)
+	truncatedAt, err = a.LogsTruncatedAt(logs, LogFilter{Lines: 1000})
+	c.Assert(err, check.IsNil)
+	c.Assert(truncatedAt.Equal(oldest.Date), check.Equals, true)
+	notice := a.LogsTruncatedNotice(truncatedAt)
+	c.Assert(notice.Source, check.Equals, "tsuru")
+	c.Assert(notice.Message, check.Matches, `logs before .* are not available, the log retention of the app keeps up to 4096 bytes`)
+}
+
+func (s *S) TestLogUsageReport(c *check.C) {
+	a1 := App{Name: "app1", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a1, s.user)
+	c.Assert(err, check.IsNil)
+	a2 := App{Name: "app2", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&a2, s.user)
+	c.Assert(err, check.IsNil)
+	err = a1.SetLogRetention(LogRetention{MaxBytes: 8192, MaxAge: time.Hour})
+	c.Assert(err, check.IsNil)
+	err = a1.Log("msg1\nmsg2", "app", "unit1")
+	c.Assert(err, check.IsNil)
+	usage, err := LogUsageReport(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(usage, check.HasLen, 2)
+	c.Assert(usage[0].App, check.Equals, "app1")
+	c.Assert(usage[0].Team, check.Equals, s.team.Name)
+	c.Assert(usage[0].Lines, check.Equals, int64(2))
+	c.Assert(usage[0].Bytes > 0, check.Equals, true)
+	c.Assert(usage[0].MaxBytes, check.Equals, int64(8192))
+	c.Assert(usage[0].MaxAge, check.Equals, time.Hour)
+	c.Assert(usage[1], check.DeepEquals, LogUsage{Team: s.team.Name, App: "app2", MaxBytes: 200 * 5000})
+	teams := LogUsageByTeam(usage)
+	c.Assert(teams, check.DeepEquals, []LogUsage{
+		{Team: s.team.Name, Lines: 2, Bytes: usage[0].Bytes, MaxBytes: 8192 + 200*5000},
+	})
+	dbApp, err := GetByName("app1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.LogRetention.MaxBytes, check.Equals, int64(8192))
+	var raw bson.M
+	err = s.conn.Apps().Find(bson.M{"name": "app2"}).One(&raw)
+	c.Assert(err, check.IsNil)
+	_, ok := raw["logretention"]
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestWriteLogUsageCSV(c *check.C) {
+	var buf bytes.Buffer
+	err := WriteLogUsageCSV(&buf, []LogUsage{
+		{Team: "team1", App: "app1", Lines: 10, Bytes: 1000, MaxBytes: 8192, MaxAge: time.Hour, Full: true},
+		{Team: "team1", Lines: 10, Bytes: 1000, MaxBytes: 8192},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "team,app,lines,bytes,maxbytes,maxage,full\n"+
+		"team1,app1,10,1000,8192,1h0m0s,true\n"+
+		"team1,,10,1000,8192,,false\n")
+}
+
+func (s *S) TestDefaultLogRetentionFromConfig(c *check.C) {
+	config.Set("app-logs:retention:max-bytes", 8192)
+	defer config.Unset("app-logs:retention:max-bytes")
+	c.Assert(defaultLogRetention(), check.Equals, LogRetention{MaxBytes: 8192})
+	c.Assert(db.DefaultLogsMaxBytes(), check.Equals, int64(8192))
+}
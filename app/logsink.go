@@ -0,0 +1,433 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"net/url"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultLogSinkQueueSize      = 10000
+	defaultLogSinkBatchSize      = 100
+	defaultLogSinkReloadInterval = 30 * time.Second
+)
+
+var (
+	ErrLogSinkNotFound = errors.New("log sink not found")
+
+	logSinkFactories = map[string]LogSinkFactory{}
+	logSinks         = &logSinkManager{}
+
+	logSinkSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_sink_sent_total",
+		Help: "The number of log entries sent to log sinks.",
+	}, []string{"sink"})
+
+	logSinkDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_sink_dropped_total",
+		Help: "The number of log entries dropped because the log sink queue was full.",
+	}, []string{"sink"})
+
+	logSinkErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsuru_logs_sink_errors_total",
+		Help: "The number of log entries not sent to log sinks due to errors.",
+	}, []string{"sink"})
+
+	logSinkQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tsuru_logs_sink_queue_current",
+		Help: "The current number of log entries waiting to be sent to log sinks.",
+	}, []string{"sink"})
+)
+
+func init() {
+	prometheus.MustRegister(logSinkSent)
+	prometheus.MustRegister(logSinkDropped)
+	prometheus.MustRegister(logSinkErrors)
+	prometheus.MustRegister(logSinkQueued)
+}
+
+// LogSink is a destination, besides MongoDB, where app logs are forwarded
+// to. Send is called with batches of logs, from a single goroutine.
+type LogSink interface {
+	Send(logs []Applog) error
+	Close() error
+}
+
+// LogSinkFactory creates a log sink from its configuration. It should not
+// connect to the destination, sinks connect when sending logs.
+type LogSinkFactory func(config map[string]string) (LogSink, error)
+
+// RegisterLogSink registers a new kind of log sink.
+func RegisterLogSink(kind string, factory LogSinkFactory) {
+	logSinkFactories[kind] = factory
+}
+
+// LogSinkConfig describes a log sink forwarding the logs of an app, of the
+// apps in a pool, or of every app when neither the app nor the pool is set.
+type LogSinkConfig struct {
+	Name   string            `json:"name" bson:"_id"`
+	Kind   string            `json:"kind"`
+	App    string            `json:"app,omitempty" bson:",omitempty"`
+	Pool   string            `json:"pool,omitempty" bson:",omitempty"`
+	Config map[string]string `json:"config,omitempty" bson:",omitempty"`
+}
+
+// logSinkSecrets are the config keys holding credentials, which are never
+// shown back to users.
+var logSinkSecrets = map[string]bool{"authorization": true}
+
+const redactedValue = "xxxxx"
+
+// IsLogSinkSecret checks whether the config key holds a credential.
+func IsLogSinkSecret(key string) bool {
+	return logSinkSecrets[key]
+}
+
+// Redacted returns a copy of the configuration with credentials, including
+// the passwords of urls, replaced by a placeholder.
+func (c LogSinkConfig) Redacted() LogSinkConfig {
+	if c.Config == nil {
+		return c
+	}
+	config := make(map[string]string, len(c.Config))
+	for key, value := range c.Config {
+		if IsLogSinkSecret(key) {
+			value = redactedValue
+		} else if u, err := url.Parse(value); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redactedValue)
+				value = u.String()
+			}
+		}
+		config[key] = value
+	}
+	c.Config = config
+	return c
+}
+
+func (c *LogSinkConfig) newSink() (LogSink, error) {
+	factory, ok := logSinkFactories[c.Kind]
+	if !ok {
+		return nil, errors.Errorf("unknown log sink kind %q", c.Kind)
+	}
+	return factory(c.Config)
+}
+
+func (c *LogSinkConfig) Validate() error {
+	if c.Name == "" {
+		return errors.New("log sink name is mandatory")
+	}
+	if c.App != "" && c.Pool != "" {
+		return errors.New("log sink must be set either for an app or for a pool")
+	}
+	sink, err := c.newSink()
+	if err != nil {
+		return err
+	}
+	return sink.Close()
+}
+
+// SetLogSink stores the configuration of a log sink, replacing the log sink
+// with the same name.
+func SetLogSink(c LogSinkConfig) error {
+	err := c.Validate()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.LogSinks().UpsertId(c.Name, c)
+	if err != nil {
+		return err
+	}
+	logSinks.invalidate()
+	return nil
+}
+
+// ListLogSinks returns the configuration of all log sinks, sorted by name.
+func ListLogSinks() ([]LogSinkConfig, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var sinks []LogSinkConfig
+	err = conn.LogSinks().Find(nil).Sort("_id").All(&sinks)
+	if err != nil {
+		return nil, err
+	}
+	return sinks, nil
+}
+
+// GetLogSink returns the configuration of the log sink with the given name.
+func GetLogSink(name string) (*LogSinkConfig, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var sink LogSinkConfig
+	err = conn.LogSinks().FindId(name).One(&sink)
+	if err == mgo.ErrNotFound {
+		return nil, ErrLogSinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sink, nil
+}
+
+// RemoveLogSink removes the log sink with the given name.
+func RemoveLogSink(name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.LogSinks().RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return ErrLogSinkNotFound
+	}
+	if err != nil {
+		return err
+	}
+	logSinks.invalidate()
+	return nil
+}
+
+func removeAppLogSinks(appName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.LogSinks().RemoveAll(bson.M{"app": appName})
+	if err != nil {
+		return err
+	}
+	logSinks.invalidate()
+	return nil
+}
+
+// logSinkQueue sends the logs of a sink in batches, dropping logs when the
+// sink can't keep up and the queue is full.
+type logSinkQueue struct {
+	config   LogSinkConfig
+	sink     LogSink
+	batch    int
+	ch       chan *Applog
+	finished chan struct{}
+}
+
+func newLogSinkQueue(c LogSinkConfig, sink LogSink) *logSinkQueue {
+	size, _ := config.GetInt("log-sinks:queue-size")
+	if size <= 0 {
+		size = defaultLogSinkQueueSize
+	}
+	batch, _ := config.GetInt("log-sinks:batch-size")
+	if batch <= 0 {
+		batch = defaultLogSinkBatchSize
+	}
+	q := &logSinkQueue{
+		config:   c,
+		sink:     sink,
+		batch:    batch,
+		ch:       make(chan *Applog, size),
+		finished: make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+func (q *logSinkQueue) send(msg *Applog) {
+	select {
+	case q.ch <- msg:
+		logSinkQueued.WithLabelValues(q.config.Name).Inc()
+	default:
+		logSinkDropped.WithLabelValues(q.config.Name).Inc()
+	}
+}
+
+func (q *logSinkQueue) run() {
+	defer close(q.finished)
+	t := time.NewTimer(bulkMaxWaitTime)
+	defer t.Stop()
+	logs := make([]Applog, 0, q.batch)
+	for {
+		flush := false
+		closed := false
+		select {
+		case msg, ok := <-q.ch:
+			if !ok {
+				closed = true
+				flush = len(logs) > 0
+				break
+			}
+			logSinkQueued.WithLabelValues(q.config.Name).Dec()
+			logs = append(logs, *msg)
+			flush = len(logs) >= q.batch
+		case <-t.C:
+			flush = len(logs) > 0
+			t.Reset(bulkMaxWaitTime)
+		}
+		if flush {
+			err := q.sink.Send(logs)
+			if err != nil {
+				log.Errorf("[log sink %s] unable to send %d logs: %s", q.config.Name, len(logs), err)
+				logSinkErrors.WithLabelValues(q.config.Name).Add(float64(len(logs)))
+			} else {
+				logSinkSent.WithLabelValues(q.config.Name).Add(float64(len(logs)))
+			}
+			logs = logs[:0]
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+func (q *logSinkQueue) close() {
+	close(q.ch)
+	<-q.finished
+	if err := q.sink.Close(); err != nil {
+		log.Errorf("[log sink %s] unable to close sink: %s", q.config.Name, err)
+	}
+}
+
+// logSinkManager forwards app logs to the log sinks matching them, reloading
+// the log sinks configuration periodically.
+type logSinkManager struct {
+	sync.RWMutex
+	queues   map[string]*logSinkQueue
+	appPools map[string]string
+	hasPools bool
+	loadedAt time.Time
+}
+
+func (m *logSinkManager) invalidate() {
+	m.Lock()
+	m.loadedAt = time.Time{}
+	m.Unlock()
+}
+
+func (m *logSinkManager) reloadIfNeeded() {
+	m.RLock()
+	loadedAt := m.loadedAt
+	m.RUnlock()
+	interval, _ := config.GetDuration("log-sinks:reload-interval")
+	if interval <= 0 {
+		interval = defaultLogSinkReloadInterval
+	}
+	if time.Since(loadedAt) < interval {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	if !m.loadedAt.Equal(loadedAt) {
+		return
+	}
+	m.loadedAt = time.Now()
+	configs, err := ListLogSinks()
+	if err != nil {
+		log.Errorf("[log sinks] unable to load log sinks: %s", err)
+		return
+	}
+	m.reload(configs)
+}
+
+func (m *logSinkManager) reload(configs []LogSinkConfig) {
+	queues := make(map[string]*logSinkQueue, len(configs))
+	m.hasPools = false
+	for _, c := range configs {
+		if c.Pool != "" {
+			m.hasPools = true
+		}
+		if q, ok := m.queues[c.Name]; ok && reflect.DeepEqual(q.config, c) {
+			queues[c.Name] = q
+			delete(m.queues, c.Name)
+			continue
+		}
+		sink, err := c.newSink()
+		if err != nil {
+			log.Errorf("[log sinks] unable to create log sink %q: %s", c.Name, err)
+			continue
+		}
+		queues[c.Name] = newLogSinkQueue(c, sink)
+	}
+	for _, q := range m.queues {
+		go q.close()
+	}
+	m.queues = queues
+	m.appPools = make(map[string]string)
+}
+
+func (m *logSinkManager) appPool(appName string) string {
+	m.RLock()
+	pool, ok := m.appPools[appName]
+	m.RUnlock()
+	if ok {
+		return pool
+	}
+	a, err := GetByName(appName)
+	if err == nil {
+		pool = a.Pool
+	}
+	m.Lock()
+	if m.appPools != nil {
+		m.appPools[appName] = pool
+	}
+	m.Unlock()
+	return pool
+}
+
+// forward sends the log to every log sink matching its app.
+func (m *logSinkManager) forward(msg *Applog) {
+	m.reloadIfNeeded()
+	m.RLock()
+	if len(m.queues) == 0 {
+		m.RUnlock()
+		return
+	}
+	hasPools := m.hasPools
+	m.RUnlock()
+	var pool string
+	if hasPools {
+		pool = m.appPool(msg.AppName)
+	}
+	m.RLock()
+	defer m.RUnlock()
+	for _, q := range m.queues {
+		if (q.config.App == "" && q.config.Pool == "") ||
+			(q.config.App != "" && q.config.App == msg.AppName) ||
+			(q.config.Pool != "" && q.config.Pool == pool) {
+			q.send(msg)
+		}
+	}
+}
+
+// LogSinkKinds returns the kinds of log sinks available.
+func LogSinkKinds() []string {
+	kinds := make([]string, 0, len(logSinkFactories))
+	for k := range logSinkFactories {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
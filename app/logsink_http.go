@@ -0,0 +1,159 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+const (
+	defaultElasticsearchIndex = "tsuru-logs"
+	defaultElasticsearchType  = "log"
+)
+
+func init() {
+	RegisterLogSink("http", newHTTPLogSink)
+	RegisterLogSink("elasticsearch", newElasticsearchLogSink)
+}
+
+func parseLogSinkURL(config map[string]string) (string, error) {
+	u, err := url.Parse(config["url"])
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", errors.Errorf("invalid url %q, it must be an http or https url", config["url"])
+	}
+	return u.String(), nil
+}
+
+func postLogs(url, contentType, authorization string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rsp, err := tsuruNet.Dial5Full60ClientNoKeepAlive.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return nil, errors.Errorf("invalid response %d: %s", rsp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// httpLogSink posts batches of logs to an URL, as a JSON array.
+type httpLogSink struct {
+	url           string
+	authorization string
+}
+
+func newHTTPLogSink(config map[string]string) (LogSink, error) {
+	u, err := parseLogSinkURL(config)
+	if err != nil {
+		return nil, err
+	}
+	return &httpLogSink{url: u, authorization: config["authorization"]}, nil
+}
+
+func (s *httpLogSink) Send(logs []Applog) error {
+	data, err := json.Marshal(logs)
+	if err != nil {
+		return err
+	}
+	_, err = postLogs(s.url, "application/json", s.authorization, bytes.NewReader(data))
+	return err
+}
+
+func (s *httpLogSink) Close() error {
+	return nil
+}
+
+// elasticsearchLogSink indexes logs in Elasticsearch, using the bulk API.
+type elasticsearchLogSink struct {
+	url           string
+	index         string
+	docType       string
+	authorization string
+}
+
+func newElasticsearchLogSink(config map[string]string) (LogSink, error) {
+	u, err := parseLogSinkURL(config)
+	if err != nil {
+		return nil, err
+	}
+	sink := &elasticsearchLogSink{
+		url:           strings.TrimRight(u, "/") + "/_bulk",
+		index:         config["index"],
+		docType:       config["type"],
+		authorization: config["authorization"],
+	}
+	if sink.index == "" {
+		sink.index = defaultElasticsearchIndex
+	}
+	if sink.docType == "" {
+		sink.docType = defaultElasticsearchType
+	}
+	return sink, nil
+}
+
+type elasticsearchBulkAction struct {
+	Index struct {
+		Index string `json:"_index"`
+		Type  string `json:"_type"`
+	} `json:"index"`
+}
+
+func (s *elasticsearchLogSink) Send(logs []Applog) error {
+	var action elasticsearchBulkAction
+	action.Index.Index = s.index
+	action.Index.Type = s.docType
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i := range logs {
+		err := encoder.Encode(action)
+		if err != nil {
+			return err
+		}
+		err = encoder.Encode(logs[i])
+		if err != nil {
+			return err
+		}
+	}
+	data, err := postLogs(s.url, "application/x-ndjson", s.authorization, &buf)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Errors bool
+	}
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return errors.Wrap(err, "invalid bulk response")
+	}
+	if result.Errors {
+		return errors.New("some logs were not indexed by elasticsearch")
+	}
+	return nil
+}
+
+func (s *elasticsearchLogSink) Close() error {
+	return nil
+}
@@ -0,0 +1,219 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	kafkaProduceKey     = 0
+	kafkaClientID       = "tsuru"
+	kafkaProduceTimeout = 5 * time.Second
+)
+
+func init() {
+	RegisterLogSink("kafka", newKafkaLogSink)
+}
+
+// kafkaLogSink produces logs, encoded as JSON and keyed by the app name, to
+// a partition of a Kafka topic, using the version 0 of the produce API. The
+// address must point to the leader of the partition.
+type kafkaLogSink struct {
+	address       string
+	topic         string
+	partition     int32
+	correlationID int32
+	conn          net.Conn
+}
+
+func newKafkaLogSink(config map[string]string) (LogSink, error) {
+	sink := &kafkaLogSink{
+		address: config["address"],
+		topic:   config["topic"],
+	}
+	if _, _, err := net.SplitHostPort(sink.address); err != nil {
+		return nil, errors.Errorf("invalid kafka address %q, it must be in the host:port format", sink.address)
+	}
+	if sink.topic == "" {
+		return nil, errors.New("kafka topic is mandatory")
+	}
+	if partition := config["partition"]; partition != "" {
+		p, err := strconv.ParseInt(partition, 10, 32)
+		if err != nil || p < 0 {
+			return nil, errors.Errorf("invalid kafka partition %q", partition)
+		}
+		sink.partition = int32(p)
+	}
+	return sink, nil
+}
+
+type kafkaEncoder struct {
+	bytes.Buffer
+}
+
+func (e *kafkaEncoder) int8(v int8) {
+	e.WriteByte(byte(v))
+}
+
+func (e *kafkaEncoder) int16(v int16) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) int32(v int32) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) int64(v int64) {
+	binary.Write(e, binary.BigEndian, v)
+}
+
+func (e *kafkaEncoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.WriteString(v)
+}
+
+func (e *kafkaEncoder) bytes(v []byte) {
+	e.int32(int32(len(v)))
+	e.Write(v)
+}
+
+func (s *kafkaLogSink) messageSet(logs []Applog) ([]byte, error) {
+	var set kafkaEncoder
+	for i := range logs {
+		value, err := json.Marshal(logs[i])
+		if err != nil {
+			return nil, err
+		}
+		var msg kafkaEncoder
+		msg.int8(0) // magic
+		msg.int8(0) // attributes
+		msg.bytes([]byte(logs[i].AppName))
+		msg.bytes(value)
+		set.int64(0) // offset, ignored by the broker
+		set.int32(int32(msg.Len() + 4))
+		set.int32(int32(crc32.ChecksumIEEE(msg.Bytes())))
+		set.Write(msg.Bytes())
+	}
+	return set.Bytes(), nil
+}
+
+func (s *kafkaLogSink) request(logs []Applog) ([]byte, error) {
+	messageSet, err := s.messageSet(logs)
+	if err != nil {
+		return nil, err
+	}
+	s.correlationID++
+	var req kafkaEncoder
+	req.int16(kafkaProduceKey)
+	req.int16(0) // api version
+	req.int32(s.correlationID)
+	req.string(kafkaClientID)
+	req.int16(1) // acks
+	req.int32(int32(kafkaProduceTimeout / time.Millisecond))
+	req.int32(1) // topics
+	req.string(s.topic)
+	req.int32(1) // partitions
+	req.int32(s.partition)
+	req.bytes(messageSet)
+	var data kafkaEncoder
+	data.bytes(req.Bytes())
+	return data.Bytes(), nil
+}
+
+func (s *kafkaLogSink) readResponse() error {
+	var size int32
+	err := binary.Read(s.conn, binary.BigEndian, &size)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(s.conn, data)
+	if err != nil {
+		return err
+	}
+	var rsp struct {
+		CorrelationID int32
+		Topics        int32
+	}
+	r := bytes.NewReader(data)
+	err = binary.Read(r, binary.BigEndian, &rsp)
+	if err != nil {
+		return err
+	}
+	if rsp.CorrelationID != s.correlationID {
+		return errors.Errorf("invalid kafka correlation id %d, expected %d", rsp.CorrelationID, s.correlationID)
+	}
+	for i := int32(0); i < rsp.Topics; i++ {
+		var topicLen int16
+		err = binary.Read(r, binary.BigEndian, &topicLen)
+		if err != nil {
+			return err
+		}
+		if _, err = r.Seek(int64(topicLen), io.SeekCurrent); err != nil {
+			return err
+		}
+		var partitions int32
+		err = binary.Read(r, binary.BigEndian, &partitions)
+		if err != nil {
+			return err
+		}
+		for j := int32(0); j < partitions; j++ {
+			var partition struct {
+				Partition int32
+				ErrorCode int16
+				Offset    int64
+			}
+			err = binary.Read(r, binary.BigEndian, &partition)
+			if err != nil {
+				return err
+			}
+			if partition.ErrorCode != 0 {
+				return errors.Errorf("kafka error code %d producing to partition %d", partition.ErrorCode, partition.Partition)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *kafkaLogSink) Send(logs []Applog) error {
+	req, err := s.request(logs)
+	if err != nil {
+		return err
+	}
+	if s.conn == nil {
+		s.conn, err = net.DialTimeout("tcp", s.address, logSinkDialTimeout)
+		if err != nil {
+			return err
+		}
+	}
+	s.conn.SetDeadline(time.Now().Add(2 * kafkaProduceTimeout))
+	_, err = s.conn.Write(req)
+	if err == nil {
+		err = s.readResponse()
+	}
+	if err != nil {
+		s.Close()
+	}
+	return err
+}
+
+func (s *kafkaLogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,161 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const logSinkDialTimeout = 5 * time.Second
+
+const defaultSyslogFacility = 1
+
+var syslogSeverities = map[string]int{
+	"emerg":     0,
+	"emergency": 0,
+	"alert":     1,
+	"crit":      2,
+	"critical":  2,
+	"fatal":     2,
+	"err":       3,
+	"error":     3,
+	"warn":      4,
+	"warning":   4,
+	"notice":    5,
+	"info":      6,
+	"debug":     7,
+	"trace":     7,
+}
+
+func init() {
+	RegisterLogSink("syslog", newSyslogLogSink)
+}
+
+// syslogLogSink sends logs to a syslog server, in the RFC 5424 format, using
+// UDP or TCP with octet counting framing.
+type syslogLogSink struct {
+	network  string
+	address  string
+	hostname string
+	facility int
+	conn     net.Conn
+}
+
+func newSyslogLogSink(config map[string]string) (LogSink, error) {
+	addr, err := url.Parse(config["address"])
+	if err != nil || addr.Host == "" {
+		return nil, errors.Errorf("invalid syslog address %q, it must be in the udp://host:port or tcp://host:port format", config["address"])
+	}
+	if addr.Scheme != "udp" && addr.Scheme != "tcp" {
+		return nil, errors.Errorf("invalid syslog protocol %q, it must be udp or tcp", addr.Scheme)
+	}
+	sink := &syslogLogSink{
+		network:  addr.Scheme,
+		address:  addr.Host,
+		hostname: config["hostname"],
+		facility: defaultSyslogFacility,
+	}
+	if facility := config["facility"]; facility != "" {
+		sink.facility, err = strconv.Atoi(facility)
+		if err != nil || sink.facility < 0 || sink.facility > 23 {
+			return nil, errors.Errorf("invalid syslog facility %q, it must be a number between 0 and 23", facility)
+		}
+	}
+	if sink.hostname == "" {
+		sink.hostname = "-"
+	}
+	return sink, nil
+}
+
+func syslogField(value string, maxLen int) string {
+	value = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, value)
+	if value == "" {
+		return "-"
+	}
+	if len(value) > maxLen {
+		value = value[:maxLen]
+	}
+	return value
+}
+
+func (s *syslogLogSink) format(l *Applog) []byte {
+	severity, ok := syslogSeverities[strings.ToLower(l.Level)]
+	if !ok {
+		severity = syslogSeverities["info"]
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %s %s - %s",
+		s.facility*8+severity,
+		l.Date.UTC().Format(time.RFC3339Nano),
+		syslogField(s.hostname, 255),
+		syslogField(l.AppName, 48),
+		syslogField(l.Unit, 128),
+		syslogField(l.Source, 32),
+		l.Message,
+	)
+	return buf.Bytes()
+}
+
+func (s *syslogLogSink) connect() error {
+	if s.conn != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout(s.network, s.address, logSinkDialTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *syslogLogSink) Send(logs []Applog) error {
+	err := s.connect()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for i := range logs {
+		msg := s.format(&logs[i])
+		if s.network == "udp" {
+			_, err = s.conn.Write(msg)
+			if err != nil {
+				break
+			}
+			continue
+		}
+		fmt.Fprintf(&buf, "%d ", len(msg))
+		buf.Write(msg)
+	}
+	if err == nil && buf.Len() > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(logSinkDialTimeout))
+		_, err = buf.WriteTo(s.conn)
+	}
+	if err != nil {
+		s.Close()
+	}
+	return err
+}
+
+func (s *syslogLogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,188 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultLogThrottleWindow = time.Minute
+
+	// logThrottleChunks is the number of chunks the lines of each window are
+	// split into when reserved by API instances.
+	logThrottleChunks = 10
+)
+
+var (
+	logThrottle = &logThrottler{}
+
+	logsThrottled = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tsuru_logs_throttled_total",
+		Help: "The number of log entries dropped because apps exceeded the log rate limit.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(logsThrottled)
+}
+
+// logThrottler limits the number of log lines stored for each app in a time
+// window, configured by the app-logs:throttle settings. The limit is shared
+// by all API instances: each instance reserves chunks of lines from a counter
+// stored in the database, and stores lines while its reservation lasts.
+type logThrottler struct {
+	sync.Mutex
+	windows map[string]*logWindow
+}
+
+type logWindow struct {
+	start     time.Time
+	reserved  int
+	exhausted bool
+	dropped   int
+}
+
+func logThrottleLimits() (int, time.Duration) {
+	maxLines, _ := config.GetInt("app-logs:throttle:max-lines")
+	window, _ := config.GetDuration("app-logs:throttle:window")
+	if window <= 0 {
+		window = defaultLogThrottleWindow
+	}
+	return maxLines, window
+}
+
+// allow returns whether a new log line of the app should be stored. When the
+// app starts or stops being throttled, it also returns a log entry to be
+// stored in the logs of the app, telling users about it.
+func (t *logThrottler) allow(appName string, now time.Time) (bool, *Applog) {
+	maxLines, window := logThrottleLimits()
+	if maxLines <= 0 {
+		return true, nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.windows == nil {
+		t.windows = make(map[string]*logWindow)
+	}
+	var notice *Applog
+	start := now.Truncate(window)
+	w := t.windows[appName]
+	if w == nil || !w.start.Equal(start) {
+		if w != nil && w.dropped > 0 {
+			notice = logThrottleNotice(appName, now, fmt.Sprintf("%d log lines were dropped because the app exceeded the limit of %d log lines per %s", w.dropped, maxLines, window))
+		}
+		w = &logWindow{start: start}
+		t.windows[appName] = w
+	}
+	if w.reserved == 0 && !w.exhausted {
+		w.reserved = reserveLogLines(appName, start, window, maxLines)
+		w.exhausted = w.reserved == 0
+	}
+	if w.reserved > 0 {
+		w.reserved--
+		return true, notice
+	}
+	w.dropped++
+	logsThrottled.Inc()
+	if w.dropped == 1 {
+		notice = logThrottleNotice(appName, now, fmt.Sprintf("the app exceeded the limit of %d log lines per %s, log lines will be dropped until %s", maxLines, window, start.Add(window).UTC().Format(time.RFC3339)))
+	}
+	return false, notice
+}
+
+// reserveLogLines reserves a chunk of the log lines of the app in the window
+// starting at the given time, returning how many lines were reserved. Errors
+// reading the counter don't block logs.
+func reserveLogLines(appName string, start time.Time, window time.Duration, maxLines int) int {
+	chunk := maxLines / logThrottleChunks
+	if chunk < 1 {
+		chunk = 1
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("[log throttle] unable to connect to the database: %s", err)
+		return chunk
+	}
+	defer conn.Close()
+	var counter struct {
+		Count int
+	}
+	_, err = conn.LogThrottle().FindId(fmt.Sprintf("%s/%d", appName, start.Unix())).Apply(mgo.Change{
+		Update: bson.M{
+			"$inc":         bson.M{"count": chunk},
+			"$setOnInsert": bson.M{"expireat": start.Add(window)},
+		},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &counter)
+	if err != nil {
+		log.Errorf("[log throttle] unable to reserve log lines for app %q: %s", appName, err)
+		return chunk
+	}
+	available := maxLines - (counter.Count - chunk)
+	if available > chunk {
+		available = chunk
+	}
+	if available < 0 {
+		available = 0
+	}
+	return available
+}
+
+func logThrottleNotice(appName string, now time.Time, message string) *Applog {
+	return &Applog{
+		Date:    now.UTC(),
+		Source:  "tsuru",
+		AppName: appName,
+		Unit:    "api",
+		Message: message,
+	}
+}
+
+// LogThrottled is like Log, but it's used for logs sent by the app itself,
+// dropping the lines exceeding the log rate limit. When lines are dropped, a
+// notice is stored in the logs of the app.
+func (app *App) LogThrottled(message, source, unit string) error {
+	var lines []string
+	flush := func() error {
+		if len(lines) == 0 {
+			return nil
+		}
+		err := app.Log(strings.Join(lines, "\n"), source, unit)
+		lines = nil
+		return err
+	}
+	for _, msg := range strings.Split(message, "\n") {
+		if msg == "" {
+			continue
+		}
+		ok, notice := logThrottle.allow(app.Name, time.Now())
+		if notice != nil {
+			err := flush()
+			if err != nil {
+				return err
+			}
+			err = app.Log(notice.Message, notice.Source, notice.Unit)
+			if err != nil {
+				return err
+			}
+		}
+		if ok {
+			lines = append(lines, msg)
+		}
+	}
+	return flush()
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLogThrottlerDisabled(c *check.C) {
+	t := &logThrottler{}
+	for i := 0; i < 100; i++ {
+		ok, notice := t.allow("myapp", time.Now())
+		c.Assert(ok, check.Equals, true)
+		c.Assert(notice, check.IsNil)
+	}
+}
+
+func (s *S) TestLogThrottlerAllow(c *check.C) {
+	config.Set("app-logs:throttle:max-lines", 2)
+	config.Set("app-logs:throttle:window", "10s")
+	defer config.Unset("app-logs:throttle")
+	t := &logThrottler{}
+	now := time.Date(2017, 3, 10, 12, 0, 0, 0, time.UTC)
+	ok, notice := t.allow("myapp", now)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(notice, check.IsNil)
+	ok, _ = t.allow("myapp", now.Add(time.Second))
+	c.Assert(ok, check.Equals, true)
+	ok, notice = t.allow("myapp", now.Add(2*time.Second))
+	c.Assert(ok, check.Equals, false)
+	c.Assert(notice, check.DeepEquals, &Applog{
+		Date:    now.Add(2 * time.Second),
+		Source:  "tsuru",
+		AppName: "myapp",
+		Unit:    "api",
+		Message: "the app exceeded the limit of 2 log lines per 10s, log lines will be dropped until 2017-03-10T12:00:10Z",
+	})
+	ok, notice = t.allow("myapp", now.Add(3*time.Second))
+	c.Assert(ok, check.Equals, false)
+	c.Assert(notice, check.IsNil)
+	ok, _ = t.allow("otherapp", now.Add(3*time.Second))
+	c.Assert(ok, check.Equals, true)
+	ok, notice = t.allow("myapp", now.Add(10*time.Second))
+	c.Assert(ok, check.Equals, true)
+	c.Assert(notice, check.NotNil)
+	c.Assert(notice.Message, check.Equals, "2 log lines were dropped because the app exceeded the limit of 2 log lines per 10s")
+	ok, notice = t.allow("myapp", now.Add(11*time.Second))
+	c.Assert(ok, check.Equals, true)
+	c.Assert(notice, check.IsNil)
+}
+
+func (s *S) TestLogThrottlerSharedLimit(c *check.C) {
+	config.Set("app-logs:throttle:max-lines", 20)
+	config.Set("app-logs:throttle:window", "10s")
+	defer config.Unset("app-logs:throttle")
+	t1 := &logThrottler{}
+	t2 := &logThrottler{}
+	now := time.Date(2017, 3, 10, 12, 0, 0, 0, time.UTC)
+	var allowed int
+	for i := 0; i < 20; i++ {
+		for _, t := range []*logThrottler{t1, t2} {
+			if ok, _ := t.allow("myapp", now); ok {
+				allowed++
+			}
+		}
+	}
+	c.Assert(allowed, check.Equals, 20)
+	ok, _ := t1.allow("myapp", now.Add(10*time.Second))
+	c.Assert(ok, check.Equals, true)
+}
+
+func (s *S) TestLogThrottled(c *check.C) {
+	config.Set("app-logs:throttle:max-lines", 2)
+	defer config.Unset("app-logs:throttle")
+	defer func() { logThrottle = &logThrottler{} }()
+	logThrottle = &logThrottler{}
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.LogThrottled("msg1\nmsg2\nmsg3", "app", "unit1")
+	c.Assert(err, check.IsNil)
+	err = a.LogThrottled("msg4", "app", "unit1")
+	c.Assert(err, check.IsNil)
+	logs, err := a.SearchLogs(LogFilter{Lines: 10})
+	c.Assert(err, check.IsNil)
+	c.Assert(logs, check.HasLen, 3)
+	c.Assert(logs[0].Message, check.Equals, "msg1")
+	c.Assert(logs[1].Message, check.Equals, "msg2")
+	c.Assert(logs[2].Source, check.Equals, "tsuru")
+	c.Assert(logs[2].Message, check.Matches, "the app exceeded the limit of 2 log lines per 1m0s, log lines will be dropped until .*")
+}
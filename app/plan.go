@@ -16,11 +16,12 @@ import (
 )
 
 type Plan struct {
-	Name     string `bson:"_id" json:"name"`
-	Memory   int64  `json:"memory"`
-	Swap     int64  `json:"swap"`
-	CpuShare int    `json:"cpushare"`
-	Default  bool   `json:"default,omitempty"`
+	Name         string       `bson:"_id" json:"name"`
+	Memory       int64        `json:"memory"`
+	Swap         int64        `json:"swap"`
+	CpuShare     int          `json:"cpushare"`
+	Default      bool         `json:"default,omitempty"`
+	LogRetention LogRetention `json:"logretention" bson:",omitempty"`
 }
 
 type PlanValidationError struct{ field string }
@@ -47,6 +48,9 @@ func (plan *Plan) Save() error {
 	if plan.Memory > 0 && plan.Memory < 4194304 {
 		return ErrLimitOfMemory
 	}
+	if plan.LogRetention.Validate() != nil {
+		return PlanValidationError{"log retention"}
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -0,0 +1,217 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/leader"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultUnitMetricsInterval  = time.Minute
+	defaultUnitMetricsRetention = time.Hour
+)
+
+var unitMetricsCollectorInstance *unitMetricsCollector
+
+func unitMetricsSettings() (time.Duration, time.Duration) {
+	interval, _ := config.GetDuration("unit-metrics:interval")
+	if interval <= 0 {
+		interval = defaultUnitMetricsInterval
+	}
+	retention, _ := config.GetDuration("unit-metrics:retention")
+	if retention <= 0 {
+		retention = defaultUnitMetricsRetention
+	}
+	return interval, retention
+}
+
+func unitMetricsEnabled() bool {
+	enabled, _ := config.GetBool("unit-metrics:enabled")
+	return enabled
+}
+
+// CollectUnitMetrics samples the resources used by the units of every app,
+// removing samples older than the retention. Collections are run by a single
+// API instance at a time, holding the lease of the collector.
+func CollectUnitMetrics(at time.Time, retention time.Duration) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	apps, err := List(nil)
+	if err != nil {
+		return err
+	}
+	coll := conn.UnitMetrics()
+	for i := range apps {
+		a := &apps[i]
+		if a.InUse == 0 {
+			continue
+		}
+		prov, err := a.getProvisioner()
+		if err != nil {
+			log.Errorf("[unit metrics] unable to get provisioner of app %q: %s", a.Name, err)
+			continue
+		}
+		metricsProv, ok := prov.(provision.UnitMetricsProvisioner)
+		if !ok {
+			continue
+		}
+		metrics, err := metricsProv.UnitsMetrics(a)
+		if err != nil {
+			log.Errorf("[unit metrics] unable to collect metrics of app %q: %s", a.Name, err)
+			continue
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		docs := make([]interface{}, len(metrics))
+		for j := range metrics {
+			docs[j] = metrics[j]
+		}
+		err = coll.Insert(docs...)
+		if err != nil {
+			return err
+		}
+	}
+	minDate := at.UTC().Add(-retention)
+	_, err = coll.RemoveAll(bson.M{"date": bson.M{"$lt": minDate}})
+	return err
+}
+
+// UnitMetrics returns the samples of the resources used by the units of the
+// app since the given time, sorted by date. When process is not empty, only
+// units of this process are returned.
+func (app *App) UnitMetrics(process string, from time.Time) ([]provision.UnitMetrics, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	query := bson.M{"appname": app.Name}
+	if process != "" {
+		query["processname"] = process
+	}
+	if !from.IsZero() {
+		query["date"] = bson.M{"$gte": from.UTC()}
+	}
+	var metrics []provision.UnitMetrics
+	err = conn.UnitMetrics().Find(query).Sort("date", "id").All(&metrics)
+	if err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// LastUnitMetrics returns the latest sample of each unit of the app, sampled
+// in the last two sampling intervals. It returns nothing when the unit
+// metrics collector is disabled.
+func (app *App) LastUnitMetrics() ([]provision.UnitMetrics, error) {
+	if !unitMetricsEnabled() {
+		return nil, nil
+	}
+	interval, _ := unitMetricsSettings()
+	metrics, err := app.UnitMetrics("", time.Now().Add(-2*interval))
+	if err != nil {
+		return nil, err
+	}
+	var last []provision.UnitMetrics
+	idx := make(map[string]int)
+	for _, m := range metrics {
+		if i, ok := idx[m.ID]; ok {
+			last[i] = m
+			continue
+		}
+		idx[m.ID] = len(last)
+		last = append(last, m)
+	}
+	return last, nil
+}
+
+func removeAppUnitMetrics(appName string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.UnitMetrics().RemoveAll(bson.M{"appname": appName})
+	return err
+}
+
+type unitMetricsCollector struct {
+	interval  time.Duration
+	retention time.Duration
+	lease     *leader.Lease
+	done      chan struct{}
+	finished  chan struct{}
+}
+
+// InitializeUnitMetrics starts the background collector of unit metrics,
+// when it's enabled.
+func InitializeUnitMetrics() error {
+	if unitMetricsCollectorInstance != nil {
+		return errors.New("unit metrics collector already initialized")
+	}
+	if !unitMetricsEnabled() {
+		return nil
+	}
+	interval, retention := unitMetricsSettings()
+	if retention < interval {
+		return errors.Errorf("invalid unit-metrics:retention %s, it must not be shorter than the interval %s", retention, interval)
+	}
+	unitMetricsCollectorInstance = &unitMetricsCollector{
+		interval:  interval,
+		retention: retention,
+		lease:     leader.NewLease("unit-metrics-collector", 3*interval),
+		done:      make(chan struct{}),
+		finished:  make(chan struct{}),
+	}
+	go unitMetricsCollectorInstance.run()
+	shutdown.Register(unitMetricsCollectorInstance)
+	return nil
+}
+
+func (c *unitMetricsCollector) run() {
+	defer close(c.finished)
+	for {
+		now := time.Now().UTC()
+		isLeader, err := c.lease.Acquire()
+		if err != nil {
+			log.Errorf("[unit metrics] unable to acquire lease: %s", err)
+		} else if isLeader {
+			if err = CollectUnitMetrics(now, c.retention); err != nil {
+				log.Errorf("[unit metrics] unable to collect unit metrics: %s", err)
+			}
+		}
+		next := now.Truncate(c.interval).Add(c.interval)
+		select {
+		case <-c.done:
+			return
+		case <-time.After(next.Sub(now)):
+		}
+	}
+}
+
+func (c *unitMetricsCollector) Shutdown() {
+	close(c.done)
+	<-c.finished
+	if err := c.lease.Release(); err != nil {
+		log.Errorf("[unit metrics] unable to release lease: %s", err)
+	}
+}
+
+func (c *unitMetricsCollector) String() string {
+	return "unit metrics collector"
+}
@@ -0,0 +1,136 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestCollectUnitMetrics(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(2, "web", nil)
+	c.Assert(err, check.IsNil)
+	idle := App{Name: "idle", Platform: "python", TeamOwner: s.team.Name}
+	err = CreateApp(&idle, s.user)
+	c.Assert(err, check.IsNil)
+	now := time.Now().UTC()
+	err = CollectUnitMetrics(now, time.Hour)
+	c.Assert(err, check.IsNil)
+	metrics, err := a.UnitMetrics("", time.Time{})
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 2)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	for i, m := range metrics {
+		c.Assert(m.ID, check.Equals, units[i].ID)
+		c.Assert(m.AppName, check.Equals, "myapp")
+		c.Assert(m.ProcessName, check.Equals, "web")
+		c.Assert(m.CPU, check.Equals, float64(10))
+		c.Assert(m.MemoryLimit, check.Equals, uint64(1024))
+	}
+	count, err := s.conn.UnitMetrics().Find(bson.M{"appname": "idle"}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 0)
+}
+
+func (s *S) TestCollectUnitMetricsRemovesOldSamples(c *check.C) {
+	old := provision.UnitMetrics{ID: "u1", AppName: "myapp", Date: time.Now().UTC().Add(-2 * time.Hour)}
+	recent := provision.UnitMetrics{ID: "u1", AppName: "myapp", Date: time.Now().UTC().Add(-time.Minute)}
+	err := s.conn.UnitMetrics().Insert(old, recent)
+	c.Assert(err, check.IsNil)
+	err = CollectUnitMetrics(time.Now(), time.Hour)
+	c.Assert(err, check.IsNil)
+	var metrics []provision.UnitMetrics
+	err = s.conn.UnitMetrics().Find(nil).All(&metrics)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 1)
+	c.Assert(metrics[0].Date.Unix(), check.Equals, recent.Date.Unix())
+}
+
+func (s *S) TestCollectUnitMetricsIgnoresProvisionerErrors(c *check.C) {
+	a := App{Name: "myapp", Platform: "python", TeamOwner: s.team.Name, Quota: quota.Unlimited}
+	err := CreateApp(&a, s.user)
+	c.Assert(err, check.IsNil)
+	err = a.AddUnits(1, "web", nil)
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareFailure("UnitsMetrics", errors.New("stats failed"))
+	err = CollectUnitMetrics(time.Now(), time.Hour)
+	c.Assert(err, check.IsNil)
+	metrics, err := a.UnitMetrics("", time.Time{})
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 0)
+}
+
+func (s *S) TestAppUnitMetricsFilters(c *check.C) {
+	now := time.Now().UTC()
+	err := s.conn.UnitMetrics().Insert(
+		provision.UnitMetrics{ID: "u1", AppName: "myapp", ProcessName: "web", Date: now.Add(-10 * time.Minute)},
+		provision.UnitMetrics{ID: "u2", AppName: "myapp", ProcessName: "worker", Date: now.Add(-time.Minute)},
+		provision.UnitMetrics{ID: "u1", AppName: "myapp", ProcessName: "web", Date: now.Add(-time.Minute)},
+		provision.UnitMetrics{ID: "u3", AppName: "otherapp", ProcessName: "web", Date: now},
+	)
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp"}
+	metrics, err := a.UnitMetrics("", time.Time{})
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 3)
+	c.Assert(metrics[0].ID, check.Equals, "u1")
+	metrics, err = a.UnitMetrics("web", time.Time{})
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 2)
+	metrics, err = a.UnitMetrics("", now.Add(-5*time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 2)
+	c.Assert(metrics[0].ID, check.Equals, "u1")
+	c.Assert(metrics[1].ID, check.Equals, "u2")
+}
+
+func (s *S) TestAppLastUnitMetrics(c *check.C) {
+	config.Set("unit-metrics:enabled", true)
+	defer config.Unset("unit-metrics:enabled")
+	now := time.Now().UTC()
+	err := s.conn.UnitMetrics().Insert(
+		provision.UnitMetrics{ID: "u1", AppName: "myapp", CPU: 5, Date: now.Add(-90 * time.Second)},
+		provision.UnitMetrics{ID: "u1", AppName: "myapp", CPU: 7, Date: now.Add(-30 * time.Second)},
+		provision.UnitMetrics{ID: "u2", AppName: "myapp", CPU: 9, Date: now.Add(-30 * time.Second)},
+		provision.UnitMetrics{ID: "u3", AppName: "myapp", CPU: 1, Date: now.Add(-time.Hour)},
+	)
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp"}
+	metrics, err := a.LastUnitMetrics()
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 2)
+	c.Assert(metrics[0].ID, check.Equals, "u1")
+	c.Assert(metrics[0].CPU, check.Equals, float64(7))
+	c.Assert(metrics[1].ID, check.Equals, "u2")
+}
+
+func (s *S) TestAppLastUnitMetricsDisabled(c *check.C) {
+	err := s.conn.UnitMetrics().Insert(provision.UnitMetrics{ID: "u1", AppName: "myapp", Date: time.Now().UTC()})
+	c.Assert(err, check.IsNil)
+	a := App{Name: "myapp"}
+	metrics, err := a.LastUnitMetrics()
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 0)
+}
+
+func (s *S) TestInitializeUnitMetricsInvalidRetention(c *check.C) {
+	config.Set("unit-metrics:enabled", true)
+	config.Set("unit-metrics:interval", "10m")
+	config.Set("unit-metrics:retention", "5m")
+	defer config.Unset("unit-metrics")
+	err := InitializeUnitMetrics()
+	c.Assert(err, check.ErrorMatches, `invalid unit-metrics:retention 5m0s, .*`)
+	c.Assert(unitMetricsCollectorInstance, check.IsNil)
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/log"
+)
+
+// GroupMapping maps groups managed by an external identity provider, like an
+// LDAP directory or an OpenID Connect provider, to tsuru teams and roles.
+type GroupMapping struct {
+	// Teams maps group names to the teams whose members receive TeamRole.
+	Teams    map[string][]string
+	TeamRole string
+	// Roles maps group names to the roles given to their members.
+	Roles map[string][]RoleInstance
+}
+
+// LoadGroupMapping reads a group mapping from the group-teams, team-role and
+// group-roles entries under the given config prefix. Roles are expressed as
+// <role> or <role>:<context value>.
+func LoadGroupMapping(prefix string) (*GroupMapping, error) {
+	teams, err := loadGroupNames(prefix + ":group-teams")
+	if err != nil {
+		return nil, err
+	}
+	teamRole, _ := config.GetString(prefix + ":team-role")
+	if len(teams) > 0 && teamRole == "" {
+		return nil, errors.Errorf("%s:team-role is required when %s:group-teams is set", prefix, prefix)
+	}
+	groupRoles, err := loadGroupNames(prefix + ":group-roles")
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string][]RoleInstance, len(groupRoles))
+	for group, names := range groupRoles {
+		for _, name := range names {
+			parts := strings.SplitN(name, ":", 2)
+			role := RoleInstance{Name: parts[0]}
+			if len(parts) == 2 {
+				role.ContextValue = parts[1]
+			}
+			roles[group] = append(roles[group], role)
+		}
+	}
+	return &GroupMapping{Teams: teams, TeamRole: teamRole, Roles: roles}, nil
+}
+
+// loadGroupNames reads a map of group names to a name or a list of names.
+func loadGroupNames(key string) (map[string][]string, error) {
+	value, err := config.Get(key)
+	if err != nil {
+		return nil, nil
+	}
+	entries, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.Errorf("invalid value for %q, expected a map of group names", key)
+	}
+	result := make(map[string][]string, len(entries))
+	for group, v := range entries {
+		name := fmt.Sprint(group)
+		switch names := v.(type) {
+		case string:
+			result[name] = []string{names}
+		case []interface{}:
+			for _, n := range names {
+				result[name] = append(result[name], fmt.Sprint(n))
+			}
+		default:
+			return nil, errors.Errorf("invalid value for group %q in %q: %v", name, key, v)
+		}
+	}
+	return result, nil
+}
+
+// Empty returns whether the mapping has no groups.
+func (m *GroupMapping) Empty() bool {
+	return m == nil || (len(m.Teams) == 0 && len(m.Roles) == 0)
+}
+
+// Sync gives the user the roles mapped from the groups they belong to,
+// removing mapped roles from groups they left. Roles not present in the
+// mapping are left untouched, so roles given manually are kept.
+func (m *GroupMapping) Sync(user *User, groups []string) error {
+	if m.Empty() {
+		return nil
+	}
+	managed := map[RoleInstance]bool{}
+	for _, teams := range m.Teams {
+		for _, team := range teams {
+			managed[RoleInstance{Name: m.TeamRole, ContextValue: team}] = true
+		}
+	}
+	for _, roles := range m.Roles {
+		for _, role := range roles {
+			managed[role] = true
+		}
+	}
+	wanted := map[RoleInstance]bool{}
+	for _, group := range groups {
+		for _, team := range m.Teams[group] {
+			_, err := GetTeam(team)
+			if err != nil {
+				log.Errorf("unable to add %q to team %q mapped from group %q: %s", user.Email, team, group, err)
+				continue
+			}
+			wanted[RoleInstance{Name: m.TeamRole, ContextValue: team}] = true
+		}
+		for _, role := range m.Roles[group] {
+			wanted[role] = true
+		}
+	}
+	current := map[RoleInstance]bool{}
+	for _, role := range user.Roles {
+		current[role] = true
+	}
+	for role := range current {
+		if managed[role] && !wanted[role] {
+			err := user.RemoveRole(role.Name, role.ContextValue)
+			if err != nil {
+				return errors.Wrapf(err, "unable to remove role %q from %q", role.Name, user.Email)
+			}
+		}
+	}
+	for role := range wanted {
+		if !current[role] {
+			err := user.AddRole(role.Name, role.ContextValue)
+			if err != nil {
+				return errors.Wrapf(err, "unable to add role %q to %q", role.Name, user.Email)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLoadGroupMapping(c *check.C) {
+	config.Set("auth:test:team-role", "team-member")
+	config.Set("auth:test:group-teams", map[interface{}]interface{}{
+		"developers": "myteam",
+		"ops":        []interface{}{"infra", "myteam"},
+	})
+	config.Set("auth:test:group-roles", map[interface{}]interface{}{
+		"admins": []interface{}{"AllowAll", "app-admin:myteam"},
+	})
+	defer config.Unset("auth:test")
+	mapping, err := LoadGroupMapping("auth:test")
+	c.Assert(err, check.IsNil)
+	c.Assert(mapping, check.DeepEquals, &GroupMapping{
+		Teams: map[string][]string{
+			"developers": {"myteam"},
+			"ops":        {"infra", "myteam"},
+		},
+		TeamRole: "team-member",
+		Roles: map[string][]RoleInstance{
+			"admins": {{Name: "AllowAll"}, {Name: "app-admin", ContextValue: "myteam"}},
+		},
+	})
+	c.Assert(mapping.Empty(), check.Equals, false)
+}
+
+func (s *S) TestLoadGroupMappingEmpty(c *check.C) {
+	mapping, err := LoadGroupMapping("auth:test")
+	c.Assert(err, check.IsNil)
+	c.Assert(mapping.Empty(), check.Equals, true)
+}
+
+func (s *S) TestLoadGroupMappingInvalid(c *check.C) {
+	config.Set("auth:test:group-teams", map[interface{}]interface{}{"developers": "myteam"})
+	defer config.Unset("auth:test")
+	_, err := LoadGroupMapping("auth:test")
+	c.Assert(err, check.ErrorMatches, `auth:test:team-role is required when auth:test:group-teams is set`)
+	config.Set("auth:test:team-role", "team-member")
+	config.Set("auth:test:group-roles", []interface{}{"admin"})
+	_, err = LoadGroupMapping("auth:test")
+	c.Assert(err, check.ErrorMatches, `invalid value for "auth:test:group-roles", expected a map of group names`)
+}
+
+func (s *S) TestGroupMappingSync(c *check.C) {
+	for _, r := range []struct{ name, ctx string }{{"team-member", "team"}, {"admin", "global"}, {"manual", "global"}} {
+		_, err := permission.NewRole(r.name, r.ctx, "")
+		c.Assert(err, check.IsNil)
+	}
+	err := s.conn.Teams().Insert(Team{Name: "myteam"})
+	c.Assert(err, check.IsNil)
+	user := &User{Email: "groupie@example.com"}
+	err = user.Create()
+	c.Assert(err, check.IsNil)
+	err = user.AddRole("manual", "")
+	c.Assert(err, check.IsNil)
+	mapping := &GroupMapping{
+		Teams:    map[string][]string{"developers": {"myteam", "missingteam"}},
+		TeamRole: "team-member",
+		Roles:    map[string][]RoleInstance{"admins": {{Name: "admin"}}},
+	}
+	err = mapping.Sync(user, []string{"developers", "admins", "others"})
+	c.Assert(err, check.IsNil)
+	c.Assert(roleSet(user.Roles), check.DeepEquals, map[RoleInstance]bool{
+		{Name: "manual"}: true,
+		{Name: "team-member", ContextValue: "myteam"}: true,
+		{Name: "admin"}: true,
+	})
+	err = mapping.Sync(user, []string{"developers"})
+	c.Assert(err, check.IsNil)
+	c.Assert(roleSet(user.Roles), check.DeepEquals, map[RoleInstance]bool{
+		{Name: "manual"}: true,
+		{Name: "team-member", ContextValue: "myteam"}: true,
+	})
+	err = mapping.Sync(user, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.DeepEquals, []RoleInstance{{Name: "manual"}})
+}
+
+func roleSet(roles []RoleInstance) map[RoleInstance]bool {
+	set := map[RoleInstance]bool{}
+	for _, r := range roles {
+		set[r] = true
+	}
+	return set
+}
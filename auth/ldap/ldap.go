@@ -0,0 +1,340 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ldap implements an authentication scheme backed by an LDAP or
+// Active Directory server. Users log in with their email and directory
+// password, and may have their teams and roles synchronized from the groups
+// they belong to.
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/auth/native"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	goldap "gopkg.in/ldap.v2"
+)
+
+const (
+	defaultUserFilter         = "(mail=%s)"
+	defaultEmailAttribute     = "mail"
+	defaultGroupFilter        = "(member=%s)"
+	defaultGroupNameAttribute = "cn"
+	defaultTimeout            = 10 * time.Second
+)
+
+var (
+	ErrMissingEmailError    = &tsuruErrors.ValidationError{Message: "You must provide an email to login"}
+	ErrMissingPasswordError = &tsuruErrors.ValidationError{Message: "You must provide a password to login"}
+	ErrUserNotInDirectory   = auth.AuthenticationFailure{Message: "Authentication failed, user not found in the directory."}
+	ErrInvalidCredentials   = auth.AuthenticationFailure{Message: "Authentication failed, wrong password."}
+)
+
+type LDAPAuthScheme struct {
+	BaseConfig BaseConfig
+}
+
+// BaseConfig holds the settings used to reach the directory and to map its
+// groups to tsuru teams and roles.
+type BaseConfig struct {
+	URL                string
+	StartTLS           bool
+	TLSConfig          *tls.Config
+	Timeout            time.Duration
+	BindDN             string
+	BindPassword       string
+	UserBaseDN         string
+	UserFilter         string
+	EmailAttribute     string
+	GroupBaseDN        string
+	GroupFilter        string
+	GroupNameAttribute string
+	GroupMapping       *auth.GroupMapping
+}
+
+func init() {
+	auth.RegisterScheme("ldap", &LDAPAuthScheme{})
+}
+
+// This method loads basic config and returns a copy of the
+// config object.
+func (s *LDAPAuthScheme) loadConfig() (BaseConfig, error) {
+	if s.BaseConfig.URL != "" {
+		return s.BaseConfig, nil
+	}
+	var emptyConfig BaseConfig
+	ldapURL, err := config.GetString("auth:ldap:url")
+	if err != nil {
+		return emptyConfig, err
+	}
+	userBaseDN, err := config.GetString("auth:ldap:user-base-dn")
+	if err != nil {
+		return emptyConfig, err
+	}
+	conf := BaseConfig{
+		URL:                ldapURL,
+		UserBaseDN:         userBaseDN,
+		UserFilter:         defaultUserFilter,
+		EmailAttribute:     defaultEmailAttribute,
+		GroupFilter:        defaultGroupFilter,
+		GroupNameAttribute: defaultGroupNameAttribute,
+		Timeout:            defaultTimeout,
+	}
+	u, err := url.Parse(ldapURL)
+	if err != nil {
+		return emptyConfig, errors.Wrapf(err, "invalid auth:ldap:url %q", ldapURL)
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return emptyConfig, errors.Errorf("invalid auth:ldap:url %q, scheme must be ldap or ldaps", ldapURL)
+	}
+	conf.StartTLS, _ = config.GetBool("auth:ldap:start-tls")
+	if conf.StartTLS || u.Scheme == "ldaps" {
+		conf.TLSConfig, err = tlsConfig(u.Hostname())
+		if err != nil {
+			return emptyConfig, err
+		}
+	}
+	if timeout, _ := config.GetInt("auth:ldap:timeout"); timeout > 0 {
+		conf.Timeout = time.Duration(timeout) * time.Second
+	}
+	conf.BindDN, _ = config.GetString("auth:ldap:bind-dn")
+	conf.BindPassword, _ = config.GetString("auth:ldap:bind-password")
+	if filter, _ := config.GetString("auth:ldap:user-filter"); filter != "" {
+		conf.UserFilter = filter
+	}
+	if attr, _ := config.GetString("auth:ldap:email-attribute"); attr != "" {
+		conf.EmailAttribute = attr
+	}
+	conf.GroupBaseDN, _ = config.GetString("auth:ldap:group-base-dn")
+	if filter, _ := config.GetString("auth:ldap:group-filter"); filter != "" {
+		conf.GroupFilter = filter
+	}
+	if attr, _ := config.GetString("auth:ldap:group-name-attribute"); attr != "" {
+		conf.GroupNameAttribute = attr
+	}
+	conf.GroupMapping, err = auth.LoadGroupMapping("auth:ldap")
+	if err != nil {
+		return emptyConfig, err
+	}
+	s.BaseConfig = conf
+	return s.BaseConfig, nil
+}
+
+func tlsConfig(serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: serverName}
+	cfg.InsecureSkipVerify, _ = config.GetBool("auth:ldap:tls:insecure-skip-verify")
+	caFile, _ := config.GetString("auth:ldap:tls:ca-file")
+	if caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, errors.Errorf("no certificates found in %q", caFile)
+		}
+	}
+	return cfg, nil
+}
+
+func (s *LDAPAuthScheme) dial(conf BaseConfig) (*goldap.Conn, error) {
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "389"
+		if u.Scheme == "ldaps" {
+			port = "636"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	dialer := &net.Dialer{Timeout: conf.Timeout}
+	var netConn net.Conn
+	if u.Scheme == "ldaps" {
+		netConn, err = tls.DialWithDialer(dialer, "tcp", host, conf.TLSConfig)
+	} else {
+		netConn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to connect to ldap server %s", conf.URL)
+	}
+	conn := goldap.NewConn(netConn, u.Scheme == "ldaps")
+	conn.SetTimeout(conf.Timeout)
+	conn.Start()
+	if conf.StartTLS && u.Scheme == "ldap" {
+		err = conn.StartTLS(conf.TLSConfig)
+		if err != nil {
+			conn.Close()
+			return nil, errors.Wrap(err, "unable to start tls")
+		}
+	}
+	return conn, nil
+}
+
+// bindService binds the connection with the service account, used to search
+// the directory. Without a configured account, searches are anonymous.
+func bindService(conn *goldap.Conn, conf BaseConfig) error {
+	if conf.BindDN == "" {
+		return nil
+	}
+	err := conn.Bind(conf.BindDN, conf.BindPassword)
+	return errors.Wrap(err, "unable to bind with the service account")
+}
+
+// authenticate checks the user password against the directory, returning
+// the names of the groups the user belongs to.
+func (s *LDAPAuthScheme) authenticate(email, password string) ([]string, error) {
+	conf, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.dial(conf)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = bindService(conn, conf)
+	if err != nil {
+		return nil, err
+	}
+	result, err := conn.Search(goldap.NewSearchRequest(
+		conf.UserBaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 2, 0, false,
+		strings.Replace(conf.UserFilter, "%s", goldap.EscapeFilter(email), -1),
+		[]string{"dn", conf.EmailAttribute}, nil,
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to search user in the directory")
+	}
+	if len(result.Entries) == 0 {
+		return nil, ErrUserNotInDirectory
+	}
+	if len(result.Entries) > 1 {
+		return nil, errors.Errorf("more than one entry found in the directory for %q", email)
+	}
+	userDN := result.Entries[0].DN
+	err = conn.Bind(userDN, password)
+	if err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, errors.Wrap(err, "unable to bind as user")
+	}
+	if conf.GroupBaseDN == "" {
+		return nil, nil
+	}
+	err = bindService(conn, conf)
+	if err != nil {
+		return nil, err
+	}
+	result, err = conn.Search(goldap.NewSearchRequest(
+		conf.GroupBaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases, 0, 0, false,
+		strings.Replace(conf.GroupFilter, "%s", goldap.EscapeFilter(userDN), -1),
+		[]string{conf.GroupNameAttribute}, nil,
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to search user groups in the directory")
+	}
+	groups := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		if name := entry.GetAttributeValue(conf.GroupNameAttribute); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func (s *LDAPAuthScheme) Login(params map[string]string) (auth.Token, error) {
+	email, ok := params["email"]
+	if !ok || email == "" {
+		return nil, ErrMissingEmailError
+	}
+	// An empty password would result in an unauthenticated bind, which most
+	// servers accept.
+	password, ok := params["password"]
+	if !ok || password == "" {
+		return nil, ErrMissingPasswordError
+	}
+	conf, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.authenticate(email, password)
+	if err != nil {
+		return nil, err
+	}
+	user, err := auth.GetUserByEmail(email)
+	if err != nil {
+		if err != auth.ErrUserNotFound {
+			return nil, err
+		}
+		registrationEnabled, _ := config.GetBool("auth:user-registration")
+		if !registrationEnabled {
+			return nil, err
+		}
+		user, err = s.Create(&auth.User{Email: email})
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = conf.GroupMapping.Sync(user, groups)
+	if err != nil {
+		return nil, err
+	}
+	return auth.CreateUserToken(user)
+}
+
+func (s *LDAPAuthScheme) AppLogin(appName string) (auth.Token, error) {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.AppLogin(appName)
+}
+
+func (s *LDAPAuthScheme) AppLogout(token string) error {
+	return s.Logout(token)
+}
+
+func (s *LDAPAuthScheme) Logout(token string) error {
+	return auth.DeleteUserToken(token)
+}
+
+func (s *LDAPAuthScheme) Auth(token string) (auth.Token, error) {
+	return auth.GetUserToken(token)
+}
+
+func (s *LDAPAuthScheme) Name() string {
+	return "ldap"
+}
+
+func (s *LDAPAuthScheme) Info() (auth.SchemeInfo, error) {
+	return nil, nil
+}
+
+// Create adds the user to tsuru. Passwords are kept in the directory, so
+// they're never stored.
+func (s *LDAPAuthScheme) Create(user *auth.User) (*auth.User, error) {
+	user.Password = ""
+	if err := user.Create(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *LDAPAuthScheme) Remove(u *auth.User) error {
+	if err := auth.DeleteUserTokens(u.Email); err != nil {
+		return err
+	}
+	return u.Delete()
+}
@@ -0,0 +1,221 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLoadConfig(c *check.C) {
+	config.Set("auth:ldap:start-tls", true)
+	config.Set("auth:ldap:tls:insecure-skip-verify", true)
+	config.Set("auth:ldap:group-base-dn", "ou=groups,dc=example,dc=com")
+	config.Set("auth:ldap:team-role", "team-member")
+	config.Set("auth:ldap:group-teams", map[interface{}]interface{}{
+		"developers": "myteam",
+		"ops":        []interface{}{"infra", "myteam"},
+	})
+	config.Set("auth:ldap:group-roles", map[interface{}]interface{}{
+		"admins": []interface{}{"AllowAll", "app-admin:myteam"},
+	})
+	conf, err := s.scheme.loadConfig()
+	c.Assert(err, check.IsNil)
+	c.Assert(conf.StartTLS, check.Equals, true)
+	c.Assert(conf.TLSConfig.InsecureSkipVerify, check.Equals, true)
+	c.Assert(conf.TLSConfig.ServerName, check.Equals, "127.0.0.1")
+	c.Assert(conf.UserFilter, check.Equals, "(mail=%s)")
+	c.Assert(conf.GroupFilter, check.Equals, "(member=%s)")
+	c.Assert(conf.GroupMapping, check.DeepEquals, &auth.GroupMapping{
+		Teams: map[string][]string{
+			"developers": {"myteam"},
+			"ops":        {"infra", "myteam"},
+		},
+		TeamRole: "team-member",
+		Roles: map[string][]auth.RoleInstance{
+			"admins": {{Name: "AllowAll"}, {Name: "app-admin", ContextValue: "myteam"}},
+		},
+	})
+}
+
+func (s *S) TestLoadConfigInvalid(c *check.C) {
+	config.Set("auth:ldap:url", "http://ldap.example.com")
+	_, err := s.scheme.loadConfig()
+	c.Assert(err, check.ErrorMatches, `invalid auth:ldap:url "http://ldap.example.com", scheme must be ldap or ldaps`)
+	config.Set("auth:ldap:url", s.server.URL())
+	config.Set("auth:ldap:group-teams", map[interface{}]interface{}{"developers": "myteam"})
+	_, err = s.scheme.loadConfig()
+	c.Assert(err, check.ErrorMatches, `auth:ldap:team-role is required when auth:ldap:group-teams is set`)
+}
+
+func (s *S) TestAuthenticate(c *check.C) {
+	config.Set("auth:ldap:group-base-dn", "ou=groups,dc=example,dc=com")
+	groups, err := s.scheme.authenticate("jdoe@example.com", "s3cr3t")
+	c.Assert(err, check.IsNil)
+	c.Assert(groups, check.DeepEquals, []string{"developers"})
+	c.Assert(s.server.bindDNs(), check.DeepEquals, []string{serviceDN, userDN, serviceDN})
+}
+
+func (s *S) TestAuthenticateAnonymousSearch(c *check.C) {
+	config.Unset("auth:ldap:bind-dn")
+	config.Unset("auth:ldap:bind-password")
+	groups, err := s.scheme.authenticate("jdoe@example.com", "s3cr3t")
+	c.Assert(err, check.IsNil)
+	c.Assert(groups, check.IsNil)
+	c.Assert(s.server.bindDNs(), check.DeepEquals, []string{userDN})
+}
+
+func (s *S) TestAuthenticateCustomFilter(c *check.C) {
+	config.Set("auth:ldap:user-filter", "(&(uid=*)(|(mail=%s)(uid=%s)))")
+	_, err := s.scheme.authenticate("jdoe", "s3cr3t")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAuthenticateWrongPassword(c *check.C) {
+	_, err := s.scheme.authenticate("jdoe@example.com", "wrong")
+	c.Assert(err, check.Equals, ErrInvalidCredentials)
+}
+
+func (s *S) TestAuthenticateUserNotFound(c *check.C) {
+	_, err := s.scheme.authenticate("nobody@example.com", "s3cr3t")
+	c.Assert(err, check.Equals, ErrUserNotInDirectory)
+}
+
+func (s *S) TestAuthenticateFilterInjection(c *check.C) {
+	_, err := s.scheme.authenticate("*)(uid=*", "s3cr3t")
+	c.Assert(err, check.Equals, ErrUserNotInDirectory)
+}
+
+func (s *S) TestAuthenticateWrongServicePassword(c *check.C) {
+	config.Set("auth:ldap:bind-password", "wrong")
+	_, err := s.scheme.authenticate("jdoe@example.com", "s3cr3t")
+	c.Assert(err, check.ErrorMatches, `unable to bind with the service account: .*`)
+}
+
+func (s *S) TestAuthenticateStartTLS(c *check.C) {
+	config.Set("auth:ldap:start-tls", true)
+	config.Set("auth:ldap:tls:insecure-skip-verify", true)
+	_, err := s.scheme.authenticate("jdoe@example.com", "s3cr3t")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.server.startTLS, check.Equals, 1)
+}
+
+func (s *S) TestAuthenticateStartTLSUntrustedCertificate(c *check.C) {
+	config.Set("auth:ldap:start-tls", true)
+	_, err := s.scheme.authenticate("jdoe@example.com", "s3cr3t")
+	c.Assert(err, check.ErrorMatches, `unable to start tls: .*`)
+}
+
+func (s *S) TestLogin(c *check.C) {
+	token, err := s.scheme.Login(map[string]string{"email": "jdoe@example.com", "password": "s3cr3t"})
+	c.Assert(err, check.IsNil)
+	c.Assert(token.GetUserName(), check.Equals, "jdoe@example.com")
+	user, err := auth.GetUserByEmail("jdoe@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Password, check.Equals, "")
+	authToken, err := s.scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.IsNil)
+	c.Assert(authToken.GetUserName(), check.Equals, "jdoe@example.com")
+}
+
+func (s *S) TestLoginRegistrationDisabled(c *check.C) {
+	config.Set("auth:user-registration", false)
+	defer config.Set("auth:user-registration", true)
+	_, err := s.scheme.Login(map[string]string{"email": "jdoe@example.com", "password": "s3cr3t"})
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestLoginMissingParams(c *check.C) {
+	_, err := s.scheme.Login(map[string]string{"password": "s3cr3t"})
+	c.Assert(err, check.Equals, ErrMissingEmailError)
+	_, err = s.scheme.Login(map[string]string{"email": "jdoe@example.com", "password": ""})
+	c.Assert(err, check.Equals, ErrMissingPasswordError)
+	c.Assert(s.server.bindDNs(), check.HasLen, 0)
+}
+
+func (s *S) TestLoginWrongPassword(c *check.C) {
+	_, err := s.scheme.Login(map[string]string{"email": "jdoe@example.com", "password": "wrong"})
+	c.Assert(err, check.Equals, ErrInvalidCredentials)
+	_, err = auth.GetUserByEmail("jdoe@example.com")
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestLoginSyncsTeamsAndRoles(c *check.C) {
+	_, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("admin", "global", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("manual", "global", "")
+	c.Assert(err, check.IsNil)
+	err = s.conn.Teams().Insert(auth.Team{Name: "myteam"})
+	c.Assert(err, check.IsNil)
+	config.Set("auth:ldap:group-base-dn", "ou=groups,dc=example,dc=com")
+	config.Set("auth:ldap:team-role", "team-member")
+	config.Set("auth:ldap:group-teams", map[interface{}]interface{}{
+		"developers": []interface{}{"myteam", "missingteam"},
+	})
+	config.Set("auth:ldap:group-roles", map[interface{}]interface{}{
+		"developers": "admin",
+	})
+	_, err = s.scheme.Login(map[string]string{"email": "jdoe@example.com", "password": "s3cr3t"})
+	c.Assert(err, check.IsNil)
+	user, err := auth.GetUserByEmail("jdoe@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.HasLen, 2)
+	roles := map[auth.RoleInstance]bool{}
+	for _, r := range user.Roles {
+		roles[r] = true
+	}
+	c.Assert(roles, check.DeepEquals, map[auth.RoleInstance]bool{
+		{Name: "team-member", ContextValue: "myteam"}: true,
+		{Name: "admin"}: true,
+	})
+	err = user.AddRole("manual", "")
+	c.Assert(err, check.IsNil)
+	s.server.setAttr(groupDN, "member", serviceDN)
+	_, err = s.scheme.Login(map[string]string{"email": "jdoe@example.com", "password": "s3cr3t"})
+	c.Assert(err, check.IsNil)
+	err = user.Reload()
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.DeepEquals, []auth.RoleInstance{{Name: "manual"}})
+}
+
+func (s *S) TestLogout(c *check.C) {
+	token, err := s.scheme.Login(map[string]string{"email": "jdoe@example.com", "password": "s3cr3t"})
+	c.Assert(err, check.IsNil)
+	err = s.scheme.Logout(token.GetValue())
+	c.Assert(err, check.IsNil)
+	_, err = s.scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+}
+
+func (s *S) TestCreate(c *check.C) {
+	user := &auth.User{Email: "jane@example.com", Password: "123456"}
+	created, err := s.scheme.Create(user)
+	c.Assert(err, check.IsNil)
+	c.Assert(created.Password, check.Equals, "")
+	dbUser, err := auth.GetUserByEmail("jane@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbUser.Password, check.Equals, "")
+}
+
+func (s *S) TestRemove(c *check.C) {
+	token, err := s.scheme.Login(map[string]string{"email": "jdoe@example.com", "password": "s3cr3t"})
+	c.Assert(err, check.IsNil)
+	user, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = s.scheme.Remove(user)
+	c.Assert(err, check.IsNil)
+	_, err = auth.GetUserByEmail("jdoe@example.com")
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+	_, err = s.scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+}
+
+func (s *S) TestName(c *check.C) {
+	c.Assert(s.scheme.Name(), check.Equals, "ldap")
+}
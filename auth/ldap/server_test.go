@@ -0,0 +1,227 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"gopkg.in/asn1-ber.v1"
+	goldap "gopkg.in/ldap.v2"
+)
+
+type fakeEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// fakeServer is a minimal in-process LDAP server, supporting simple binds,
+// searches with and, or, not, equality and presence filters and StartTLS.
+type fakeServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	mu        sync.Mutex
+	entries   []fakeEntry
+	binds     []string
+	startTLS  int
+}
+
+func newFakeServer() (*fakeServer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	certs := srv.TLS.Certificates
+	srv.Close()
+	s := &fakeServer{listener: l, tlsConfig: &tls.Config{Certificates: certs}}
+	go s.serve()
+	return s, nil
+}
+
+func (s *fakeServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *fakeServer) Close() {
+	s.listener.Close()
+}
+
+func (s *fakeServer) reset(entries ...fakeEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = entries
+	s.binds = nil
+	s.startTLS = 0
+}
+
+func (s *fakeServer) setAttr(dn, name string, values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) {
+			e.attrs[name] = values
+		}
+	}
+}
+
+func (s *fakeServer) bindDNs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer func() { conn.Close() }()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case goldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			conn.Write(result(id, goldap.ApplicationBindResponse, s.bind(dn, password)).Bytes())
+		case goldap.ApplicationSearchRequest:
+			base := op.Children[0].Value.(string)
+			for _, e := range s.search(base, op.Children[6]) {
+				conn.Write(entryPacket(id, e).Bytes())
+			}
+			conn.Write(result(id, goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess).Bytes())
+		case goldap.ApplicationExtendedRequest:
+			s.mu.Lock()
+			s.startTLS++
+			s.mu.Unlock()
+			conn.Write(result(id, goldap.ApplicationExtendedResponse, goldap.LDAPResultSuccess).Bytes())
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+		default:
+			return
+		}
+	}
+}
+
+func (s *fakeServer) bind(dn, password string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.binds = append(s.binds, dn)
+	if dn == "" && password == "" {
+		return goldap.LDAPResultSuccess
+	}
+	for _, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) && e.password != "" && e.password == password {
+			return goldap.LDAPResultSuccess
+		}
+	}
+	return goldap.LDAPResultInvalidCredentials
+}
+
+func (s *fakeServer) search(base string, filter *ber.Packet) []fakeEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []fakeEntry
+	for _, e := range s.entries {
+		if strings.HasSuffix(strings.ToLower(e.dn), strings.ToLower(base)) && matches(e, filter) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+func matches(e fakeEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case goldap.FilterAnd:
+		for _, f := range filter.Children {
+			if !matches(e, f) {
+				return false
+			}
+		}
+		return true
+	case goldap.FilterOr:
+		for _, f := range filter.Children {
+			if matches(e, f) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterNot:
+		return !matches(e, filter.Children[0])
+	case goldap.FilterEqualityMatch:
+		name := filter.Children[0].Data.String()
+		value := filter.Children[1].Data.String()
+		for _, v := range attrValues(e, name) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterPresent:
+		return len(attrValues(e, filter.Data.String())) > 0
+	}
+	return false
+}
+
+func attrValues(e fakeEntry, name string) []string {
+	for k, v := range e.attrs {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+func envelope(id int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func result(id int64, tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return envelope(id, op)
+}
+
+func entryPacket(id int64, e fakeEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "Object Name"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range e.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return envelope(id, op)
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ldap
+
+import (
+	"testing"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/repository/repositorytest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	conn   *db.Storage
+	server *fakeServer
+	scheme *LDAPAuthScheme
+}
+
+var _ = check.Suite(&S{})
+
+const (
+	serviceDN = "cn=tsuru,ou=services,dc=example,dc=com"
+	userDN    = "uid=jdoe,ou=people,dc=example,dc=com"
+	groupDN   = "cn=developers,ou=groups,dc=example,dc=com"
+	adminsDN  = "cn=admins,ou=groups,dc=example,dc=com"
+)
+
+func (s *S) SetUpSuite(c *check.C) {
+	var err error
+	s.server, err = newFakeServer()
+	c.Assert(err, check.IsNil)
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_auth_ldap_test")
+	config.Set("auth:user-registration", true)
+	config.Set("repo-manager", "fake")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.conn, _ = db.Conn()
+	repositorytest.Reset()
+	s.server.reset(
+		fakeEntry{dn: serviceDN, password: "service-secret", attrs: map[string][]string{"cn": {"tsuru"}}},
+		fakeEntry{dn: userDN, password: "s3cr3t", attrs: map[string][]string{
+			"uid":  {"jdoe"},
+			"mail": {"jdoe@example.com"},
+		}},
+		fakeEntry{dn: groupDN, attrs: map[string][]string{"cn": {"developers"}, "member": {userDN}}},
+		fakeEntry{dn: adminsDN, attrs: map[string][]string{"cn": {"admins"}, "member": {serviceDN}}},
+	)
+	config.Unset("auth:ldap")
+	config.Set("auth:ldap:url", s.server.URL())
+	config.Set("auth:ldap:user-base-dn", "ou=people,dc=example,dc=com")
+	config.Set("auth:ldap:bind-dn", serviceDN)
+	config.Set("auth:ldap:bind-password", "service-secret")
+	s.scheme = &LDAPAuthScheme{}
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	err := dbtest.ClearAllCollections(s.conn.Users().Database)
+	c.Assert(err, check.IsNil)
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	s.server.Close()
+	config.Unset("auth:ldap")
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Users().Database.DropDatabase()
+}
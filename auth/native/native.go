@@ -39,11 +39,14 @@ func (s NativeScheme) Login(params map[string]string) (auth.Token, error) {
 	if err != nil {
 		return nil, err
 	}
-	token, err := createToken(user, password)
+	if err = checkPassword(user.Password, password); err != nil {
+		return nil, err
+	}
+	restricted, err := checkTwoFactor(user, params["otp"])
 	if err != nil {
 		return nil, err
 	}
-	return token, nil
+	return insertToken(user, restricted)
 }
 
 func (s NativeScheme) Auth(token string) (auth.Token, error) {
@@ -139,6 +142,10 @@ func (s NativeScheme) Remove(u *auth.User) error {
 	if err != nil {
 		return err
 	}
+	err = removeTwoFactor(u.Email)
+	if err != nil {
+		return err
+	}
 	return u.Delete()
 }
 
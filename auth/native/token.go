@@ -41,6 +41,9 @@ type Token struct {
 	Expires   time.Duration `json:"expires"`
 	UserEmail string        `json:"email"`
 	AppName   string        `json:"app"`
+	// Restricted tokens have no permissions until the user enrolls in
+	// two-factor authentication.
+	Restricted bool `json:"restricted"`
 }
 
 func (t *Token) GetValue() string {
@@ -63,7 +66,14 @@ func (t *Token) GetAppName() string {
 	return t.AppName
 }
 
+func (t *Token) IsRestricted() bool {
+	return t.Restricted
+}
+
 func (t *Token) Permissions() ([]permission.Permission, error) {
+	if t.Restricted {
+		return []permission.Permission{}, nil
+	}
 	return auth.BaseTokenPermission(t)
 }
 
@@ -176,6 +186,10 @@ func createToken(u *auth.User, password string) (*Token, error) {
 	if err := checkPassword(u.Password, password); err != nil {
 		return nil, err
 	}
+	return insertToken(u, false)
+}
+
+func insertToken(u *auth.User, restricted bool) (*Token, error) {
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
@@ -185,6 +199,7 @@ func createToken(u *auth.User, password string) (*Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	token.Restricted = restricted
 	err = conn.Tokens().Insert(token)
 	go removeOldTokens(u.Email)
 	return token, err
@@ -0,0 +1,490 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/permission"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSecretSize    = 20
+	recoveryCodes     = 10
+	recoveryCodeSize  = 10
+	defaultOTPIssuer  = "tsuru"
+	defaultAttempts   = 5
+	defaultLockout    = 5 * time.Minute
+	recoveryCodeChars = "abcdefghijklmnopqrstuvwxyz234567"
+)
+
+var (
+	ErrInvalidTwoFactorCode    = auth.AuthenticationFailure{Message: "Authentication failed, invalid two-factor authentication code."}
+	ErrTwoFactorNotEnabled     = &errors.ValidationError{Message: "two-factor authentication is not enabled"}
+	ErrTwoFactorAlreadyEnabled = &errors.ConflictError{Message: "two-factor authentication is already enabled"}
+	ErrTwoFactorNotStarted     = &errors.ValidationError{Message: "two-factor authentication enrollment was not started"}
+	ErrTwoFactorLocked         = auth.AuthenticationFailure{Message: "Authentication failed, too many invalid two-factor authentication codes. Try again later."}
+
+	// now is replaced in tests to generate codes for a known time.
+	now = time.Now
+)
+
+type twoFactor struct {
+	Email         string `bson:"_id"`
+	Secret        string
+	Enabled       bool
+	LastStep      int64
+	RecoveryCodes []string
+	Failures      int
+	LockedUntil   time.Time
+}
+
+func getTwoFactor(email string) (*twoFactor, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var tf twoFactor
+	err = conn.TwoFactor().FindId(email).One(&tf)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tf, nil
+}
+
+func removeTwoFactor(email string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.TwoFactor().RemoveId(email)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// totpCode generates the code for the given time step, as defined in RFC
+// 6238, using HMAC-SHA1.
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	h := hmac.New(sha1.New, secret)
+	h.Write(msg[:])
+	sum := h.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+}
+
+// totpStep returns the time step matching the code, accepting one step of
+// clock drift in each direction. Steps up to lastStep are rejected, so a code
+// can't be used twice.
+func totpStep(secret, code string, lastStep int64) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+	current := now().Unix() / totpPeriod
+	for step := current - 1; step <= current+1; step++ {
+		if step > lastStep && hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	_, err := strconv.Atoi(code)
+	return err == nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func attemptsLimit() (int, time.Duration) {
+	attempts, err := config.GetInt("auth:two-factor:max-attempts")
+	if err != nil || attempts <= 0 {
+		attempts = defaultAttempts
+	}
+	lockout := defaultLockout
+	if seconds, err := config.GetInt("auth:two-factor:lockout-time"); err == nil && seconds > 0 {
+		lockout = time.Duration(seconds) * time.Second
+	}
+	return attempts, lockout
+}
+
+// reserveAttempt counts a verification attempt before the code is checked,
+// so concurrent attempts can't go past the limit. After the configured
+// number of invalid codes in a row, codes are rejected until the lockout
+// time passes.
+func (tf *twoFactor) reserveAttempt(conn *db.Storage) error {
+	attempts, lockout := attemptsLimit()
+	var updated twoFactor
+	_, err := conn.TwoFactor().Find(bson.M{
+		"_id":         tf.Email,
+		"lockeduntil": bson.M{"$not": bson.M{"$gt": now()}},
+	}).Apply(mgo.Change{Update: bson.M{"$inc": bson.M{"failures": 1}}, ReturnNew: true}, &updated)
+	if err == mgo.ErrNotFound {
+		return ErrTwoFactorLocked
+	}
+	if err != nil {
+		return err
+	}
+	if updated.Failures > attempts {
+		err = conn.TwoFactor().UpdateId(tf.Email, bson.M{"$set": bson.M{"failures": 0, "lockeduntil": now().Add(lockout)}})
+		if err != nil {
+			return err
+		}
+		return ErrTwoFactorLocked
+	}
+	return nil
+}
+
+// verify checks a TOTP code or a recovery code, limiting the number of
+// invalid attempts. Valid codes reset the count of invalid attempts.
+func (tf *twoFactor) verify(code string, allowRecovery bool) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = tf.reserveAttempt(conn)
+	if err != nil {
+		return err
+	}
+	err = tf.checkCode(conn, code, allowRecovery)
+	if err != nil {
+		return err
+	}
+	return conn.TwoFactor().UpdateId(tf.Email, bson.M{"$set": bson.M{"failures": 0}})
+}
+
+// checkCode checks a TOTP code or a recovery code, storing the used step or
+// removing the used recovery code. The update is conditional to the stored
+// state, so concurrent logins can't use the same code.
+func (tf *twoFactor) checkCode(conn *db.Storage, code string, allowRecovery bool) error {
+	var err error
+	code = strings.TrimSpace(code)
+	if isTOTPCode(code) {
+		step, ok := totpStep(tf.Secret, code, tf.LastStep)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		err = conn.TwoFactor().Update(
+			bson.M{"_id": tf.Email, "laststep": bson.M{"$lt": step}},
+			bson.M{"$set": bson.M{"laststep": step}},
+		)
+		if err == mgo.ErrNotFound {
+			return ErrInvalidTwoFactorCode
+		}
+		if err == nil {
+			tf.LastStep = step
+		}
+		return err
+	}
+	if !allowRecovery {
+		return ErrInvalidTwoFactorCode
+	}
+	code = normalizeRecoveryCode(code)
+	for _, hash := range tf.RecoveryCodes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) != nil {
+			continue
+		}
+		err = conn.TwoFactor().Update(
+			bson.M{"_id": tf.Email, "recoverycodes": hash},
+			bson.M{"$pull": bson.M{"recoverycodes": hash}},
+		)
+		if err == mgo.ErrNotFound {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+func randomString(size int, chars string) (string, error) {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+	for i := range data {
+		data[i] = chars[int(data[i])%len(chars)]
+	}
+	return string(data), nil
+}
+
+// generateRecoveryCodes returns the recovery codes shown to the user, in the
+// xxxxx-xxxxx format, and their hashes.
+func generateRecoveryCodes() ([]string, []string, error) {
+	if err := loadConfig(); err != nil {
+		return nil, nil, err
+	}
+	codes := make([]string, recoveryCodes)
+	hashes := make([]string, recoveryCodes)
+	for i := range codes {
+		code, err := randomString(recoveryCodeSize, recoveryCodeChars)
+		if err != nil {
+			return nil, nil, err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), cost)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = code[:recoveryCodeSize/2] + "-" + code[recoveryCodeSize/2:]
+		hashes[i] = string(hash)
+	}
+	return codes, hashes, nil
+}
+
+func provisioningURI(email, secret string) string {
+	issuer, _ := config.GetString("auth:two-factor:issuer")
+	if issuer == "" {
+		issuer = defaultOTPIssuer
+	}
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totpDigits))
+	query.Set("period", strconv.Itoa(totpPeriod))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + email,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// twoFactorRequired checks whether the policy defined in the
+// auth:two-factor settings requires the user to use two-factor
+// authentication. Users are required to use it when holding any global role,
+// if auth:two-factor:required-for-global-roles is enabled, or any of the
+// permissions listed in auth:two-factor:required-permissions.
+func twoFactorRequired(user *auth.User) (bool, error) {
+	required, _ := config.GetList("auth:two-factor:required-permissions")
+	globalRoles, _ := config.GetBool("auth:two-factor:required-for-global-roles")
+	if len(required) == 0 && !globalRoles {
+		return false, nil
+	}
+	if globalRoles {
+		for _, roleData := range user.Roles {
+			role, err := permission.FindRole(roleData.Name)
+			if err != nil {
+				if err == permission.ErrRoleNotFound {
+					continue
+				}
+				return false, err
+			}
+			if role.ContextType == permission.CtxGlobal {
+				return true, nil
+			}
+		}
+	}
+	if len(required) == 0 {
+		return false, nil
+	}
+	perms, err := user.Permissions()
+	if err != nil {
+		return false, err
+	}
+	for _, perm := range perms {
+		if perm.Scheme == permission.PermUser || perm.Deny {
+			continue
+		}
+		name := perm.Scheme.FullName()
+		for _, req := range required {
+			req = strings.TrimSuffix(req, ".*")
+			if name == "" || name == req || strings.HasPrefix(name, req+".") || strings.HasPrefix(req, name+".") {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// checkTwoFactor validates the second factor of a login. It returns whether
+// the token must be restricted, because the user is required to use
+// two-factor authentication and haven't enrolled yet.
+func checkTwoFactor(user *auth.User, code string) (bool, error) {
+	tf, err := getTwoFactor(user.Email)
+	if err != nil {
+		return false, err
+	}
+	if tf != nil && tf.Enabled {
+		if code == "" {
+			return false, auth.ErrTwoFactorRequired
+		}
+		return false, tf.verify(code, true)
+	}
+	return twoFactorRequired(user)
+}
+
+func (s NativeScheme) StartTwoFactorEnrollment(user *auth.User) (*auth.TwoFactorEnrollment, error) {
+	tf, err := getTwoFactor(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if tf != nil && tf.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	key := make([]byte, totpSecretSize)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key)
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_, err = conn.TwoFactor().UpsertId(user.Email, twoFactor{Email: user.Email, Secret: secret})
+	if err != nil {
+		return nil, err
+	}
+	return &auth.TwoFactorEnrollment{Secret: secret, URI: provisioningURI(user.Email, secret)}, nil
+}
+
+// ConfirmTwoFactorEnrollment enables two-factor authentication after the
+// user proves the authenticator app was provisioned, returning the recovery
+// codes. Restricted tokens of the user are granted their permissions.
+func (s NativeScheme) ConfirmTwoFactorEnrollment(user *auth.User, code string) ([]string, error) {
+	tf, err := getTwoFactor(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil {
+		return nil, ErrTwoFactorNotStarted
+	}
+	if tf.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	err = tf.verify(code, false)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = conn.TwoFactor().UpdateId(user.Email, bson.M{"$set": bson.M{"enabled": true, "recoverycodes": hashes}})
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Tokens().UpdateAll(
+		bson.M{"useremail": user.Email, "restricted": true},
+		bson.M{"$set": bson.M{"restricted": false}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s NativeScheme) DisableTwoFactor(user *auth.User, code string) error {
+	tf, err := getTwoFactor(user.Email)
+	if err != nil {
+		return err
+	}
+	if tf == nil || !tf.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+	err = tf.verify(code, true)
+	if err != nil {
+		return err
+	}
+	return removeTwoFactor(user.Email)
+}
+
+// ResetTwoFactor disables two-factor authentication without a code, used by
+// admins when users lose both their device and recovery codes.
+func (s NativeScheme) ResetTwoFactor(user *auth.User) error {
+	return removeTwoFactor(user.Email)
+}
+
+func (s NativeScheme) RegenerateRecoveryCodes(user *auth.User, code string) ([]string, error) {
+	tf, err := getTwoFactor(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil || !tf.Enabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	err = tf.verify(code, false)
+	if err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = conn.TwoFactor().UpdateId(user.Email, bson.M{"$set": bson.M{"recoverycodes": hashes}})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s NativeScheme) TwoFactorStatus(user *auth.User) (*auth.TwoFactorStatus, error) {
+	tf, err := getTwoFactor(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	required, err := twoFactorRequired(user)
+	if err != nil {
+		return nil, err
+	}
+	status := auth.TwoFactorStatus{Required: required}
+	if tf != nil && tf.Enabled {
+		status.Enabled = true
+		status.RecoveryCodesLeft = len(tf.RecoveryCodes)
+	}
+	return &status, nil
+}
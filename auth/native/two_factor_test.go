@@ -0,0 +1,335 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package native
+
+import (
+	"encoding/base32"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func fixedNow(t time.Time) func() {
+	now = func() time.Time { return t }
+	return func() { now = time.Now }
+}
+
+func currentCode(c *check.C, secret string, offset int64) string {
+	key, err := decodeSecret(secret)
+	c.Assert(err, check.IsNil)
+	return totpCode(key, now().Unix()/totpPeriod+offset)
+}
+
+func (s *S) enroll(c *check.C) (string, []string) {
+	enrollment, err := nativeScheme.StartTwoFactorEnrollment(s.user)
+	c.Assert(err, check.IsNil)
+	codes, err := nativeScheme.ConfirmTwoFactorEnrollment(s.user, currentCode(c, enrollment.Secret, 0))
+	c.Assert(err, check.IsNil)
+	return enrollment.Secret, codes
+}
+
+func (s *S) TestTOTPCode(c *check.C) {
+	// Test vectors from RFC 6238, truncated to 6 digits.
+	key := []byte("12345678901234567890")
+	c.Assert(totpCode(key, 59/totpPeriod), check.Equals, "287082")
+	c.Assert(totpCode(key, 1111111109/totpPeriod), check.Equals, "081804")
+	c.Assert(totpCode(key, 1234567890/totpPeriod), check.Equals, "005924")
+	c.Assert(totpCode(key, 20000000000/totpPeriod), check.Equals, "353130")
+}
+
+func (s *S) TestTOTPStep(c *check.C) {
+	defer fixedNow(time.Unix(1111111109, 0))()
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	step, ok := totpStep(secret, "081804", 0)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(step, check.Equals, int64(1111111109/totpPeriod))
+	_, ok = totpStep(secret, "081804", step)
+	c.Assert(ok, check.Equals, false)
+	_, ok = totpStep(secret, currentCode(c, secret, 1), 0)
+	c.Assert(ok, check.Equals, true)
+	_, ok = totpStep(secret, currentCode(c, secret, -1), 0)
+	c.Assert(ok, check.Equals, true)
+	_, ok = totpStep(secret, currentCode(c, secret, 2), 0)
+	c.Assert(ok, check.Equals, false)
+	_, ok = totpStep("not base32!", "081804", 0)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestProvisioningURI(c *check.C) {
+	uri := provisioningURI("me@tsuru.io", "SECRET")
+	u, err := url.Parse(uri)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Scheme, check.Equals, "otpauth")
+	c.Assert(u.Host, check.Equals, "totp")
+	c.Assert(u.Path, check.Equals, "/tsuru:me@tsuru.io")
+	c.Assert(u.Query().Get("secret"), check.Equals, "SECRET")
+	c.Assert(u.Query().Get("issuer"), check.Equals, "tsuru")
+	c.Assert(u.Query().Get("digits"), check.Equals, "6")
+	c.Assert(u.Query().Get("period"), check.Equals, "30")
+}
+
+func (s *S) TestProvisioningURICustomIssuer(c *check.C) {
+	config.Set("auth:two-factor:issuer", "my tsuru")
+	defer config.Unset("auth:two-factor:issuer")
+	u, err := url.Parse(provisioningURI("me@tsuru.io", "SECRET"))
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Path, check.Equals, "/my tsuru:me@tsuru.io")
+	c.Assert(u.Query().Get("issuer"), check.Equals, "my tsuru")
+}
+
+func (s *S) TestNormalizeRecoveryCode(c *check.C) {
+	c.Assert(normalizeRecoveryCode("ABCDE-fghij"), check.Equals, "abcdefghij")
+	c.Assert(normalizeRecoveryCode("abcde fghij"), check.Equals, "abcdefghij")
+}
+
+func (s *S) TestStartTwoFactorEnrollment(c *check.C) {
+	enrollment, err := nativeScheme.StartTwoFactorEnrollment(s.user)
+	c.Assert(err, check.IsNil)
+	key, err := decodeSecret(enrollment.Secret)
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.HasLen, totpSecretSize)
+	c.Assert(enrollment.URI, check.Equals, provisioningURI(s.user.Email, enrollment.Secret))
+	tf, err := getTwoFactor(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tf.Secret, check.Equals, enrollment.Secret)
+	c.Assert(tf.Enabled, check.Equals, false)
+	status, err := nativeScheme.TwoFactorStatus(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(status, check.DeepEquals, &auth.TwoFactorStatus{})
+}
+
+func (s *S) TestStartTwoFactorEnrollmentAlreadyEnabled(c *check.C) {
+	s.enroll(c)
+	_, err := nativeScheme.StartTwoFactorEnrollment(s.user)
+	c.Assert(err, check.Equals, ErrTwoFactorAlreadyEnabled)
+}
+
+func (s *S) TestConfirmTwoFactorEnrollment(c *check.C) {
+	_, codes := s.enroll(c)
+	c.Assert(codes, check.HasLen, recoveryCodes)
+	c.Assert(codes[0], check.Matches, `^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	status, err := nativeScheme.TwoFactorStatus(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(status, check.DeepEquals, &auth.TwoFactorStatus{Enabled: true, RecoveryCodesLeft: recoveryCodes})
+}
+
+func (s *S) TestConfirmTwoFactorEnrollmentInvalidCode(c *check.C) {
+	enrollment, err := nativeScheme.StartTwoFactorEnrollment(s.user)
+	c.Assert(err, check.IsNil)
+	_, err = nativeScheme.ConfirmTwoFactorEnrollment(s.user, currentCode(c, enrollment.Secret, 3))
+	c.Assert(err, check.Equals, ErrInvalidTwoFactorCode)
+	tf, err := getTwoFactor(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tf.Enabled, check.Equals, false)
+}
+
+func (s *S) TestConfirmTwoFactorEnrollmentNotStarted(c *check.C) {
+	_, err := nativeScheme.ConfirmTwoFactorEnrollment(s.user, "123456")
+	c.Assert(err, check.Equals, ErrTwoFactorNotStarted)
+}
+
+func (s *S) TestConfirmTwoFactorEnrollmentReleasesRestrictedTokens(c *check.C) {
+	token, err := insertToken(s.user, true)
+	c.Assert(err, check.IsNil)
+	s.enroll(c)
+	t, err := getToken("bearer " + token.Token)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Restricted, check.Equals, false)
+}
+
+func (s *S) TestNativeLoginTwoFactorRequired(c *check.C) {
+	s.enroll(c)
+	_, err := nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, check.Equals, auth.ErrTwoFactorRequired)
+}
+
+func (s *S) TestNativeLoginTwoFactorWrongPasswordFirst(c *check.C) {
+	s.enroll(c)
+	_, err := nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "wrong-password"})
+	c.Assert(err, check.Not(check.Equals), auth.ErrTwoFactorRequired)
+	_, isAuthFail := err.(auth.AuthenticationFailure)
+	c.Assert(isAuthFail, check.Equals, true)
+}
+
+func (s *S) TestNativeLoginTwoFactorCode(c *check.C) {
+	secret, _ := s.enroll(c)
+	params := map[string]string{"email": s.user.Email, "password": "123456", "otp": currentCode(c, secret, 1)}
+	token, err := nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+	c.Assert(token.(*Token).Restricted, check.Equals, false)
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.Equals, ErrInvalidTwoFactorCode)
+}
+
+func (s *S) TestNativeLoginTwoFactorRecoveryCode(c *check.C) {
+	_, codes := s.enroll(c)
+	params := map[string]string{"email": s.user.Email, "password": "123456", "otp": codes[3]}
+	_, err := nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.Equals, ErrInvalidTwoFactorCode)
+	status, err := nativeScheme.TwoFactorStatus(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.RecoveryCodesLeft, check.Equals, recoveryCodes-1)
+}
+
+func (s *S) TestNativeLoginTwoFactorInvalidCode(c *check.C) {
+	s.enroll(c)
+	params := map[string]string{"email": s.user.Email, "password": "123456", "otp": "wrong"}
+	_, err := nativeScheme.Login(params)
+	c.Assert(err, check.Equals, ErrInvalidTwoFactorCode)
+}
+
+func (s *S) TestNativeLoginTwoFactorAttemptsLimit(c *check.C) {
+	config.Set("auth:two-factor:max-attempts", 2)
+	config.Set("auth:two-factor:lockout-time", 60)
+	defer config.Unset("auth:two-factor:max-attempts")
+	defer config.Unset("auth:two-factor:lockout-time")
+	secret, _ := s.enroll(c)
+	params := map[string]string{"email": s.user.Email, "password": "123456", "otp": "000000"}
+	for i := 0; i < 2; i++ {
+		_, err := nativeScheme.Login(params)
+		c.Assert(err, check.Equals, ErrInvalidTwoFactorCode)
+	}
+	params["otp"] = currentCode(c, secret, 1)
+	_, err := nativeScheme.Login(params)
+	c.Assert(err, check.Equals, ErrTwoFactorLocked)
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.Equals, ErrTwoFactorLocked)
+	defer fixedNow(time.Now().Add(2 * time.Minute))()
+	params["otp"] = currentCode(c, secret, 0)
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+	tf, err := getTwoFactor(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tf.Failures, check.Equals, 0)
+}
+
+func (s *S) TestNativeLoginTwoFactorValidCodeResetsAttempts(c *check.C) {
+	config.Set("auth:two-factor:max-attempts", 2)
+	defer config.Unset("auth:two-factor:max-attempts")
+	secret, _ := s.enroll(c)
+	params := map[string]string{"email": s.user.Email, "password": "123456", "otp": "000000"}
+	_, err := nativeScheme.Login(params)
+	c.Assert(err, check.Equals, ErrInvalidTwoFactorCode)
+	params["otp"] = currentCode(c, secret, 1)
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+	params["otp"] = "000000"
+	for i := 0; i < 2; i++ {
+		_, err = nativeScheme.Login(params)
+		c.Assert(err, check.Equals, ErrInvalidTwoFactorCode)
+	}
+}
+
+func (s *S) TestNativeLoginTwoFactorPolicyRestrictsToken(c *check.C) {
+	config.Set("auth:two-factor:required-permissions", []interface{}{"pool.*"})
+	defer config.Unset("auth:two-factor:required-permissions")
+	role, err := permission.NewRole("pool-admin", "global", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("pool.create")
+	c.Assert(err, check.IsNil)
+	params := map[string]string{"email": s.user.Email, "password": "123456"}
+	token, err := nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+	c.Assert(token.(*Token).Restricted, check.Equals, false)
+	err = s.user.AddRole("pool-admin", "")
+	c.Assert(err, check.IsNil)
+	token, err = nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+	c.Assert(token.(*Token).IsRestricted(), check.Equals, true)
+	perms, err := token.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.NotNil)
+	c.Assert(perms, check.HasLen, 0)
+	status, err := nativeScheme.TwoFactorStatus(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Required, check.Equals, true)
+}
+
+func (s *S) TestTwoFactorRequiredForGlobalRoles(c *check.C) {
+	_, err := permission.NewRole("app-admin", "app", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("global-reader", "global", "")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("app-admin", "myapp")
+	c.Assert(err, check.IsNil)
+	required, err := twoFactorRequired(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(required, check.Equals, false)
+	config.Set("auth:two-factor:required-for-global-roles", true)
+	defer config.Unset("auth:two-factor:required-for-global-roles")
+	required, err = twoFactorRequired(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(required, check.Equals, false)
+	err = s.user.AddRole("global-reader", "")
+	c.Assert(err, check.IsNil)
+	required, err = twoFactorRequired(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(required, check.Equals, true)
+}
+
+func (s *S) TestTwoFactorRequiredParentPermission(c *check.C) {
+	config.Set("auth:two-factor:required-permissions", []interface{}{"pool.update.team.add"})
+	defer config.Unset("auth:two-factor:required-permissions")
+	role, err := permission.NewRole("pool-all", "pool", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("pool")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("pool-all", "p1")
+	c.Assert(err, check.IsNil)
+	required, err := twoFactorRequired(s.user)
+	c.Assert(err, check.IsNil)
+	c.Assert(required, check.Equals, true)
+}
+
+func (s *S) TestDisableTwoFactor(c *check.C) {
+	secret, _ := s.enroll(c)
+	err := nativeScheme.DisableTwoFactor(s.user, "000000")
+	c.Assert(err, check.Equals, ErrInvalidTwoFactorCode)
+	err = nativeScheme.DisableTwoFactor(s.user, currentCode(c, secret, 1))
+	c.Assert(err, check.IsNil)
+	tf, err := getTwoFactor(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tf, check.IsNil)
+	err = nativeScheme.DisableTwoFactor(s.user, currentCode(c, secret, 0))
+	c.Assert(err, check.Equals, ErrTwoFactorNotEnabled)
+}
+
+func (s *S) TestResetTwoFactor(c *check.C) {
+	s.enroll(c)
+	err := nativeScheme.ResetTwoFactor(s.user)
+	c.Assert(err, check.IsNil)
+	_, err = nativeScheme.Login(map[string]string{"email": s.user.Email, "password": "123456"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestRegenerateRecoveryCodes(c *check.C) {
+	secret, codes := s.enroll(c)
+	_, err := nativeScheme.RegenerateRecoveryCodes(s.user, codes[0])
+	c.Assert(err, check.Equals, ErrInvalidTwoFactorCode)
+	newCodes, err := nativeScheme.RegenerateRecoveryCodes(s.user, currentCode(c, secret, 1))
+	c.Assert(err, check.IsNil)
+	c.Assert(newCodes, check.HasLen, recoveryCodes)
+	params := map[string]string{"email": s.user.Email, "password": "123456", "otp": codes[1]}
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.Equals, ErrInvalidTwoFactorCode)
+	params["otp"] = newCodes[1]
+	_, err = nativeScheme.Login(params)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestRemoveRemovesTwoFactor(c *check.C) {
+	s.enroll(c)
+	err := nativeScheme.Remove(s.user)
+	c.Assert(err, check.IsNil)
+	tf, err := getTwoFactor(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tf, check.IsNil)
+}
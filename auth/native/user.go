@@ -29,7 +29,7 @@ func sendResetPassword(u *auth.User, t *passwordToken) {
 		log.Errorf("Failed to send password token to user %q: %s", u.Email, err)
 		return
 	}
-	err = sendEmail(u.Email, body.Bytes())
+	err = SendEmail(u.Email, body.Bytes())
 	if err != nil {
 		log.Errorf("Failed to send password token for user %q: %s", u.Email, err)
 	}
@@ -51,7 +51,7 @@ func sendNewPassword(u *auth.User, password string) {
 		log.Errorf("Failed to send new password to user %q: %s", u.Email, err)
 		return
 	}
-	err = sendEmail(u.Email, body.Bytes())
+	err = SendEmail(u.Email, body.Bytes())
 	if err != nil {
 		log.Errorf("Failed to send new password to user %q: %s", u.Email, err)
 	}
@@ -65,7 +65,10 @@ func generatePassword(length int) string {
 	return string(password)
 }
 
-func sendEmail(email string, data []byte) error {
+// SendEmail sends the message to the given address through the SMTP server
+// in the smtp settings, used by the native auth scheme. The message must
+// include its headers.
+func SendEmail(email string, data []byte) error {
 	addr, err := smtpServer()
 	if err != nil {
 		return err
@@ -14,7 +14,7 @@ import (
 
 func (s *S) TestSendEmail(c *check.C) {
 	defer s.server.Reset()
-	err := sendEmail("something@tsuru.io", []byte("Hello world!"))
+	err := SendEmail("something@tsuru.io", []byte("Hello world!"))
 	c.Assert(err, check.IsNil)
 	s.server.Lock()
 	defer s.server.Unlock()
@@ -28,7 +28,7 @@ func (s *S) TestSendEmailUndefinedSMTPServer(c *check.C) {
 	old, _ := config.Get("smtp:server")
 	defer config.Set("smtp:server", old)
 	config.Unset("smtp:server")
-	err := sendEmail("something@tsuru.io", []byte("Hello world!"))
+	err := SendEmail("something@tsuru.io", []byte("Hello world!"))
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, `Setting "smtp:server" is not defined`)
 }
@@ -37,7 +37,7 @@ func (s *S) TestSendEmailUndefinedUser(c *check.C) {
 	old, _ := config.Get("smtp:user")
 	defer config.Set("smtp:user", old)
 	config.Unset("smtp:user")
-	err := sendEmail("something@tsuru.io", []byte("Hello world!"))
+	err := SendEmail("something@tsuru.io", []byte("Hello world!"))
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, `Setting "smtp:user" is not defined`)
 }
@@ -47,7 +47,7 @@ func (s *S) TestSendEmailUndefinedSMTPPassword(c *check.C) {
 	old, _ := config.Get("smtp:password")
 	defer config.Set("smtp:password", old)
 	config.Unset("smtp:password")
-	err := sendEmail("something@tsuru.io", []byte("Hello world!"))
+	err := SendEmail("something@tsuru.io", []byte("Hello world!"))
 	c.Assert(err, check.IsNil)
 	s.server.Lock()
 	defer s.server.Unlock()
@@ -0,0 +1,250 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package oidc implements an OpenID Connect authentication scheme. Users are
+// identified by ID tokens validated against the provider keys, and may have
+// their teams and roles synchronized from a groups claim on every login.
+package oidc
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/auth/native"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+)
+
+const (
+	defaultScope       = "openid email"
+	defaultEmailClaim  = "email"
+	defaultGroupsClaim = "groups"
+
+	// redirectURLPlaceholder is replaced by clients with the URL where they
+	// receive the authorization code.
+	redirectURLPlaceholder = "__redirect_url__"
+)
+
+var (
+	ErrMissingCodeError       = &tsuruErrors.ValidationError{Message: "You must provide code to login"}
+	ErrMissingCodeRedirectUrl = &tsuruErrors.ValidationError{Message: "You must provide the used redirect url to login"}
+	ErrMissingIDToken         = &tsuruErrors.NotAuthorizedError{Message: "Couldn't convert code to id token."}
+	ErrEmptyUserEmail         = &tsuruErrors.NotAuthorizedError{Message: "Couldn't find user email in id token."}
+	ErrEmailNotVerified       = &tsuruErrors.NotAuthorizedError{Message: "User email is not verified."}
+)
+
+type OIDCAuthScheme struct {
+	BaseConfig BaseConfig
+	provider   *provider
+}
+
+type BaseConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scope        string
+	EmailClaim   string
+	GroupsClaim  string
+	CallbackPort int
+	GroupMapping *auth.GroupMapping
+}
+
+func init() {
+	auth.RegisterScheme("oidc", &OIDCAuthScheme{})
+}
+
+// This method loads basic config and returns a copy of the
+// config object.
+func (s *OIDCAuthScheme) loadConfig() (BaseConfig, error) {
+	if s.BaseConfig.ClientID != "" {
+		if s.provider == nil {
+			s.provider = newProvider(s.BaseConfig.Issuer, s.BaseConfig.ClientID, s.BaseConfig.ClientSecret)
+		}
+		return s.BaseConfig, nil
+	}
+	var emptyConfig BaseConfig
+	issuer, err := config.GetString("auth:oidc:issuer")
+	if err != nil {
+		return emptyConfig, err
+	}
+	clientID, err := config.GetString("auth:oidc:client-id")
+	if err != nil {
+		return emptyConfig, err
+	}
+	conf := BaseConfig{
+		Issuer:      issuer,
+		ClientID:    clientID,
+		Scope:       defaultScope,
+		EmailClaim:  defaultEmailClaim,
+		GroupsClaim: defaultGroupsClaim,
+	}
+	conf.ClientSecret, _ = config.GetString("auth:oidc:client-secret")
+	if scope, _ := config.GetString("auth:oidc:scope"); scope != "" {
+		conf.Scope = scope
+	}
+	if claim, _ := config.GetString("auth:oidc:email-claim"); claim != "" {
+		conf.EmailClaim = claim
+	}
+	if claim, _ := config.GetString("auth:oidc:groups-claim"); claim != "" {
+		conf.GroupsClaim = claim
+	}
+	conf.CallbackPort, err = config.GetInt("auth:oidc:callback-port")
+	if err != nil {
+		log.Debugf("auth:oidc:callback-port not found using random port: %s", err)
+	}
+	conf.GroupMapping, err = auth.LoadGroupMapping("auth:oidc")
+	if err != nil {
+		return emptyConfig, err
+	}
+	s.BaseConfig = conf
+	s.provider = newProvider(conf.Issuer, conf.ClientID, conf.ClientSecret)
+	return s.BaseConfig, nil
+}
+
+func (s *OIDCAuthScheme) Login(params map[string]string) (auth.Token, error) {
+	conf, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	code, ok := params["code"]
+	if !ok {
+		return nil, ErrMissingCodeError
+	}
+	redirectURL, ok := params["redirectUrl"]
+	if !ok {
+		return nil, ErrMissingCodeRedirectUrl
+	}
+	idToken, err := s.provider.exchange(code, redirectURL, params["code_verifier"])
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.provider.verify(idToken)
+	if err != nil {
+		return nil, err
+	}
+	email, _ := claimValue(claims, conf.EmailClaim).(string)
+	if email == "" {
+		return nil, ErrEmptyUserEmail
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, ErrEmailNotVerified
+	}
+	user, err := auth.GetUserByEmail(email)
+	if err != nil {
+		if err != auth.ErrUserNotFound {
+			return nil, err
+		}
+		registrationEnabled, _ := config.GetBool("auth:user-registration")
+		if !registrationEnabled {
+			return nil, err
+		}
+		user, err = s.Create(&auth.User{Email: email})
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = conf.GroupMapping.Sync(user, groups(claimValue(claims, conf.GroupsClaim)))
+	if err != nil {
+		return nil, err
+	}
+	return auth.CreateUserToken(user)
+}
+
+// claimValue returns the value of a claim, names with dots refer to claims
+// nested in objects, like realm_access.roles.
+func claimValue(claims jwt.MapClaims, name string) interface{} {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(name, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+	return value
+}
+
+func groups(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, g := range v {
+			result = append(result, fmt.Sprint(g))
+		}
+		return result
+	}
+	return nil
+}
+
+func (s *OIDCAuthScheme) AppLogin(appName string) (auth.Token, error) {
+	nativeScheme := native.NativeScheme{}
+	return nativeScheme.AppLogin(appName)
+}
+
+func (s *OIDCAuthScheme) AppLogout(token string) error {
+	return s.Logout(token)
+}
+
+func (s *OIDCAuthScheme) Logout(token string) error {
+	return auth.DeleteUserToken(token)
+}
+
+func (s *OIDCAuthScheme) Auth(token string) (auth.Token, error) {
+	return auth.GetUserToken(token)
+}
+
+func (s *OIDCAuthScheme) Name() string {
+	return "oidc"
+}
+
+// Info returns the authorization URL used by clients. Clients must use PKCE,
+// adding the code_challenge, code_challenge_method and state parameters to
+// the URL and sending the code verifier to login.
+func (s *OIDCAuthScheme) Info() (auth.SchemeInfo, error) {
+	conf, err := s.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.provider.discovery()
+	if err != nil {
+		return nil, err
+	}
+	authURL, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", conf.ClientID)
+	query.Set("scope", conf.Scope)
+	query.Set("redirect_uri", redirectURLPlaceholder)
+	authURL.RawQuery = query.Encode()
+	return auth.SchemeInfo{
+		"authorizeUrl": authURL.String(),
+		"port":         strconv.Itoa(conf.CallbackPort),
+		"pkce":         "S256",
+	}, nil
+}
+
+func (s *OIDCAuthScheme) Create(user *auth.User) (*auth.User, error) {
+	user.Password = ""
+	if err := user.Create(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *OIDCAuthScheme) Remove(u *auth.User) error {
+	if err := auth.DeleteUserTokens(u.Email); err != nil {
+		return err
+	}
+	return u.Delete()
+}
@@ -0,0 +1,161 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"net/url"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLoadConfig(c *check.C) {
+	config.Set("auth:oidc:client-secret", "s3cr3t")
+	config.Set("auth:oidc:groups-claim", "realm_access.roles")
+	config.Set("auth:oidc:callback-port", 5555)
+	config.Set("auth:oidc:team-role", "team-member")
+	config.Set("auth:oidc:group-teams", map[interface{}]interface{}{"developers": "myteam"})
+	conf, err := s.scheme.loadConfig()
+	c.Assert(err, check.IsNil)
+	c.Assert(conf, check.DeepEquals, BaseConfig{
+		Issuer:       s.idp.server.URL,
+		ClientID:     "tsuru",
+		ClientSecret: "s3cr3t",
+		Scope:        "openid email",
+		EmailClaim:   "email",
+		GroupsClaim:  "realm_access.roles",
+		CallbackPort: 5555,
+		GroupMapping: &auth.GroupMapping{
+			Teams:    map[string][]string{"developers": {"myteam"}},
+			TeamRole: "team-member",
+			Roles:    map[string][]auth.RoleInstance{},
+		},
+	})
+}
+
+func (s *S) TestInfo(c *check.C) {
+	config.Set("auth:oidc:scope", "openid email groups")
+	config.Set("auth:oidc:callback-port", 5555)
+	info, err := s.scheme.Info()
+	c.Assert(err, check.IsNil)
+	c.Assert(info["port"], check.Equals, "5555")
+	c.Assert(info["pkce"], check.Equals, "S256")
+	authURL, err := url.Parse(info["authorizeUrl"].(string))
+	c.Assert(err, check.IsNil)
+	c.Assert(authURL.Path, check.Equals, "/authorize")
+	c.Assert(authURL.Query(), check.DeepEquals, url.Values{
+		"prompt":        {"login"},
+		"response_type": {"code"},
+		"client_id":     {"tsuru"},
+		"scope":         {"openid email groups"},
+		"redirect_uri":  {"__redirect_url__"},
+	})
+}
+
+func (s *S) TestClaimValue(c *check.C) {
+	claims := jwt.MapClaims{
+		"email":        "jane@example.com",
+		"groups":       []interface{}{"a", "b"},
+		"realm_access": map[string]interface{}{"roles": []interface{}{"admin"}},
+	}
+	c.Assert(claimValue(claims, "email"), check.Equals, "jane@example.com")
+	c.Assert(groups(claimValue(claims, "groups")), check.DeepEquals, []string{"a", "b"})
+	c.Assert(groups(claimValue(claims, "realm_access.roles")), check.DeepEquals, []string{"admin"})
+	c.Assert(claimValue(claims, "email.nested"), check.IsNil)
+	c.Assert(groups(claimValue(claims, "missing")), check.IsNil)
+	c.Assert(groups("single"), check.DeepEquals, []string{"single"})
+}
+
+func (s *S) TestLogin(c *check.C) {
+	params := map[string]string{"code": "mycode", "redirectUrl": "http://localhost:5555", "code_verifier": "verifier"}
+	token, err := s.scheme.Login(params)
+	c.Assert(err, check.IsNil)
+	c.Assert(token.GetUserName(), check.Equals, "jane@example.com")
+	c.Assert(s.idp.tokenForms[0].Get("code_verifier"), check.Equals, "verifier")
+	user, err := auth.GetUserByEmail("jane@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Password, check.Equals, "")
+	authToken, err := s.scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.IsNil)
+	c.Assert(authToken.GetUserName(), check.Equals, "jane@example.com")
+}
+
+func (s *S) TestLoginMissingParams(c *check.C) {
+	_, err := s.scheme.Login(map[string]string{"redirectUrl": "http://localhost"})
+	c.Assert(err, check.Equals, ErrMissingCodeError)
+	_, err = s.scheme.Login(map[string]string{"code": "mycode"})
+	c.Assert(err, check.Equals, ErrMissingCodeRedirectUrl)
+}
+
+func (s *S) TestLoginRegistrationDisabled(c *check.C) {
+	config.Set("auth:user-registration", false)
+	defer config.Set("auth:user-registration", true)
+	_, err := s.scheme.Login(map[string]string{"code": "mycode", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestLoginEmailNotVerified(c *check.C) {
+	s.idp.claims["email_verified"] = false
+	_, err := s.scheme.Login(map[string]string{"code": "mycode", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.Equals, ErrEmailNotVerified)
+}
+
+func (s *S) TestLoginMissingEmail(c *check.C) {
+	config.Set("auth:oidc:email-claim", "upn")
+	_, err := s.scheme.Login(map[string]string{"code": "mycode", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.Equals, ErrEmptyUserEmail)
+}
+
+func (s *S) TestLoginSyncsGroups(c *check.C) {
+	_, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("admin", "global", "")
+	c.Assert(err, check.IsNil)
+	err = s.conn.Teams().Insert(auth.Team{Name: "myteam"})
+	c.Assert(err, check.IsNil)
+	config.Set("auth:oidc:team-role", "team-member")
+	config.Set("auth:oidc:group-teams", map[interface{}]interface{}{"developers": "myteam"})
+	config.Set("auth:oidc:group-roles", map[interface{}]interface{}{"admins": "admin"})
+	s.idp.claims["groups"] = []string{"developers", "admins"}
+	params := map[string]string{"code": "mycode", "redirectUrl": "http://localhost"}
+	_, err = s.scheme.Login(params)
+	c.Assert(err, check.IsNil)
+	user, err := auth.GetUserByEmail("jane@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.HasLen, 2)
+	s.idp.claims["groups"] = []string{"admins"}
+	_, err = s.scheme.Login(params)
+	c.Assert(err, check.IsNil)
+	err = user.Reload()
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.DeepEquals, []auth.RoleInstance{{Name: "admin"}})
+}
+
+func (s *S) TestLogout(c *check.C) {
+	token, err := s.scheme.Login(map[string]string{"code": "mycode", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.IsNil)
+	err = s.scheme.Logout(token.GetValue())
+	c.Assert(err, check.IsNil)
+	_, err = s.scheme.Auth("bearer " + token.GetValue())
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+}
+
+func (s *S) TestRemove(c *check.C) {
+	token, err := s.scheme.Login(map[string]string{"code": "mycode", "redirectUrl": "http://localhost"})
+	c.Assert(err, check.IsNil)
+	user, err := token.User()
+	c.Assert(err, check.IsNil)
+	err = s.scheme.Remove(user)
+	c.Assert(err, check.IsNil)
+	_, err = auth.GetUserByEmail("jane@example.com")
+	c.Assert(err, check.Equals, auth.ErrUserNotFound)
+}
+
+func (s *S) TestName(c *check.C) {
+	c.Assert(s.scheme.Name(), check.Equals, "oidc")
+}
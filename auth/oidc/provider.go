@@ -0,0 +1,304 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+)
+
+// keysRefreshInterval is the minimum interval between two requests for the
+// provider keys, fetched again when tokens are signed with an unknown key.
+const keysRefreshInterval = time.Minute
+
+var validMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// provider talks to an OpenID Connect provider, caching its discovery
+// document and signing keys.
+type provider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+
+	mu            sync.Mutex
+	doc           *discoveryDocument
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+func newProvider(issuer, clientID, clientSecret string) *provider {
+	return &provider{
+		issuer:       strings.TrimSuffix(issuer, "/"),
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *provider) getJSON(u string, v interface{}) error {
+	rsp, err := p.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read response from %s", u)
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected response from %s %d: %s", u, rsp.StatusCode, data)
+	}
+	err = json.Unmarshal(data, v)
+	return errors.Wrapf(err, "unable to parse response from %s: %s", u, data)
+}
+
+// discovery returns the provider configuration, from the
+// .well-known/openid-configuration document.
+func (p *provider) discovery() (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.doc != nil {
+		return p.doc, nil
+	}
+	var doc discoveryDocument
+	err := p.getJSON(p.issuer+"/.well-known/openid-configuration", &doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to discover openid provider configuration")
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.issuer {
+		return nil, errors.Errorf("openid provider issuer %q doesn't match the configured issuer %q", doc.Issuer, p.issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("openid provider configuration is missing required endpoints")
+	}
+	p.doc = &doc
+	return p.doc, nil
+}
+
+// key returns the key used to sign the token, fetching the provider keys
+// again when the key is unknown, as providers rotate them.
+func (p *provider) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	doc, err := p.discovery()
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, errors.Errorf("unknown signing key %q", kid)
+	}
+	p.keysFetchedAt = time.Now()
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = p.getJSON(doc.JWKSURI, &set)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to fetch openid provider keys")
+	}
+	p.keys = make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		p.keys[k.Kid] = key
+	}
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, errors.Errorf("unknown signing key %q", kid)
+}
+
+func (p *provider) findKey(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, errors.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// exchange trades an authorization code for an ID token. The code verifier
+// is only sent when the authorization request used PKCE.
+func (p *provider) exchange(code, redirectURL, codeVerifier string) (string, error) {
+	doc, err := p.discovery()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURL)
+	if codeVerifier != "" {
+		form.Set("code_verifier", codeVerifier)
+	}
+	if p.clientSecret == "" {
+		form.Set("client_id", p.clientID)
+	}
+	req, err := http.NewRequest("POST", doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.clientID), url.QueryEscape(p.clientSecret))
+	}
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read token response")
+	}
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to parse token response: %s", data)
+	}
+	if result.Error != "" {
+		return "", &tsuruErrors.NotAuthorizedError{Message: strings.TrimSpace(result.Error + ": " + result.ErrorDescription)}
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("unexpected token response %d: %s", rsp.StatusCode, data)
+	}
+	if result.IDToken == "" {
+		return "", ErrMissingIDToken
+	}
+	return result.IDToken, nil
+}
+
+// verify checks the signature, issuer, audience and expiration of the ID
+// token, returning its claims.
+func (p *provider) verify(idToken string) (jwt.MapClaims, error) {
+	doc, err := p.discovery()
+	if err != nil {
+		return nil, err
+	}
+	parser := jwt.Parser{ValidMethods: validMethods, UseJSONNumber: true}
+	claims := jwt.MapClaims{}
+	_, err = parser.ParseWithClaims(idToken, claims, p.key)
+	if err != nil {
+		return nil, &tsuruErrors.NotAuthorizedError{Message: "invalid id token: " + err.Error()}
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, &tsuruErrors.NotAuthorizedError{Message: "invalid id token: missing expiration"}
+	}
+	if iss, _ := claims["iss"].(string); iss != doc.Issuer {
+		return nil, &tsuruErrors.NotAuthorizedError{Message: "invalid id token: unexpected issuer " + iss}
+	}
+	var audiences []string
+	switch aud := claims["aud"].(type) {
+	case string:
+		audiences = []string{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+	found := false
+	for _, aud := range audiences {
+		found = found || aud == p.clientID
+	}
+	if !found {
+		return nil, &tsuruErrors.NotAuthorizedError{Message: "invalid id token: client is not in the audience"}
+	}
+	if azp, ok := claims["azp"].(string); ok && len(audiences) > 1 && azp != p.clientID {
+		return nil, &tsuruErrors.NotAuthorizedError{Message: "invalid id token: unexpected authorized party " + azp}
+	}
+	return claims, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/tsuru/tsuru/errors"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) newProvider() *provider {
+	return newProvider(s.idp.server.URL+"/", "tsuru", "")
+}
+
+func (s *S) TestDiscovery(c *check.C) {
+	p := s.newProvider()
+	doc, err := p.discovery()
+	c.Assert(err, check.IsNil)
+	c.Assert(doc, check.DeepEquals, &discoveryDocument{
+		Issuer:                s.idp.server.URL,
+		AuthorizationEndpoint: s.idp.server.URL + "/authorize?prompt=login",
+		TokenEndpoint:         s.idp.server.URL + "/token",
+		JWKSURI:               s.idp.server.URL + "/keys",
+	})
+}
+
+func (s *S) TestDiscoveryIssuerMismatch(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"issuer": "https://evil.example.com"}`))
+	}))
+	defer srv.Close()
+	p := newProvider(srv.URL, "tsuru", "")
+	_, err := p.discovery()
+	c.Assert(err, check.ErrorMatches, `openid provider issuer "https://evil.example.com" doesn't match the configured issuer ".*"`)
+}
+
+func (s *S) TestVerify(c *check.C) {
+	p := s.newProvider()
+	claims, err := p.verify(s.idp.sign(s.idp.validClaims()))
+	c.Assert(err, check.IsNil)
+	c.Assert(claims["email"], check.Equals, "jane@example.com")
+	_, err = p.verify(s.idp.sign(s.idp.validClaims()))
+	c.Assert(err, check.IsNil)
+	c.Assert(s.idp.keysRequests, check.Equals, 1)
+}
+
+func (s *S) TestVerifyAudienceList(c *check.C) {
+	p := s.newProvider()
+	claims := s.idp.validClaims()
+	claims["aud"] = []string{"other", "tsuru"}
+	claims["azp"] = "tsuru"
+	_, err := p.verify(s.idp.sign(claims))
+	c.Assert(err, check.IsNil)
+	claims["azp"] = "other"
+	_, err = p.verify(s.idp.sign(claims))
+	c.Assert(err, check.ErrorMatches, `invalid id token: unexpected authorized party other`)
+}
+
+func (s *S) TestVerifyInvalidClaims(c *check.C) {
+	p := s.newProvider()
+	tests := []struct {
+		change   func(jwt.MapClaims)
+		expected string
+	}{
+		{func(cl jwt.MapClaims) { cl["exp"] = time.Now().Add(-time.Minute).Unix() }, `invalid id token: Token is expired`},
+		{func(cl jwt.MapClaims) { delete(cl, "exp") }, `invalid id token: missing expiration`},
+		{func(cl jwt.MapClaims) { cl["iss"] = "https://evil.example.com" }, `invalid id token: unexpected issuer https://evil.example.com`},
+		{func(cl jwt.MapClaims) { cl["aud"] = "other" }, `invalid id token: client is not in the audience`},
+		{func(cl jwt.MapClaims) { delete(cl, "aud") }, `invalid id token: client is not in the audience`},
+	}
+	for i, tt := range tests {
+		claims := s.idp.validClaims()
+		tt.change(claims)
+		_, err := p.verify(s.idp.sign(claims))
+		c.Check(err, check.ErrorMatches, tt.expected, check.Commentf("test %d", i))
+		c.Check(err, check.FitsTypeOf, &errors.NotAuthorizedError{})
+	}
+}
+
+func (s *S) TestVerifyInvalidSignature(c *check.C) {
+	p := s.newProvider()
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	c.Assert(err, check.IsNil)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, s.idp.validClaims())
+	token.Header["kid"] = s.idp.kid
+	signed, err := token.SignedString(otherKey)
+	c.Assert(err, check.IsNil)
+	_, err = p.verify(signed)
+	c.Assert(err, check.ErrorMatches, `invalid id token: .*verification error`)
+}
+
+func (s *S) TestVerifyRejectsSymmetricAndUnsignedTokens(c *check.C) {
+	p := s.newProvider()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, s.idp.validClaims())
+	signed, err := token.SignedString([]byte("secret"))
+	c.Assert(err, check.IsNil)
+	_, err = p.verify(signed)
+	c.Assert(err, check.ErrorMatches, `invalid id token: signing method HS256 is invalid`)
+	token = jwt.NewWithClaims(jwt.SigningMethodNone, s.idp.validClaims())
+	signed, err = token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	c.Assert(err, check.IsNil)
+	_, err = p.verify(signed)
+	c.Assert(err, check.ErrorMatches, `invalid id token: signing method none is invalid`)
+}
+
+func (s *S) TestVerifyKeyRotation(c *check.C) {
+	p := s.newProvider()
+	_, err := p.verify(s.idp.sign(s.idp.validClaims()))
+	c.Assert(err, check.IsNil)
+	newKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	c.Assert(err, check.IsNil)
+	s.idp.mu.Lock()
+	s.idp.key, s.idp.kid = newKey, "key-2"
+	s.idp.mu.Unlock()
+	signed := s.idp.sign(s.idp.validClaims())
+	_, err = p.verify(signed)
+	c.Assert(err, check.ErrorMatches, `invalid id token: unknown signing key "key-2"`)
+	c.Assert(s.idp.keysRequests, check.Equals, 1)
+	p.keysFetchedAt = time.Time{}
+	_, err = p.verify(signed)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.idp.keysRequests, check.Equals, 2)
+}
+
+func (s *S) TestExchangePublicClient(c *check.C) {
+	p := s.newProvider()
+	idToken, err := p.exchange("mycode", "http://localhost:5555", "verifier")
+	c.Assert(err, check.IsNil)
+	c.Assert(idToken, check.Not(check.Equals), "")
+	c.Assert(s.idp.tokenForms, check.HasLen, 1)
+	form := s.idp.tokenForms[0]
+	c.Assert(form.Get("grant_type"), check.Equals, "authorization_code")
+	c.Assert(form.Get("code"), check.Equals, "mycode")
+	c.Assert(form.Get("redirect_uri"), check.Equals, "http://localhost:5555")
+	c.Assert(form.Get("code_verifier"), check.Equals, "verifier")
+	c.Assert(form.Get("client_id"), check.Equals, "tsuru")
+	_, _, ok := s.idp.tokenRequests[0].BasicAuth()
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestExchangeConfidentialClient(c *check.C) {
+	p := newProvider(s.idp.server.URL, "tsuru", "s3cr3t")
+	_, err := p.exchange("mycode", "http://localhost:5555", "")
+	c.Assert(err, check.IsNil)
+	form := s.idp.tokenForms[0]
+	c.Assert(form.Get("client_id"), check.Equals, "")
+	_, ok := form["code_verifier"]
+	c.Assert(ok, check.Equals, false)
+	user, password, ok := s.idp.tokenRequests[0].BasicAuth()
+	c.Assert(ok, check.Equals, true)
+	c.Assert(user, check.Equals, "tsuru")
+	c.Assert(password, check.Equals, "s3cr3t")
+}
+
+func (s *S) TestExchangeError(c *check.C) {
+	s.idp.tokenError = "invalid_grant"
+	p := s.newProvider()
+	_, err := p.exchange("mycode", "http://localhost:5555", "verifier")
+	c.Assert(err, check.ErrorMatches, `invalid_grant: bad code`)
+	c.Assert(err, check.FitsTypeOf, &errors.NotAuthorizedError{})
+}
@@ -0,0 +1,168 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/repository/repositorytest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	conn   *db.Storage
+	idp    *fakeProvider
+	scheme *OIDCAuthScheme
+}
+
+var _ = check.Suite(&S{})
+
+// fakeProvider is an OpenID Connect provider issuing ID tokens with the
+// configured claims for any authorization code.
+type fakeProvider struct {
+	server        *httptest.Server
+	mu            sync.Mutex
+	key           *rsa.PrivateKey
+	kid           string
+	claims        jwt.MapClaims
+	tokenError    string
+	tokenRequests []*http.Request
+	tokenForms    []url.Values
+	keysRequests  int
+}
+
+func newFakeProvider() (*fakeProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	p := &fakeProvider{key: key, kid: "key-1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize?prompt=login",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.keysRequests++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{
+				{"kty": "EC", "kid": "enc", "use": "enc", "crv": "P-256"},
+				{
+					"kty": "RSA",
+					"kid": p.kid,
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+				},
+			},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.tokenRequests = append(p.tokenRequests, r)
+		p.tokenForms = append(p.tokenForms, r.PostForm)
+		w.Header().Set("Content-Type", "application/json")
+		if p.tokenError != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": p.tokenError, "error_description": "bad code"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     p.sign(p.claims),
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	return p, nil
+}
+
+func (p *fakeProvider) sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.kid
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func (p *fakeProvider) validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            p.server.URL,
+		"sub":            "248289761001",
+		"aud":            "tsuru",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"groups":         []string{"developers"},
+	}
+}
+
+func (s *S) SetUpSuite(c *check.C) {
+	var err error
+	s.idp, err = newFakeProvider()
+	c.Assert(err, check.IsNil)
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "tsuru_auth_oidc_test")
+	config.Set("auth:user-registration", true)
+	config.Set("repo-manager", "fake")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.conn, _ = db.Conn()
+	repositorytest.Reset()
+	s.idp.mu.Lock()
+	s.idp.claims = s.idp.validClaims()
+	s.idp.tokenError = ""
+	s.idp.tokenRequests = nil
+	s.idp.tokenForms = nil
+	s.idp.keysRequests = 0
+	s.idp.mu.Unlock()
+	config.Unset("auth:oidc")
+	config.Set("auth:oidc:issuer", s.idp.server.URL)
+	config.Set("auth:oidc:client-id", "tsuru")
+	s.scheme = &OIDCAuthScheme{}
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	err := dbtest.ClearAllCollections(s.conn.Users().Database)
+	c.Assert(err, check.IsNil)
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	s.idp.server.Close()
+	config.Unset("auth:oidc")
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Users().Database.DropDatabase()
+}
@@ -0,0 +1,241 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	defaultPersonalTokenExpiration    = 30 * 24 * time.Hour
+	defaultPersonalTokenMaxExpiration = 365 * 24 * time.Hour
+	personalTokenSize                 = 32
+
+	// lastUsedResolution is the minimum interval between two updates of the
+	// last use of a token, avoiding a write on every request.
+	lastUsedResolution = time.Minute
+)
+
+var (
+	ErrPersonalTokenNotFound = errors.New("Personal token not found.")
+	ErrPersonalTokenExists   = &tsuruErrors.ConflictError{Message: "A personal token with this name already exists."}
+	ErrInvalidTokenName      = &tsuruErrors.ValidationError{Message: "Invalid token name, token names must start with a letter or number and contain only letters, numbers, underscores, dashes and dots, up to 40 characters."}
+
+	tokenNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,39}$`)
+)
+
+// TokenScope narrows a personal token to a single permission in a context.
+type TokenScope struct {
+	Permission string                       `json:"permission"`
+	Context    permission.PermissionContext `json:"context"`
+	// CheckContexts are the contexts used to check whether the user still
+	// holds the permission, like the teams and pool of an app. They default
+	// to the scope context.
+	CheckContexts []permission.PermissionContext `json:"-"`
+}
+
+// PersonalToken is a named token created by users, usually used by
+// automation like CI jobs. Personal tokens expire, and may be restricted to a
+// subset of the permissions of the user. Only a hash of the token is stored,
+// its value is available only when the token is created.
+type PersonalToken struct {
+	Hash       string       `json:"-" bson:"_id"`
+	Token      string       `json:"token,omitempty" bson:"-"`
+	Name       string       `json:"name"`
+	UserEmail  string       `json:"email"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	LastUsedAt time.Time    `json:"last_used_at"`
+	Scopes     []TokenScope `json:"scopes"`
+}
+
+func (t *PersonalToken) GetValue() string {
+	return t.Token
+}
+
+func (t *PersonalToken) User() (*User, error) {
+	return GetUserByEmail(t.UserEmail)
+}
+
+func (t *PersonalToken) IsAppToken() bool {
+	return false
+}
+
+func (t *PersonalToken) GetUserName() string {
+	return t.UserEmail
+}
+
+func (t *PersonalToken) GetAppName() string {
+	return ""
+}
+
+// Permissions returns the permissions of the user, narrowed to the token
+// scopes. Scopes are only granted while the user holds their permissions,
+// and the permissions denied to the user are kept.
+func (t *PersonalToken) Permissions() ([]permission.Permission, error) {
+	perms, err := BaseTokenPermission(t)
+	if err != nil || len(t.Scopes) == 0 {
+		return perms, err
+	}
+	result := []permission.Permission{}
+	for _, p := range perms {
+		if p.Deny {
+			result = append(result, p)
+		}
+	}
+	for _, scope := range t.Scopes {
+		scheme, err := permission.SafeGet(scope.Permission)
+		if err != nil {
+			log.Errorf("ignoring scope %q of token %q: %s", scope.Permission, t.Name, err)
+			continue
+		}
+		if permission.CheckFromPermList(perms, scheme, scope.CheckContexts...) {
+			result = append(result, permission.Permission{Scheme: scheme, Context: scope.Context})
+		}
+	}
+	return result, nil
+}
+
+func hashPersonalToken(token string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+}
+
+func personalTokenMaxExpiration() time.Duration {
+	days, err := config.GetInt("auth:personal-tokens:max-expiration-days")
+	if err != nil || days <= 0 {
+		return defaultPersonalTokenMaxExpiration
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// CreatePersonalToken creates a token for the user, expiring after the given
+// duration, or 30 days if it's zero. Scopes must be checked against the
+// permissions of the requester by callers.
+func CreatePersonalToken(user *User, name string, expiration time.Duration, scopes []TokenScope) (*PersonalToken, error) {
+	if !tokenNameRegexp.MatchString(name) {
+		return nil, ErrInvalidTokenName
+	}
+	if expiration == 0 {
+		expiration = defaultPersonalTokenExpiration
+	}
+	if maxExpiration := personalTokenMaxExpiration(); expiration < 0 || expiration > maxExpiration {
+		return nil, &tsuruErrors.ValidationError{
+			Message: fmt.Sprintf("Invalid expiration, tokens must expire in at most %d days.", maxExpiration/(24*time.Hour)),
+		}
+	}
+	for i := range scopes {
+		if _, err := permission.SafeGet(scopes[i].Permission); err != nil {
+			return nil, &tsuruErrors.ValidationError{Message: fmt.Sprintf("Invalid permission %q.", scopes[i].Permission)}
+		}
+		if scopes[i].Context.CtxType != permission.CtxGlobal && len(scopes[i].CheckContexts) == 0 {
+			scopes[i].CheckContexts = []permission.PermissionContext{scopes[i].Context}
+		}
+	}
+	var data [personalTokenSize]byte
+	_, err := rand.Read(data[:])
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	t := PersonalToken{
+		Token:     fmt.Sprintf("%x", data),
+		Name:      name,
+		UserEmail: user.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(expiration),
+		Scopes:    scopes,
+	}
+	t.Hash = hashPersonalToken(t.Token)
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	err = conn.PersonalTokens().Insert(t)
+	if mgo.IsDup(err) {
+		return nil, ErrPersonalTokenExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ListPersonalTokens returns the personal tokens of the user, including the
+// expired ones, sorted by name.
+func ListPersonalTokens(email string) ([]PersonalToken, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var tokens []PersonalToken
+	err = conn.PersonalTokens().Find(bson.M{"useremail": email}).Sort("name").All(&tokens)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func RevokePersonalToken(email, name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.PersonalTokens().Remove(bson.M{"useremail": email, "name": name})
+	if err == mgo.ErrNotFound {
+		return ErrPersonalTokenNotFound
+	}
+	return err
+}
+
+// PersonalTokenAuth returns the personal token in the header, recording its
+// use.
+func PersonalTokenAuth(header string) (*PersonalToken, error) {
+	token, err := ParseToken(header)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var t PersonalToken
+	err = conn.PersonalTokens().FindId(hashPersonalToken(token)).One(&t)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if !now.Before(t.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	t.Token = token
+	if now.Sub(t.LastUsedAt) >= lastUsedResolution {
+		t.LastUsedAt = now
+		err = conn.PersonalTokens().UpdateId(t.Hash, bson.M{"$set": bson.M{"lastusedat": now}})
+		if err != nil {
+			log.Errorf("unable to update last use of token %q: %s", t.Name, err)
+		}
+	}
+	return &t, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestCreatePersonalToken(c *check.C) {
+	t, err := CreatePersonalToken(s.user, "ci", 0, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Token, check.HasLen, 64)
+	c.Assert(t.Hash, check.Equals, hashPersonalToken(t.Token))
+	c.Assert(t.UserEmail, check.Equals, s.user.Email)
+	c.Assert(t.ExpiresAt.Sub(t.CreatedAt), check.Equals, defaultPersonalTokenExpiration)
+	tokens, err := ListPersonalTokens(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 1)
+	c.Assert(tokens[0].Name, check.Equals, "ci")
+	c.Assert(tokens[0].Token, check.Equals, "")
+}
+
+func (s *S) TestCreatePersonalTokenDuplicated(c *check.C) {
+	_, err := CreatePersonalToken(s.user, "ci", 0, nil)
+	c.Assert(err, check.IsNil)
+	_, err = CreatePersonalToken(s.user, "ci", 0, nil)
+	c.Assert(err, check.Equals, ErrPersonalTokenExists)
+}
+
+func (s *S) TestCreatePersonalTokenInvalidName(c *check.C) {
+	for _, name := range []string{"", "-ci", "my token", "a-very-long-token-name-exceeding-the-limit"} {
+		_, err := CreatePersonalToken(s.user, name, 0, nil)
+		c.Check(err, check.Equals, ErrInvalidTokenName, check.Commentf("name %q", name))
+	}
+}
+
+func (s *S) TestCreatePersonalTokenInvalidExpiration(c *check.C) {
+	config.Set("auth:personal-tokens:max-expiration-days", 10)
+	defer config.Unset("auth:personal-tokens:max-expiration-days")
+	_, err := CreatePersonalToken(s.user, "ci", 11*24*time.Hour, nil)
+	c.Assert(err, check.ErrorMatches, "Invalid expiration, tokens must expire in at most 10 days.")
+	_, err = CreatePersonalToken(s.user, "ci", 10*24*time.Hour, nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestCreatePersonalTokenInvalidScope(c *check.C) {
+	_, err := CreatePersonalToken(s.user, "ci", 0, []TokenScope{{Permission: "app.invalid"}})
+	c.Assert(err, check.ErrorMatches, `Invalid permission "app.invalid".`)
+}
+
+func (s *S) TestPersonalTokenAuth(c *check.C) {
+	created, err := CreatePersonalToken(s.user, "ci", time.Hour, nil)
+	c.Assert(err, check.IsNil)
+	t, err := PersonalTokenAuth("bearer " + created.Token)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Name, check.Equals, "ci")
+	c.Assert(t.GetValue(), check.Equals, created.Token)
+	c.Assert(t.GetUserName(), check.Equals, s.user.Email)
+	tokens, err := ListPersonalTokens(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens[0].LastUsedAt.IsZero(), check.Equals, false)
+}
+
+func (s *S) TestPersonalTokenAuthExpired(c *check.C) {
+	created, err := CreatePersonalToken(s.user, "ci", time.Hour, nil)
+	c.Assert(err, check.IsNil)
+	err = s.conn.PersonalTokens().UpdateId(created.Hash, map[string]interface{}{
+		"$set": map[string]interface{}{"expiresat": time.Now().Add(-time.Minute)},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = PersonalTokenAuth("bearer " + created.Token)
+	c.Assert(err, check.Equals, ErrInvalidToken)
+}
+
+func (s *S) TestPersonalTokenAuthNotFound(c *check.C) {
+	_, err := PersonalTokenAuth("bearer invalid")
+	c.Assert(err, check.Equals, ErrInvalidToken)
+}
+
+func (s *S) TestRevokePersonalToken(c *check.C) {
+	created, err := CreatePersonalToken(s.user, "ci", 0, nil)
+	c.Assert(err, check.IsNil)
+	err = RevokePersonalToken(s.user.Email, "ci")
+	c.Assert(err, check.IsNil)
+	_, err = PersonalTokenAuth("bearer " + created.Token)
+	c.Assert(err, check.Equals, ErrInvalidToken)
+	err = RevokePersonalToken(s.user.Email, "ci")
+	c.Assert(err, check.Equals, ErrPersonalTokenNotFound)
+}
+
+func (s *S) TestPersonalTokenPermissionsWithoutScopes(c *check.C) {
+	t, err := CreatePersonalToken(s.user, "ci", 0, nil)
+	c.Assert(err, check.IsNil)
+	perms, err := t.Permissions()
+	c.Assert(err, check.IsNil)
+	expected, err := s.user.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, expected)
+}
+
+func (s *S) TestPersonalTokenPermissionsWithScopes(c *check.C) {
+	role, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy", "app.read")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("deployer", "cobrateam")
+	c.Assert(err, check.IsNil)
+	t, err := CreatePersonalToken(s.user, "ci", 0, []TokenScope{
+		{
+			Permission: "app.deploy",
+			Context:    permission.Context(permission.CtxApp, "myapp"),
+			CheckContexts: []permission.PermissionContext{
+				permission.Context(permission.CtxApp, "myapp"),
+				permission.Context(permission.CtxTeam, "cobrateam"),
+			},
+		},
+		{
+			Permission:    "app.deploy",
+			Context:       permission.Context(permission.CtxApp, "otherapp"),
+			CheckContexts: []permission.PermissionContext{permission.Context(permission.CtxTeam, "otherteam")},
+		},
+		{Permission: "pool.create", Context: permission.Context(permission.CtxGlobal, "")},
+	})
+	c.Assert(err, check.IsNil)
+	perms, err := t.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.DeepEquals, []permission.Permission{
+		{Scheme: permission.PermAppDeploy, Context: permission.Context(permission.CtxApp, "myapp")},
+	})
+	c.Assert(permission.Check(t, permission.PermAppDeploy, permission.Context(permission.CtxApp, "myapp")), check.Equals, true)
+	c.Assert(permission.Check(t, permission.PermAppRead, permission.Context(permission.CtxApp, "myapp")), check.Equals, false)
+	err = s.user.RemoveRole("deployer", "cobrateam")
+	c.Assert(err, check.IsNil)
+	perms, err = t.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.HasLen, 0)
+}
+
+func (s *S) TestPersonalTokenPermissionsScopeNoLongerGranted(c *check.C) {
+	role, err := permission.NewRole("deployer", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("deployer", "cobrateam")
+	c.Assert(err, check.IsNil)
+	t, err := CreatePersonalToken(s.user, "ci", 0, []TokenScope{
+		{
+			Permission:    "app.deploy",
+			Context:       permission.Context(permission.CtxTeam, "cobrateam"),
+			CheckContexts: []permission.PermissionContext{permission.Context(permission.CtxTeam, "cobrateam")},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = s.user.RemoveRole("deployer", "cobrateam")
+	c.Assert(err, check.IsNil)
+	perms, err := t.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.NotNil)
+	c.Assert(perms, check.DeepEquals, []permission.Permission{})
+}
+
+func (s *S) TestDeleteUserRemovesPersonalTokens(c *check.C) {
+	u := User{Email: "ci@tsuru.io", Password: "123456"}
+	err := u.Create()
+	c.Assert(err, check.IsNil)
+	_, err = CreatePersonalToken(&u, "ci", 0, nil)
+	c.Assert(err, check.IsNil)
+	err = u.Delete()
+	c.Assert(err, check.IsNil)
+	tokens, err := ListPersonalTokens(u.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(tokens, check.HasLen, 0)
+}
@@ -173,7 +173,7 @@ func (s *SAMLAuthScheme) Login(params map[string]string) (auth.Token, error) {
 			return nil, err
 		}
 	}
-	token, err := createToken(user)
+	token, err := auth.CreateUserToken(user)
 	if err != nil {
 		return nil, err
 	}
@@ -249,11 +249,11 @@ func (s *SAMLAuthScheme) AppLogin(appName string) (auth.Token, error) {
 }
 
 func (s *SAMLAuthScheme) Logout(token string) error {
-	return deleteToken(token)
+	return auth.DeleteUserToken(token)
 }
 
 func (s *SAMLAuthScheme) Auth(token string) (auth.Token, error) {
-	return getToken(token)
+	return auth.GetUserToken(token)
 }
 
 func (s *SAMLAuthScheme) Name() string {
@@ -365,7 +365,7 @@ func (s *SAMLAuthScheme) Create(user *auth.User) (*auth.User, error) {
 }
 
 func (s *SAMLAuthScheme) Remove(u *auth.User) error {
-	if err := deleteAllTokens(u.Email); err != nil {
+	if err := auth.DeleteUserTokens(u.Email); err != nil {
 		return err
 	}
 	return u.Delete()
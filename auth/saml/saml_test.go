@@ -418,13 +418,6 @@ func (s *S) TestSamlCallbackWithInvalidResponse(c *check.C) {
 	c.Assert(err, check.Equals, ErrParseResponseError)
 }
 
-func (s *S) TestNewTokenReturnsErrorWhenUserIsNil(c *check.C) {
-	t, err := newUserToken(nil)
-	c.Assert(t, check.IsNil)
-	c.Assert(err, check.NotNil)
-	c.Assert(err, check.ErrorMatches, "^User is nil$")
-}
-
 func (s *S) TestSamlAuthName(c *check.C) {
 	scheme := SAMLAuthScheme{}
 	name := scheme.Name()
@@ -443,7 +436,7 @@ func (s *S) TestSamlAuthInfo(c *check.C) {
 
 func (s *S) TestSamlAuth(c *check.C) {
 	user := auth.User{Email: "x@x.com"}
-	token, _ := createToken(&user)
+	token, _ := auth.CreateUserToken(&user)
 	scheme := SAMLAuthScheme{}
 	strtoken, err := scheme.Auth("bearer " + token.GetValue())
 	c.Assert(err, check.IsNil)
@@ -27,6 +27,42 @@ type ManagedScheme interface {
 	ChangePassword(token Token, oldPassword string, newPassword string) error
 }
 
+// TwoFactorScheme is implemented by schemes supporting time-based one-time
+// passwords as a second authentication factor on login.
+type TwoFactorScheme interface {
+	Scheme
+	StartTwoFactorEnrollment(user *User) (*TwoFactorEnrollment, error)
+	ConfirmTwoFactorEnrollment(user *User, code string) ([]string, error)
+	DisableTwoFactor(user *User, code string) error
+	ResetTwoFactor(user *User) error
+	RegenerateRecoveryCodes(user *User, code string) ([]string, error)
+	TwoFactorStatus(user *User) (*TwoFactorStatus, error)
+}
+
+// TwoFactorEnrollment holds the secret shared with the authenticator app,
+// along with the otpauth URI used to provision it.
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool
+	Required          bool
+	RecoveryCodesLeft int
+}
+
+// RestrictedToken is implemented by tokens that may be restricted. Restricted
+// tokens are issued to users required to use two-factor authentication that
+// haven't enrolled yet, and have no permissions until the enrollment is
+// confirmed.
+type RestrictedToken interface {
+	Token
+	IsRestricted() bool
+}
+
+var ErrTwoFactorRequired = AuthenticationFailure{Message: "Two-factor authentication code required."}
+
 type AuthenticationFailure struct {
 	Message string
 }
@@ -41,6 +41,15 @@ func (e *ErrTeamStillUsed) Error() string {
 type Team struct {
 	Name         string `bson:"_id" json:"name"`
 	CreatingUser string
+	// Quota limits the resources used by apps and service instances owned
+	// by the team. A nil quota means the team is unlimited.
+	Quota *TeamResources `json:",omitempty" bson:",omitempty"`
+	// QuotaReservations holds the resources reserved by operations in
+	// progress, not yet counted in the usage of the team. QuotaVersion
+	// changes whenever reservations change, so reservations are conditional
+	// to the checked state.
+	QuotaReservations []teamQuotaReservation `json:"-"`
+	QuotaVersion      int                    `json:"-"`
 }
 
 // AllowedApps returns the apps that the team has access.
@@ -151,7 +160,8 @@ func RemoveTeam(teamName string) error {
 	if err == mgo.ErrNotFound {
 		return ErrTeamNotFound
 	}
-	return nil
+	_, err = conn.TeamInvites().RemoveAll(bson.M{"team": teamName})
+	return err
 }
 
 func ListTeams() ([]Team, error) {
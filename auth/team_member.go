@@ -0,0 +1,260 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/validation"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrMemberNotFound    = errors.New("member not found")
+	ErrInvalidMemberRole = errors.New("member roles must have the team context")
+)
+
+// TeamMember is a user holding team context roles in a team. Invited members
+// don't have an account yet, and receive their roles when the account is
+// created.
+type TeamMember struct {
+	Email   string   `json:"email"`
+	Roles   []string `json:"roles"`
+	Invited bool     `json:"invited,omitempty"`
+}
+
+// TeamInvite is a pending invitation of an email to a team, granting the
+// role to the user created with the email.
+type TeamInvite struct {
+	Team      string
+	Email     string
+	Role      string
+	InvitedBy string
+	CreatedAt time.Time
+}
+
+func teamContextRoles() (map[string]bool, error) {
+	roles, err := permission.ListRoles()
+	if err != nil {
+		return nil, err
+	}
+	teamRoles := make(map[string]bool)
+	for _, r := range roles {
+		if r.ContextType == permission.CtxTeam {
+			teamRoles[r.Name] = true
+		}
+	}
+	return teamRoles, nil
+}
+
+// Members returns the users holding team context roles in the team, along
+// with the pending invitations, sorted by email.
+func (t *Team) Members() ([]TeamMember, error) {
+	teamRoles, err := teamContextRoles()
+	if err != nil {
+		return nil, err
+	}
+	users, err := listUsers(bson.M{"roles.contextvalue": t.Name})
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]*TeamMember)
+	for _, u := range users {
+		for _, r := range u.Roles {
+			if r.ContextValue != t.Name || !teamRoles[r.Name] {
+				continue
+			}
+			if members[u.Email] == nil {
+				members[u.Email] = &TeamMember{Email: u.Email}
+			}
+			members[u.Email].Roles = append(members[u.Email].Roles, r.Name)
+		}
+	}
+	invites, err := t.Invites()
+	if err != nil {
+		return nil, err
+	}
+	for _, invite := range invites {
+		if members[invite.Email] == nil {
+			members[invite.Email] = &TeamMember{Email: invite.Email, Invited: true}
+		}
+		members[invite.Email].Roles = append(members[invite.Email].Roles, invite.Role)
+	}
+	result := make([]TeamMember, 0, len(members))
+	for _, m := range members {
+		sort.Strings(m.Roles)
+		result = append(result, *m)
+	}
+	sort.Sort(teamMemberList(result))
+	return result, nil
+}
+
+// Permissions returns the permissions granted to members of the team by the
+// team context roles they hold in the team. They are used to check what
+// resources owned by the team, like webhooks, may access on its behalf.
+func (t *Team) Permissions() ([]permission.Permission, error) {
+	teamRoles, err := teamContextRoles()
+	if err != nil {
+		return nil, err
+	}
+	users, err := listUsers(bson.M{"roles.contextvalue": t.Name})
+	if err != nil {
+		return nil, err
+	}
+	var perms []permission.Permission
+	seen := make(map[string]bool)
+	for _, u := range users {
+		for _, r := range u.Roles {
+			if r.ContextValue != t.Name || !teamRoles[r.Name] || seen[r.Name] {
+				continue
+			}
+			seen[r.Name] = true
+			role, err := permission.FindRole(r.Name)
+			if err != nil {
+				if err == permission.ErrRoleNotFound {
+					continue
+				}
+				return nil, err
+			}
+			perms = append(perms, role.PermissionsFor(t.Name)...)
+		}
+	}
+	return perms, nil
+}
+
+type teamMemberList []TeamMember
+
+func (l teamMemberList) Len() int           { return len(l) }
+func (l teamMemberList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l teamMemberList) Less(i, j int) bool { return l[i].Email < l[j].Email }
+
+// Invites returns the pending invitations to the team.
+func (t *Team) Invites() ([]TeamInvite, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var invites []TeamInvite
+	err = conn.TeamInvites().Find(bson.M{"team": t.Name}).Sort("email", "role").All(&invites)
+	if err != nil {
+		return nil, err
+	}
+	return invites, nil
+}
+
+// AddMember grants the team context role in the team to the user with the
+// given email. When there's no user with the email, an invitation is stored
+// and AddMember returns a nil user, the role is granted once the user is
+// created.
+func (t *Team) AddMember(email, roleName, invitedBy string) (*User, error) {
+	if !validation.ValidateEmail(email) {
+		return nil, &tsuruErrors.ValidationError{Message: "invalid email"}
+	}
+	role, err := permission.FindRole(roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role.ContextType != permission.CtxTeam {
+		return nil, ErrInvalidMemberRole
+	}
+	user, err := GetUserByEmail(email)
+	if err == nil {
+		return user, user.AddRole(roleName, t.Name)
+	}
+	if err != ErrUserNotFound {
+		return nil, err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_, err = conn.TeamInvites().Upsert(bson.M{"team": t.Name, "email": email, "role": roleName}, TeamInvite{
+		Team:      t.Name,
+		Email:     email,
+		Role:      roleName,
+		InvitedBy: invitedBy,
+		CreatedAt: time.Now().UTC(),
+	})
+	return nil, err
+}
+
+// RemoveMember revokes every team context role in the team from the user
+// with the given email, and removes the pending invitations of the email. It
+// returns the user, when the email belongs to a user.
+func (t *Team) RemoveMember(email string) (*User, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	info, err := conn.TeamInvites().RemoveAll(bson.M{"team": t.Name, "email": email})
+	if err != nil {
+		return nil, err
+	}
+	found := info.Removed > 0
+	user, err := GetUserByEmail(email)
+	if err == ErrUserNotFound {
+		if !found {
+			return nil, ErrMemberNotFound
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	teamRoles, err := teamContextRoles()
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range user.Roles {
+		if r.ContextValue != t.Name || !teamRoles[r.Name] {
+			continue
+		}
+		found = true
+		err = user.RemoveRole(r.Name, t.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, ErrMemberNotFound
+	}
+	return user, nil
+}
+
+// acceptTeamInvites grants to the user the roles of the pending invitations
+// to the user email, removing the invitations.
+func (u *User) acceptTeamInvites() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var invites []TeamInvite
+	err = conn.TeamInvites().Find(bson.M{"email": u.Email}).All(&invites)
+	if err != nil {
+		return err
+	}
+	for _, invite := range invites {
+		err = u.AddRole(invite.Role, invite.Team)
+		if err != nil {
+			log.Errorf("unable to accept invite of %q to team %q with role %q: %s", u.Email, invite.Team, invite.Role, err)
+			continue
+		}
+		err = conn.TeamInvites().Remove(bson.M{"team": invite.Team, "email": invite.Email, "role": invite.Role})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestTeamAddMember(c *check.C) {
+	_, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	user, err := s.team.AddMember(s.user.Email, "team-member", "admin@tsuru.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Email, check.Equals, s.user.Email)
+	c.Assert(user.Roles, check.DeepEquals, []RoleInstance{{Name: "team-member", ContextValue: "cobrateam"}})
+	members, err := s.team.Members()
+	c.Assert(err, check.IsNil)
+	c.Assert(members, check.DeepEquals, []TeamMember{{Email: s.user.Email, Roles: []string{"team-member"}}})
+}
+
+func (s *S) TestTeamAddMemberInvalidRole(c *check.C) {
+	_, err := permission.NewRole("app-deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	_, err = s.team.AddMember(s.user.Email, "app-deployer", "")
+	c.Assert(err, check.Equals, ErrInvalidMemberRole)
+	_, err = s.team.AddMember(s.user.Email, "unknown", "")
+	c.Assert(err, check.Equals, permission.ErrRoleNotFound)
+	_, err = s.team.AddMember("not-an-email", "app-deployer", "")
+	c.Assert(err, check.ErrorMatches, "invalid email")
+}
+
+func (s *S) TestTeamAddMemberInvite(c *check.C) {
+	_, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	user, err := s.team.AddMember("newcomer@tsuru.io", "team-member", s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(user, check.IsNil)
+	invites, err := s.team.Invites()
+	c.Assert(err, check.IsNil)
+	c.Assert(invites, check.HasLen, 1)
+	c.Assert(invites[0].Email, check.Equals, "newcomer@tsuru.io")
+	c.Assert(invites[0].Role, check.Equals, "team-member")
+	c.Assert(invites[0].InvitedBy, check.Equals, s.user.Email)
+	members, err := s.team.Members()
+	c.Assert(err, check.IsNil)
+	c.Assert(members, check.DeepEquals, []TeamMember{{Email: "newcomer@tsuru.io", Roles: []string{"team-member"}, Invited: true}})
+	newcomer := User{Email: "newcomer@tsuru.io", Password: "123456"}
+	err = newcomer.Create()
+	c.Assert(err, check.IsNil)
+	c.Assert(newcomer.Roles, check.DeepEquals, []RoleInstance{{Name: "team-member", ContextValue: "cobrateam"}})
+	invites, err = s.team.Invites()
+	c.Assert(err, check.IsNil)
+	c.Assert(invites, check.HasLen, 0)
+}
+
+func (s *S) TestTeamMembersIgnoresOtherContexts(c *check.C) {
+	_, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("app-deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("app-deployer", "cobrateam")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("team-member", "otherteam")
+	c.Assert(err, check.IsNil)
+	members, err := s.team.Members()
+	c.Assert(err, check.IsNil)
+	c.Assert(members, check.HasLen, 0)
+}
+
+func (s *S) TestTeamPermissions(c *check.C) {
+	role, err := permission.NewRole("team-reader", "team", "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions("app.read.events")
+	c.Assert(err, check.IsNil)
+	other, err := permission.NewRole("app-deployer", "app", "")
+	c.Assert(err, check.IsNil)
+	err = other.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("team-reader", "cobrateam")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("app-deployer", "cobrateam")
+	c.Assert(err, check.IsNil)
+	perms, err := s.team.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.HasLen, 1)
+	c.Assert(perms[0].Scheme, check.Equals, permission.PermAppReadEvents)
+	c.Assert(perms[0].Context, check.Equals, permission.Context(permission.CtxTeam, "cobrateam"))
+	otherTeam := Team{Name: "otherteam"}
+	perms, err = otherTeam.Permissions()
+	c.Assert(err, check.IsNil)
+	c.Assert(perms, check.HasLen, 0)
+}
+
+func (s *S) TestTeamRemoveMember(c *check.C) {
+	_, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	_, err = permission.NewRole("team-admin", "team", "")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("team-member", "cobrateam")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("team-admin", "cobrateam")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("team-admin", "otherteam")
+	c.Assert(err, check.IsNil)
+	user, err := s.team.RemoveMember(s.user.Email)
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Roles, check.DeepEquals, []RoleInstance{{Name: "team-admin", ContextValue: "otherteam"}})
+	_, err = s.team.RemoveMember(s.user.Email)
+	c.Assert(err, check.Equals, ErrMemberNotFound)
+}
+
+func (s *S) TestTeamRemoveMemberInvite(c *check.C) {
+	_, err := permission.NewRole("team-member", "team", "")
+	c.Assert(err, check.IsNil)
+	_, err = s.team.AddMember("newcomer@tsuru.io", "team-member", "")
+	c.Assert(err, check.IsNil)
+	user, err := s.team.RemoveMember("newcomer@tsuru.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(user, check.IsNil)
+	invites, err := s.team.Invites()
+	c.Assert(err, check.IsNil)
+	c.Assert(invites, check.HasLen, 0)
+	_, err = s.team.RemoveMember("newcomer@tsuru.io")
+	c.Assert(err, check.Equals, ErrMemberNotFound)
+}
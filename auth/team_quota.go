@@ -0,0 +1,278 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TeamResources holds the amount of each resource limited by team quotas.
+// Memory is the sum of the plan memory, in bytes, of each unit. In limits, a
+// negative value means the resource is unlimited.
+type TeamResources struct {
+	Apps             int
+	Units            int
+	Memory           int64
+	ServiceInstances int
+}
+
+// TeamQuota is the limit and the current usage of the resources of a team.
+type TeamQuota struct {
+	Limit TeamResources
+	InUse TeamResources
+}
+
+var unlimitedTeamResources = TeamResources{Apps: -1, Units: -1, Memory: -1, ServiceInstances: -1}
+
+// teamQuotaReservationTTL is how long reserved resources are held when the
+// reservation isn't released, like when the API server dies in the middle of
+// the operation.
+const teamQuotaReservationTTL = 10 * time.Minute
+
+// teamQuotaReservation holds the resources reserved by an operation in
+// progress, until it's released or expired.
+type teamQuotaReservation struct {
+	ID        bson.ObjectId `bson:"_id"`
+	Resources TeamResources
+	Expires   time.Time
+}
+
+// QuotaLimit returns the limits of the team, with every resource unlimited
+// when the team has no quota.
+func (t *Team) QuotaLimit() TeamResources {
+	if t.Quota == nil {
+		return unlimitedTeamResources
+	}
+	return *t.Quota
+}
+
+// QuotaInUse returns the resources currently used by apps and service
+// instances owned by the team.
+func (t *Team) QuotaInUse() (TeamResources, error) {
+	var inUse TeamResources
+	conn, err := db.Conn()
+	if err != nil {
+		return inUse, err
+	}
+	defer conn.Close()
+	var result struct {
+		Apps   int
+		Units  int
+		Memory int64
+	}
+	err = conn.Apps().Pipe([]bson.M{
+		{"$match": bson.M{"teamowner": t.Name}},
+		{"$group": bson.M{
+			"_id":    nil,
+			"apps":   bson.M{"$sum": 1},
+			"units":  bson.M{"$sum": "$quota.inuse"},
+			"memory": bson.M{"$sum": bson.M{"$multiply": []interface{}{"$plan.memory", "$quota.inuse"}}},
+		}},
+	}).One(&result)
+	if err != nil && err != mgo.ErrNotFound {
+		return inUse, err
+	}
+	inUse.Apps, inUse.Units, inUse.Memory = result.Apps, result.Units, result.Memory
+	inUse.ServiceInstances, err = conn.ServiceInstances().Find(bson.M{"teamowner": t.Name}).Count()
+	if err != nil {
+		return inUse, err
+	}
+	return inUse, nil
+}
+
+// GetTeamQuota returns the limit and usage of the resources of the team.
+func GetTeamQuota(name string) (*TeamQuota, error) {
+	team, err := GetTeam(name)
+	if err != nil {
+		return nil, err
+	}
+	inUse, err := team.QuotaInUse()
+	if err != nil {
+		return nil, err
+	}
+	return &TeamQuota{Limit: team.QuotaLimit(), InUse: inUse}, nil
+}
+
+// ReserveTeamQuota reserves the requested resources in the quota of the
+// team, returning a *quota.QuotaExceededError describing the first exhausted
+// resource when the team has no room for them. Callers must call the
+// returned release function once the reserved resources are counted in the
+// usage of the team, or when the operation fails. The reservation is a
+// conditional update on the team, retried when concurrent reservations change
+// the team. Reservations not released expire after
+// teamQuotaReservationTTL. Unknown teams have no quota, validating the team is
+// up to callers.
+func ReserveTeamQuota(name string, requested TeamResources) (func(), error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	for {
+		team, err := GetTeam(name)
+		if err == ErrTeamNotFound {
+			return func() {}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if team.Quota == nil {
+			return func() {}, nil
+		}
+		inUse, err := team.QuotaInUse()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().UTC()
+		reservations := team.activeQuotaReservations(now)
+		err = team.checkQuota(inUse, sumQuotaReservations(reservations), requested)
+		if err != nil {
+			return nil, err
+		}
+		reservation := teamQuotaReservation{
+			ID:        bson.NewObjectId(),
+			Resources: requested,
+			Expires:   now.Add(teamQuotaReservationTTL),
+		}
+		var version interface{} = team.QuotaVersion
+		if team.QuotaVersion == 0 {
+			version = bson.M{"$in": []interface{}{0, nil}}
+		}
+		err = conn.Teams().Update(
+			bson.M{"_id": name, "quotaversion": version},
+			bson.M{
+				"$set": bson.M{"quotareservations": append(reservations, reservation)},
+				"$inc": bson.M{"quotaversion": 1},
+			},
+		)
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return func() {
+			releaseTeamQuota(name, reservation.ID)
+		}, nil
+	}
+}
+
+func releaseTeamQuota(name string, id bson.ObjectId) {
+	conn, err := db.Conn()
+	if err != nil {
+		log.Errorf("unable to release the quota reserved for team %s: %s", name, err)
+		return
+	}
+	defer conn.Close()
+	err = conn.Teams().UpdateId(name, bson.M{
+		"$pull": bson.M{"quotareservations": bson.M{"_id": id}},
+		"$inc":  bson.M{"quotaversion": 1},
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		log.Errorf("unable to release the quota reserved for team %s: %s", name, err)
+	}
+}
+
+// activeQuotaReservations returns the reservations of the team not expired
+// at the given time.
+func (t *Team) activeQuotaReservations(now time.Time) []teamQuotaReservation {
+	var active []teamQuotaReservation
+	for _, r := range t.QuotaReservations {
+		if r.Expires.After(now) {
+			active = append(active, r)
+		}
+	}
+	return active
+}
+
+func sumQuotaReservations(reservations []teamQuotaReservation) TeamResources {
+	var sum TeamResources
+	for _, r := range reservations {
+		sum.Apps += r.Resources.Apps
+		sum.Units += r.Resources.Units
+		sum.Memory += r.Resources.Memory
+		sum.ServiceInstances += r.Resources.ServiceInstances
+	}
+	return sum
+}
+
+// checkQuota checks whether the team has room for the requested resources,
+// counting the current usage and the resources reserved by operations in
+// progress.
+func (t *Team) checkQuota(inUse, reserved, requested TeamResources) error {
+	checks := []struct {
+		resource                string
+		limit, inUse, requested int64
+	}{
+		{"apps", int64(t.Quota.Apps), int64(inUse.Apps + reserved.Apps), int64(requested.Apps)},
+		{"units", int64(t.Quota.Units), int64(inUse.Units + reserved.Units), int64(requested.Units)},
+		{"memory", t.Quota.Memory, inUse.Memory + reserved.Memory, requested.Memory},
+		{"service instances", int64(t.Quota.ServiceInstances), int64(inUse.ServiceInstances + reserved.ServiceInstances), int64(requested.ServiceInstances)},
+	}
+	for _, check := range checks {
+		if check.requested <= 0 || check.limit < 0 || check.inUse+check.requested <= check.limit {
+			continue
+		}
+		available := check.limit - check.inUse
+		if available < 0 {
+			available = 0
+		}
+		return &quota.QuotaExceededError{
+			Resource:  fmt.Sprintf("%s of team %s", check.resource, t.Name),
+			Available: uint(available),
+			Requested: uint(check.requested),
+		}
+	}
+	return nil
+}
+
+// ChangeTeamQuota redefines the limits of the team. Negative limits mean the
+// resource is unlimited, other limits must be bigger than or equal to the
+// current usage of the team.
+func ChangeTeamQuota(team *Team, limit TeamResources) error {
+	inUse, err := team.QuotaInUse()
+	if err != nil {
+		return err
+	}
+	if limit.Apps < 0 {
+		limit.Apps = -1
+	} else if limit.Apps < inUse.Apps {
+		return errors.New("new apps limit is lesser than the current allocated value")
+	}
+	if limit.Units < 0 {
+		limit.Units = -1
+	} else if limit.Units < inUse.Units {
+		return errors.New("new units limit is lesser than the current allocated value")
+	}
+	if limit.Memory < 0 {
+		limit.Memory = -1
+	} else if limit.Memory < inUse.Memory {
+		return errors.New("new memory limit is lesser than the current allocated value")
+	}
+	if limit.ServiceInstances < 0 {
+		limit.ServiceInstances = -1
+	} else if limit.ServiceInstances < inUse.ServiceInstances {
+		return errors.New("new service instances limit is lesser than the current allocated value")
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Teams().UpdateId(team.Name, bson.M{"$set": bson.M{"quota": limit}})
+	if err != nil {
+		return err
+	}
+	team.Quota = &limit
+	return nil
+}
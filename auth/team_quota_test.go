@@ -0,0 +1,142 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) insertQuotaApp(c *check.C, name, team string, units int, memory int64) {
+	err := s.conn.Apps().Insert(bson.M{
+		"name":      name,
+		"teamowner": team,
+		"plan":      bson.M{"_id": "small", "memory": memory},
+		"quota":     bson.M{"limit": -1, "inuse": units},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestTeamQuotaInUse(c *check.C) {
+	s.insertQuotaApp(c, "app1", s.team.Name, 2, 512)
+	s.insertQuotaApp(c, "app2", s.team.Name, 3, 1024)
+	s.insertQuotaApp(c, "app3", "otherteam", 5, 1024)
+	err := s.conn.ServiceInstances().Insert(bson.M{"name": "mysql", "teamowner": s.team.Name})
+	c.Assert(err, check.IsNil)
+	inUse, err := s.team.QuotaInUse()
+	c.Assert(err, check.IsNil)
+	c.Assert(inUse, check.DeepEquals, TeamResources{Apps: 2, Units: 5, Memory: 2*512 + 3*1024, ServiceInstances: 1})
+}
+
+func (s *S) TestTeamQuotaInUseEmpty(c *check.C) {
+	inUse, err := s.team.QuotaInUse()
+	c.Assert(err, check.IsNil)
+	c.Assert(inUse, check.DeepEquals, TeamResources{})
+}
+
+func (s *S) TestGetTeamQuotaUnlimited(c *check.C) {
+	q, err := GetTeamQuota(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(q.Limit, check.DeepEquals, unlimitedTeamResources)
+	_, err = GetTeamQuota("unknown")
+	c.Assert(err, check.Equals, ErrTeamNotFound)
+}
+
+func (s *S) TestReserveTeamQuota(c *check.C) {
+	s.insertQuotaApp(c, "app1", s.team.Name, 2, 512)
+	err := ChangeTeamQuota(s.team, TeamResources{Apps: 2, Units: 4, Memory: -1, ServiceInstances: 0})
+	c.Assert(err, check.IsNil)
+	release, err := ReserveTeamQuota(s.team.Name, TeamResources{Apps: 1, Units: 2, Memory: 1 << 30})
+	c.Assert(err, check.IsNil)
+	team, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.QuotaReservations, check.HasLen, 1)
+	c.Assert(team.QuotaReservations[0].Resources, check.DeepEquals, TeamResources{Apps: 1, Units: 2, Memory: 1 << 30})
+	_, err = ReserveTeamQuota(s.team.Name, TeamResources{Units: 1})
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: "units of team cobrateam", Available: 0, Requested: 1})
+	release()
+	team, err = GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.QuotaReservations, check.HasLen, 0)
+	_, err = ReserveTeamQuota(s.team.Name, TeamResources{Units: 3})
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: "units of team cobrateam", Available: 2, Requested: 3})
+	c.Assert(err, check.ErrorMatches, `Quota exceeded for units of team cobrateam\. Available: 2\. Requested: 3\.`)
+	_, err = ReserveTeamQuota(s.team.Name, TeamResources{ServiceInstances: 1})
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: "service instances of team cobrateam", Available: 0, Requested: 1})
+}
+
+func (s *S) TestReserveTeamQuotaConcurrent(c *check.C) {
+	err := ChangeTeamQuota(s.team, TeamResources{Apps: -1, Units: 5, Memory: -1, ServiceInstances: -1})
+	c.Assert(err, check.IsNil)
+	var wg sync.WaitGroup
+	results := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ReserveTeamQuota(s.team.Name, TeamResources{Units: 1})
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+	var reserved int
+	for err := range results {
+		if err == nil {
+			reserved++
+		}
+	}
+	c.Assert(reserved, check.Equals, 5)
+}
+
+func (s *S) TestReserveTeamQuotaIgnoresExpiredReservations(c *check.C) {
+	err := ChangeTeamQuota(s.team, TeamResources{Apps: -1, Units: 2, Memory: -1, ServiceInstances: -1})
+	c.Assert(err, check.IsNil)
+	expired := teamQuotaReservation{
+		ID:        bson.NewObjectId(),
+		Resources: TeamResources{Units: 2},
+		Expires:   time.Now().UTC().Add(-time.Minute),
+	}
+	err = s.conn.Teams().UpdateId(s.team.Name, bson.M{"$push": bson.M{"quotareservations": expired}})
+	c.Assert(err, check.IsNil)
+	_, err = ReserveTeamQuota(s.team.Name, TeamResources{Units: 2})
+	c.Assert(err, check.IsNil)
+	team, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.QuotaReservations, check.HasLen, 1)
+	c.Assert(team.QuotaReservations[0].ID, check.Not(check.Equals), expired.ID)
+	c.Assert(team.QuotaReservations[0].Expires.After(time.Now()), check.Equals, true)
+}
+
+func (s *S) TestReserveTeamQuotaWithoutQuota(c *check.C) {
+	s.insertQuotaApp(c, "app1", s.team.Name, 2, 512)
+	release, err := ReserveTeamQuota(s.team.Name, TeamResources{Apps: 100, Units: 100, Memory: 100, ServiceInstances: 100})
+	c.Assert(err, check.IsNil)
+	release()
+	release, err = ReserveTeamQuota("unknown", TeamResources{Apps: 1})
+	c.Assert(err, check.IsNil)
+	release()
+}
+
+func (s *S) TestChangeTeamQuota(c *check.C) {
+	err := ChangeTeamQuota(s.team, TeamResources{Apps: 3, Units: -5, Memory: 1024, ServiceInstances: -1})
+	c.Assert(err, check.IsNil)
+	team, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota, check.DeepEquals, &TeamResources{Apps: 3, Units: -1, Memory: 1024, ServiceInstances: -1})
+}
+
+func (s *S) TestChangeTeamQuotaLesserThanInUse(c *check.C) {
+	s.insertQuotaApp(c, "app1", s.team.Name, 2, 512)
+	err := ChangeTeamQuota(s.team, TeamResources{Apps: -1, Units: 1, Memory: -1, ServiceInstances: -1})
+	c.Assert(err, check.ErrorMatches, "new units limit is lesser than the current allocated value")
+	team, err := GetTeam(s.team.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(team.Quota, check.IsNil)
+}
@@ -22,6 +22,25 @@ type Token interface {
 
 var ErrInvalidToken = errors.New("Invalid token")
 
+// WrapperToken is implemented by tokens that wrap another token, adding
+// information to it, like the tokens used in API requests.
+type WrapperToken interface {
+	Token
+	Unwrap() Token
+}
+
+// UnwrapToken returns the innermost token wrapped by t, so callers can check
+// the concrete type of a token regardless of how it was wrapped.
+func UnwrapToken(t Token) Token {
+	for {
+		wrapper, ok := t.(WrapperToken)
+		if !ok {
+			return t
+		}
+		t = wrapper.Unwrap()
+	}
+}
+
 // ParseToken extracts token from a header:
 // 'type token' or 'token'
 func ParseToken(header string) (string, error) {
@@ -20,3 +20,18 @@ func (s *S) TestParseToken(c *check.C) {
 	c.Assert(err, check.Equals, ErrInvalidToken)
 	c.Assert(t, check.Equals, "")
 }
+
+type wrapperToken struct {
+	Token
+}
+
+func (t *wrapperToken) Unwrap() Token {
+	return t.Token
+}
+
+func (s *S) TestUnwrapToken(c *check.C) {
+	token := &PersonalToken{Token: "abc"}
+	c.Assert(UnwrapToken(token), check.Equals, token)
+	c.Assert(UnwrapToken(&wrapperToken{Token: token}), check.Equals, token)
+	c.Assert(UnwrapToken(&wrapperToken{Token: &wrapperToken{Token: token}}), check.Equals, token)
+}
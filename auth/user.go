@@ -9,6 +9,7 @@ import (
 	"crypto/rand"
 	_ "crypto/sha256"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/pkg/errors"
@@ -88,6 +89,43 @@ usersLoop:
 	return filteredUsers, nil
 }
 
+// PermissionGrant holds the role instances granting a permission to a user.
+// Users implicitly hold the user permissions over themselves, so the
+// permission may be granted without roles.
+type PermissionGrant struct {
+	Email string         `json:"email"`
+	Roles []RoleInstance `json:"roles"`
+}
+
+type permissionGrantList []PermissionGrant
+
+func (l permissionGrantList) Len() int           { return len(l) }
+func (l permissionGrantList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l permissionGrantList) Less(i, j int) bool { return l[i].Email < l[j].Email }
+
+// ListUsersWhoCan returns the users holding the permission in any of the
+// contexts, along with the role instances granting it, sorted by email.
+func ListUsersWhoCan(scheme *permission.PermissionScheme, contexts ...permission.PermissionContext) ([]PermissionGrant, error) {
+	allUsers, err := ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	grants := []PermissionGrant{}
+	roleCache := make(map[string]*permission.Role)
+	for i := range allUsers {
+		u := &allUsers[i]
+		roles, allowed, err := u.rolesGranting(scheme, contexts, roleCache)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			grants = append(grants, PermissionGrant{Email: u.Email, Roles: roles})
+		}
+	}
+	sort.Sort(permissionGrantList(grants))
+	return grants, nil
+}
+
 func GetUserByEmail(email string) (*User, error) {
 	if !validation.ValidateEmail(email) {
 		return nil, &tsuruErrors.ValidationError{Message: "invalid email"}
@@ -132,6 +170,10 @@ func (u *User) Create() error {
 	if err != nil {
 		log.Errorf("unable to add default roles during user creation for %q: %s", u.Email, err)
 	}
+	err = u.acceptTeamInvites()
+	if err != nil {
+		log.Errorf("unable to accept team invites during user creation for %q: %s", u.Email, err)
+	}
 	return nil
 }
 
@@ -145,6 +187,10 @@ func (u *User) Delete() error {
 	if err != nil {
 		log.Errorf("failed to remove user %q from the database: %s", u.Email, err)
 	}
+	_, err = conn.PersonalTokens().RemoveAll(bson.M{"useremail": u.Email})
+	if err != nil {
+		log.Errorf("failed to remove personal tokens of user %q from the database: %s", u.Email, err)
+	}
 	err = repository.Manager().RemoveUser(u.Email)
 	if err != nil {
 		log.Errorf("failed to remove user %q from the repository manager: %s", u.Email, err)
@@ -251,6 +297,37 @@ func (u *User) Permissions() ([]permission.Permission, error) {
 	return permissions, nil
 }
 
+// RolesGranting returns whether the user holds the permission in any of the
+// contexts, along with the role instances granting it. Permissions denied by
+// any role aren't held, even when granted by other roles.
+func (u *User) RolesGranting(scheme *permission.PermissionScheme, contexts ...permission.PermissionContext) ([]RoleInstance, bool, error) {
+	return u.rolesGranting(scheme, contexts, make(map[string]*permission.Role))
+}
+
+func (u *User) rolesGranting(scheme *permission.PermissionScheme, contexts []permission.PermissionContext, roleCache map[string]*permission.Role) ([]RoleInstance, bool, error) {
+	perms := []permission.Permission{
+		{Scheme: permission.PermUser, Context: permission.Context(permission.CtxUser, u.Email)},
+	}
+	var granting []RoleInstance
+	for _, roleData := range u.Roles {
+		role := roleCache[roleData.Name]
+		if role == nil {
+			foundRole, err := permission.FindRole(roleData.Name)
+			if err != nil && err != permission.ErrRoleNotFound {
+				return nil, false, err
+			}
+			role = &foundRole
+			roleCache[roleData.Name] = role
+		}
+		rolePerms := role.PermissionsFor(roleData.ContextValue)
+		perms = append(perms, rolePerms...)
+		if permission.CheckFromPermList(rolePerms, scheme, contexts...) {
+			granting = append(granting, roleData)
+		}
+	}
+	return granting, permission.CheckFromPermList(perms, scheme, contexts...), nil
+}
+
 func (u *User) AddRole(roleName string, contextValue string) error {
 	_, err := permission.FindRole(roleName)
 	if err != nil {
@@ -487,3 +487,71 @@ func (s *S) TestAddRolesForEvent(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(u.Roles, check.DeepEquals, []RoleInstance{{Name: "r1", ContextValue: "team1"}})
 }
+
+func (s *S) TestUserRolesGranting(c *check.C) {
+	r1, err := permission.NewRole("r1", "app", "")
+	c.Assert(err, check.IsNil)
+	err = r1.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	r2, err := permission.NewRole("r2", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r2.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("r1", "myapp")
+	c.Assert(err, check.IsNil)
+	err = s.user.AddRole("r2", "myteam")
+	c.Assert(err, check.IsNil)
+	roles, allowed, err := s.user.RolesGranting(permission.PermAppDeploy,
+		permission.Context(permission.CtxApp, "myapp"),
+		permission.Context(permission.CtxTeam, "myteam"),
+	)
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, true)
+	c.Assert(roles, check.DeepEquals, []RoleInstance{{Name: "r1", ContextValue: "myapp"}, {Name: "r2", ContextValue: "myteam"}})
+	roles, allowed, err = s.user.RolesGranting(permission.PermAppDelete, permission.Context(permission.CtxApp, "myapp"))
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, false)
+	c.Assert(roles, check.HasLen, 0)
+}
+
+func (s *S) TestUserRolesGrantingImplicitUserPermission(c *check.C) {
+	roles, allowed, err := s.user.RolesGranting(permission.PermUserUpdateToken, permission.Context(permission.CtxUser, s.user.Email))
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, true)
+	c.Assert(roles, check.HasLen, 0)
+	_, allowed, err = s.user.RolesGranting(permission.PermUserUpdateToken, permission.Context(permission.CtxUser, "other@tsuru.io"))
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, false)
+}
+
+func (s *S) TestListUsersWhoCan(c *check.C) {
+	u1 := User{Email: "me1@tsuru.com", Password: "123"}
+	err := u1.Create()
+	c.Assert(err, check.IsNil)
+	u2 := User{Email: "me2@tsuru.com", Password: "123"}
+	err = u2.Create()
+	c.Assert(err, check.IsNil)
+	r1, err := permission.NewRole("r1", "app", "")
+	c.Assert(err, check.IsNil)
+	err = r1.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	r2, err := permission.NewRole("r2", "global", "")
+	c.Assert(err, check.IsNil)
+	err = r2.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	err = u2.AddRole("r1", "myapp1")
+	c.Assert(err, check.IsNil)
+	err = u1.AddRole("r2", "")
+	c.Assert(err, check.IsNil)
+	grants, err := ListUsersWhoCan(permission.PermAppDeploy, permission.Context(permission.CtxApp, "myapp1"))
+	c.Assert(err, check.IsNil)
+	c.Assert(grants, check.DeepEquals, []PermissionGrant{
+		{Email: "me1@tsuru.com", Roles: []RoleInstance{{Name: "r2"}}},
+		{Email: "me2@tsuru.com", Roles: []RoleInstance{{Name: "r1", ContextValue: "myapp1"}}},
+	})
+	grants, err = ListUsersWhoCan(permission.PermAppDeploy, permission.Context(permission.CtxApp, "myapp2"))
+	c.Assert(err, check.IsNil)
+	c.Assert(grants, check.DeepEquals, []PermissionGrant{
+		{Email: "me1@tsuru.com", Roles: []RoleInstance{{Name: "r2"}}},
+	})
+}
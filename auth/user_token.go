@@ -1,8 +1,8 @@
-// Copyright 2014 tsuru authors. All rights reserved.
+// Copyright 2017 tsuru authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-package saml
+package auth
 
 import (
 	"crypto"
@@ -12,7 +12,6 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/tsuru/config"
-	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/permission"
 	"gopkg.in/mgo.v2"
@@ -20,13 +19,15 @@ import (
 )
 
 const (
-	keySize           = 32
-	defaultExpiration = 7 * 24 * time.Hour
+	userTokenKeySize         = 32
+	defaultUserTokenDuration = 7 * 24 * time.Hour
 )
 
-var tokenExpire time.Duration
+var userTokenExpire time.Duration
 
-type Token struct {
+// UserToken is the session token issued to users by the auth schemes backed
+// by external identity providers, like SAML, LDAP and OpenID Connect.
+type UserToken struct {
 	Token     string        `json:"token"`
 	Creation  time.Time     `json:"creation"`
 	Expires   time.Duration `json:"expires"`
@@ -34,47 +35,44 @@ type Token struct {
 	AppName   string        `json:"app"`
 }
 
-func (t *Token) GetValue() string {
+func (t *UserToken) GetValue() string {
 	return t.Token
 }
 
-func (t *Token) User() (*auth.User, error) {
-	return auth.GetUserByEmail(t.UserEmail)
+func (t *UserToken) User() (*User, error) {
+	return GetUserByEmail(t.UserEmail)
 }
 
-func (t *Token) IsAppToken() bool {
+func (t *UserToken) IsAppToken() bool {
 	return t.AppName != ""
 }
 
-func (t *Token) GetUserName() string {
+func (t *UserToken) GetUserName() string {
 	return t.UserEmail
 }
 
-func (t *Token) GetAppName() string {
+func (t *UserToken) GetAppName() string {
 	return t.AppName
 }
 
-func (t *Token) Permissions() ([]permission.Permission, error) {
-	return auth.BaseTokenPermission(t)
+func (t *UserToken) Permissions() ([]permission.Permission, error) {
+	return BaseTokenPermission(t)
 }
 
-func loadConfig() error {
-	if tokenExpire == 0 {
-		var err error
-		var days int
-		if days, err = config.GetInt("auth:token-expire-days"); err == nil {
-			tokenExpire = time.Duration(int64(days) * 24 * int64(time.Hour))
+func loadUserTokenExpire() {
+	if userTokenExpire == 0 {
+		if days, err := config.GetInt("auth:token-expire-days"); err == nil {
+			userTokenExpire = time.Duration(int64(days) * 24 * int64(time.Hour))
 		} else {
-			tokenExpire = defaultExpiration
+			userTokenExpire = defaultUserTokenDuration
 		}
 	}
-	return nil
 }
 
-func token(data string, hash crypto.Hash) string {
-	var tokenKey [keySize]byte
+func userTokenValue(data string, hash crypto.Hash) string {
+	var tokenKey [userTokenKeySize]byte
 	n, err := rand.Read(tokenKey[:])
-	for n < keySize || err != nil {
+	for n < userTokenKeySize || err != nil {
 		n, err = rand.Read(tokenKey[:])
 	}
 	h := hash.New()
@@ -84,25 +82,23 @@ func token(data string, hash crypto.Hash) string {
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
-func newUserToken(u *auth.User) (*Token, error) {
+func newUserToken(u *User) (*UserToken, error) {
 	if u == nil {
 		return nil, errors.New("User is nil")
 	}
 	if u.Email == "" {
 		return nil, errors.New("Impossible to generate tokens for users without email")
 	}
-	if err := loadConfig(); err != nil {
-		return nil, err
-	}
-	t := Token{}
+	loadUserTokenExpire()
+	t := UserToken{}
 	t.Creation = time.Now()
-	t.Expires = tokenExpire
-	t.Token = token(u.Email, crypto.SHA1)
+	t.Expires = userTokenExpire
+	t.Token = userTokenValue(u.Email, crypto.SHA1)
 	t.UserEmail = u.Email
 	return &t, nil
 }
 
-func removeOldTokens(userEmail string) error {
+func removeOldUserTokens(userEmail string) error {
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -134,7 +130,9 @@ func removeOldTokens(userEmail string) error {
 	return err
 }
 
-func createToken(u *auth.User) (*Token, error) {
+// CreateUserToken issues a new session token to the user, removing the
+// oldest sessions of the user beyond auth:max-simultaneous-sessions.
+func CreateUserToken(u *User) (*UserToken, error) {
 	if u.Email == "" {
 		return nil, errors.New("User does not have an email")
 	}
@@ -148,35 +146,38 @@ func createToken(u *auth.User) (*Token, error) {
 		return nil, err
 	}
 	err = conn.Tokens().Insert(token)
-	go removeOldTokens(u.Email)
+	go removeOldUserTokens(u.Email)
 	return token, err
 }
 
-func getToken(header string) (*Token, error) {
+// GetUserToken returns the session token in the header, returning
+// ErrInvalidToken when it doesn't exist or has expired.
+func GetUserToken(header string) (*UserToken, error) {
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close()
-	var t Token
-	token, err := auth.ParseToken(header)
+	var t UserToken
+	token, err := ParseToken(header)
 	if err != nil {
 		return nil, err
 	}
 	err = conn.Tokens().Find(bson.M{"token": token}).One(&t)
 	if err != nil {
 		if err == mgo.ErrNotFound {
-			return nil, auth.ErrInvalidToken
+			return nil, ErrInvalidToken
 		}
 		return nil, err
 	}
 	if t.Expires > 0 && t.Creation.Add(t.Expires).Sub(time.Now()) < 1 {
-		return nil, auth.ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 	return &t, nil
 }
 
-func deleteToken(token string) error {
+// DeleteUserToken removes the session token.
+func DeleteUserToken(token string) error {
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -185,7 +186,8 @@ func deleteToken(token string) error {
 	return conn.Tokens().Remove(bson.M{"token": token})
 }
 
-func deleteAllTokens(email string) error {
+// DeleteUserTokens removes every session token of the user with the email.
+func DeleteUserTokens(email string) error {
 	conn, err := db.Conn()
 	if err != nil {
 		return err
@@ -0,0 +1,59 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestCreateUserToken(c *check.C) {
+	user := &User{Email: "x@x.com"}
+	token, err := CreateUserToken(user)
+	c.Assert(err, check.IsNil)
+	count, err := s.conn.Tokens().Find(bson.M{"useremail": "x@x.com"}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 1)
+	t, err := GetUserToken("bearer " + token.Token)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Token, check.Equals, token.Token)
+	c.Assert(t.UserEmail, check.Equals, "x@x.com")
+}
+
+func (s *S) TestNewUserTokenReturnsErrorWhenUserIsNil(c *check.C) {
+	t, err := newUserToken(nil)
+	c.Assert(t, check.IsNil)
+	c.Assert(err, check.ErrorMatches, "^User is nil$")
+}
+
+func (s *S) TestGetUserTokenNotFound(c *check.C) {
+	t, err := GetUserToken("bearer invalid")
+	c.Assert(t, check.IsNil)
+	c.Assert(err, check.Equals, ErrInvalidToken)
+}
+
+func (s *S) TestGetUserTokenInvalid(c *check.C) {
+	t, err := GetUserToken("invalid")
+	c.Assert(t, check.IsNil)
+	c.Assert(err, check.Equals, ErrInvalidToken)
+}
+
+func (s *S) TestDeleteUserTokens(c *check.C) {
+	user := &User{Email: "x@x.com"}
+	token, err := CreateUserToken(user)
+	c.Assert(err, check.IsNil)
+	_, err = CreateUserToken(user)
+	c.Assert(err, check.IsNil)
+	err = DeleteUserToken(token.Token)
+	c.Assert(err, check.IsNil)
+	count, err := s.conn.Tokens().Find(bson.M{"useremail": "x@x.com"}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 1)
+	err = DeleteUserTokens("x@x.com")
+	c.Assert(err, check.IsNil)
+	count, err = s.conn.Tokens().Find(bson.M{"useremail": "x@x.com"}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 0)
+}
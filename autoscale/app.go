@@ -0,0 +1,423 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/leader"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	AppEventKind = "app-autoscale"
+
+	defaultAppRunInterval       = 30 * time.Second
+	defaultAppMetricsWindow     = 5 * time.Minute
+	defaultAppScaleUpCooldown   = 3 * time.Minute
+	defaultAppScaleDownCooldown = 5 * time.Minute
+
+	// appScaleTolerance is the deviation from the target tolerated before
+	// scaling, avoiding flapping around the target.
+	appScaleTolerance = 0.1
+)
+
+var (
+	ErrAppPolicyNotFound = errors.New("autoscale policy not found")
+
+	appScalerInstance *appScaler
+)
+
+// AppPolicy is the unit autoscaling policy of an app process. The number of
+// units is kept between MinUnits and MaxUnits, following the targets of
+// average CPU and memory usage of the units, in percent, and of requests
+// per second per unit. Targets set to zero are ignored. Cooldowns, in
+// seconds, are the minimum time between two scaling operations in the same
+// direction.
+type AppPolicy struct {
+	App               string    `json:"app"`
+	Process           string    `json:"process"`
+	MinUnits          int       `json:"min_units"`
+	MaxUnits          int       `json:"max_units"`
+	CPU               float64   `json:"cpu,omitempty" bson:",omitempty"`
+	Memory            float64   `json:"memory,omitempty" bson:",omitempty"`
+	RequestRate       float64   `json:"request_rate,omitempty" bson:",omitempty"`
+	ScaleUpCooldown   int       `json:"scale_up_cooldown"`
+	ScaleDownCooldown int       `json:"scale_down_cooldown"`
+	LastScaleUp       time.Time `json:"last_scale_up,omitempty" bson:",omitempty"`
+	LastScaleDown     time.Time `json:"last_scale_down,omitempty" bson:",omitempty"`
+}
+
+// AppScaleResult is the decision taken for an app process, stored as the
+// custom data of the autoscale event.
+type AppScaleResult struct {
+	Process string
+	From    int
+	To      int
+	Reason  string
+}
+
+func (p *AppPolicy) Validate() error {
+	if p.MinUnits < 1 {
+		return errors.New("min units must be greater than zero")
+	}
+	if p.MaxUnits < p.MinUnits {
+		return errors.New("max units must be greater than or equal to min units")
+	}
+	if p.CPU < 0 || p.Memory < 0 || p.RequestRate < 0 {
+		return errors.New("targets must not be negative")
+	}
+	if p.ScaleUpCooldown < 0 || p.ScaleDownCooldown < 0 {
+		return errors.New("cooldowns must not be negative")
+	}
+	return nil
+}
+
+func (p *AppPolicy) cooldown(up bool) time.Duration {
+	if up {
+		if p.ScaleUpCooldown == 0 {
+			return defaultAppScaleUpCooldown
+		}
+		return time.Duration(p.ScaleUpCooldown) * time.Second
+	}
+	if p.ScaleDownCooldown == 0 {
+		return defaultAppScaleDownCooldown
+	}
+	return time.Duration(p.ScaleDownCooldown) * time.Second
+}
+
+// SetAppPolicy creates or replaces the autoscaling policy of the app
+// process, keeping the time of the last scaling operations.
+func SetAppPolicy(p AppPolicy) error {
+	err := p.Validate()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.AppAutoScalePolicies().Upsert(bson.M{"app": p.App, "process": p.Process}, bson.M{
+		"$set": bson.M{
+			"minunits":          p.MinUnits,
+			"maxunits":          p.MaxUnits,
+			"cpu":               p.CPU,
+			"memory":            p.Memory,
+			"requestrate":       p.RequestRate,
+			"scaleupcooldown":   p.ScaleUpCooldown,
+			"scaledowncooldown": p.ScaleDownCooldown,
+		},
+	})
+	return err
+}
+
+// ListAppPolicies returns the autoscaling policies of the app, sorted by
+// process.
+func ListAppPolicies(appName string) ([]AppPolicy, error) {
+	return listAppPolicies(bson.M{"app": appName})
+}
+
+func listAppPolicies(query bson.M) ([]AppPolicy, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var policies []AppPolicy
+	err = conn.AppAutoScalePolicies().Find(query).Sort("app", "process").All(&policies)
+	if err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// RemoveAppPolicy removes the autoscaling policy of the app process.
+func RemoveAppPolicy(appName, process string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.AppAutoScalePolicies().Remove(bson.M{"app": appName, "process": process})
+	if err == mgo.ErrNotFound {
+		return ErrAppPolicyNotFound
+	}
+	return err
+}
+
+// ScaleApps runs the autoscaling policies of every app once, adding or
+// removing units of the processes whose metrics are away from the targets.
+func ScaleApps() error {
+	return scaleApps(appMetricsWindow())
+}
+
+func scaleApps(window time.Duration) error {
+	policies, err := listAppPolicies(nil)
+	if err != nil {
+		return err
+	}
+	for i := range policies {
+		err = scaleAppProcess(&policies[i], window)
+		if err != nil {
+			log.Errorf("[app autoscale] error scaling process %q of app %q: %s", policies[i].Process, policies[i].App, err)
+		}
+	}
+	return nil
+}
+
+func scaleAppProcess(p *AppPolicy, window time.Duration) error {
+	a, err := app.GetByName(p.App)
+	if err == app.ErrAppNotFound {
+		return RemoveAppPolicy(p.App, p.Process)
+	}
+	if err != nil {
+		return err
+	}
+	units, err := a.Units()
+	if err != nil {
+		return err
+	}
+	var current int
+	for _, u := range units {
+		if u.ProcessName == p.Process {
+			current++
+		}
+	}
+	if current == 0 {
+		return nil
+	}
+	scheduled, err := lastScheduledUnits(p.App, p.Process)
+	if err != nil {
+		return err
+	}
+	result, err := p.desiredUnits(a, current, scheduled, window)
+	if err != nil || result.To == current {
+		return err
+	}
+	up := result.To > current
+	last := p.LastScaleDown
+	if up {
+		last = p.LastScaleUp
+	}
+	if current >= p.MinUnits && current <= p.MaxUnits && time.Since(last) < p.cooldown(up) {
+		return nil
+	}
+	err = scaleAppUnits(a, AppEventKind, result)
+	if err == nil {
+		err = p.markScaled(up)
+	}
+	if _, ok := err.(errAppNotLocked); ok {
+		return nil
+	}
+	return err
+}
+
+// scaleAppUnits adds or removes units of the app process, going from
+// result.From to result.To units, holding the app lock and recording the
+// operation as an internal event of the given kind targeting the app.
+// Operations on locked apps are skipped, returning errAppNotLocked.
+func scaleAppUnits(a *app.App, kind string, result *AppScaleResult) error {
+	locked, err := a.InternalLock("app auto scale")
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return errAppNotLocked{app: a.Name}
+	}
+	defer a.Unlock()
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		InternalKind: kind,
+		CustomData:   result,
+		Allowed: event.Allowed(permission.PermAppReadEvents, append(permission.Contexts(permission.CtxTeam, a.Teams),
+			permission.Context(permission.CtxApp, a.Name),
+			permission.Context(permission.CtxPool, a.Pool),
+		)...),
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			return errAppNotLocked{app: a.Name}
+		}
+		return err
+	}
+	evt.Logf("scaling process %q from %d to %d units: %s", result.Process, result.From, result.To, result.Reason)
+	if result.To > result.From {
+		err = a.AddUnits(uint(result.To-result.From), result.Process, evt)
+	} else {
+		err = a.RemoveUnits(uint(result.From-result.To), result.Process, evt)
+	}
+	if doneErr := evt.DoneCustomData(err, result); doneErr != nil {
+		log.Errorf("[app autoscale] unable to finish event: %s", doneErr)
+	}
+	return err
+}
+
+// desiredUnits computes the number of units of the process needed to bring
+// each metric to its target, using the highest of them, never going below
+// the units set by the last scale schedule of the process, and keeping it
+// between the policy limits.
+func (p *AppPolicy) desiredUnits(a *app.App, current, scheduled int, window time.Duration) (*AppScaleResult, error) {
+	result := &AppScaleResult{Process: p.Process, From: current, To: current}
+	targets := []struct {
+		metric Metric
+		target float64
+		unit   string
+	}{
+		{MetricCPU, p.CPU, "%"},
+		{MetricMemory, p.Memory, "%"},
+		{MetricRequestRate, p.RequestRate, " req/s per unit"},
+	}
+	var backend MetricsBackend
+	desired := 0
+	for _, t := range targets {
+		if t.target <= 0 {
+			continue
+		}
+		if backend == nil {
+			envs, err := a.MetricEnvs()
+			if err != nil {
+				return nil, err
+			}
+			backend, err = getMetricsBackend(envs)
+			if err != nil {
+				return nil, err
+			}
+		}
+		value, ok, err := backend.Metric(a.Name, p.Process, t.metric, window)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if t.metric == MetricRequestRate {
+			value /= float64(current)
+		}
+		units := current
+		ratio := value / t.target
+		if math.Abs(ratio-1) > appScaleTolerance {
+			units = int(math.Ceil(float64(current) * ratio))
+		}
+		if units > desired {
+			desired = units
+			result.Reason = fmt.Sprintf("%s %.1f%s, target %.1f%s", t.metric, value, t.unit, t.target, t.unit)
+		}
+	}
+	if desired == 0 {
+		desired = current
+	}
+	if desired < scheduled {
+		desired = scheduled
+		result.Reason = fmt.Sprintf("scheduled units %d", scheduled)
+	}
+	if desired < p.MinUnits {
+		desired = p.MinUnits
+		result.Reason = fmt.Sprintf("min units %d", p.MinUnits)
+	}
+	if desired > p.MaxUnits {
+		desired = p.MaxUnits
+		result.Reason = fmt.Sprintf("max units %d", p.MaxUnits)
+	}
+	result.To = desired
+	return result, nil
+}
+
+func (p *AppPolicy) markScaled(up bool) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	field := "lastscaledown"
+	if up {
+		field = "lastscaleup"
+	}
+	return conn.AppAutoScalePolicies().Update(bson.M{"app": p.App, "process": p.Process}, bson.M{
+		"$set": bson.M{field: time.Now().UTC()},
+	})
+}
+
+func appMetricsWindow() time.Duration {
+	if seconds, _ := config.GetInt("auto-scale:apps:metrics-window"); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultAppMetricsWindow
+}
+
+type appScaler struct {
+	interval time.Duration
+	window   time.Duration
+	lease    *leader.Lease
+	done     chan struct{}
+	finished chan struct{}
+}
+
+// InitializeApps starts the background app autoscaler, when app autoscaling
+// is enabled.
+func InitializeApps() error {
+	if appScalerInstance != nil {
+		return errors.New("app autoscaler already initialized")
+	}
+	if enabled, _ := config.GetBool("auto-scale:apps:enabled"); !enabled {
+		return nil
+	}
+	interval := defaultAppRunInterval
+	if seconds, _ := config.GetInt("auto-scale:apps:run-interval"); seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+	appScalerInstance = &appScaler{
+		interval: interval,
+		window:   appMetricsWindow(),
+		lease:    leader.NewLease("app-autoscale", 3*interval),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go appScalerInstance.run()
+	shutdown.Register(appScalerInstance)
+	return nil
+}
+
+func (s *appScaler) run() {
+	defer close(s.finished)
+	for {
+		isLeader, err := s.lease.Acquire()
+		if err != nil {
+			log.Errorf("[app autoscale] unable to acquire lease: %s", err)
+		} else if isLeader {
+			if err = scaleApps(s.window); err != nil {
+				log.Errorf("[app autoscale] unable to scale apps: %s", err)
+			}
+		}
+		select {
+		case <-s.done:
+			return
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+func (s *appScaler) Shutdown() {
+	close(s.done)
+	<-s.finished
+	if err := s.lease.Release(); err != nil {
+		log.Errorf("[app autoscale] unable to release lease: %s", err)
+	}
+}
+
+func (s *appScaler) String() string {
+	return "app auto scale"
+}
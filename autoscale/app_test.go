@@ -0,0 +1,242 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type fakeMetricsBackend struct {
+	values map[Metric]float64
+}
+
+func (b *fakeMetricsBackend) Metric(appName, process string, metric Metric, window time.Duration) (float64, bool, error) {
+	value, ok := b.values[metric]
+	return value, ok, nil
+}
+
+var fakeMetrics = &fakeMetricsBackend{}
+
+func init() {
+	RegisterMetricsBackend("fake", func(envs map[string]string) (MetricsBackend, error) {
+		return fakeMetrics, nil
+	})
+}
+
+func (s *S) newScaledApp(c *check.C, units uint) *app.App {
+	a := &app.App{Name: "scaled", Platform: "python", Pool: "pool1", Quota: quota.Unlimited}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.p.Provision(a)
+	c.Assert(err, check.IsNil)
+	if units > 0 {
+		err = s.p.AddUnits(a, units, "web", nil)
+		c.Assert(err, check.IsNil)
+	}
+	fakeMetrics.values = map[Metric]float64{}
+	return a
+}
+
+func (s *S) TestAppPolicyValidate(c *check.C) {
+	tests := []struct {
+		policy AppPolicy
+		err    string
+	}{
+		{AppPolicy{MinUnits: 1, MaxUnits: 1}, ""},
+		{AppPolicy{MinUnits: 0, MaxUnits: 1}, "min units must be greater than zero"},
+		{AppPolicy{MinUnits: 2, MaxUnits: 1}, "max units must be greater than or equal to min units"},
+		{AppPolicy{MinUnits: 1, MaxUnits: 2, CPU: -1}, "targets must not be negative"},
+		{AppPolicy{MinUnits: 1, MaxUnits: 2, ScaleUpCooldown: -1}, "cooldowns must not be negative"},
+	}
+	for _, t := range tests {
+		err := t.policy.Validate()
+		if t.err == "" {
+			c.Check(err, check.IsNil)
+		} else {
+			c.Check(err, check.ErrorMatches, t.err)
+		}
+	}
+}
+
+func (s *S) TestSetAppPolicy(c *check.C) {
+	err := SetAppPolicy(AppPolicy{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5, CPU: 70})
+	c.Assert(err, check.IsNil)
+	last := time.Now().UTC().Truncate(time.Second)
+	err = s.conn.AppAutoScalePolicies().Update(bson.M{"app": "myapp"}, bson.M{"$set": bson.M{"lastscaleup": last}})
+	c.Assert(err, check.IsNil)
+	err = SetAppPolicy(AppPolicy{App: "myapp", Process: "web", MinUnits: 2, MaxUnits: 4, Memory: 80})
+	c.Assert(err, check.IsNil)
+	err = SetAppPolicy(AppPolicy{App: "myapp", Process: "worker", MinUnits: 1, MaxUnits: 2})
+	c.Assert(err, check.IsNil)
+	policies, err := ListAppPolicies("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.HasLen, 2)
+	c.Assert(policies[0].LastScaleUp.Equal(last), check.Equals, true)
+	policies[0].LastScaleUp = time.Time{}
+	c.Assert(policies, check.DeepEquals, []AppPolicy{
+		{App: "myapp", Process: "web", MinUnits: 2, MaxUnits: 4, Memory: 80},
+		{App: "myapp", Process: "worker", MinUnits: 1, MaxUnits: 2},
+	})
+}
+
+func (s *S) TestSetAppPolicyInvalid(c *check.C) {
+	err := SetAppPolicy(AppPolicy{App: "myapp", Process: "web", MinUnits: 3, MaxUnits: 1})
+	c.Assert(err, check.ErrorMatches, "max units must be greater than or equal to min units")
+	policies, err := ListAppPolicies("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveAppPolicy(c *check.C) {
+	err := SetAppPolicy(AppPolicy{App: "myapp", Process: "web", MinUnits: 1, MaxUnits: 5})
+	c.Assert(err, check.IsNil)
+	err = RemoveAppPolicy("myapp", "web")
+	c.Assert(err, check.IsNil)
+	err = RemoveAppPolicy("myapp", "web")
+	c.Assert(err, check.Equals, ErrAppPolicyNotFound)
+}
+
+func (s *S) TestScaleAppsUp(c *check.C) {
+	a := s.newScaledApp(c, 2)
+	fakeMetrics.values[MetricCPU] = 100
+	fakeMetrics.values[MetricMemory] = 30
+	err := SetAppPolicy(AppPolicy{App: a.Name, Process: "web", MinUnits: 1, MaxUnits: 10, CPU: 50, Memory: 60})
+	c.Assert(err, check.IsNil)
+	err = ScaleApps()
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 4)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:   AppEventKind,
+		EndCustomData: map[string]interface{}{
+			"process": "web",
+			"from":    2,
+			"to":      4,
+			"reason":  "cpu 100.0%, target 50.0%",
+		},
+		LogMatches: `(?s).*scaling process "web" from 2 to 4 units.*`,
+	}, eventtest.HasEvent)
+	policies, err := ListAppPolicies(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(policies[0].LastScaleUp.IsZero(), check.Equals, false)
+}
+
+func (s *S) TestScaleAppsDown(c *check.C) {
+	a := s.newScaledApp(c, 4)
+	fakeMetrics.values[MetricRequestRate] = 40
+	err := SetAppPolicy(AppPolicy{App: a.Name, Process: "web", MinUnits: 1, MaxUnits: 10, RequestRate: 20})
+	c.Assert(err, check.IsNil)
+	err = ScaleApps()
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestScaleAppsWithinTolerance(c *check.C) {
+	a := s.newScaledApp(c, 2)
+	fakeMetrics.values[MetricCPU] = 54
+	err := SetAppPolicy(AppPolicy{App: a.Name, Process: "web", MinUnits: 1, MaxUnits: 10, CPU: 50})
+	c.Assert(err, check.IsNil)
+	err = ScaleApps()
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestScaleAppsKeepsScheduledUnits(c *check.C) {
+	a := s.newScaledApp(c, 4)
+	fakeMetrics.values[MetricRequestRate] = 40
+	err := SetAppPolicy(AppPolicy{App: a.Name, Process: "web", MinUnits: 1, MaxUnits: 10, RequestRate: 20})
+	c.Assert(err, check.IsNil)
+	schedule := s.addSchedule(c, AppSchedule{App: a.Name, Process: "web", Cron: "0 8 * * *", Units: 3}, time.Now().Add(-time.Hour))
+	err = s.conn.AppScaleSchedules().UpdateId(schedule.ID, bson.M{"$set": bson.M{"lastrun": time.Now().UTC()}})
+	c.Assert(err, check.IsNil)
+	err = ScaleApps()
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 3)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:   AppEventKind,
+		EndCustomData: map[string]interface{}{
+			"process": "web",
+			"from":    4,
+			"to":      3,
+			"reason":  "scheduled units 3",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestScaleAppsRespectsMaxUnits(c *check.C) {
+	a := s.newScaledApp(c, 2)
+	fakeMetrics.values[MetricCPU] = 400
+	err := SetAppPolicy(AppPolicy{App: a.Name, Process: "web", MinUnits: 1, MaxUnits: 3, CPU: 50})
+	c.Assert(err, check.IsNil)
+	err = ScaleApps()
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 3)
+}
+
+func (s *S) TestScaleAppsCooldown(c *check.C) {
+	a := s.newScaledApp(c, 2)
+	fakeMetrics.values[MetricCPU] = 100
+	err := SetAppPolicy(AppPolicy{App: a.Name, Process: "web", MinUnits: 1, MaxUnits: 10, CPU: 50, ScaleUpCooldown: 600})
+	c.Assert(err, check.IsNil)
+	err = s.conn.AppAutoScalePolicies().Update(bson.M{"app": a.Name}, bson.M{"$set": bson.M{"lastscaleup": time.Now().UTC()}})
+	c.Assert(err, check.IsNil)
+	err = ScaleApps()
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestScaleAppsMinUnitsIgnoresCooldown(c *check.C) {
+	a := s.newScaledApp(c, 1)
+	err := SetAppPolicy(AppPolicy{App: a.Name, Process: "web", MinUnits: 3, MaxUnits: 10})
+	c.Assert(err, check.IsNil)
+	err = s.conn.AppAutoScalePolicies().Update(bson.M{"app": a.Name}, bson.M{"$set": bson.M{"lastscaleup": time.Now().UTC()}})
+	c.Assert(err, check.IsNil)
+	err = ScaleApps()
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 3)
+}
+
+func (s *S) TestScaleAppsIgnoresStoppedProcesses(c *check.C) {
+	a := s.newScaledApp(c, 0)
+	err := SetAppPolicy(AppPolicy{App: a.Name, Process: "web", MinUnits: 2, MaxUnits: 10})
+	c.Assert(err, check.IsNil)
+	err = ScaleApps()
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 0)
+}
+
+func (s *S) TestScaleAppsRemovesPoliciesOfRemovedApps(c *check.C) {
+	err := SetAppPolicy(AppPolicy{App: "removed", Process: "web", MinUnits: 1, MaxUnits: 2})
+	c.Assert(err, check.IsNil)
+	err = ScaleApps()
+	c.Assert(err, check.IsNil)
+	policies, err := ListAppPolicies("removed")
+	c.Assert(err, check.IsNil)
+	c.Assert(policies, check.HasLen, 0)
+}
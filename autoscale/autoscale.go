@@ -7,6 +7,7 @@ package autoscale
 import (
 	"fmt"
 	"io"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,6 +36,8 @@ type Config struct {
 	WaitTimeNewMachine  time.Duration
 	RunInterval         time.Duration
 	TotalMemoryMetadata string
+	TotalCpuMetadata    string
+	PreProvisionWindow  time.Duration
 	Enabled             bool
 	done                chan bool
 	writer              io.Writer
@@ -68,10 +71,14 @@ func newConfig() *Config {
 	waitSecondsNewMachine, _ := config.GetInt("docker:auto-scale:wait-new-time")
 	runInterval, _ := config.GetInt("docker:auto-scale:run-interval")
 	totalMemoryMetadata, _ := config.GetString("docker:scheduler:total-memory-metadata")
+	totalCpuMetadata, _ := config.GetString("docker:scheduler:total-cpu-metadata")
+	preProvisionWindow, _ := config.GetInt("docker:auto-scale:pre-provision-window")
 	c := &Config{
 		TotalMemoryMetadata: totalMemoryMetadata,
+		TotalCpuMetadata:    totalCpuMetadata,
 		WaitTimeNewMachine:  time.Duration(waitSecondsNewMachine) * time.Second,
 		RunInterval:         time.Duration(runInterval) * time.Second,
+		PreProvisionWindow:  time.Duration(preProvisionWindow) * time.Second,
 		Enabled:             enabled,
 		done:                make(chan bool),
 	}
@@ -81,6 +88,9 @@ func newConfig() *Config {
 	if c.WaitTimeNewMachine == 0 {
 		c.WaitTimeNewMachine = 5 * time.Minute
 	}
+	if c.PreProvisionWindow == 0 {
+		c.PreProvisionWindow = time.Hour
+	}
 	return c
 }
 
@@ -111,11 +121,71 @@ type autoScaler interface {
 	scale(pool string, nodes []provision.Node) (*ScalerResult, error)
 }
 
+// scalerForRule returns the scaler for the rule. Unless the rule combines
+// scalers, count based scaling is preferred, followed by cpu and memory based
+// scaling. Combined rules use every scaler with thresholds set in the rule.
+// Rules with spare nodes have the chosen scaler wrapped by a spareScaler.
 func (a *Config) scalerForRule(rule *Rule) (autoScaler, error) {
+	scaler, err := a.baseScalerForRule(rule)
+	if err != nil || rule.SpareNodes <= 0 {
+		return scaler, err
+	}
+	return &spareScaler{Config: a, rule: rule, scaler: scaler}, nil
+}
+
+func (a *Config) baseScalerForRule(rule *Rule) (autoScaler, error) {
+	var scalers []autoScaler
 	if rule.MaxContainerCount > 0 {
-		return &countScaler{Config: a, rule: rule}, nil
+		scalers = append(scalers, &countScaler{Config: a, rule: rule})
+	}
+	if rule.MaxCpuRatio > 0 && (len(scalers) == 0 || rule.CombineScalers) {
+		scalers = append(scalers, newCpuScaler(a, rule))
+	}
+	if len(scalers) == 0 || (rule.CombineScalers && a.TotalMemoryMetadata != "" && rule.MaxMemoryRatio > 0) {
+		scalers = append(scalers, newMemoryScaler(a, rule))
+	}
+	if len(scalers) == 1 {
+		return scalers[0], nil
+	}
+	return &multiScaler{scalers: scalers}, nil
+}
+
+// multiScaler combines the results of many scalers, adding nodes when any of
+// them needs more nodes, and removing nodes only when all of them agree,
+// removing the fewest nodes proposed.
+type multiScaler struct {
+	scalers []autoScaler
+}
+
+func (m *multiScaler) scale(pool string, nodes []provision.Node) (*ScalerResult, error) {
+	var toAdd *ScalerResult
+	var toRemove *ScalerResult
+	var reasons []string
+	removeAll := true
+	for _, scaler := range m.scalers {
+		result, err := scaler.scale(pool, nodes)
+		if err != nil {
+			return nil, err
+		}
+		if result.ToAdd > 0 {
+			reasons = append(reasons, result.Reason)
+			if toAdd == nil || result.ToAdd > toAdd.ToAdd {
+				toAdd = result
+			}
+		}
+		if len(result.ToRemove) == 0 {
+			removeAll = false
+		} else if toRemove == nil || len(result.ToRemove) < len(toRemove.ToRemove) {
+			toRemove = result
+		}
+	}
+	if toAdd != nil {
+		return &ScalerResult{ToAdd: toAdd.ToAdd, Reason: strings.Join(reasons, "; ")}, nil
 	}
-	return &memoryScaler{Config: a, rule: rule}, nil
+	if removeAll && toRemove != nil {
+		return toRemove, nil
+	}
+	return &ScalerResult{}, nil
 }
 
 func (a *Config) run() error {
@@ -172,9 +242,22 @@ func (a *Config) runScaler() (retErr error) {
 			retErr = errors.Errorf("recovered panic, we can never stop! panic: %v", r)
 		}
 	}()
+	provPoolMap, clusterMap, err := a.poolNodes()
+	if err != nil {
+		return err
+	}
+	for pool, nodes := range clusterMap {
+		a.runScalerInNodes(provPoolMap[pool], pool, nodes)
+	}
+	return
+}
+
+// poolNodes returns the nodes of every node provisioner grouped by pool,
+// along with the provisioner managing the nodes of each pool.
+func (a *Config) poolNodes() (map[string]provision.NodeProvisioner, map[string][]provision.Node, error) {
 	provs, err := provision.Registry()
 	if err != nil {
-		return errors.Wrap(err, "error getting provisioners")
+		return nil, nil, errors.Wrap(err, "error getting provisioners")
 	}
 	provPoolMap := map[string]provision.NodeProvisioner{}
 	var allNodes []provision.Node
@@ -186,7 +269,7 @@ func (a *Config) runScaler() (retErr error) {
 		var nodes []provision.Node
 		nodes, err = nodeProv.ListNodes(nil)
 		if err != nil {
-			return errors.Wrap(err, "error getting nodes")
+			return nil, nil, errors.Wrap(err, "error getting nodes")
 		}
 		for _, n := range nodes {
 			provPoolMap[n.Pool()] = nodeProv
@@ -202,10 +285,17 @@ func (a *Config) runScaler() (retErr error) {
 		}
 		clusterMap[pool] = append(clusterMap[pool], node)
 	}
-	for pool, nodes := range clusterMap {
-		a.runScalerInNodes(provPoolMap[pool], pool, nodes)
+	return provPoolMap, clusterMap, nil
+}
+
+// ruleForPool returns the auto scale rule for the pool, falling back to the
+// default rule, or mgo.ErrNotFound when there's none.
+func ruleForPool(pool string) (*Rule, error) {
+	rule, err := AutoScaleRuleForMetadata(pool)
+	if err == mgo.ErrNotFound {
+		rule, err = AutoScaleRuleForMetadata("")
 	}
-	return
+	return rule, err
 }
 
 type EventCustomData struct {
@@ -256,10 +346,7 @@ func (a *Config) runScalerInNodes(prov provision.NodeProvisioner, pool string, n
 			})
 		}
 	}()
-	rule, err = AutoScaleRuleForMetadata(pool)
-	if err == mgo.ErrNotFound {
-		rule, err = AutoScaleRuleForMetadata("")
-	}
+	rule, err = ruleForPool(pool)
 	if err != nil {
 		if err != mgo.ErrNotFound {
 			retErr = errors.Wrapf(err, "unable to fetch auto scale rules for %s", pool)
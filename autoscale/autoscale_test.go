@@ -98,6 +98,7 @@ func (s *S) TearDownTest(c *check.C) {
 	config.Unset("docker:auto-scale:scale-down-ratio")
 	config.Unset("docker:scheduler:max-used-memory")
 	config.Unset("docker:scheduler:total-memory-metadata")
+	config.Unset("docker:scheduler:total-cpu-metadata")
 }
 
 func (s *S) TestAutoScaleConfigRunOnce(c *check.C) {
@@ -961,7 +962,7 @@ func (s *S) TestAutoScaleConfigRunParamsError(c *check.C) {
 	config.Set("docker:auto-scale:max-container-count", 0)
 	a := newConfig()
 	a.runOnce()
-	c.Assert(s.logBuf.String(), check.Matches, `(?s).*invalid rule, either memory information or max container count must be set.*`)
+	c.Assert(s.logBuf.String(), check.Matches, `(?s).*invalid rule, either memory information, cpu information or max container count must be set.*`)
 	config.Set("docker:auto-scale:max-container-count", 10)
 	config.Set("docker:auto-scale:scale-down-ratio", 0.9)
 	defer config.Unset("docker:auto-scale:scale-down-ratio")
@@ -0,0 +1,69 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestParseCronInvalid(c *check.C) {
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{"* * * *", `invalid cron expression "\* \* \* \*", it must have 5 fields`},
+		{"60 * * * *", `invalid minute in cron expression "60 \* \* \* \*"`},
+		{"* 8-25 * * *", `invalid hour in cron expression "\* 8-25 \* \* \*"`},
+		{"* * 0 * *", `invalid day of month in cron expression "\* \* 0 \* \*"`},
+		{"* * * 5-2 *", `invalid month in cron expression "\* \* \* 5-2 \*"`},
+		{"* * * * mon", `invalid day of week in cron expression "\* \* \* \* mon"`},
+		{"*/0 * * * *", `invalid minute in cron expression "\*/0 \* \* \* \*"`},
+	}
+	for _, t := range tests {
+		_, err := parseCron(t.spec)
+		c.Check(err, check.ErrorMatches, t.err)
+	}
+}
+
+func (s *S) TestCronNext(c *check.C) {
+	base := time.Date(2017, time.March, 10, 14, 30, 15, 0, time.UTC) // Friday
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2017, time.March, 10, 14, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2017, time.March, 10, 14, 45, 0, 0, time.UTC)},
+		{"0 8 * * *", time.Date(2017, time.March, 11, 8, 0, 0, 0, time.UTC)},
+		{"0 20 * * *", time.Date(2017, time.March, 10, 20, 0, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.Date(2017, time.March, 13, 8, 0, 0, 0, time.UTC)},
+		{"30 6 * * 0", time.Date(2017, time.March, 12, 6, 30, 0, 0, time.UTC)},
+		{"30 6 * * 7", time.Date(2017, time.March, 12, 6, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2017, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * 1", time.Date(2017, time.March, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2020, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{"15,45 9-17/4 * 6 *", time.Date(2017, time.June, 1, 9, 15, 0, 0, time.UTC)},
+	}
+	for _, t := range tests {
+		cron, err := parseCron(t.spec)
+		c.Assert(err, check.IsNil)
+		c.Check(cron.next(base), check.DeepEquals, t.expected, check.Commentf("spec %q", t.spec))
+	}
+}
+
+func (s *S) TestCronNextNever(c *check.C) {
+	cron, err := parseCron("0 0 31 2 *")
+	c.Assert(err, check.IsNil)
+	c.Assert(cron.next(time.Now()).IsZero(), check.Equals, true)
+}
+
+func (s *S) TestCronNextLocation(c *check.C) {
+	loc := time.FixedZone("BRT", -3*60*60)
+	cron, err := parseCron("0 8 * * *")
+	c.Assert(err, check.IsNil)
+	next := cron.next(time.Date(2017, time.March, 10, 12, 0, 0, 0, time.UTC).In(loc))
+	c.Assert(next.UTC(), check.DeepEquals, time.Date(2017, time.March, 11, 11, 0, 0, 0, time.UTC))
+}
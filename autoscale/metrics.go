@@ -0,0 +1,144 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+type Metric string
+
+const (
+	MetricCPU         = Metric("cpu")
+	MetricMemory      = Metric("memory")
+	MetricRequestRate = Metric("requests")
+)
+
+// MetricsBackend reads the metrics of app units stored by the node
+// containers in the metrics backend.
+type MetricsBackend interface {
+	// Metric returns the value of the metric for the units of the process
+	// during the last window, and false when there's no data. CPU and memory
+	// are the average usage of the units, in percent, and the request rate is
+	// the number of requests per second received by the app routes.
+	Metric(appName, process string, metric Metric, window time.Duration) (float64, bool, error)
+}
+
+// MetricsBackendFactory creates a metrics backend from the METRICS_* envs
+// of the node containers.
+type MetricsBackendFactory func(envs map[string]string) (MetricsBackend, error)
+
+var metricsBackends = map[string]MetricsBackendFactory{
+	"logstash": newElasticsearchBackend,
+}
+
+// RegisterMetricsBackend registers a factory for the backend with the given
+// name, as set in the METRICS_BACKEND env of the node containers.
+func RegisterMetricsBackend(name string, factory MetricsBackendFactory) {
+	metricsBackends[name] = factory
+}
+
+func getMetricsBackend(envs map[string]string) (MetricsBackend, error) {
+	name := envs["METRICS_BACKEND"]
+	factory, ok := metricsBackends[name]
+	if !ok {
+		return nil, errors.Errorf("unsupported metrics backend %q", name)
+	}
+	return factory(envs)
+}
+
+// elasticsearchBackend reads the metrics sent by bs to logstash from the
+// elasticsearch cluster where logstash stores them, in the daily
+// .measure-tsuru-* indexes with the metric name as the document type. The
+// cluster address is the METRICS_ELASTICSEARCH_HOST env of bs.
+type elasticsearchBackend struct {
+	url string
+}
+
+var elasticsearchMetrics = map[Metric]struct {
+	docType string
+	agg     string
+	field   string
+}{
+	MetricCPU:         {docType: "cpu_max", agg: "avg", field: "value"},
+	MetricMemory:      {docType: "mem_pct_max", agg: "avg", field: "value"},
+	MetricRequestRate: {docType: "response_time", agg: "sum", field: "count"},
+}
+
+func newElasticsearchBackend(envs map[string]string) (MetricsBackend, error) {
+	host := envs["METRICS_ELASTICSEARCH_HOST"]
+	if host == "" {
+		return nil, errors.New("METRICS_ELASTICSEARCH_HOST is not set")
+	}
+	return &elasticsearchBackend{url: strings.TrimRight(host, "/")}, nil
+}
+
+func (b *elasticsearchBackend) Metric(appName, process string, metric Metric, window time.Duration) (float64, bool, error) {
+	m, ok := elasticsearchMetrics[metric]
+	if !ok {
+		return 0, false, errors.Errorf("unknown metric %q", metric)
+	}
+	filters := []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"app.raw": appName}},
+		map[string]interface{}{"range": map[string]interface{}{
+			"@timestamp": map[string]interface{}{"gte": fmt.Sprintf("now-%ds", int(window.Seconds()))},
+		}},
+	}
+	if process != "" && metric != MetricRequestRate {
+		filters = append(filters, map[string]interface{}{"term": map[string]interface{}{"process.raw": process}})
+	}
+	query := map[string]interface{}{
+		"size":  0,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"aggs": map[string]interface{}{
+			"result": map[string]interface{}{m.agg: map[string]interface{}{"field": m.field}},
+		},
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return 0, false, err
+	}
+	url := fmt.Sprintf("%s/.measure-tsuru-*/%s/_search", b.url, m.docType)
+	rsp, err := tsuruNet.Dial5Full60ClientNoKeepAlive.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, false, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(rsp.Body)
+		return 0, false, errors.Errorf("invalid status code %d from elasticsearch: %s", rsp.StatusCode, data)
+	}
+	var result struct {
+		Hits struct {
+			Total int
+		}
+		Aggregations struct {
+			Result struct {
+				Value *float64
+			}
+		}
+	}
+	err = json.NewDecoder(rsp.Body).Decode(&result)
+	if err != nil {
+		return 0, false, err
+	}
+	if result.Hits.Total == 0 || result.Aggregations.Result.Value == nil {
+		return 0, false, nil
+	}
+	value := *result.Aggregations.Result.Value
+	if metric == MetricRequestRate {
+		value /= window.Seconds()
+	}
+	return value, true, nil
+}
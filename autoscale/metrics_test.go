@@ -0,0 +1,71 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestElasticsearchBackendMetric(c *check.C) {
+	var paths []string
+	var queries []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		var query map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&query)
+		queries = append(queries, query)
+		w.Write([]byte(`{"hits": {"total": 10}, "aggregations": {"result": {"value": 600}}}`))
+	}))
+	defer srv.Close()
+	backend, err := getMetricsBackend(map[string]string{
+		"METRICS_BACKEND":            "logstash",
+		"METRICS_ELASTICSEARCH_HOST": srv.URL + "/",
+	})
+	c.Assert(err, check.IsNil)
+	value, ok, err := backend.Metric("myapp", "web", MetricCPU, time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(value, check.Equals, 600.0)
+	value, ok, err = backend.Metric("myapp", "web", MetricRequestRate, time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(value, check.Equals, 10.0)
+	c.Assert(paths, check.DeepEquals, []string{
+		"/.measure-tsuru-*/cpu_max/_search",
+		"/.measure-tsuru-*/response_time/_search",
+	})
+	filters := queries[0]["query"].(map[string]interface{})["bool"].(map[string]interface{})["filter"].([]interface{})
+	c.Assert(filters, check.DeepEquals, []interface{}{
+		map[string]interface{}{"term": map[string]interface{}{"app.raw": "myapp"}},
+		map[string]interface{}{"range": map[string]interface{}{
+			"@timestamp": map[string]interface{}{"gte": "now-60s"},
+		}},
+		map[string]interface{}{"term": map[string]interface{}{"process.raw": "web"}},
+	})
+}
+
+func (s *S) TestElasticsearchBackendMetricNoData(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"hits": {"total": 0}, "aggregations": {"result": {"value": null}}}`))
+	}))
+	defer srv.Close()
+	backend, err := newElasticsearchBackend(map[string]string{"METRICS_ELASTICSEARCH_HOST": srv.URL})
+	c.Assert(err, check.IsNil)
+	_, ok, err := backend.Metric("myapp", "web", MetricMemory, time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestGetMetricsBackendInvalid(c *check.C) {
+	_, err := getMetricsBackend(map[string]string{"METRICS_BACKEND": "statsd"})
+	c.Assert(err, check.ErrorMatches, `unsupported metrics backend "statsd"`)
+	_, err = getMetricsBackend(map[string]string{"METRICS_BACKEND": "logstash"})
+	c.Assert(err, check.ErrorMatches, "METRICS_ELASTICSEARCH_HOST is not set")
+}
@@ -0,0 +1,282 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const preProvisionMaxEvents = 1000
+
+// PoolActivity summarizes the events that happened in a pool in the
+// pre-provision window, used to predict whether new units are likely to be
+// added to the pool soon.
+type PoolActivity struct {
+	Deploys  int
+	UnitAdds int
+	ScaleUps int
+}
+
+func (p *PoolActivity) Active() bool {
+	return p.Deploys+p.UnitAdds+p.ScaleUps > 0
+}
+
+func (p *PoolActivity) String() string {
+	return fmt.Sprintf("%d deploys, %d unit additions and %d node scale ups", p.Deploys, p.UnitAdds, p.ScaleUps)
+}
+
+func (a *Config) poolActivity(pool string) (*PoolActivity, error) {
+	since := time.Now().UTC().Add(-a.PreProvisionWindow)
+	var activity PoolActivity
+	apps, err := app.List(&app.Filter{Pool: pool})
+	if err != nil {
+		return nil, err
+	}
+	if len(apps) > 0 {
+		appNames := make([]string, len(apps))
+		for i := range apps {
+			appNames[i] = apps[i].Name
+		}
+		var evts []event.Event
+		evts, err = event.List(&event.Filter{
+			Target: event.Target{Type: event.TargetTypeApp},
+			Since:  since,
+			Limit:  preProvisionMaxEvents,
+			Raw: bson.M{
+				"target.value": bson.M{"$in": appNames},
+				"kind.name": bson.M{"$in": []string{
+					permission.PermAppDeploy.FullName(),
+					permission.PermAppUpdateUnitAdd.FullName(),
+				}},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range evts {
+			if evts[i].Kind.Name == permission.PermAppDeploy.FullName() {
+				activity.Deploys++
+			} else {
+				activity.UnitAdds++
+			}
+		}
+	}
+	evts, err := event.List(&event.Filter{
+		Target:   event.Target{Type: event.TargetTypePool, Value: pool},
+		KindName: EventKind,
+		Since:    since,
+		Limit:    preProvisionMaxEvents,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range evts {
+		asEvt, err := toAutoScaleEvent(&evts[i])
+		if err != nil {
+			return nil, err
+		}
+		if asEvt.Action == scaleActionAdd {
+			activity.ScaleUps++
+		}
+	}
+	return &activity, nil
+}
+
+// spareScaler keeps a headroom of spare nodes in pools with recent deploys,
+// unit additions or node scale ups, so that new units don't have to wait for
+// new machines. The units of the emptiest nodes are considered to be running
+// in the other nodes when running the wrapped scaler, reserving the capacity
+// of the spare nodes.
+type spareScaler struct {
+	*Config
+	rule   *Rule
+	scaler autoScaler
+}
+
+// reservedNode is a node holding, besides its own units, the units of the
+// nodes reserved as spare nodes.
+type reservedNode struct {
+	provision.Node
+	extra []provision.Unit
+}
+
+func (n *reservedNode) Units() ([]provision.Unit, error) {
+	units, err := n.Node.Units()
+	if err != nil {
+		return nil, err
+	}
+	return append(units, n.extra...), nil
+}
+
+type nodeUnitsList struct {
+	nodes []provision.Node
+	units [][]provision.Unit
+}
+
+func (l nodeUnitsList) Len() int { return len(l.nodes) }
+func (l nodeUnitsList) Swap(i, j int) {
+	l.nodes[i], l.nodes[j] = l.nodes[j], l.nodes[i]
+	l.units[i], l.units[j] = l.units[j], l.units[i]
+}
+func (l nodeUnitsList) Less(i, j int) bool {
+	if len(l.units[i]) == len(l.units[j]) {
+		return l.nodes[i].Address() < l.nodes[j].Address()
+	}
+	return len(l.units[i]) > len(l.units[j])
+}
+
+// reserveNodes returns the nodes left after reserving count nodes, holding
+// the units of the reserved nodes.
+func reserveNodes(nodes []provision.Node, count int) ([]provision.Node, error) {
+	list := nodeUnitsList{
+		nodes: make([]provision.Node, len(nodes)),
+		units: make([][]provision.Unit, len(nodes)),
+	}
+	copy(list.nodes, nodes)
+	for i, node := range list.nodes {
+		units, err := node.Units()
+		if err != nil {
+			return nil, err
+		}
+		list.units[i] = units
+	}
+	sort.Sort(list)
+	remaining := len(nodes) - count
+	result := make([]provision.Node, remaining)
+	reserved := make([]*reservedNode, remaining)
+	for i := range result {
+		reserved[i] = &reservedNode{Node: list.nodes[i]}
+		result[i] = reserved[i]
+	}
+	var i int
+	for _, units := range list.units[remaining:] {
+		for _, unit := range units {
+			reserved[i%remaining].extra = append(reserved[i%remaining].extra, unit)
+			i++
+		}
+	}
+	return result, nil
+}
+
+func (a *spareScaler) scale(pool string, nodes []provision.Node) (*ScalerResult, error) {
+	activity, err := a.poolActivity(pool)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read pool activity")
+	}
+	if !activity.Active() {
+		return a.scaler.scale(pool, nodes)
+	}
+	reserved := a.rule.SpareNodes
+	if reserved >= len(nodes) {
+		reserved = len(nodes) - 1
+	}
+	missing := a.rule.SpareNodes - reserved
+	remaining, err := reserveNodes(nodes, reserved)
+	if err != nil {
+		return nil, err
+	}
+	result, err := a.scaler.scale(pool, remaining)
+	if err != nil {
+		return nil, err
+	}
+	if missing > 0 {
+		result.ToAdd += missing
+		result.ToRemove = nil
+	} else if len(result.ToRemove) > 0 {
+		result.ToRemove = nodesToSpec(chooseNodeForRemoval(nodes, len(result.ToRemove)))
+	}
+	if result.ToAdd == 0 && len(result.ToRemove) == 0 {
+		return result, nil
+	}
+	reason := fmt.Sprintf("keeping %d spare nodes after %s in the last %s", a.rule.SpareNodes, activity, a.PreProvisionWindow)
+	if result.Reason != "" {
+		reason = fmt.Sprintf("%s, %s", result.Reason, reason)
+	}
+	result.Reason = reason
+	return result, nil
+}
+
+// PreProvisionReport describes what node auto scale would do in a pool whose
+// rule keeps spare nodes, without adding or removing any node.
+type PreProvisionReport struct {
+	Pool       string
+	Nodes      int
+	SpareNodes int
+	Activity   PoolActivity
+	Active     bool
+	ToAdd      int
+	ToRemove   []provision.NodeSpec
+	Reason     string
+	Error      string `json:",omitempty"`
+}
+
+// PreProvisionReports returns the pre-provision report of every pool whose
+// auto scale rule keeps spare nodes.
+func PreProvisionReports() ([]PreProvisionReport, error) {
+	a := newConfig()
+	_, clusterMap, err := a.poolNodes()
+	if err != nil {
+		return nil, err
+	}
+	pools := make([]string, 0, len(clusterMap))
+	for pool := range clusterMap {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+	var reports []PreProvisionReport
+	for _, pool := range pools {
+		rule, err := ruleForPool(pool)
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !rule.Enabled || rule.SpareNodes <= 0 {
+			continue
+		}
+		reports = append(reports, a.preProvisionReport(pool, clusterMap[pool], rule))
+	}
+	return reports, nil
+}
+
+func (a *Config) preProvisionReport(pool string, nodes []provision.Node, rule *Rule) PreProvisionReport {
+	report := PreProvisionReport{
+		Pool:       pool,
+		Nodes:      len(nodes),
+		SpareNodes: rule.SpareNodes,
+	}
+	activity, err := a.poolActivity(pool)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.Activity = *activity
+	report.Active = activity.Active()
+	scaler, err := a.scalerForRule(rule)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	result, err := scaler.scale(pool, nodes)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.ToAdd = result.ToAdd
+	report.ToRemove = result.ToRemove
+	report.Reason = result.Reason
+	return report
+}
@@ -0,0 +1,155 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) insertAppEvent(c *check.C, appName string, kind *permission.PermissionScheme) {
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: event.TargetTypeApp, Value: appName},
+		Kind:     kind,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: "me@me.com"},
+		Allowed:  event.Allowed(permission.PermApp),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestPoolActivity(c *check.C) {
+	s.insertAppEvent(c, s.appInstance.GetName(), permission.PermAppDeploy)
+	s.insertAppEvent(c, s.appInstance.GetName(), permission.PermAppDeploy)
+	s.insertAppEvent(c, s.appInstance.GetName(), permission.PermAppUpdateUnitAdd)
+	s.insertAppEvent(c, s.appInstance.GetName(), permission.PermAppUpdateEnvSet)
+	s.insertAppEvent(c, "otherapp", permission.PermAppDeploy)
+	a := newConfig()
+	activity, err := a.poolActivity("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(activity, check.DeepEquals, &PoolActivity{Deploys: 2, UnitAdds: 1})
+	c.Assert(activity.Active(), check.Equals, true)
+	activity, err = a.poolActivity("pool2")
+	c.Assert(err, check.IsNil)
+	c.Assert(activity.Active(), check.Equals, false)
+}
+
+func (s *S) TestAutoScaleConfigRunSpareNodes(c *check.C) {
+	config.Unset("docker:auto-scale:max-container-count")
+	s.insertRule(c, Rule{MetadataFilter: "pool1", Enabled: true, ScaleDownRatio: 1.333, MaxContainerCount: 2, SpareNodes: 1})
+	s.insertAppEvent(c, s.appInstance.GetName(), permission.PermAppDeploy)
+	_, err := s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2, check.Commentf("log: %s", s.logBuf.String()))
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: provision.PoolMetadataName, Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toadd":  1,
+			"result.reason": "keeping 1 spare nodes after 1 deploys, 0 unit additions and 0 node scale ups in the last 1h0m0s",
+			"nodes":         bson.M{"$size": 1},
+		},
+		LogMatches: `(?s).*running scaler.*spareScaler.*pool1.*`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAutoScaleConfigRunSpareNodesWithoutActivity(c *check.C) {
+	config.Unset("docker:auto-scale:max-container-count")
+	s.insertRule(c, Rule{MetadataFilter: "pool1", Enabled: true, ScaleDownRatio: 1.333, MaxContainerCount: 2, SpareNodes: 1})
+	_, err := s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+}
+
+func (s *S) TestAutoScaleConfigRunSpareNodesKeepsSpareNode(c *check.C) {
+	config.Unset("docker:auto-scale:max-container-count")
+	s.insertRule(c, Rule{MetadataFilter: "pool1", Enabled: true, ScaleDownRatio: 1.333, MaxContainerCount: 2, SpareNodes: 1})
+	s.insertAppEvent(c, s.appInstance.GetName(), permission.PermAppUpdateUnitAdd)
+	err := s.p.AddNode(provision.AddNodeOptions{
+		Address: "http://n2:2",
+		Metadata: map[string]string{
+			provision.PoolMetadataName: "pool1",
+			"iaas": "my-scale-iaas",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+}
+
+func (s *S) TestPreProvisionReports(c *check.C) {
+	config.Unset("docker:auto-scale:max-container-count")
+	s.insertRule(c, Rule{MetadataFilter: "pool1", Enabled: true, ScaleDownRatio: 1.333, MaxContainerCount: 2, SpareNodes: 2})
+	s.insertAppEvent(c, s.appInstance.GetName(), permission.PermAppDeploy)
+	_, err := s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	reports, err := PreProvisionReports()
+	c.Assert(err, check.IsNil)
+	c.Assert(reports, check.DeepEquals, []PreProvisionReport{
+		{
+			Pool:       "pool1",
+			Nodes:      1,
+			SpareNodes: 2,
+			Activity:   PoolActivity{Deploys: 1},
+			Active:     true,
+			ToAdd:      2,
+			Reason:     "keeping 2 spare nodes after 1 deploys, 0 unit additions and 0 node scale ups in the last 1h0m0s",
+		},
+	})
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+}
+
+func (s *S) TestReserveNodes(c *check.C) {
+	err := s.p.AddNode(provision.AddNodeOptions{Address: "http://n2:2", Metadata: map[string]string{provision.PoolMetadataName: "pool1"}})
+	c.Assert(err, check.IsNil)
+	err = s.p.AddNode(provision.AddNodeOptions{Address: "http://n3:3", Metadata: map[string]string{provision.PoolMetadataName: "pool1"}})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 3, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 2, "web", nil, "n2:2")
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n3:3")
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	remaining, err := reserveNodes(nodes, 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(remaining, check.HasLen, 2)
+	c.Assert(remaining[0].Address(), check.Equals, "http://n1:1")
+	c.Assert(remaining[1].Address(), check.Equals, "http://n2:2")
+	units, err := remaining[0].Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 4)
+	units, err = remaining[1].Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
@@ -0,0 +1,168 @@
+// Copyright 2015 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
+)
+
+// resourceScaler scales nodes based on the sum of a resource reserved by the
+// plans of the units in each node, like memory or cpu shares, compared to the
+// amount of the resource available to the node, described by the node
+// metadata and limited by the ratio set in the rule.
+type resourceScaler struct {
+	*Config
+	rule *Rule
+
+	// resource names the resource in messages, like "memory".
+	resource string
+	// unit describes amounts of the resource in messages, like "bytes".
+	unit string
+	// metadata is the node metadata holding the total amount of the
+	// resource in the node.
+	metadata string
+	// ratio is the maximum ratio of the total amount that may be reserved.
+	ratio float32
+	// planAmount returns the amount of the resource reserved by the plan.
+	planAmount func(*app.Plan) int64
+}
+
+func newMemoryScaler(a *Config, rule *Rule) *resourceScaler {
+	return &resourceScaler{
+		Config:     a,
+		rule:       rule,
+		resource:   "memory",
+		unit:       "bytes",
+		metadata:   a.TotalMemoryMetadata,
+		ratio:      rule.MaxMemoryRatio,
+		planAmount: func(p *app.Plan) int64 { return p.Memory },
+	}
+}
+
+func newCpuScaler(a *Config, rule *Rule) *resourceScaler {
+	return &resourceScaler{
+		Config:     a,
+		rule:       rule,
+		resource:   "cpu",
+		unit:       "cpu shares",
+		metadata:   a.TotalCpuMetadata,
+		ratio:      rule.MaxCpuRatio,
+		planAmount: func(p *app.Plan) int64 { return int64(p.CpuShare) },
+	}
+}
+
+type nodeResourceData struct {
+	node      provision.Node
+	max       int64
+	reserved  int64
+	available int64
+}
+
+func (a *resourceScaler) nodesData(pool string, nodes []provision.Node) (map[string]*nodeResourceData, error) {
+	nodesData := make(map[string]*nodeResourceData)
+	unitsMap, err := preciseUnitsByNode(pool, nodes)
+	if err != nil {
+		return nil, err
+	}
+	amounts := make(map[string]int64)
+	for _, node := range nodes {
+		metadata := node.Metadata()
+		total, _ := strconv.ParseFloat(metadata[a.metadata], 64)
+		if total == 0.0 {
+			return nil, errors.Errorf("no value found for %s metadata (%s) in node %s", a.resource, a.metadata, node.Address())
+		}
+		data := &nodeResourceData{
+			node: node,
+			max:  int64(float64(a.ratio) * total),
+		}
+		nodesData[node.Address()] = data
+		for _, unit := range unitsMap[node.Address()] {
+			amount, ok := amounts[unit.AppName]
+			if !ok {
+				unitApp, err := app.GetByName(unit.AppName)
+				if err != nil {
+					return nil, errors.Wrapf(err, "couldn't find container app (%s)", unit.AppName)
+				}
+				amount = a.planAmount(&unitApp.Plan)
+				amounts[unit.AppName] = amount
+			}
+			data.reserved += amount
+		}
+		data.available = data.max - data.reserved
+	}
+	return nodesData, nil
+}
+
+func (a *resourceScaler) maxPlanAmount() (int64, error) {
+	plans, err := app.PlansList()
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't list plans")
+	}
+	var maxPlan int64
+	for i := range plans {
+		if amount := a.planAmount(&plans[i]); amount > maxPlan {
+			maxPlan = amount
+		}
+	}
+	if maxPlan == 0 {
+		defaultPlan, err := app.DefaultPlan()
+		if err != nil {
+			return 0, errors.Wrap(err, "couldn't get default plan")
+		}
+		maxPlan = a.planAmount(defaultPlan)
+	}
+	return maxPlan, nil
+}
+
+func (a *resourceScaler) scale(pool string, nodes []provision.Node) (*ScalerResult, error) {
+	maxPlan, err := a.maxPlanAmount()
+	if err != nil {
+		return nil, err
+	}
+	nodesData, err := a.nodesData(pool, nodes)
+	if err != nil {
+		return nil, err
+	}
+	var totalReserved, total int64
+	for _, node := range nodes {
+		data := nodesData[node.Address()]
+		totalReserved += data.reserved
+		total += data.max
+	}
+	perNode := total / int64(len(nodes))
+	scaledMaxPlan := int64(float32(maxPlan) * a.rule.ScaleDownRatio)
+	toRemoveCount := len(nodes) - int(((totalReserved+scaledMaxPlan)/perNode)+1)
+	if toRemoveCount > 0 {
+		chosenNodes := chooseNodeForRemoval(nodes, toRemoveCount)
+		if len(chosenNodes) > 0 {
+			return &ScalerResult{
+				ToRemove: nodesToSpec(chosenNodes),
+				Reason:   fmt.Sprintf("containers can be distributed in only %d nodes", len(nodes)-len(chosenNodes)),
+			}, nil
+		}
+	}
+	for _, node := range nodes {
+		data := nodesData[node.Address()]
+		if maxPlan > data.max {
+			return nil, errors.Errorf("aborting, impossible to fit max plan %s of %d %s, node max available %s is %d", a.resource, maxPlan, a.unit, a.resource, data.max)
+		}
+		if data.available >= maxPlan {
+			return &ScalerResult{}, nil
+		}
+	}
+	nodesToAdd := int((totalReserved + maxPlan) / total)
+	if nodesToAdd == 0 {
+		return &ScalerResult{}, nil
+	}
+	return &ScalerResult{
+		ToAdd:  nodesToAdd,
+		Reason: fmt.Sprintf("can't add %d %s to an existing node", maxPlan, a.unit),
+	}, nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type fakeScaler struct {
+	result *ScalerResult
+}
+
+func (s *fakeScaler) scale(pool string, nodes []provision.Node) (*ScalerResult, error) {
+	return s.result, nil
+}
+
+func (s *S) insertRule(c *check.C, rule Rule) {
+	coll, err := autoScaleRuleCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(rule)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAutoScaleConfigRunCpuBased(c *check.C) {
+	config.Unset("docker:auto-scale:max-container-count")
+	config.Set("docker:scheduler:total-cpu-metadata", "totalCpu")
+	err := s.p.UpdateNode(provision.UpdateNodeOptions{
+		Address: "http://n1:1",
+		Metadata: map[string]string{
+			provision.PoolMetadataName: "pool1",
+			"iaas":     "my-scale-iaas",
+			"totalCpu": "40",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	s.insertRule(c, Rule{MetadataFilter: "pool1", Enabled: true, ScaleDownRatio: 1.333, MaxCpuRatio: 1})
+	_, err = s.p.AddUnitsToNode(s.appInstance, 4, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	err = a.runOnce()
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2, check.Commentf("log: %s", s.logBuf.String()))
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: provision.PoolMetadataName, Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toadd":       1,
+			"result.torebalance": true,
+			"result.reason":      "can't add 10 cpu shares to an existing node",
+			"nodes":              bson.M{"$size": 1},
+		},
+		LogMatches: `(?s).*running scaler.*resourceScaler.*pool1.*`,
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAutoScaleConfigRunScaleDownCpuScaler(c *check.C) {
+	config.Unset("docker:auto-scale:max-container-count")
+	config.Set("docker:scheduler:total-cpu-metadata", "totalCpu")
+	err := s.p.UpdateNode(provision.UpdateNodeOptions{
+		Address: "http://n1:1",
+		Metadata: map[string]string{
+			provision.PoolMetadataName: "pool1",
+			"iaas":     "my-scale-iaas",
+			"totalCpu": "40",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = s.p.AddNode(provision.AddNodeOptions{
+		Address: "http://n2:2",
+		Metadata: map[string]string{
+			provision.PoolMetadataName: "pool1",
+			"iaas":     "my-scale-iaas",
+			"totalCpu": "40",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	s.insertRule(c, Rule{MetadataFilter: "pool1", Enabled: true, ScaleDownRatio: 1.333, MaxCpuRatio: 1})
+	_, err = s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	_, err = s.p.AddUnitsToNode(s.appInstance, 1, "web", nil, "n2:2")
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	a.runOnce()
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: provision.PoolMetadataName, Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toremove":    bson.M{"$size": 1},
+			"result.torebalance": false,
+			"result.reason":      "containers can be distributed in only 1 nodes",
+			"nodes":              bson.M{"$size": 1},
+		},
+	}, eventtest.HasEvent)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	units, err := nodes[0].Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestAutoScaleConfigRunCpuMissingMetadata(c *check.C) {
+	config.Unset("docker:auto-scale:max-container-count")
+	config.Set("docker:scheduler:total-cpu-metadata", "totalCpu")
+	s.insertRule(c, Rule{MetadataFilter: "pool1", Enabled: true, ScaleDownRatio: 1.333, MaxCpuRatio: 1})
+	_, err := s.p.AddUnitsToNode(s.appInstance, 4, "web", nil, "n1:1")
+	c.Assert(err, check.IsNil)
+	a := newConfig()
+	a.runOnce()
+	c.Assert(s.logBuf.String(), check.Matches, `(?s).*no value found for cpu metadata \(totalCpu\) in node http://n1:1.*`)
+	nodes, err := s.p.ListNodes(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+}
+
+func (s *S) TestScalerForRule(c *check.C) {
+	a := &Config{TotalMemoryMetadata: "totalMem", TotalCpuMetadata: "totalCpu"}
+	scaler, err := a.scalerForRule(&Rule{MaxContainerCount: 2, MaxCpuRatio: 0.8, MaxMemoryRatio: 0.8})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &countScaler{})
+	scaler, err = a.scalerForRule(&Rule{MaxCpuRatio: 0.8, MaxMemoryRatio: 0.8})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &resourceScaler{})
+	c.Assert(scaler.(*resourceScaler).resource, check.Equals, "cpu")
+	c.Assert(scaler.(*resourceScaler).metadata, check.Equals, "totalCpu")
+	scaler, err = a.scalerForRule(&Rule{MaxMemoryRatio: 0.8})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &resourceScaler{})
+	c.Assert(scaler.(*resourceScaler).resource, check.Equals, "memory")
+	c.Assert(scaler.(*resourceScaler).metadata, check.Equals, "totalMem")
+	scaler, err = a.scalerForRule(&Rule{MaxContainerCount: 2, MaxCpuRatio: 0.8, MaxMemoryRatio: 0.8, CombineScalers: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &multiScaler{})
+	scalers := scaler.(*multiScaler).scalers
+	c.Assert(scalers, check.HasLen, 3)
+	c.Assert(scalers[0], check.FitsTypeOf, &countScaler{})
+	c.Assert(scalers[1].(*resourceScaler).resource, check.Equals, "cpu")
+	c.Assert(scalers[2].(*resourceScaler).resource, check.Equals, "memory")
+	scaler, err = a.scalerForRule(&Rule{MaxContainerCount: 2, CombineScalers: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &countScaler{})
+	scaler, err = a.scalerForRule(&Rule{MaxContainerCount: 2, SpareNodes: 1})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &spareScaler{})
+	c.Assert(scaler.(*spareScaler).scaler, check.FitsTypeOf, &countScaler{})
+}
+
+func (s *S) TestMultiScalerAddsWhenAnyScalerAdds(c *check.C) {
+	m := &multiScaler{scalers: []autoScaler{
+		&fakeScaler{result: &ScalerResult{ToRemove: []provision.NodeSpec{{Address: "n1"}}}},
+		&fakeScaler{result: &ScalerResult{ToAdd: 1, Reason: "reason 1"}},
+		&fakeScaler{result: &ScalerResult{ToAdd: 2, Reason: "reason 2"}},
+	}}
+	result, err := m.scale("pool1", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, &ScalerResult{ToAdd: 2, Reason: "reason 1; reason 2"})
+}
+
+func (s *S) TestMultiScalerRemovesWhenAllScalersRemove(c *check.C) {
+	m := &multiScaler{scalers: []autoScaler{
+		&fakeScaler{result: &ScalerResult{ToRemove: []provision.NodeSpec{{Address: "n1"}, {Address: "n2"}}, Reason: "reason 1"}},
+		&fakeScaler{result: &ScalerResult{ToRemove: []provision.NodeSpec{{Address: "n1"}}, Reason: "reason 2"}},
+	}}
+	result, err := m.scale("pool1", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, &ScalerResult{ToRemove: []provision.NodeSpec{{Address: "n1"}}, Reason: "reason 2"})
+	m.scalers = append(m.scalers, &fakeScaler{result: &ScalerResult{}})
+	result, err = m.scale("pool1", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, &ScalerResult{})
+}
+
+func (s *S) TestRuleNormalizeCpu(c *check.C) {
+	rule := Rule{Enabled: true, MaxCpuRatio: 0.8}
+	err := rule.normalize()
+	c.Assert(err, check.ErrorMatches, "invalid rule, max cpu ratio requires cpu information")
+	config.Set("docker:scheduler:total-cpu-metadata", "totalCpu")
+	rule = Rule{Enabled: true, MaxCpuRatio: -1}
+	err = rule.normalize()
+	c.Assert(err, check.ErrorMatches, "invalid rule, max cpu ratio must not be negative, got -1.000000")
+	rule = Rule{Enabled: true, MaxCpuRatio: 0.8}
+	err = rule.normalize()
+	c.Assert(err, check.IsNil)
+	c.Assert(rule.Error, check.Equals, "")
+}
@@ -21,6 +21,9 @@ type Rule struct {
 	MaxContainerCount int
 	ScaleDownRatio    float32
 	MaxMemoryRatio    float32
+	MaxCpuRatio       float32
+	CombineScalers    bool
+	SpareNodes        int
 	Enabled           bool
 	PreventRebalance  bool
 }
@@ -44,8 +47,24 @@ func (r *Rule) normalize() error {
 		r.MaxMemoryRatio = float32(maxMemoryRatio)
 	}
 	TotalMemoryMetadata, _ := config.GetString("docker:scheduler:total-memory-metadata")
-	if r.Enabled && r.MaxContainerCount <= 0 && (TotalMemoryMetadata == "" || r.MaxMemoryRatio <= 0) {
-		err := errors.Errorf("invalid rule, either memory information or max container count must be set")
+	TotalCpuMetadata, _ := config.GetString("docker:scheduler:total-cpu-metadata")
+	if r.MaxCpuRatio < 0 {
+		err := errors.Errorf("invalid rule, max cpu ratio must not be negative, got %f", r.MaxCpuRatio)
+		r.Error = err.Error()
+		return err
+	}
+	if r.SpareNodes < 0 {
+		err := errors.Errorf("invalid rule, spare nodes must not be negative, got %d", r.SpareNodes)
+		r.Error = err.Error()
+		return err
+	}
+	if r.MaxCpuRatio > 0 && TotalCpuMetadata == "" {
+		err := errors.Errorf("invalid rule, max cpu ratio requires cpu information")
+		r.Error = err.Error()
+		return err
+	}
+	if r.Enabled && r.MaxContainerCount <= 0 && r.MaxCpuRatio <= 0 && (TotalMemoryMetadata == "" || r.MaxMemoryRatio <= 0) {
+		err := errors.Errorf("invalid rule, either memory information, cpu information or max container count must be set")
 		r.Error = err.Error()
 		return err
 	}
@@ -0,0 +1,299 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/leader"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	ScheduleEventKind = "app-scheduled-scale"
+
+	scheduleRunInterval = time.Minute
+	scheduleLeaseStale  = 3 * time.Minute
+)
+
+var (
+	ErrAppScheduleNotFound = errors.New("scale schedule not found")
+
+	scheduleRunnerInstance *scheduleRunner
+)
+
+// AppSchedule scales an app process to a fixed number of units at the times
+// matching a cron expression, like "0 8 * * 1-5", evaluated in the timezone
+// of the schedule, UTC by default.
+type AppSchedule struct {
+	ID        bson.ObjectId `json:"id" bson:"_id"`
+	App       string        `json:"app"`
+	Process   string        `json:"process"`
+	Cron      string        `json:"cron"`
+	Units     int           `json:"units"`
+	Timezone  string        `json:"timezone,omitempty" bson:",omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	LastRun   time.Time     `json:"last_run,omitempty" bson:",omitempty"`
+}
+
+func (s *AppSchedule) Validate() error {
+	if s.Units < 1 {
+		return errors.New("units must be greater than zero")
+	}
+	if _, err := parseCron(s.Cron); err != nil {
+		return err
+	}
+	_, err := s.location()
+	return err
+}
+
+func (s *AppSchedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, errors.Errorf("invalid timezone %q", s.Timezone)
+	}
+	return loc, nil
+}
+
+// next returns the first time matching the schedule after the given time.
+func (s *AppSchedule) next(after time.Time) (time.Time, error) {
+	cron, err := parseCron(s.Cron)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := s.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cron.next(after.In(loc)), nil
+}
+
+// AddAppSchedule stores a new scale schedule for an app process.
+func AddAppSchedule(s *AppSchedule) error {
+	err := s.Validate()
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	s.ID = bson.NewObjectId()
+	s.CreatedAt = time.Now().UTC()
+	s.LastRun = time.Time{}
+	return conn.AppScaleSchedules().Insert(s)
+}
+
+// ListAppSchedules returns the scale schedules of the app, sorted by process
+// and creation time.
+func ListAppSchedules(appName string) ([]AppSchedule, error) {
+	return listAppSchedules(bson.M{"app": appName})
+}
+
+func listAppSchedules(query bson.M) ([]AppSchedule, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var schedules []AppSchedule
+	err = conn.AppScaleSchedules().Find(query).Sort("app", "process", "createdat").All(&schedules)
+	if err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// RemoveAppSchedule removes the scale schedule with the given id from the
+// app.
+func RemoveAppSchedule(appName, id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return ErrAppScheduleNotFound
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.AppScaleSchedules().Remove(bson.M{"_id": bson.ObjectIdHex(id), "app": appName})
+	if err == mgo.ErrNotFound {
+		return ErrAppScheduleNotFound
+	}
+	return err
+}
+
+// lastScheduledUnits returns the units set by the schedule of the app process
+// that ran last, or zero when no schedule of the process ran.
+func lastScheduledUnits(appName, process string) (int, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	var schedule AppSchedule
+	err = conn.AppScaleSchedules().Find(bson.M{
+		"app":     appName,
+		"process": process,
+		"lastrun": bson.M{"$exists": true},
+	}).Sort("-lastrun").One(&schedule)
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return schedule.Units, nil
+}
+
+// RunAppSchedules scales the app processes whose schedules had a matching
+// time since their last run, up to the given time. Missed times are
+// coalesced, each schedule runs at most once per call.
+func RunAppSchedules(now time.Time) error {
+	schedules, err := listAppSchedules(nil)
+	if err != nil {
+		return err
+	}
+	for i := range schedules {
+		err = runAppSchedule(&schedules[i], now)
+		if err != nil {
+			log.Errorf("[app scheduled scale] error running schedule %q of app %q: %s", schedules[i].Cron, schedules[i].App, err)
+		}
+	}
+	return nil
+}
+
+func runAppSchedule(s *AppSchedule, now time.Time) error {
+	since := s.LastRun
+	if since.IsZero() {
+		since = s.CreatedAt
+	}
+	next, err := s.next(since)
+	if err != nil || next.IsZero() || next.After(now) {
+		return err
+	}
+	a, err := app.GetByName(s.App)
+	if err == app.ErrAppNotFound {
+		return RemoveAppSchedule(s.App, s.ID.Hex())
+	}
+	if err != nil {
+		return err
+	}
+	units, err := a.Units()
+	if err != nil {
+		return err
+	}
+	var current int
+	for _, u := range units {
+		if u.ProcessName == s.Process {
+			current++
+		}
+	}
+	target := s.Units
+	reason := fmt.Sprintf("schedule %q", s.Cron)
+	policies, err := listAppPolicies(bson.M{"app": s.App, "process": s.Process})
+	if err != nil {
+		return err
+	}
+	if len(policies) > 0 {
+		if target < policies[0].MinUnits {
+			target = policies[0].MinUnits
+			reason += fmt.Sprintf(", min units %d", target)
+		}
+		if target > policies[0].MaxUnits {
+			target = policies[0].MaxUnits
+			reason += fmt.Sprintf(", max units %d", target)
+		}
+	}
+	if current > 0 && current != target {
+		err = scaleAppUnits(a, ScheduleEventKind, &AppScaleResult{
+			Process: s.Process,
+			From:    current,
+			To:      target,
+			Reason:  reason,
+		})
+		if _, ok := err.(errAppNotLocked); ok {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.AppScaleSchedules().UpdateId(s.ID, bson.M{"$set": bson.M{"lastrun": now.UTC()}})
+}
+
+type scheduleRunner struct {
+	lease    *leader.Lease
+	done     chan struct{}
+	finished chan struct{}
+}
+
+// InitializeAppSchedules starts the background runner of app scale
+// schedules, when scheduled scaling is enabled.
+func InitializeAppSchedules() error {
+	if scheduleRunnerInstance != nil {
+		return errors.New("app scale schedules runner already initialized")
+	}
+	if enabled, _ := config.GetBool("auto-scale:apps:schedules:enabled"); !enabled {
+		return nil
+	}
+	scheduleRunnerInstance = &scheduleRunner{
+		lease:    leader.NewLease("app-scale-schedules", scheduleLeaseStale),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go scheduleRunnerInstance.run()
+	shutdown.Register(scheduleRunnerInstance)
+	return nil
+}
+
+func (r *scheduleRunner) run() {
+	defer close(r.finished)
+	for {
+		now := time.Now().UTC()
+		isLeader, err := r.lease.Acquire()
+		if err != nil {
+			log.Errorf("[app scheduled scale] unable to acquire lease: %s", err)
+		} else if isLeader {
+			if err = RunAppSchedules(now); err != nil {
+				log.Errorf("[app scheduled scale] unable to run schedules: %s", err)
+			}
+		}
+		next := now.Truncate(scheduleRunInterval).Add(scheduleRunInterval)
+		select {
+		case <-r.done:
+			return
+		case <-time.After(next.Sub(now)):
+		}
+	}
+}
+
+func (r *scheduleRunner) Shutdown() {
+	close(r.done)
+	<-r.finished
+	if err := r.lease.Release(); err != nil {
+		log.Errorf("[app scheduled scale] unable to release lease: %s", err)
+	}
+}
+
+func (r *scheduleRunner) String() string {
+	return "app scheduled scale"
+}
@@ -0,0 +1,199 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package autoscale
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestAppScheduleValidate(c *check.C) {
+	tests := []struct {
+		schedule AppSchedule
+		err      string
+	}{
+		{AppSchedule{Cron: "0 8 * * *", Units: 1}, ""},
+		{AppSchedule{Cron: "0 8 * * *", Units: 1, Timezone: "America/Sao_Paulo"}, ""},
+		{AppSchedule{Cron: "0 8 * * *", Units: 0}, "units must be greater than zero"},
+		{AppSchedule{Cron: "0 8 * *", Units: 1}, `invalid cron expression .*`},
+		{AppSchedule{Cron: "0 8 * * *", Units: 1, Timezone: "Nowhere/City"}, `invalid timezone "Nowhere/City"`},
+	}
+	for _, t := range tests {
+		err := t.schedule.Validate()
+		if t.err == "" {
+			c.Check(err, check.IsNil)
+		} else {
+			c.Check(err, check.ErrorMatches, t.err)
+		}
+	}
+}
+
+func (s *S) TestAddAppSchedule(c *check.C) {
+	schedule := AppSchedule{App: "myapp", Process: "web", Cron: "0 8 * * *", Units: 10}
+	err := AddAppSchedule(&schedule)
+	c.Assert(err, check.IsNil)
+	c.Assert(schedule.ID.Valid(), check.Equals, true)
+	c.Assert(schedule.CreatedAt.IsZero(), check.Equals, false)
+	err = AddAppSchedule(&AppSchedule{App: "myapp", Process: "web", Cron: "0 8 * * *", Units: 0})
+	c.Assert(err, check.ErrorMatches, "units must be greater than zero")
+	schedules, err := ListAppSchedules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules, check.HasLen, 1)
+	c.Assert(schedules[0].ID, check.Equals, schedule.ID)
+	c.Assert(schedules[0].Units, check.Equals, 10)
+}
+
+func (s *S) TestRemoveAppSchedule(c *check.C) {
+	schedule := AppSchedule{App: "myapp", Process: "web", Cron: "0 8 * * *", Units: 10}
+	err := AddAppSchedule(&schedule)
+	c.Assert(err, check.IsNil)
+	err = RemoveAppSchedule("otherapp", schedule.ID.Hex())
+	c.Assert(err, check.Equals, ErrAppScheduleNotFound)
+	err = RemoveAppSchedule("myapp", "invalid")
+	c.Assert(err, check.Equals, ErrAppScheduleNotFound)
+	err = RemoveAppSchedule("myapp", schedule.ID.Hex())
+	c.Assert(err, check.IsNil)
+	schedules, err := ListAppSchedules("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules, check.HasLen, 0)
+}
+
+func (s *S) addSchedule(c *check.C, schedule AppSchedule, createdAt time.Time) AppSchedule {
+	err := AddAppSchedule(&schedule)
+	c.Assert(err, check.IsNil)
+	schedule.CreatedAt = createdAt
+	err = s.conn.AppScaleSchedules().UpdateId(schedule.ID, bson.M{"$set": bson.M{"createdat": createdAt}})
+	c.Assert(err, check.IsNil)
+	return schedule
+}
+
+func (s *S) TestRunAppSchedules(c *check.C) {
+	a := s.newScaledApp(c, 2)
+	created := time.Date(2017, time.March, 10, 7, 0, 0, 0, time.UTC)
+	schedule := s.addSchedule(c, AppSchedule{App: a.Name, Process: "web", Cron: "0 8 * * *", Units: 5}, created)
+	now := time.Date(2017, time.March, 10, 8, 0, 30, 0, time.UTC)
+	err := RunAppSchedules(now)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 5)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:   ScheduleEventKind,
+		EndCustomData: map[string]interface{}{
+			"process": "web",
+			"from":    2,
+			"to":      5,
+			"reason":  `schedule "0 8 * * *"`,
+		},
+	}, eventtest.HasEvent)
+	schedules, err := ListAppSchedules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules[0].ID, check.Equals, schedule.ID)
+	c.Assert(schedules[0].LastRun.Equal(now), check.Equals, true)
+}
+
+func (s *S) TestRunAppSchedulesScaleDown(c *check.C) {
+	a := s.newScaledApp(c, 4)
+	created := time.Date(2017, time.March, 10, 7, 0, 0, 0, time.UTC)
+	s.addSchedule(c, AppSchedule{App: a.Name, Process: "web", Cron: "0 20 * * *", Units: 1}, created)
+	err := RunAppSchedules(time.Date(2017, time.March, 10, 21, 0, 0, 0, time.UTC))
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 1)
+}
+
+func (s *S) TestRunAppSchedulesClampsToPolicy(c *check.C) {
+	a := s.newScaledApp(c, 2)
+	err := SetAppPolicy(AppPolicy{App: a.Name, Process: "web", MinUnits: 1, MaxUnits: 4, CPU: 50})
+	c.Assert(err, check.IsNil)
+	created := time.Date(2017, time.March, 10, 7, 0, 0, 0, time.UTC)
+	s.addSchedule(c, AppSchedule{App: a.Name, Process: "web", Cron: "0 8 * * *", Units: 10}, created)
+	err = RunAppSchedules(time.Date(2017, time.March, 10, 8, 0, 30, 0, time.UTC))
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 4)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:   ScheduleEventKind,
+		EndCustomData: map[string]interface{}{
+			"process": "web",
+			"from":    2,
+			"to":      4,
+			"reason":  `schedule "0 8 * * *", max units 4`,
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRunAppSchedulesNotDue(c *check.C) {
+	a := s.newScaledApp(c, 2)
+	created := time.Date(2017, time.March, 10, 7, 0, 0, 0, time.UTC)
+	s.addSchedule(c, AppSchedule{App: a.Name, Process: "web", Cron: "0 8 * * *", Units: 5}, created)
+	err := RunAppSchedules(time.Date(2017, time.March, 10, 7, 59, 0, 0, time.UTC))
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	schedules, err := ListAppSchedules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules[0].LastRun.IsZero(), check.Equals, true)
+}
+
+func (s *S) TestRunAppSchedulesRunsOnce(c *check.C) {
+	a := s.newScaledApp(c, 2)
+	created := time.Date(2017, time.March, 10, 7, 0, 0, 0, time.UTC)
+	s.addSchedule(c, AppSchedule{App: a.Name, Process: "web", Cron: "0 8 * * *", Units: 5}, created)
+	err := RunAppSchedules(time.Date(2017, time.March, 10, 8, 0, 0, 0, time.UTC))
+	c.Assert(err, check.IsNil)
+	err = s.p.RemoveUnits(a, 3, "web", nil)
+	c.Assert(err, check.IsNil)
+	err = RunAppSchedules(time.Date(2017, time.March, 10, 8, 1, 0, 0, time.UTC))
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestRunAppSchedulesLockedApp(c *check.C) {
+	a := s.newScaledApp(c, 2)
+	created := time.Date(2017, time.March, 10, 7, 0, 0, 0, time.UTC)
+	s.addSchedule(c, AppSchedule{App: a.Name, Process: "web", Cron: "0 8 * * *", Units: 5}, created)
+	locked, err := app.AcquireApplicationLock(a.Name, "someone", "deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	now := time.Date(2017, time.March, 10, 8, 0, 0, 0, time.UTC)
+	err = RunAppSchedules(now)
+	c.Assert(err, check.IsNil)
+	units, err := s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	schedules, err := ListAppSchedules(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules[0].LastRun.IsZero(), check.Equals, true)
+	app.ReleaseApplicationLock(a.Name)
+	err = RunAppSchedules(now.Add(time.Minute))
+	c.Assert(err, check.IsNil)
+	units, err = s.p.Units(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 5)
+}
+
+func (s *S) TestRunAppSchedulesRemovesSchedulesOfRemovedApps(c *check.C) {
+	created := time.Date(2017, time.March, 10, 7, 0, 0, 0, time.UTC)
+	s.addSchedule(c, AppSchedule{App: "removed", Process: "web", Cron: "0 8 * * *", Units: 5}, created)
+	err := RunAppSchedules(time.Date(2017, time.March, 10, 8, 0, 0, 0, time.UTC))
+	c.Assert(err, check.IsNil)
+	schedules, err := ListAppSchedules("removed")
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules, check.HasLen, 0)
+}
+
@@ -20,6 +20,11 @@ import (
 	"golang.org/x/crypto/ssh/terminal"
 )
 
+// twoFactorHeader is set by the API when a two-factor authentication code is
+// required to login, or when the user must enroll in two-factor
+// authentication.
+const twoFactorHeader = "X-Tsuru-Two-Factor"
+
 type loginScheme struct {
 	Name string
 	Data map[string]string
@@ -43,19 +48,17 @@ func nativeLogin(context *Context, client *Client) error {
 		return err
 	}
 	fmt.Fprintln(context.Stdout)
-	u, err := GetURL("/users/" + email + "/tokens")
-	if err != nil {
-		return err
-	}
 	v := url.Values{}
 	v.Set("password", password)
-	b := strings.NewReader(v.Encode())
-	request, err := http.NewRequest("POST", u, b)
-	if err != nil {
-		return err
+	response, err := requestNativeToken(client, email, v)
+	if err == errUnauthorized && response.Header.Get(twoFactorHeader) == "required" {
+		response.Body.Close()
+		fmt.Fprint(context.Stdout, "Two-factor authentication code: ")
+		var code string
+		fmt.Fscanf(context.Stdin, "%s\n", &code)
+		v.Set("otp", code)
+		response, err = requestNativeToken(client, email, v)
 	}
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	response, err := client.Do(request)
 	if err != nil {
 		return err
 	}
@@ -70,9 +73,25 @@ func nativeLogin(context *Context, client *Client) error {
 		return err
 	}
 	fmt.Fprintln(context.Stdout, "Successfully logged in!")
+	if response.Header.Get(twoFactorHeader) == "enroll" {
+		fmt.Fprintln(context.Stdout, "You're required to enable two-factor authentication, the token has no permissions until you enroll.")
+	}
 	return writeToken(out["token"].(string))
 }
 
+func requestNativeToken(client *Client, email string, v url.Values) (*http.Response, error) {
+	u, err := GetURL("/users/" + email + "/tokens")
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return client.Do(request)
+}
+
 func (c *login) getScheme() *loginScheme {
 	if c.scheme == nil {
 		info, err := schemeInfo()
@@ -86,7 +105,7 @@ func (c *login) getScheme() *loginScheme {
 }
 
 func (c *login) Run(context *Context, client *Client) error {
-	if c.getScheme().Name == "oauth" {
+	if c.getScheme().Name == "oauth" || c.getScheme().Name == "oidc" {
 		return c.oauthLogin(context, client)
 	}
 	if c.getScheme().Name == "saml" {
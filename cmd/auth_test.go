@@ -103,6 +103,73 @@ func (s *S) TestNativeLoginShouldNotDependOnTsuruTokenFile(c *check.C) {
 	c.Assert(globalManager.stdout.(*bytes.Buffer).String(), check.Equals, expected)
 }
 
+func (s *S) TestNativeLoginTwoFactor(c *check.C) {
+	os.Unsetenv("TSURU_TOKEN")
+	nativeScheme()
+	fsystem = &fstest.RecordingFs{FileContent: "old-token"}
+	defer func() {
+		fsystem = nil
+	}()
+	expected := "Password: \nTwo-factor authentication code: Successfully logged in!\n"
+	reader := strings.NewReader("chico\n123456\n")
+	context := Context{[]string{"foo@foo.com"}, globalManager.stdout, globalManager.stderr, reader}
+	transport := cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{
+					Message: "Two-factor authentication code required.",
+					Status:  http.StatusUnauthorized,
+					Headers: map[string][]string{"X-Tsuru-Two-Factor": {"required"}},
+				},
+				CondFunc: func(r *http.Request) bool {
+					return r.FormValue("password") == "chico" && r.FormValue("otp") == ""
+				},
+			},
+			{
+				Transport: cmdtest.Transport{
+					Message: `{"token": "sometoken"}`,
+					Status:  http.StatusOK,
+				},
+				CondFunc: func(r *http.Request) bool {
+					url := r.URL.Path == "/1.0/users/foo@foo.com/tokens"
+					return url && r.FormValue("password") == "chico" && r.FormValue("otp") == "123456"
+				},
+			},
+		},
+	}
+	client := NewClient(&http.Client{Transport: &transport}, nil, globalManager)
+	command := login{}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(globalManager.stdout.(*bytes.Buffer).String(), check.Equals, expected)
+	token, err := ReadToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token, check.Equals, "sometoken")
+}
+
+func (s *S) TestNativeLoginTwoFactorEnrollmentRequired(c *check.C) {
+	os.Unsetenv("TSURU_TOKEN")
+	nativeScheme()
+	fsystem = &fstest.RecordingFs{FileContent: "old-token"}
+	defer func() {
+		fsystem = nil
+	}()
+	expected := "Password: \nSuccessfully logged in!\n" +
+		"You're required to enable two-factor authentication, the token has no permissions until you enroll.\n"
+	reader := strings.NewReader("chico\n")
+	context := Context{[]string{"foo@foo.com"}, globalManager.stdout, globalManager.stderr, reader}
+	transport := cmdtest.Transport{
+		Message: `{"token": "sometoken"}`,
+		Status:  http.StatusOK,
+		Headers: map[string][]string{"X-Tsuru-Two-Factor": {"enroll"}},
+	}
+	client := NewClient(&http.Client{Transport: &transport}, nil, globalManager)
+	command := login{}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(globalManager.stdout.(*bytes.Buffer).String(), check.Equals, expected)
+}
+
 func (s *S) TestNativeLoginShouldReturnErrorIfThePasswordIsNotGiven(c *check.C) {
 	nativeScheme()
 	context := Context{[]string{"foo@foo.com"}, globalManager.stdout, globalManager.stderr, strings.NewReader("\n")}
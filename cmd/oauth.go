@@ -5,6 +5,9 @@
 package cmd
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -61,11 +64,58 @@ func port(schemeData map[string]string) string {
 	return ":0"
 }
 
-func convertToken(code, redirectUrl string) (string, error) {
+// pkce holds the values used in an authorization request with Proof Key for
+// Code Exchange, as described in RFC 7636.
+type pkce struct {
+	state    string
+	verifier string
+}
+
+func randomString() (string, error) {
+	var data [32]byte
+	_, err := rand.Read(data[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data[:]), nil
+}
+
+func newPKCE() (*pkce, error) {
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	return &pkce{state: state, verifier: verifier}, nil
+}
+
+// authURL adds the state and the S256 code challenge to the authorization
+// URL.
+func (p *pkce) authURL(authUrl string) (string, error) {
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(p.verifier))
+	query := u.Query()
+	query.Set("state", p.state)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func convertToken(code, redirectUrl, codeVerifier string) (string, error) {
 	var token string
 	v := url.Values{}
 	v.Set("code", code)
 	v.Set("redirectUrl", redirectUrl)
+	if codeVerifier != "" {
+		v.Set("code_verifier", codeVerifier)
+	}
 	u, err := GetURL("/auth/login")
 	if err != nil {
 		return token, errors.Wrap(err, "Error in GetURL")
@@ -88,12 +138,29 @@ func convertToken(code, redirectUrl string) (string, error) {
 }
 
 func callback(redirectUrl string, finish chan bool) http.HandlerFunc {
+	return pkceCallback(redirectUrl, nil, finish)
+}
+
+// pkceCallback handles the redirect from the authorization server. When p is
+// not nil, the state must match the one sent in the authorization request
+// and the code verifier is sent along with the code.
+func pkceCallback(redirectUrl string, p *pkce, finish chan bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			finish <- true
 		}()
 		var page string
-		token, err := convertToken(r.URL.Query().Get("code"), redirectUrl)
+		var token, codeVerifier string
+		var err error
+		if p != nil {
+			codeVerifier = p.verifier
+			if r.URL.Query().Get("state") != p.state {
+				err = errors.New("Invalid state in authorization response.")
+			}
+		}
+		if err == nil {
+			token, err = convertToken(r.URL.Query().Get("code"), redirectUrl, codeVerifier)
+		}
 		if err == nil {
 			writeToken(token)
 			page = fmt.Sprintf(callbackPage, successMarkup)
@@ -119,7 +186,18 @@ func (c *login) oauthLogin(context *Context, client *Client) error {
 	}
 	redirectUrl := fmt.Sprintf("http://localhost:%s", port)
 	authUrl := strings.Replace(schemeData["authorizeUrl"], "__redirect_url__", redirectUrl, 1)
-	http.HandleFunc("/", callback(redirectUrl, finish))
+	var p *pkce
+	if schemeData["pkce"] == "S256" {
+		p, err = newPKCE()
+		if err != nil {
+			return err
+		}
+		authUrl, err = p.authURL(authUrl)
+		if err != nil {
+			return err
+		}
+	}
+	http.HandleFunc("/", pkceCallback(redirectUrl, p, finish))
 	server := &http.Server{}
 	go server.Serve(l)
 	err = open(authUrl)
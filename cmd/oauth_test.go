@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"runtime"
 	"strings"
@@ -67,3 +68,76 @@ func (s *S) TestCallbackHandler(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(string(data), check.Equals, "xpto")
 }
+
+func (s *S) TestPKCEAuthURL(c *check.C) {
+	p := &pkce{state: "mystate", verifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"}
+	authUrl, err := p.authURL("http://idp.example.com/authorize?client_id=tsuru&redirect_uri=http://localhost:5555")
+	c.Assert(err, check.IsNil)
+	u, err := url.Parse(authUrl)
+	c.Assert(err, check.IsNil)
+	c.Assert(u.Query(), check.DeepEquals, url.Values{
+		"client_id":             {"tsuru"},
+		"redirect_uri":          {"http://localhost:5555"},
+		"state":                 {"mystate"},
+		"code_challenge":        {"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+		"code_challenge_method": {"S256"},
+	})
+}
+
+func (s *S) TestNewPKCE(c *check.C) {
+	p1, err := newPKCE()
+	c.Assert(err, check.IsNil)
+	p2, err := newPKCE()
+	c.Assert(err, check.IsNil)
+	c.Assert(p1.verifier, check.HasLen, 43)
+	c.Assert(p1.state, check.Not(check.Equals), p2.state)
+	c.Assert(p1.verifier, check.Not(check.Equals), p2.verifier)
+}
+
+func (s *S) TestPKCECallbackHandler(c *check.C) {
+	var form url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		w.Write([]byte(`{"token": "xpto"}`))
+	}))
+	defer ts.Close()
+	rfs := &fstest.RecordingFs{}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	os.Setenv("TSURU_TARGET", ts.URL)
+	finish := make(chan bool, 1)
+	handler := pkceCallback("http://localhost:5555", &pkce{state: "mystate", verifier: "myverifier"}, finish)
+	request, err := http.NewRequest("GET", "/?code=mycode&state=mystate", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	c.Assert(<-finish, check.Equals, true)
+	c.Assert(recorder.Body.String(), check.Equals, fmt.Sprintf(callbackPage, successMarkup))
+	c.Assert(form, check.DeepEquals, url.Values{
+		"code":          {"mycode"},
+		"redirectUrl":   {"http://localhost:5555"},
+		"code_verifier": {"myverifier"},
+	})
+}
+
+func (s *S) TestPKCECallbackHandlerInvalidState(c *check.C) {
+	called := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer ts.Close()
+	os.Setenv("TSURU_TARGET", ts.URL)
+	finish := make(chan bool, 1)
+	handler := pkceCallback("http://localhost:5555", &pkce{state: "mystate", verifier: "myverifier"}, finish)
+	request, err := http.NewRequest("GET", "/?code=mycode&state=otherstate", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	c.Assert(<-finish, check.Equals, true)
+	msg := fmt.Sprintf(errorMarkup, "Invalid state in authorization response.")
+	c.Assert(recorder.Body.String(), check.Equals, fmt.Sprintf(callbackPage, msg))
+	c.Assert(called, check.Equals, false)
+}
@@ -0,0 +1,37 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/event/retention"
+)
+
+type eventArchiveRestoreCmd struct{}
+
+func (eventArchiveRestoreCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "event-archive-restore",
+		Usage: "event-archive-restore <archive> [archive...]",
+		Desc: `Restores events from archives created by the events retention pruner,
+configured by the events:retention:archive-path setting. Restoring an archive
+more than once is harmless.`,
+		MinArgs: 1,
+	}
+}
+
+func (eventArchiveRestoreCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	for _, path := range context.Args {
+		n, err := retention.RestoreFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "unable to restore %s", path)
+		}
+		fmt.Fprintf(context.Stdout, "%d events restored from %s.\n", n, path)
+	}
+	return nil
+}
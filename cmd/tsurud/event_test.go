@@ -0,0 +1,45 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/event"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestEventArchiveRestoreCmd(c *check.C) {
+	id := bson.NewObjectId()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`{"_id":{"$oid":"` + id.Hex() + `"},"uniqueid":{"$oid":"` + id.Hex() + `"},` +
+		`"target":{"type":"app","value":"myapp"},"kind":{"type":"permission","name":"app.deploy"},` +
+		`"starttime":{"$date":"2017-05-01T10:00:00Z"},"running":false}` + "\n"))
+	gz.Close()
+	path := filepath.Join(c.MkDir(), "events.jsonl.gz")
+	err := ioutil.WriteFile(path, buf.Bytes(), 0644)
+	c.Assert(err, check.IsNil)
+	var stdout bytes.Buffer
+	context := cmd.Context{Args: []string{path}, Stdout: &stdout}
+	err = eventArchiveRestoreCmd{}.Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "1 events restored from "+path+".\n")
+	evt, err := event.GetByID(id)
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.Kind.Name, check.Equals, "app.deploy")
+}
+
+func (s *S) TestEventArchiveRestoreCmdInvalidFile(c *check.C) {
+	var stdout bytes.Buffer
+	context := cmd.Context{Args: []string{"/tmp/not-found/events.jsonl.gz"}, Stdout: &stdout}
+	err := eventArchiveRestoreCmd{}.Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "unable to restore /tmp/not-found/events.jsonl.gz: .*")
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/cmd"
+)
+
+type logUsageCmd struct {
+	fs     *gnuflag.FlagSet
+	team   string
+	byTeam bool
+	format string
+}
+
+func (*logUsageCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "log-usage",
+		Usage: "log-usage [-t/--team team] [--by-team] [--format csv|json]",
+		Desc: `Reports the storage used by the logs of each app, along with the log
+retention of the app. Apps whose logs reached the retention size are replacing
+their oldest logs. With --by-team, the usage of the apps of each team is
+summed. By default, the report includes every team, in the CSV format.`,
+	}
+}
+
+func (c *logUsageCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	if c.format != "" && c.format != "csv" && c.format != "json" {
+		return errors.Errorf("invalid format %q, it must be csv or json", c.format)
+	}
+	usage, err := app.LogUsageReport(&app.Filter{TeamOwner: c.team})
+	if err != nil {
+		return err
+	}
+	if c.byTeam {
+		usage = app.LogUsageByTeam(usage)
+	}
+	if c.format == "json" {
+		return json.NewEncoder(context.Stdout).Encode(usage)
+	}
+	return app.WriteLogUsageCSV(context.Stdout, usage)
+}
+
+func (c *logUsageCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("log-usage", gnuflag.ExitOnError)
+		teamMsg := "Report only the log usage of the apps of the given team"
+		c.fs.StringVar(&c.team, "team", "", teamMsg)
+		c.fs.StringVar(&c.team, "t", "", teamMsg)
+		c.fs.BoolVar(&c.byTeam, "by-team", false, "Sum the log usage of the apps of each team")
+		c.fs.StringVar(&c.format, "format", "csv", "Format of the report, csv or json")
+	}
+	return c.fs
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestLogUsageCmd(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	defer conn.Apps().RemoveAll(nil)
+	err = conn.Apps().Insert(
+		app.App{Name: "app1", TeamOwner: "team1", LogRetention: app.LogRetention{MaxBytes: 8192, MaxAge: time.Hour}},
+		app.App{Name: "app2", TeamOwner: "team1", Plan: app.Plan{LogRetention: app.LogRetention{MaxBytes: 4096}}},
+		app.App{Name: "app3", TeamOwner: "team2"},
+	)
+	c.Assert(err, check.IsNil)
+	var stdout bytes.Buffer
+	command := logUsageCmd{}
+	err = command.Flags().Parse(true, []string{"--team", "team1"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&cmd.Context{Stdout: &stdout}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "team,app,lines,bytes,maxbytes,maxage,full\n"+
+		"team1,app1,0,0,8192,1h0m0s,false\n"+
+		"team1,app2,0,0,4096,,false\n")
+	stdout.Reset()
+	command = logUsageCmd{}
+	err = command.Flags().Parse(true, []string{"--by-team"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&cmd.Context{Stdout: &stdout}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "team,app,lines,bytes,maxbytes,maxage,full\n"+
+		"team1,,0,0,12288,,false\n"+
+		"team2,,0,0,1000000,,false\n")
+}
+
+func (s *S) TestLogUsageCmdInvalidFormat(c *check.C) {
+	command := logUsageCmd{}
+	err := command.Flags().Parse(true, []string{"--format", "xml"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&cmd.Context{Stdout: &bytes.Buffer{}}, nil)
+	c.Assert(err, check.ErrorMatches, `invalid format "xml", it must be csv or json`)
+}
@@ -33,6 +33,9 @@ func buildManager() *cmd.Manager {
 	m.Register(&tsurudCommand{Command: &migrateCmd{}})
 	m.Register(&tsurudCommand{Command: gandalfSyncCmd{}})
 	m.Register(&tsurudCommand{Command: createRootUserCmd{}})
+	m.Register(&tsurudCommand{Command: eventArchiveRestoreCmd{}})
+	m.Register(&tsurudCommand{Command: &usageReportCmd{}})
+	m.Register(&tsurudCommand{Command: &logUsageCmd{}})
 	m.Register(&migrationListCmd{})
 	err := registerProvisionersCommands(m)
 	if err != nil {
@@ -68,6 +68,33 @@ func (s *S) TestGandalfSyncCmdIsRegistered(c *check.C) {
 	c.Assert(sync.Command, check.FitsTypeOf, gandalfSyncCmd{})
 }
 
+func (s *S) TestEventArchiveRestoreCmdIsRegistered(c *check.C) {
+	manager := buildManager()
+	cmd, ok := manager.Commands["event-archive-restore"]
+	c.Assert(ok, check.Equals, true)
+	restore, ok := cmd.(*tsurudCommand)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(restore.Command, check.FitsTypeOf, eventArchiveRestoreCmd{})
+}
+
+func (s *S) TestUsageReportCmdIsRegistered(c *check.C) {
+	manager := buildManager()
+	cmd, ok := manager.Commands["usage-report"]
+	c.Assert(ok, check.Equals, true)
+	report, ok := cmd.(*tsurudCommand)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(report.Command, check.FitsTypeOf, &usageReportCmd{})
+}
+
+func (s *S) TestLogUsageCmdIsRegistered(c *check.C) {
+	manager := buildManager()
+	cmd, ok := manager.Commands["log-usage"]
+	c.Assert(ok, check.Equals, true)
+	report, ok := cmd.(*tsurudCommand)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(report.Command, check.FitsTypeOf, &logUsageCmd{})
+}
+
 func (s *S) TestShouldRegisterAllCommandsFromProvisioners(c *check.C) {
 	fp := provisiontest.NewFakeProvisioner()
 	p := CommandableProvisioner{FakeProvisioner: fp}
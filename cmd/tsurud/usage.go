@@ -0,0 +1,80 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/metering"
+)
+
+type usageReportCmd struct {
+	fs     *gnuflag.FlagSet
+	team   string
+	from   string
+	to     string
+	format string
+}
+
+func (*usageReportCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "usage-report",
+		Usage: "usage-report [-t/--team team] [--from YYYY-MM-DD] [--to YYYY-MM-DD] [--format csv|json]",
+		Desc: `Reports the unit-hours used by apps and the instance-hours used by service
+instances, along with their cost according to the prices configured in the
+metering:prices setting. By default, the report includes every team, from the
+first day of the current month until now, in the CSV format.`,
+	}
+}
+
+func (c *usageReportCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	now := time.Now().UTC()
+	filter := metering.ReportFilter{
+		Team: c.team,
+		From: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC),
+		To:   now,
+	}
+	var err error
+	if c.from != "" {
+		filter.From, err = time.Parse("2006-01-02", c.from)
+		if err != nil {
+			return errors.Errorf("invalid --from date %q, it must be in the YYYY-MM-DD format", c.from)
+		}
+	}
+	if c.to != "" {
+		filter.To, err = time.Parse("2006-01-02", c.to)
+		if err != nil {
+			return errors.Errorf("invalid --to date %q, it must be in the YYYY-MM-DD format", c.to)
+		}
+	}
+	items, err := metering.Report(filter)
+	if err != nil {
+		return err
+	}
+	switch c.format {
+	case "", "csv":
+		return metering.WriteCSV(context.Stdout, items)
+	case "json":
+		return json.NewEncoder(context.Stdout).Encode(items)
+	}
+	return errors.Errorf("invalid format %q, it must be csv or json", c.format)
+}
+
+func (c *usageReportCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("usage-report", gnuflag.ExitOnError)
+		teamMsg := "Report only the usage of the given team"
+		c.fs.StringVar(&c.team, "team", "", teamMsg)
+		c.fs.StringVar(&c.team, "t", "", teamMsg)
+		c.fs.StringVar(&c.from, "from", "", "First day of the report, defaults to the first day of the current month")
+		c.fs.StringVar(&c.to, "to", "", "Day after the last day of the report, defaults to now")
+		c.fs.StringVar(&c.format, "format", "csv", "Format of the report, csv or json")
+	}
+	return c.fs
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/metering"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestUsageReportCmd(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	err = conn.Usage().Insert(metering.Record{
+		Hour:  time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC),
+		Kind:  metering.KindUnit,
+		Team:  "myteam",
+		App:   "myapp",
+		Plan:  "small",
+		Hours: 2,
+	})
+	c.Assert(err, check.IsNil)
+	var stdout bytes.Buffer
+	command := usageReportCmd{}
+	err = command.Flags().Parse(true, []string{"--team", "myteam", "--from", "2017-06-01", "--to", "2017-06-02"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&cmd.Context{Stdout: &stdout}, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "team,kind,app,service,instance,plan,memory,swap,cpushare,hours,price,cost\n"+
+		"myteam,unit,myapp,,,small,0,0,0,2,0,0\n")
+}
+
+func (s *S) TestUsageReportCmdInvalidFlags(c *check.C) {
+	command := usageReportCmd{}
+	err := command.Flags().Parse(true, []string{"--from", "june"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&cmd.Context{Stdout: &bytes.Buffer{}}, nil)
+	c.Assert(err, check.ErrorMatches, `invalid --from date "june", it must be in the YYYY-MM-DD format`)
+}
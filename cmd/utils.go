@@ -70,6 +70,7 @@ func ReadToken() (string, error) {
 type ServiceModel struct {
 	Service   string
 	Instances []string
+	Status    string
 }
 
 func ShowServicesInstancesList(b []byte) ([]byte, error) {
@@ -81,11 +82,25 @@ func ShowServicesInstancesList(b []byte) ([]byte, error) {
 	if len(services) == 0 {
 		return []byte{}, nil
 	}
+	var withStatus bool
+	for _, s := range services {
+		if s.Status != "" {
+			withStatus = true
+			break
+		}
+	}
 	table := NewTable()
-	table.Headers = Row([]string{"Services", "Instances"})
+	if withStatus {
+		table.Headers = Row([]string{"Services", "Instances", "Status"})
+	} else {
+		table.Headers = Row([]string{"Services", "Instances"})
+	}
 	for _, s := range services {
 		insts := strings.Join(s.Instances, ", ")
 		r := Row([]string{s.Service, insts})
+		if withStatus {
+			r = append(r, s.Status)
+		}
 		table.AddRow(r)
 	}
 	return table.Bytes(), nil
@@ -87,6 +87,20 @@ func (s *S) TestShowServicesInstancesList(c *check.C) {
 	c.Assert(string(result), check.Equals, expected)
 }
 
+func (s *S) TestShowServicesInstancesListWithStatus(c *check.C) {
+	expected := `+----------+-----------+--------+
+| Services | Instances | Status |
++----------+-----------+--------+
+| mongodb  | my_nosql  | up     |
+| mysql    |           | down   |
++----------+-----------+--------+
+`
+	b := `[{"service": "mongodb", "instances": ["my_nosql"], "status": "up"}, {"service": "mysql", "instances": [], "status": "down"}]`
+	result, err := ShowServicesInstancesList([]byte(b))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(result), check.Equals, expected)
+}
+
 func (s *S) TestMergeFlagSet(c *check.C) {
 	var x, y bool
 	fs1 := gnuflag.NewFlagSet("x", gnuflag.ExitOnError)
@@ -13,11 +13,13 @@ package db
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db/storage"
 	"github.com/tsuru/tsuru/hc"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 const (
@@ -147,6 +149,20 @@ func (s *Storage) PasswordTokens() *storage.Collection {
 	return s.Collection("password_tokens")
 }
 
+// PersonalTokens returns the collection of personal access tokens created by
+// users.
+func (s *Storage) PersonalTokens() *storage.Collection {
+	coll := s.Collection("personal_tokens")
+	coll.EnsureIndex(mgo.Index{Key: []string{"useremail", "name"}, Unique: true})
+	return coll
+}
+
+// TwoFactor returns the collection holding the two-factor authentication
+// secrets and recovery codes of users.
+func (s *Storage) TwoFactor() *storage.Collection {
+	return s.Collection("two_factor")
+}
+
 func (s *Storage) UserActions() *storage.Collection {
 	return s.Collection("user_actions")
 }
@@ -156,6 +172,15 @@ func (s *Storage) Teams() *storage.Collection {
 	return s.Collection("teams")
 }
 
+// TeamInvites returns the collection holding the pending invitations of
+// users to teams.
+func (s *Storage) TeamInvites() *storage.Collection {
+	c := s.Collection("team_invites")
+	c.EnsureIndex(mgo.Index{Key: []string{"team", "email", "role"}, Unique: true})
+	c.EnsureIndex(mgo.Index{Key: []string{"email"}})
+	return c
+}
+
 // Quota returns the quota collection from MongoDB.
 func (s *Storage) Quota() *storage.Collection {
 	userIndex := mgo.Index{Key: []string{"owner"}, Unique: true}
@@ -179,16 +204,129 @@ var logCappedInfo = mgo.CollectionInfo{
 	ForceIdIndex: true,
 }
 
+// DefaultLogsMaxBytes returns the maximum size of the logs collection of apps
+// without a log retention set in the app or in its plan.
+func DefaultLogsMaxBytes() int64 {
+	maxBytes, _ := config.GetInt("app-logs:retention:max-bytes")
+	if maxBytes > 0 {
+		return int64(maxBytes)
+	}
+	return int64(logCappedInfo.MaxBytes)
+}
+
+func defaultLogsCappedInfo() *mgo.CollectionInfo {
+	info := logCappedInfo
+	if maxBytes := DefaultLogsMaxBytes(); maxBytes != int64(info.MaxBytes) {
+		info.MaxBytes = int(maxBytes)
+		info.MaxDocs = 0
+	}
+	return &info
+}
+
 // Logs returns the logs collection for one app from MongoDB.
 func (s *LogStorage) Logs(appName string) *storage.Collection {
 	if appName == "" {
 		return nil
 	}
 	c := s.Collection("logs_" + appName)
-	c.Create(&logCappedInfo)
+	c.Create(defaultLogsCappedInfo())
+	ensureLogsIndexes(c)
 	return c
 }
 
+func ensureLogsIndexes(c *storage.Collection) {
+	c.EnsureIndex(mgo.Index{Key: []string{"date"}})
+	c.EnsureIndex(mgo.Index{Key: []string{"level", "date"}})
+}
+
+// LogsStats holds the storage used by the logs collection of an app.
+type LogsStats struct {
+	Count   int64 `bson:"count"`
+	Size    int64 `bson:"size"`
+	AvgSize int64 `bson:"avgObjSize"`
+	MaxSize int64 `bson:"maxSize"`
+	MaxDocs int64 `bson:"max"`
+	Capped  bool  `bson:"capped"`
+}
+
+// Full returns whether the logs collection reached its limits, meaning that
+// new logs are replacing the oldest ones.
+func (s *LogsStats) Full() bool {
+	if !s.Capped || s.Count == 0 {
+		return false
+	}
+	if s.MaxDocs > 0 && s.Count >= s.MaxDocs {
+		return true
+	}
+	return s.Size+2*s.AvgSize >= s.MaxSize
+}
+
+// LogsStats returns the storage used by the logs collection of one app. Apps
+// without logs have empty stats.
+func (s *LogStorage) LogsStats(appName string) (*LogsStats, error) {
+	var stats LogsStats
+	name := "logs_" + appName
+	names, err := s.Collection(name).Database.CollectionNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		if n == name {
+			err = s.Collection(name).Database.Run(bson.D{{Name: "collStats", Value: name}}, &stats)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return &stats, nil
+}
+
+// SetLogsMaxBytes changes the maximum size of the logs collection of one app.
+// Existing collections are copied to a new collection with the new size,
+// keeping the newest logs that fit in it. Logs received while the collection
+// is being copied may be lost.
+func (s *LogStorage) SetLogsMaxBytes(appName string, maxBytes int64) error {
+	name := "logs_" + appName
+	stats, err := s.LogsStats(appName)
+	if err != nil {
+		return err
+	}
+	c := s.Collection(name)
+	if !stats.Capped {
+		if maxBytes == DefaultLogsMaxBytes() {
+			c.Create(defaultLogsCappedInfo())
+		} else {
+			c.Create(&mgo.CollectionInfo{Capped: true, MaxBytes: int(maxBytes), ForceIdIndex: true})
+		}
+		ensureLogsIndexes(c)
+		return nil
+	}
+	if stats.MaxSize == maxBytes {
+		return nil
+	}
+	tmpName := name + "_resize"
+	s.Collection(tmpName).DropCollection()
+	err = c.Database.Run(bson.D{
+		{Name: "cloneCollectionAsCapped", Value: name},
+		{Name: "toCollection", Value: tmpName},
+		{Name: "size", Value: maxBytes},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	err = c.Database.Session.Run(bson.D{
+		{Name: "renameCollection", Value: c.Database.Name + "." + tmpName},
+		{Name: "to", Value: c.FullName},
+		{Name: "dropTarget", Value: true},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	ensureLogsIndexes(c)
+	return nil
+}
+
 // LogsCollections returns logs collections for all apps from MongoDB.
 func (s *LogStorage) LogsCollections() ([]*storage.Collection, error) {
 	var names []struct {
@@ -235,3 +373,97 @@ func (s *Storage) InstallHosts() *storage.Collection {
 	c.EnsureIndex(nameIndex)
 	return c
 }
+
+// Webhooks returns the webhooks collection from MongoDB.
+func (s *Storage) Webhooks() *storage.Collection {
+	return s.Collection("webhooks")
+}
+
+// WebhookDeliveries returns the collection holding the delivery status of
+// events sent to webhooks.
+func (s *Storage) WebhookDeliveries() *storage.Collection {
+	webhookIndex := mgo.Index{Key: []string{"webhook", "-time"}}
+	c := s.Collection("webhook_deliveries")
+	c.EnsureIndex(webhookIndex)
+	return c
+}
+
+// Usage returns the collection holding the hourly usage rollups of units and
+// service instances.
+func (s *Storage) Usage() *storage.Collection {
+	c := s.Collection("usage")
+	c.EnsureIndex(mgo.Index{Key: []string{"team", "hour"}})
+	c.EnsureIndex(mgo.Index{Key: []string{"hour"}})
+	return c
+}
+
+// AppAutoScalePolicies returns the collection holding the unit autoscaling
+// policies of app processes.
+func (s *Storage) AppAutoScalePolicies() *storage.Collection {
+	c := s.Collection("app_autoscale_policies")
+	c.EnsureIndex(mgo.Index{Key: []string{"app", "process"}, Unique: true})
+	return c
+}
+
+// AppScaleSchedules returns the collection holding the scheduled scaling
+// operations of app processes.
+func (s *Storage) AppScaleSchedules() *storage.Collection {
+	c := s.Collection("app_scale_schedules")
+	c.EnsureIndex(mgo.Index{Key: []string{"app", "process"}})
+	return c
+}
+
+// LogSinks returns the collection holding the destinations where app logs
+// are forwarded to.
+func (s *Storage) LogSinks() *storage.Collection {
+	c := s.Collection("log_sinks")
+	c.EnsureIndex(mgo.Index{Key: []string{"app"}})
+	c.EnsureIndex(mgo.Index{Key: []string{"pool"}})
+	return c
+}
+
+// LogThrottle returns the collection holding the number of log lines stored
+// for each app in each throttle window, shared by all API instances.
+func (s *Storage) LogThrottle() *storage.Collection {
+	c := s.Collection("log_throttle")
+	c.EnsureIndex(mgo.Index{Key: []string{"expireat"}, ExpireAfter: time.Hour})
+	return c
+}
+
+// Leaders returns the collection holding the leases of the workers that must
+// run in a single API instance at a time.
+func (s *Storage) Leaders() *storage.Collection {
+	return s.Collection("leaders")
+}
+
+// UsageSamples returns the collection holding the usage sampling slots
+// already recorded, ensuring each slot is credited only once.
+func (s *Storage) UsageSamples() *storage.Collection {
+	return s.Collection("usage_samples")
+}
+
+// UnitMetrics returns the collection holding the recent samples of the
+// resources used by app units.
+func (s *Storage) UnitMetrics() *storage.Collection {
+	c := s.Collection("unit_metrics")
+	c.EnsureIndex(mgo.Index{Key: []string{"appname", "date"}})
+	c.EnsureIndex(mgo.Index{Key: []string{"date"}})
+	return c
+}
+
+// UnitStatusChanges returns the collection holding the recent status changes
+// reported by app units.
+func (s *Storage) UnitStatusChanges() *storage.Collection {
+	c := s.Collection("unit_status_changes")
+	c.EnsureIndex(mgo.Index{Key: []string{"app", "date"}})
+	c.EnsureIndex(mgo.Index{Key: []string{"date"}})
+	return c
+}
+
+// AlertRules returns the collection holding the alert rules of apps and
+// their current state.
+func (s *Storage) AlertRules() *storage.Collection {
+	c := s.Collection("alert_rules")
+	c.EnsureIndex(mgo.Index{Key: []string{"app", "name"}, Unique: true})
+	return c
+}
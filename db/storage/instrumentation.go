@@ -126,3 +126,81 @@ func (c *instrumentedConn) SetReadDeadline(t time.Time) error {
 func (c *instrumentedConn) SetWriteDeadline(t time.Time) error {
 	return c.tcpConn.SetWriteDeadline(t)
 }
+
+// Insert calls mgo's Insert, tracing the call as part of the span of the
+// storage.
+func (c *Collection) Insert(docs ...interface{}) (err error) {
+	defer c.trace("insert")(&err)
+	return c.Collection.Insert(docs...)
+}
+
+// Update calls mgo's Update, tracing the call as part of the span of the
+// storage.
+func (c *Collection) Update(selector interface{}, update interface{}) (err error) {
+	defer c.trace("update")(&err)
+	return c.Collection.Update(selector, update)
+}
+
+// UpdateId calls mgo's UpdateId, tracing the call as part of the span of the
+// storage.
+func (c *Collection) UpdateId(id interface{}, update interface{}) (err error) {
+	defer c.trace("update")(&err)
+	return c.Collection.UpdateId(id, update)
+}
+
+// UpdateAll calls mgo's UpdateAll, tracing the call as part of the span of
+// the storage.
+func (c *Collection) UpdateAll(selector interface{}, update interface{}) (info *mgo.ChangeInfo, err error) {
+	defer c.trace("update all")(&err)
+	return c.Collection.UpdateAll(selector, update)
+}
+
+// Upsert calls mgo's Upsert, tracing the call as part of the span of the
+// storage.
+func (c *Collection) Upsert(selector interface{}, update interface{}) (info *mgo.ChangeInfo, err error) {
+	defer c.trace("upsert")(&err)
+	return c.Collection.Upsert(selector, update)
+}
+
+// UpsertId calls mgo's UpsertId, tracing the call as part of the span of the
+// storage.
+func (c *Collection) UpsertId(id interface{}, update interface{}) (info *mgo.ChangeInfo, err error) {
+	defer c.trace("upsert")(&err)
+	return c.Collection.UpsertId(id, update)
+}
+
+// Remove calls mgo's Remove, tracing the call as part of the span of the
+// storage.
+func (c *Collection) Remove(selector interface{}) (err error) {
+	defer c.trace("remove")(&err)
+	return c.Collection.Remove(selector)
+}
+
+// RemoveId calls mgo's RemoveId, tracing the call as part of the span of the
+// storage.
+func (c *Collection) RemoveId(id interface{}) (err error) {
+	defer c.trace("remove")(&err)
+	return c.Collection.RemoveId(id)
+}
+
+// RemoveAll calls mgo's RemoveAll, tracing the call as part of the span of
+// the storage.
+func (c *Collection) RemoveAll(selector interface{}) (info *mgo.ChangeInfo, err error) {
+	defer c.trace("remove all")(&err)
+	return c.Collection.RemoveAll(selector)
+}
+
+func (c *Collection) trace(op string) func(*error) {
+	span := c.span.StartChild("mongodb " + op)
+	if span == nil {
+		return func(*error) {}
+	}
+	span.SetTag("collection", c.Name)
+	return func(err *error) {
+		if *err == mgo.ErrNotFound {
+			span.Finish(nil)
+			return
+		}
+		span.Finish(*err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/mgo.v2"
 )
 
@@ -20,6 +21,7 @@ var (
 type Storage struct {
 	session *mgo.Session
 	dbname  string
+	span    *tracing.Span
 }
 
 // Collection represents a database collection. It embeds mgo.Collection for
@@ -27,6 +29,7 @@ type Storage struct {
 // using the method close.
 type Collection struct {
 	*mgo.Collection
+	span *tracing.Span
 }
 
 // Close closes the session with the database.
@@ -55,9 +58,15 @@ func (s *Storage) Close() {
 	s.session.Close()
 }
 
+// SetSpan sets the span of the operation using the storage. Writes to the
+// collections returned by the storage are traced as children of the span.
+func (s *Storage) SetSpan(span *tracing.Span) {
+	s.span = span
+}
+
 // Collection returns a collection by its name.
 //
 // If the collection does not exist, MongoDB will create it.
 func (s *Storage) Collection(name string) *Collection {
-	return &Collection{s.session.DB(s.dbname).C(name)}
+	return &Collection{Collection: s.session.DB(s.dbname).C(name), span: s.span}
 }
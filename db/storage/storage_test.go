@@ -5,10 +5,17 @@
 package storage
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func Test(t *testing.T) { check.TestingT(t) }
@@ -79,3 +86,46 @@ func (s *S) TestCollection(c *check.C) {
 	collection := storage.Collection("users")
 	c.Assert(collection.FullName, check.Equals, storage.dbname+".users")
 }
+
+func (s *S) TestCollectionTracesWrites(c *check.C) {
+	path := filepath.Join(c.MkDir(), "spans.json")
+	config.Set("tracing:exporter", "file")
+	config.Set("tracing:file:path", path)
+	defer config.Unset("tracing")
+	err := tracing.Initialize()
+	c.Assert(err, check.IsNil)
+	defer tracing.Stop()
+	storage, err := Open("127.0.0.1:27017", "tsuru_storage_test")
+	c.Assert(err, check.IsNil)
+	defer storage.session.Close()
+	root := tracing.StartRemoteSpan("POST /apps", "", "req-1")
+	storage.SetSpan(root)
+	collection := storage.Collection("users")
+	err = collection.Insert(bson.M{"_id": "me@tsuru.io"})
+	c.Assert(err, check.IsNil)
+	err = collection.RemoveId("someone@tsuru.io")
+	c.Assert(err, check.Equals, mgo.ErrNotFound)
+	storage.SetSpan(nil)
+	err = storage.Collection("users").RemoveId("me@tsuru.io")
+	c.Assert(err, check.IsNil)
+	tracing.Stop()
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, check.IsNil)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	c.Assert(lines, check.HasLen, 2)
+	var spans []*tracing.Span
+	for _, line := range lines {
+		span := &tracing.Span{}
+		err = json.Unmarshal([]byte(line), span)
+		c.Assert(err, check.IsNil)
+		spans = append(spans, span)
+	}
+	c.Assert(spans[0].Name, check.Equals, "mongodb insert")
+	c.Assert(spans[1].Name, check.Equals, "mongodb remove")
+	for _, span := range spans {
+		c.Assert(span.ParentID, check.Equals, root.SpanID)
+		c.Assert(span.RequestID, check.Equals, "req-1")
+		c.Assert(span.Tags["collection"], check.Equals, "users")
+		c.Assert(span.Error, check.Equals, "")
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db/storage"
 	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 type hasUniqueIndexChecker struct{}
@@ -194,6 +196,70 @@ func (s *S) TestLogs(c *check.C) {
 	c.Assert(logs, check.DeepEquals, logsc)
 }
 
+func (s *S) TestLogsStats(c *check.C) {
+	strg, err := LogConn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	defer strg.Logs("statsapp").DropCollection()
+	stats, err := strg.LogsStats("statsapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(stats, check.DeepEquals, &LogsStats{})
+	err = strg.Logs("statsapp").Insert(bson.M{"message": "hello"}, bson.M{"message": "world"})
+	c.Assert(err, check.IsNil)
+	stats, err = strg.LogsStats("statsapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(stats.Count, check.Equals, int64(2))
+	c.Assert(stats.Capped, check.Equals, true)
+	c.Assert(stats.MaxSize, check.Equals, int64(200*5000))
+	c.Assert(stats.Size > 0, check.Equals, true)
+	c.Assert(stats.Full(), check.Equals, false)
+}
+
+func (s *S) TestLogsStatsFull(c *check.C) {
+	stats := LogsStats{Count: 10, Size: 1000, AvgSize: 100, MaxSize: 1100, Capped: true}
+	c.Assert(stats.Full(), check.Equals, true)
+	stats.MaxSize = 2000
+	c.Assert(stats.Full(), check.Equals, false)
+	stats.MaxDocs = 10
+	c.Assert(stats.Full(), check.Equals, true)
+	stats = LogsStats{}
+	c.Assert(stats.Full(), check.Equals, false)
+}
+
+func (s *S) TestSetLogsMaxBytes(c *check.C) {
+	strg, err := LogConn()
+	c.Assert(err, check.IsNil)
+	defer strg.Close()
+	defer strg.Logs("sizedapp").DropCollection()
+	err = strg.SetLogsMaxBytes("sizedapp", 8192)
+	c.Assert(err, check.IsNil)
+	stats, err := strg.LogsStats("sizedapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(stats.Capped, check.Equals, true)
+	c.Assert(stats.MaxSize, check.Equals, int64(8192))
+	err = strg.Logs("sizedapp").Insert(bson.M{"message": "hello"})
+	c.Assert(err, check.IsNil)
+	err = strg.SetLogsMaxBytes("sizedapp", 16384)
+	c.Assert(err, check.IsNil)
+	stats, err = strg.LogsStats("sizedapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(stats.MaxSize, check.Equals, int64(16384))
+	c.Assert(stats.Count, check.Equals, int64(1))
+	names, err := strg.Logs("sizedapp").Database.CollectionNames()
+	c.Assert(err, check.IsNil)
+	for _, name := range names {
+		c.Assert(name, check.Not(check.Equals), "logs_sizedapp_resize")
+	}
+}
+
+func (s *S) TestDefaultLogsMaxBytes(c *check.C) {
+	c.Assert(DefaultLogsMaxBytes(), check.Equals, int64(200*5000))
+	config.Set("app-logs:retention:max-bytes", 4096)
+	defer config.Unset("app-logs:retention:max-bytes")
+	c.Assert(DefaultLogsMaxBytes(), check.Equals, int64(4096))
+	c.Assert(defaultLogsCappedInfo(), check.DeepEquals, &mgo.CollectionInfo{Capped: true, MaxBytes: 4096, ForceIdIndex: true})
+}
+
 func (s *S) TestRoles(c *check.C) {
 	strg, err := Conn()
 	c.Assert(err, check.IsNil)
@@ -0,0 +1,252 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package audit forwards events started by users to a syslog server, in
+// RFC 5424 or CEF format, so they can be consumed by SIEM systems.
+package audit
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+)
+
+const (
+	defaultBufferSize    = 10000
+	defaultRetryInterval = 5 * time.Second
+	dialTimeout          = 10 * time.Second
+	writeTimeout         = 10 * time.Second
+)
+
+var sinkInstance *sink
+
+type sink struct {
+	network       string
+	address       string
+	tlsConfig     *tls.Config
+	format        formatter
+	hostname      string
+	version       string
+	retryInterval time.Duration
+	queue         chan []byte
+	done          chan struct{}
+	wg            sync.WaitGroup
+	conn          net.Conn
+	dropped       uint64
+}
+
+// Initialize starts forwarding user events to the syslog server configured
+// in events:audit:address. It does nothing if no address is configured. The
+// version is reported as the device version of CEF messages.
+func Initialize(version string) error {
+	if sinkInstance != nil {
+		return errors.New("audit sink already initialized")
+	}
+	address, _ := config.GetString("events:audit:address")
+	if address == "" {
+		return nil
+	}
+	s, err := newSinkFromConfig(address)
+	if err != nil {
+		return err
+	}
+	s.version = version
+	sinkInstance = s
+	s.start()
+	event.AddDoneNotifier(s.enqueue)
+	shutdown.Register(s)
+	return nil
+}
+
+func newSinkFromConfig(address string) (*sink, error) {
+	network, _ := config.GetString("events:audit:network")
+	if network == "" {
+		network = "udp"
+	}
+	formatName, _ := config.GetString("events:audit:format")
+	if formatName == "" {
+		formatName = "rfc5424"
+	}
+	format, ok := formatters[formatName]
+	if !ok {
+		return nil, errors.Errorf("invalid audit format %q, must be rfc5424 or cef", formatName)
+	}
+	bufferSize, _ := config.GetInt("events:audit:buffer-size")
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	s := newSink(network, address, format, bufferSize)
+	switch network {
+	case "udp", "tcp":
+	case "tls":
+		var err error
+		s.tlsConfig, err = tlsConfig(address)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("invalid audit network %q, must be udp, tcp or tls", network)
+	}
+	return s, nil
+}
+
+func tlsConfig(address string) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{ServerName: host}
+	cfg.InsecureSkipVerify, _ = config.GetBool("events:audit:tls:insecure-skip-verify")
+	caFile, _ := config.GetString("events:audit:tls:ca-file")
+	if caFile != "" {
+		data, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(data) {
+			return nil, errors.Errorf("no certificates found in %q", caFile)
+		}
+	}
+	return cfg, nil
+}
+
+func newSink(network, address string, format formatter, bufferSize int) *sink {
+	hostname, _ := os.Hostname()
+	return &sink{
+		network:       network,
+		address:       address,
+		format:        format,
+		hostname:      hostname,
+		retryInterval: defaultRetryInterval,
+		queue:         make(chan []byte, bufferSize),
+		done:          make(chan struct{}),
+	}
+}
+
+// enqueue formats events owned by users and stores them in the local buffer.
+// When the buffer is full, because the syslog server is unavailable for too
+// long, new messages are discarded.
+func (s *sink) enqueue(evt *event.Event) {
+	if evt.Owner.Type != event.OwnerTypeUser {
+		return
+	}
+	msg := s.format(evt, s.hostname, s.version)
+	select {
+	case s.queue <- msg:
+	default:
+		n := atomic.AddUint64(&s.dropped, 1)
+		log.Errorf("[audit] buffer is full, dropping event %s (%d dropped so far)", evt.UniqueID.Hex(), n)
+	}
+}
+
+func (s *sink) start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.closeConn()
+		for {
+			select {
+			case msg := <-s.queue:
+				if !s.send(msg) {
+					return
+				}
+			case <-s.done:
+				s.flush()
+				return
+			}
+		}
+	}()
+}
+
+// flush tries to send the messages still in the buffer, giving up on the
+// first error.
+func (s *sink) flush() {
+	for {
+		select {
+		case msg := <-s.queue:
+			err := s.write(msg)
+			if err != nil {
+				log.Errorf("[audit] unable to flush events to %s://%s: %s", s.network, s.address, err)
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// send writes the message, retrying until it succeeds. It returns false if
+// the sink was shut down before the message could be sent.
+func (s *sink) send(msg []byte) bool {
+	for {
+		err := s.write(msg)
+		if err == nil {
+			return true
+		}
+		log.Errorf("[audit] unable to send event to %s://%s: %s", s.network, s.address, err)
+		s.closeConn()
+		select {
+		case <-s.done:
+			return false
+		case <-time.After(s.retryInterval):
+		}
+	}
+}
+
+func (s *sink) write(msg []byte) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	data := msg
+	if s.network != "udp" {
+		// Octet counting framing, from RFC 6587.
+		data = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+	}
+	_, err := s.conn.Write(data)
+	return err
+}
+
+func (s *sink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if s.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	}
+	return dialer.Dial(s.network, s.address)
+}
+
+func (s *sink) closeConn() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// Shutdown stops sending messages, after trying to send the ones still in the
+// buffer.
+func (s *sink) Shutdown() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *sink) String() string {
+	return "audit sink"
+}
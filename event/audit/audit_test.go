@@ -0,0 +1,180 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"gopkg.in/check.v1"
+)
+
+// readFrame reads a message framed with octet counting.
+func readFrame(c *check.C, r *bufio.Reader) string {
+	length, err := r.ReadString(' ')
+	c.Assert(err, check.IsNil)
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	c.Assert(err, check.IsNil)
+	buf := make([]byte, n)
+	_, err = r.Read(buf)
+	c.Assert(err, check.IsNil)
+	return string(buf)
+}
+
+func acceptOne(c *check.C, l net.Listener) <-chan string {
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(ch)
+			return
+		}
+		defer conn.Close()
+		ch <- readFrame(c, bufio.NewReader(conn))
+	}()
+	return ch
+}
+
+func waitMessage(c *check.C, ch <-chan string) string {
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for audit message")
+	}
+	return ""
+}
+
+func (s *S) TestSinkTCP(c *check.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	received := acceptOne(c, l)
+	sk := newSink("tcp", l.Addr().String(), formatRFC5424, 10)
+	sk.start()
+	defer sk.Shutdown()
+	sk.enqueue(newTestEvent(""))
+	msg := waitMessage(c, received)
+	c.Assert(msg, check.Equals, string(formatRFC5424(newTestEvent(""), sk.hostname, "")))
+}
+
+func (s *S) TestSinkUDP(c *check.C) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	sk := newSink("udp", conn.LocalAddr().String(), formatCEF, 10)
+	sk.start()
+	defer sk.Shutdown()
+	sk.enqueue(newTestEvent(""))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(buf[:n]), check.Equals, string(formatCEF(newTestEvent(""), sk.hostname, "")))
+}
+
+func (s *S) TestSinkTLS(c *check.C) {
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	certs := srv.TLS.Certificates
+	srv.Close()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certs})
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	received := acceptOne(c, l)
+	sk := newSink("tls", l.Addr().String(), formatRFC5424, 10)
+	sk.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	sk.start()
+	defer sk.Shutdown()
+	sk.enqueue(newTestEvent(""))
+	msg := waitMessage(c, received)
+	c.Assert(strings.HasPrefix(msg, "<109>1 "), check.Equals, true)
+}
+
+func (s *S) TestSinkIgnoresNonUserEvents(c *check.C) {
+	sk := newSink("tcp", "127.0.0.1:0", formatRFC5424, 10)
+	evt := newTestEvent("")
+	evt.Owner = event.Owner{Type: event.OwnerTypeInternal}
+	sk.enqueue(evt)
+	evt.Owner = event.Owner{Type: event.OwnerTypeApp, Name: "myapp"}
+	sk.enqueue(evt)
+	c.Assert(sk.queue, check.HasLen, 0)
+	sk.enqueue(newTestEvent(""))
+	c.Assert(sk.queue, check.HasLen, 1)
+}
+
+func (s *S) TestSinkBufferFull(c *check.C) {
+	sk := newSink("tcp", "127.0.0.1:0", formatRFC5424, 1)
+	sk.enqueue(newTestEvent(""))
+	sk.enqueue(newTestEvent(""))
+	c.Assert(sk.queue, check.HasLen, 1)
+	c.Assert(sk.dropped, check.Equals, uint64(1))
+}
+
+func (s *S) TestSinkBuffersDuringOutage(c *check.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	addr := l.Addr().String()
+	l.Close()
+	sk := newSink("tcp", addr, formatRFC5424, 10)
+	sk.retryInterval = 50 * time.Millisecond
+	sk.start()
+	defer sk.Shutdown()
+	sk.enqueue(newTestEvent(""))
+	sk.enqueue(newTestEvent("my error"))
+	time.Sleep(100 * time.Millisecond)
+	l, err = net.Listen("tcp", addr)
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	ch := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		ch <- readFrame(c, r)
+		ch <- readFrame(c, r)
+	}()
+	c.Assert(strings.HasPrefix(waitMessage(c, ch), "<109>1 "), check.Equals, true)
+	c.Assert(strings.HasPrefix(waitMessage(c, ch), "<108>1 "), check.Equals, true)
+}
+
+func (s *S) TestNewSinkFromConfig(c *check.C) {
+	config.Set("events:audit:network", "tls")
+	config.Set("events:audit:format", "cef")
+	config.Set("events:audit:buffer-size", 5)
+	defer config.Unset("events:audit")
+	sk, err := newSinkFromConfig("siem.example.com:6514")
+	c.Assert(err, check.IsNil)
+	c.Assert(sk.network, check.Equals, "tls")
+	c.Assert(sk.tlsConfig.ServerName, check.Equals, "siem.example.com")
+	c.Assert(cap(sk.queue), check.Equals, 5)
+}
+
+func (s *S) TestNewSinkFromConfigInvalid(c *check.C) {
+	config.Set("events:audit:network", "http")
+	defer config.Unset("events:audit")
+	_, err := newSinkFromConfig("siem.example.com:514")
+	c.Assert(err, check.ErrorMatches, `invalid audit network "http", must be udp, tcp or tls`)
+	config.Set("events:audit:network", "udp")
+	config.Set("events:audit:format", "json")
+	_, err = newSinkFromConfig("siem.example.com:514")
+	c.Assert(err, check.ErrorMatches, `invalid audit format "json", must be rfc5424 or cef`)
+}
+
+func (s *S) TestInitializeWithoutAddress(c *check.C) {
+	err := Initialize("1.0")
+	c.Assert(err, check.IsNil)
+	c.Assert(sinkInstance, check.IsNil)
+}
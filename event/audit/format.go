@@ -0,0 +1,164 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+)
+
+const (
+	// facilityLogAudit is the "log audit" syslog facility, from RFC 5424.
+	facilityLogAudit = 13
+
+	severityWarning = 4
+	severityNotice  = 5
+
+	// sdID is the structured data element holding event fields. 32473 is
+	// the private enterprise number reserved for documentation by RFC 5612.
+	sdID = "tsuru@32473"
+
+	timestampFormat = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// formatter converts a finished event to a syslog message.
+type formatter func(evt *event.Event, hostname, version string) []byte
+
+var formatters = map[string]formatter{
+	"rfc5424": formatRFC5424,
+	"cef":     formatCEF,
+}
+
+func success(evt *event.Event) bool {
+	return evt.Error == ""
+}
+
+// header returns the RFC 5424 header of a message about the event, the
+// structured data and message parts must be appended to it.
+func header(evt *event.Event, hostname string) string {
+	severity := severityNotice
+	if !success(evt) {
+		severity = severityWarning
+	}
+	msgID := evt.Kind.Name
+	if msgID == "" {
+		msgID = "-"
+	} else if len(msgID) > 32 {
+		msgID = msgID[:32]
+	}
+	if hostname == "" {
+		hostname = "-"
+	}
+	return fmt.Sprintf("<%d>1 %s %s tsuru - %s", facilityLogAudit*8+severity,
+		evt.EndTime.UTC().Format(timestampFormat), hostname, msgID)
+}
+
+func description(evt *event.Event) string {
+	msg := fmt.Sprintf("%s %s ran %s on %s %s", evt.Owner.Type, evt.Owner.Name, evt.Kind.Name, evt.Target.Type, evt.Target.Value)
+	if success(evt) {
+		return msg + ": succeeded"
+	}
+	return msg + ": failed: " + evt.Error
+}
+
+func formatRFC5424(evt *event.Event, hostname, version string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(header(evt, hostname))
+	buf.WriteString(" [" + sdID)
+	param := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, ` %s="%s"`, name, sdEscaper.Replace(value))
+		}
+	}
+	param("id", evt.UniqueID.Hex())
+	param("kind", evt.Kind.Name)
+	param("ownerType", string(evt.Owner.Type))
+	param("owner", evt.Owner.Name)
+	param("targetType", string(evt.Target.Type))
+	param("targetValue", evt.Target.Value)
+	param("success", fmt.Sprint(success(evt)))
+	param("error", evt.Error)
+	param("remoteAddr", evt.RemoteAddr)
+	param("requestID", evt.RequestID)
+	param("start", evt.StartTime.UTC().Format(timestampFormat))
+	param("end", evt.EndTime.UTC().Format(timestampFormat))
+	param("version", version)
+	buf.WriteString("] ")
+	buf.WriteString(description(evt))
+	return buf.Bytes()
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func formatCEF(evt *event.Event, hostname, version string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(header(evt, hostname))
+	buf.WriteString(" - ")
+	severity := 3
+	outcome := "success"
+	if !success(evt) {
+		severity = 7
+		outcome = "failure"
+	}
+	if version == "" {
+		version = "-"
+	}
+	fmt.Fprintf(&buf, "CEF:0|tsuru|tsuru|%s|%s|%s|%d|",
+		cefHeaderEscaper.Replace(version),
+		cefHeaderEscaper.Replace(evt.Kind.Name),
+		cefHeaderEscaper.Replace(fmt.Sprintf("%s on %s %s", evt.Kind.Name, evt.Target.Type, evt.Target.Value)),
+		severity,
+	)
+	var ext []string
+	field := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefExtensionEscaper.Replace(value))
+		}
+	}
+	field("rt", cefTime(evt.EndTime))
+	field("start", cefTime(evt.StartTime))
+	field("end", cefTime(evt.EndTime))
+	field("externalId", evt.UniqueID.Hex())
+	field("act", evt.Kind.Name)
+	field("outcome", outcome)
+	field("suser", evt.Owner.Name)
+	if evt.RemoteAddr != "" {
+		host, port, err := net.SplitHostPort(evt.RemoteAddr)
+		if err != nil {
+			host = evt.RemoteAddr
+		}
+		field("src", host)
+		field("spt", port)
+	}
+	field("dvchost", hostname)
+	field("cs1Label", "targetType")
+	field("cs1", string(evt.Target.Type))
+	field("cs2Label", "targetValue")
+	field("cs2", evt.Target.Value)
+	if evt.RequestID != "" {
+		field("cs3Label", "requestID")
+		field("cs3", evt.RequestID)
+	}
+	field("msg", evt.Error)
+	buf.WriteString(strings.Join(ext, " "))
+	return buf.Bytes()
+}
+
+func cefTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprint(t.UnixNano() / int64(time.Millisecond))
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
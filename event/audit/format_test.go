@@ -0,0 +1,50 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestFormatRFC5424(c *check.C) {
+	msg := formatRFC5424(newTestEvent(""), "tsuru-api-1", "1.3.0")
+	c.Assert(string(msg), check.Equals, `<109>1 2017-05-01T10:01:30.500Z tsuru-api-1 tsuru - app.deploy `+
+		`[tsuru@32473 id="5901a6ca8a2b1d1e9e5e7e1a" kind="app.deploy" ownerType="user" owner="me@tsuru.io" `+
+		`targetType="app" targetValue="myapp" success="true" remoteAddr="10.0.0.1:51234" requestID="req-1" `+
+		`start="2017-05-01T10:00:00.000Z" end="2017-05-01T10:01:30.500Z" version="1.3.0"] `+
+		`user me@tsuru.io ran app.deploy on app myapp: succeeded`)
+}
+
+func (s *S) TestFormatRFC5424Error(c *check.C) {
+	evt := newTestEvent(`build "failed" [step 2] \o/`)
+	evt.RemoteAddr = ""
+	evt.RequestID = ""
+	msg := string(formatRFC5424(evt, "", ""))
+	c.Assert(strings.HasPrefix(msg, "<108>1 2017-05-01T10:01:30.500Z - tsuru - app.deploy [tsuru@32473 "), check.Equals, true)
+	c.Assert(msg, check.Matches, `.* success="false" error="build \\"failed\\" \[step 2\\] \\\\o/" start=.*`)
+	c.Assert(strings.Contains(msg, "remoteAddr"), check.Equals, false)
+	c.Assert(strings.HasSuffix(msg, `: failed: build "failed" [step 2] \o/`), check.Equals, true)
+}
+
+func (s *S) TestFormatCEF(c *check.C) {
+	msg := formatCEF(newTestEvent(""), "tsuru-api-1", "1.3.0")
+	c.Assert(string(msg), check.Equals, `<109>1 2017-05-01T10:01:30.500Z tsuru-api-1 tsuru - app.deploy - `+
+		`CEF:0|tsuru|tsuru|1.3.0|app.deploy|app.deploy on app myapp|3|`+
+		`rt=1493632890500 start=1493632800000 end=1493632890500 externalId=5901a6ca8a2b1d1e9e5e7e1a `+
+		`act=app.deploy outcome=success suser=me@tsuru.io src=10.0.0.1 spt=51234 dvchost=tsuru-api-1 `+
+		`cs1Label=targetType cs1=app cs2Label=targetValue cs2=myapp cs3Label=requestID cs3=req-1`)
+}
+
+func (s *S) TestFormatCEFError(c *check.C) {
+	evt := newTestEvent("a=b\nc|d")
+	evt.Target.Value = "my|app"
+	msg := string(formatCEF(evt, "tsuru-api-1", ""))
+	c.Assert(strings.HasPrefix(msg, `<108>1 `), check.Equals, true)
+	c.Assert(strings.Contains(msg, `CEF:0|tsuru|tsuru|-|app.deploy|app.deploy on app my\|app|7|`), check.Equals, true)
+	c.Assert(strings.Contains(msg, "outcome=failure"), check.Equals, true)
+	c.Assert(strings.HasSuffix(msg, ` msg=a\=b\nc|d`), check.Equals, true)
+}
@@ -0,0 +1,34 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+func newTestEvent(evtErr string) *event.Event {
+	evt := &event.Event{}
+	evt.UniqueID = bson.ObjectIdHex("5901a6ca8a2b1d1e9e5e7e1a")
+	evt.Target = event.Target{Type: event.TargetTypeApp, Value: "myapp"}
+	evt.Kind = event.Kind{Type: event.KindTypePermission, Name: "app.deploy"}
+	evt.Owner = event.Owner{Type: event.OwnerTypeUser, Name: "me@tsuru.io"}
+	evt.StartTime = time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+	evt.EndTime = time.Date(2017, 5, 1, 10, 1, 30, 500000000, time.UTC)
+	evt.RemoteAddr = "10.0.0.1:51234"
+	evt.RequestID = "req-1"
+	evt.Error = evtErr
+	return evt
+}
@@ -69,6 +69,7 @@ var (
 	TargetTypePlan            = TargetType("plan")
 	TargetTypeNodeContainer   = TargetType("node-container")
 	TargetTypeInstallHost     = TargetType("install-host")
+	TargetTypeWebhook         = TargetType("webhook")
 )
 
 const (
@@ -156,6 +157,8 @@ type eventData struct {
 	Running         bool
 	Allowed         AllowedPermission
 	AllowedCancel   AllowedPermission
+	RemoteAddr      string `bson:",omitempty" json:",omitempty"`
+	RequestID       string `bson:",omitempty" json:",omitempty"`
 }
 
 type cancelInfo struct {
@@ -258,6 +261,13 @@ type Opts struct {
 	AllowedCancel AllowedPermission
 }
 
+// RequestOwner may be implemented by tokens used as event owners, allowing
+// events to record information about the request that started them.
+type RequestOwner interface {
+	RemoteAddr() string
+	RequestID() string
+}
+
 func Allowed(scheme *permission.PermissionScheme, contexts ...permission.PermissionContext) AllowedPermission {
 	return AllowedPermission{
 		Scheme:   scheme.FullName(),
@@ -313,6 +323,12 @@ type Filter struct {
 	Raw            bson.M
 	AllowedTargets []TargetFilter
 	Permissions    []permission.Permission
+	// Source is the network address of the client listing events, used to
+	// evaluate the source conditions of the permissions.
+	Source string
+	// fromUser is set by PruneUserValues on filters built from user input,
+	// which must only match events allowed by Permissions.
+	fromUser bool
 
 	Limit int
 	Skip  int
@@ -323,6 +339,8 @@ func (f *Filter) PruneUserValues() {
 	f.Raw = nil
 	f.AllowedTargets = nil
 	f.Permissions = nil
+	f.Source = ""
+	f.fromUser = true
 	if f.Limit > filterMaxLimit || f.Limit <= 0 {
 		f.Limit = filterMaxLimit
 	}
@@ -330,33 +348,15 @@ func (f *Filter) PruneUserValues() {
 
 func (f *Filter) toQuery() (bson.M, error) {
 	query := bson.M{}
-	permMap := map[string][]permission.PermissionContext{}
-	if f.Permissions != nil {
-		for _, p := range f.Permissions {
-			permMap[p.Scheme.FullName()] = append(permMap[p.Scheme.FullName()], p.Context)
-		}
-		var permOrBlock []bson.M
-		for perm, ctxs := range permMap {
-			ctxsBson := []bson.D{}
-			for _, ctx := range ctxs {
-				if ctx.CtxType == permission.CtxGlobal {
-					ctxsBson = nil
-					break
-				}
-				ctxsBson = append(ctxsBson, bson.D{
-					{Name: "ctxtype", Value: ctx.CtxType},
-					{Name: "value", Value: ctx.Value},
-				})
-			}
-			toAppend := bson.M{
-				"allowed.scheme": bson.M{"$regex": "^" + strings.Replace(perm, ".", `\.`, -1)},
-			}
-			if ctxsBson != nil {
-				toAppend["allowed.contexts"] = bson.M{"$in": ctxsBson}
-			}
-			permOrBlock = append(permOrBlock, toAppend)
+	if f.Permissions != nil || f.fromUser {
+		grants, denies := f.permissionsQuery()
+		if len(grants) == 0 {
+			return nil, errInvalidQuery
+		}
+		query["$or"] = grants
+		if len(denies) > 0 {
+			query["$nor"] = denies
 		}
-		query["$or"] = permOrBlock
 	}
 	if f.AllowedTargets != nil {
 		var orBlock []bson.M
@@ -417,6 +417,181 @@ func (f *Filter) toQuery() (bson.M, error) {
 	return query, nil
 }
 
+// Matches returns whether the event would be returned by a List call using
+// this filter. It's used to filter events that are not stored in the
+// database yet, like the ones received from the events stream. Raw, Limit,
+// Skip and Sort are ignored.
+func (f *Filter) Matches(evt *Event) bool {
+	if (f.Permissions != nil || f.fromUser) && !f.matchesPermissions(evt) {
+		return false
+	}
+	if f.AllowedTargets != nil && !f.matchesAllowedTargets(evt) {
+		return false
+	}
+	if f.Target.Type != "" && f.Target.Type != evt.Target.Type {
+		return false
+	}
+	if f.Target.Value != "" && f.Target.Value != evt.Target.Value {
+		return false
+	}
+	if f.KindType != "" && f.KindType != evt.Kind.Type {
+		return false
+	}
+	if f.KindName != "" && f.KindName != evt.Kind.Name {
+		return false
+	}
+	if f.OwnerType != "" && f.OwnerType != evt.Owner.Type {
+		return false
+	}
+	if f.OwnerName != "" && f.OwnerName != evt.Owner.Name {
+		return false
+	}
+	if !f.Since.IsZero() && evt.StartTime.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && evt.StartTime.After(f.Until) {
+		return false
+	}
+	if f.Running != nil && *f.Running != evt.Running {
+		return false
+	}
+	if !f.IncludeRemoved && !evt.RemoveDate.IsZero() {
+		return false
+	}
+	if f.ErrorOnly && evt.Error == "" {
+		return false
+	}
+	return true
+}
+
+// permissionsQuery returns the clauses matching the events allowed and
+// denied by the permissions of the filter. Grants without pool conditions
+// are grouped by scheme.
+func (f *Filter) permissionsQuery() ([]bson.M, []bson.M) {
+	permMap := map[string][]permission.PermissionContext{}
+	var grants, denies []bson.M
+	for _, p := range f.Permissions {
+		if wp := withoutPools(p); !wp.Applies(f.Source) {
+			continue
+		}
+		if p.Deny {
+			denies = append(denies, permissionClause(p.Scheme.FullName(), []permission.PermissionContext{p.Context}, p.Conditions, true))
+			continue
+		}
+		if p.Conditions != nil && len(p.Conditions.Pools) > 0 {
+			grants = append(grants, permissionClause(p.Scheme.FullName(), []permission.PermissionContext{p.Context}, p.Conditions, false))
+			continue
+		}
+		permMap[p.Scheme.FullName()] = append(permMap[p.Scheme.FullName()], p.Context)
+	}
+	for perm, ctxs := range permMap {
+		grants = append(grants, permissionClause(perm, ctxs, nil, false))
+	}
+	return grants, denies
+}
+
+func permissionClause(scheme string, ctxs []permission.PermissionContext, conditions *permission.Conditions, deny bool) bson.M {
+	clause := bson.M{
+		"allowed.scheme": bson.M{"$regex": "^" + strings.Replace(scheme, ".", `\.`, -1)},
+	}
+	var ctxsBson []bson.D
+	for _, ctx := range ctxs {
+		if ctx.CtxType == permission.CtxGlobal {
+			ctxsBson = nil
+			break
+		}
+		ctxsBson = append(ctxsBson, contextBson(ctx))
+	}
+	var and []bson.M
+	if ctxsBson != nil {
+		and = append(and, bson.M{"allowed.contexts": bson.M{"$in": ctxsBson}})
+	}
+	if conditions != nil && len(conditions.Pools) > 0 {
+		var poolsBson []bson.D
+		for _, pool := range conditions.Pools {
+			poolsBson = append(poolsBson, contextBson(permission.Context(permission.CtxPool, pool)))
+		}
+		poolClause := bson.M{"allowed.contexts": bson.M{"$in": poolsBson}}
+		if deny {
+			// Denies restricted to pools also apply to events without pools,
+			// as done by permission.Check.
+			poolClause = bson.M{"$or": []bson.M{
+				poolClause,
+				{"allowed.contexts.ctxtype": bson.M{"$ne": permission.CtxPool}},
+			}}
+		}
+		and = append(and, poolClause)
+	}
+	if len(and) > 0 {
+		clause["$and"] = and
+	}
+	return clause
+}
+
+func contextBson(ctx permission.PermissionContext) bson.D {
+	return bson.D{
+		{Name: "ctxtype", Value: ctx.CtxType},
+		{Name: "value", Value: ctx.Value},
+	}
+}
+
+// withoutPools returns the permission without its pool conditions, which
+// are evaluated against the contexts of each event.
+func withoutPools(p permission.Permission) permission.Permission {
+	if p.Conditions != nil && len(p.Conditions.Pools) > 0 {
+		conditions := *p.Conditions
+		conditions.Pools = nil
+		p.Conditions = &conditions
+	}
+	return p
+}
+
+func (f *Filter) matchesPermissions(evt *Event) bool {
+	allowed := false
+	for _, p := range f.Permissions {
+		if !strings.HasPrefix(evt.Allowed.Scheme, p.Scheme.FullName()) || !matchesContext(p.Context, evt.Allowed.Contexts) {
+			continue
+		}
+		if !p.Applies(f.Source, evt.Allowed.Contexts...) {
+			continue
+		}
+		if p.Deny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+func matchesContext(ctx permission.PermissionContext, contexts []permission.PermissionContext) bool {
+	if ctx.CtxType == permission.CtxGlobal {
+		return true
+	}
+	for _, c := range contexts {
+		if c.CtxType == ctx.CtxType && c.Value == ctx.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Filter) matchesAllowedTargets(evt *Event) bool {
+	for _, at := range f.AllowedTargets {
+		if at.Type != evt.Target.Type {
+			continue
+		}
+		if at.Values == nil {
+			return true
+		}
+		for _, v := range at.Values {
+			if v == evt.Target.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func GetKinds() ([]Kind, error) {
 	conn, err := db.Conn()
 	if err != nil {
@@ -644,6 +819,11 @@ func newEvt(opts *Opts) (*Event, error) {
 		o.Type = OwnerTypeUser
 		o.Name = opts.Owner.GetUserName()
 	}
+	var remoteAddr, requestID string
+	if reqOwner, ok := opts.Owner.(RequestOwner); ok {
+		remoteAddr = reqOwner.RemoteAddr()
+		requestID = reqOwner.RequestID()
+	}
 	conn, err := db.Conn()
 	if err != nil {
 		return nil, err
@@ -694,6 +874,8 @@ func newEvt(opts *Opts) (*Event, error) {
 		Cancelable:      opts.Cancelable,
 		Allowed:         opts.Allowed,
 		AllowedCancel:   opts.AllowedCancel,
+		RemoteAddr:      remoteAddr,
+		RequestID:       requestID,
 	}}
 	maxRetries := 1
 	for i := 0; i < maxRetries+1; i++ {
@@ -702,6 +884,7 @@ func newEvt(opts *Opts) (*Event, error) {
 			if !opts.DisableLock {
 				updater.addCh <- &opts.Target
 			}
+			notifyStart(&evt)
 			return &evt, nil
 		}
 		if mgo.IsDup(err) {
@@ -899,11 +1082,16 @@ func (e *Event) done(evtErr error, customData interface{}, abort bool) (err erro
 		e.OtherCustomData = dbEvt.OtherCustomData
 	}
 	if len(e.ID.ObjId) != 0 {
-		return coll.UpdateId(e.ID, e.eventData)
+		err = coll.UpdateId(e.ID, e.eventData)
+	} else {
+		defer coll.RemoveId(e.ID)
+		e.ID = eventID{ObjId: e.UniqueID}
+		err = coll.Insert(e.eventData)
 	}
-	defer coll.RemoveId(e.ID)
-	e.ID = eventID{ObjId: e.UniqueID}
-	return coll.Insert(e.eventData)
+	if err == nil {
+		notifyDone(e)
+	}
+	return err
 }
 
 type lockUpdater struct {
@@ -677,6 +677,7 @@ func (s *S) TestListFilterPruneUserValues(c *check.C) {
 	expectedFilter := f
 	expectedFilter.Raw = nil
 	expectedFilter.AllowedTargets = nil
+	expectedFilter.fromUser = true
 	f.PruneUserValues()
 	c.Assert(f, check.DeepEquals, expectedFilter)
 	f.Limit = 110
@@ -693,6 +694,31 @@ func (s *S) TestListFilterPruneUserValues(c *check.C) {
 	c.Assert(f, check.DeepEquals, expectedFilter)
 }
 
+func (s *S) TestListFilterFromUserWithoutPermissions(c *check.C) {
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, "myapp")),
+	})
+	c.Assert(err, check.IsNil)
+	f := &Filter{}
+	c.Assert(f.Matches(evt), check.Equals, true)
+	evts, err := List(f)
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	f.PruneUserValues()
+	c.Assert(f.Matches(evt), check.Equals, false)
+	evts, err = List(f)
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+	f.Permissions = []permission.Permission{}
+	c.Assert(f.Matches(evt), check.Equals, false)
+	evts, err = List(f)
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
 func (s *S) TestEventOtherCustomData(c *check.C) {
 	_, err := New(&Opts{
 		Target:     Target{Type: "app", Value: "myapp"},
@@ -890,3 +916,131 @@ func (s *S) TestNewCustomDataPtr(c *check.C) {
 	}}
 	c.Assert(evt, check.DeepEquals, expected)
 }
+
+func (s *S) TestFilterMatches(c *check.C) {
+	running := true
+	evt := &Event{eventData: eventData{
+		Target:    Target{Type: "app", Value: "myapp"},
+		Kind:      Kind{Type: KindTypePermission, Name: "app.update.env.set"},
+		Owner:     Owner{Type: OwnerTypeUser, Name: "me@me.com"},
+		StartTime: time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC),
+		Running:   true,
+		Allowed: AllowedPermission{
+			Scheme:   "app.read.events",
+			Contexts: []permission.PermissionContext{permission.Context(permission.CtxTeam, "myteam")},
+		},
+	}}
+	tests := []struct {
+		filter  Filter
+		matches bool
+	}{
+		{Filter{}, true},
+		{Filter{Target: Target{Type: "app", Value: "myapp"}}, true},
+		{Filter{Target: Target{Type: "app", Value: "otherapp"}}, false},
+		{Filter{KindType: KindTypeInternal}, false},
+		{Filter{KindName: "app.update.env.set", OwnerName: "me@me.com"}, true},
+		{Filter{OwnerType: OwnerTypeApp}, false},
+		{Filter{Since: time.Date(2017, 5, 1, 11, 0, 0, 0, time.UTC)}, false},
+		{Filter{Until: time.Date(2017, 5, 1, 11, 0, 0, 0, time.UTC)}, true},
+		{Filter{Running: &running}, true},
+		{Filter{ErrorOnly: true}, false},
+		{Filter{AllowedTargets: []TargetFilter{}}, false},
+		{Filter{AllowedTargets: []TargetFilter{{Type: "app"}}}, true},
+		{Filter{AllowedTargets: []TargetFilter{{Type: "app", Values: []string{"otherapp"}}}}, false},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermAll, Context: permission.Context(permission.CtxGlobal, "")},
+		}}, true},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermApp, Context: permission.Context(permission.CtxTeam, "myteam")},
+		}}, true},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermApp, Context: permission.Context(permission.CtxTeam, "otherteam")},
+		}}, false},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermTeam, Context: permission.Context(permission.CtxGlobal, "")},
+		}}, false},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermApp, Context: permission.Context(permission.CtxGlobal, "")},
+			{Scheme: permission.PermAppRead, Context: permission.Context(permission.CtxTeam, "myteam"), Deny: true},
+		}}, false},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermApp, Context: permission.Context(permission.CtxGlobal, "")},
+			{Scheme: permission.PermAppRead, Context: permission.Context(permission.CtxTeam, "otherteam"), Deny: true},
+		}}, true},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermApp, Context: permission.Context(permission.CtxGlobal, ""), Conditions: &permission.Conditions{SourceCIDRs: []string{"10.0.0.0/8"}}},
+		}, Source: "10.1.1.1:1234"}, true},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermApp, Context: permission.Context(permission.CtxGlobal, ""), Conditions: &permission.Conditions{SourceCIDRs: []string{"10.0.0.0/8"}}},
+		}, Source: "192.168.1.1:1234"}, false},
+		{Filter{Permissions: []permission.Permission{
+			{Scheme: permission.PermApp, Context: permission.Context(permission.CtxGlobal, ""), Conditions: &permission.Conditions{Pools: []string{"mypool"}}},
+		}}, false},
+	}
+	for i, tt := range tests {
+		c.Check(tt.filter.Matches(evt), check.Equals, tt.matches, check.Commentf("test %d", i))
+	}
+	evt.RemoveDate = time.Now()
+	c.Assert((&Filter{}).Matches(evt), check.Equals, false)
+	c.Assert((&Filter{IncludeRemoved: true}).Matches(evt), check.Equals, true)
+}
+
+func (s *S) TestListFilterPermissionsDenyAndConditions(c *check.C) {
+	for _, team := range []string{"myteam", "otherteam"} {
+		evt, err := New(&Opts{
+			Target:  Target{Type: "app", Value: "app-" + team},
+			Kind:    permission.PermAppUpdateEnvSet,
+			Owner:   s.token,
+			Allowed: Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxTeam, team)),
+		})
+		c.Assert(err, check.IsNil)
+		c.Assert(evt.Done(nil), check.IsNil)
+	}
+	evts, err := List(&Filter{Permissions: []permission.Permission{
+		{Scheme: permission.PermApp, Context: permission.Context(permission.CtxGlobal, "")},
+		{Scheme: permission.PermAppRead, Context: permission.Context(permission.CtxTeam, "otherteam"), Deny: true},
+	}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Target.Value, check.Equals, "app-myteam")
+	evts, err = List(&Filter{Permissions: []permission.Permission{
+		{Scheme: permission.PermApp, Context: permission.Context(permission.CtxGlobal, ""), Conditions: &permission.Conditions{SourceCIDRs: []string{"10.0.0.0/8"}}},
+	}, Source: "192.168.1.1:1234"})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+	evts, err = List(&Filter{Permissions: []permission.Permission{
+		{Scheme: permission.PermApp, Context: permission.Context(permission.CtxGlobal, ""), Conditions: &permission.Conditions{SourceCIDRs: []string{"10.0.0.0/8"}}},
+	}, Source: "10.1.1.1:1234"})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 2)
+}
+
+type requestOwnerToken struct {
+	auth.Token
+}
+
+func (requestOwnerToken) RemoteAddr() string {
+	return "10.0.0.1:51234"
+}
+
+func (requestOwnerToken) RequestID() string {
+	return "my-request"
+}
+
+func (s *S) TestNewRequestOwner(c *check.C) {
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   requestOwnerToken{Token: s.token},
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.RemoteAddr, check.Equals, "10.0.0.1:51234")
+	c.Assert(evt.RequestID, check.Equals, "my-request")
+	c.Assert(evt.Owner, check.DeepEquals, Owner{Type: OwnerTypeUser, Name: s.token.GetUserName()})
+	evts, err := All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].RemoteAddr, check.Equals, "10.0.0.1:51234")
+	c.Assert(evts[0].RequestID, check.Equals, "my-request")
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import "sync"
+
+// DoneNotifier is called every time an event is marked as done. Notifiers are
+// called synchronously while the event is being finished, so they must not
+// block.
+type DoneNotifier func(evt *Event)
+
+// StartNotifier is called every time a new event is started. As with
+// DoneNotifier, it's called synchronously and must not block.
+type StartNotifier func(evt *Event)
+
+var notifiers = struct {
+	sync.RWMutex
+	list      []DoneNotifier
+	startList []StartNotifier
+}{}
+
+// AddDoneNotifier registers a function to be called after events are done.
+// Aborted events are not notified.
+func AddDoneNotifier(n DoneNotifier) {
+	notifiers.Lock()
+	defer notifiers.Unlock()
+	notifiers.list = append(notifiers.list, n)
+}
+
+// AddStartNotifier registers a function to be called after events are
+// created.
+func AddStartNotifier(n StartNotifier) {
+	notifiers.Lock()
+	defer notifiers.Unlock()
+	notifiers.startList = append(notifiers.startList, n)
+}
+
+func notifyDone(evt *Event) {
+	notifiers.RLock()
+	defer notifiers.RUnlock()
+	for _, n := range notifiers.list {
+		n(evt)
+	}
+}
+
+func notifyStart(evt *Event) {
+	notifiers.RLock()
+	defer notifiers.RUnlock()
+	for _, n := range notifiers.startList {
+		n(evt)
+	}
+}
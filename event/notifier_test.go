@@ -0,0 +1,73 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"errors"
+
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAddDoneNotifier(c *check.C) {
+	defer func() { notifiers.list = nil }()
+	var notified []*Event
+	AddDoneNotifier(func(evt *Event) {
+		notified = append(notified, evt)
+	})
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(notified, check.HasLen, 0)
+	err = evt.Done(errors.New("my error"))
+	c.Assert(err, check.IsNil)
+	c.Assert(notified, check.HasLen, 1)
+	c.Assert(notified[0].UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(notified[0].Running, check.Equals, false)
+	c.Assert(notified[0].Error, check.Equals, "my error")
+}
+
+func (s *S) TestAddDoneNotifierAbort(c *check.C) {
+	defer func() { notifiers.list = nil }()
+	var notified []*Event
+	AddDoneNotifier(func(evt *Event) {
+		notified = append(notified, evt)
+	})
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Abort()
+	c.Assert(err, check.IsNil)
+	c.Assert(notified, check.HasLen, 0)
+}
+
+func (s *S) TestAddStartNotifier(c *check.C) {
+	defer func() { notifiers.startList = nil }()
+	var notified []*Event
+	AddStartNotifier(func(evt *Event) {
+		notified = append(notified, evt)
+	})
+	evt, err := New(&Opts{
+		Target:  Target{Type: "app", Value: "myapp"},
+		Kind:    permission.PermAppUpdateEnvSet,
+		Owner:   s.token,
+		Allowed: Allowed(permission.PermAppReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(notified, check.HasLen, 1)
+	c.Assert(notified[0].UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(notified[0].Running, check.Equals, true)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(notified, check.HasLen, 1)
+}
@@ -0,0 +1,161 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/fs"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// maxLineSize is the maximum size of an event in an archive, events keep
+// their whole log, so they may be large.
+const maxLineSize = 64 * 1024 * 1024
+
+var fsystem fs.Fs
+
+func filesystem() fs.Fs {
+	if fsystem == nil {
+		fsystem = fs.OsFs{}
+	}
+	return fsystem
+}
+
+// archive writes every event returned by the iterator to a new archive file
+// in dir, returning their ids. Archives are gzipped files with one event per
+// line, in MongoDB extended JSON format. The archive is only renamed to its
+// final name after all events are written, so ids are only returned for
+// events safely stored.
+func archive(iter *mgo.Iter, dir string) ([]interface{}, error) {
+	err := filesystem().MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Join(dir, fmt.Sprintf("events-%s-%s.jsonl.gz",
+		time.Now().UTC().Format("20060102T150405Z"), bson.NewObjectId().Hex()))
+	tmpName := name + ".tmp"
+	file, err := filesystem().Create(tmpName)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := export(iter, file)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil || len(ids) == 0 {
+		filesystem().Remove(tmpName)
+		return nil, err
+	}
+	err = filesystem().Rename(tmpName, name)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func export(iter *mgo.Iter, w io.Writer) ([]interface{}, error) {
+	gz := gzip.NewWriter(w)
+	var ids []interface{}
+	var doc bson.M
+	for iter.Next(&doc) {
+		data, err := bson.MarshalJSON(widenInts(doc))
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		_, err = gz.Write(append(data, '\n'))
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		ids = append(ids, doc["_id"])
+		doc = nil
+	}
+	err := iter.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// widenInts converts int values to int64, which are encoded as
+// $numberLong in extended JSON. Plain numbers would be restored as floats.
+func widenInts(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case bson.M:
+		for k := range v {
+			v[k] = widenInts(v[k])
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = widenInts(v[i])
+		}
+	}
+	return value
+}
+
+// RestoreFile restores the events stored in the archive at the given path.
+func RestoreFile(path string) (int, error) {
+	file, err := filesystem().Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return Restore(file)
+}
+
+// Restore inserts the events read from an archive back in the database,
+// returning the number of restored events. Events already in the database
+// are replaced, so restoring the same archive twice is harmless.
+func Restore(r io.Reader) (int, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(nil, maxLineSize)
+	restored, lineNumber := 0, 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var doc bson.M
+		err = bson.UnmarshalJSON(line, &doc)
+		if err != nil {
+			return restored, errors.Wrapf(err, "unable to parse event at line %d", lineNumber)
+		}
+		_, err = coll.UpsertId(doc["_id"], doc)
+		if err != nil {
+			return restored, err
+		}
+		restored++
+	}
+	return restored, scanner.Err()
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package retention
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestPruneWithArchive(c *check.C) {
+	dir := c.MkDir()
+	app := event.Target{Type: event.TargetTypeApp, Value: "myapp"}
+	old := s.insertEvent(c, app, "app.deploy", 40*day)
+	s.insertEvent(c, app, "app.deploy", day)
+	removed, err := Prune(&Policy{Default: 30 * day}, dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(removed, check.Equals, 1)
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 1)
+	c.Assert(files[0].Name(), check.Matches, `events-\d{8}T\d{6}Z-[0-9a-f]{24}\.jsonl\.gz`)
+	_, err = event.GetByID(old.UniqueID)
+	c.Assert(err, check.NotNil)
+	restored, err := RestoreFile(filepath.Join(dir, files[0].Name()))
+	c.Assert(err, check.IsNil)
+	c.Assert(restored, check.Equals, 1)
+	evt, err := event.GetByID(old.UniqueID)
+	c.Assert(err, check.IsNil)
+	c.Assert(evt.Target, check.DeepEquals, old.Target)
+	c.Assert(evt.Kind, check.DeepEquals, old.Kind)
+	c.Assert(evt.Allowed, check.DeepEquals, old.Allowed)
+	c.Assert(evt.StartTime.Unix(), check.Equals, old.StartTime.Unix())
+	var data map[string]int
+	err = evt.StartData(&data)
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.DeepEquals, map[string]int{"units": 3})
+	restored, err = RestoreFile(filepath.Join(dir, files[0].Name()))
+	c.Assert(err, check.IsNil)
+	c.Assert(restored, check.Equals, 1)
+	c.Assert(s.remainingKinds(c), check.DeepEquals, []string{"app.deploy", "app.deploy"})
+}
+
+func (s *S) TestPruneWithArchiveNothingExpired(c *check.C) {
+	dir := c.MkDir()
+	s.insertEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, "app.deploy", time.Hour)
+	removed, err := Prune(&Policy{Default: 30 * day}, dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(removed, check.Equals, 0)
+	files, err := ioutil.ReadDir(dir)
+	c.Assert(err, check.IsNil)
+	c.Assert(files, check.HasLen, 0)
+}
+
+func (s *S) TestRestoreInvalidLine(c *check.C) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("\n{invalid\n"))
+	gz.Close()
+	restored, err := Restore(&buf)
+	c.Assert(err, check.ErrorMatches, `unable to parse event at line 2: .*`)
+	c.Assert(restored, check.Equals, 0)
+}
+
+func (s *S) TestRestoreNotGzip(c *check.C) {
+	_, err := Restore(bytes.NewBufferString("{}"))
+	c.Assert(err, check.NotNil)
+}
@@ -0,0 +1,263 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package retention removes finished events older than the configured
+// retention, optionally archiving them before removal.
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/leader"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const day = 24 * time.Hour
+
+var prunerInstance *pruner
+
+// Policy describes how long finished events are kept. Rules for kind names
+// take precedence over rules for target types, which take precedence over
+// the default. Zero durations mean events are kept forever.
+type Policy struct {
+	Default     time.Duration
+	Kinds       map[string]time.Duration
+	TargetTypes map[string]time.Duration
+}
+
+// LoadPolicy reads the retention policy from the events:retention config
+// entries. Retention times are expressed in days.
+func LoadPolicy() (*Policy, error) {
+	policy := &Policy{
+		Kinds:       map[string]time.Duration{},
+		TargetTypes: map[string]time.Duration{},
+	}
+	days, _ := config.GetInt("events:retention:default")
+	if days < 0 {
+		return nil, errors.Errorf("invalid default event retention: %d", days)
+	}
+	policy.Default = time.Duration(days) * day
+	err := loadRules("events:retention:kinds", policy.Kinds)
+	if err != nil {
+		return nil, err
+	}
+	err = loadRules("events:retention:target-types", policy.TargetTypes)
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func loadRules(key string, rules map[string]time.Duration) error {
+	value, err := config.Get(key)
+	if err != nil {
+		return nil
+	}
+	entries, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return errors.Errorf("invalid value for %q, expected a map of names to days", key)
+	}
+	for name, v := range entries {
+		days, ok := v.(int)
+		if !ok || days < 0 {
+			return errors.Errorf("invalid retention for %q in %q: %v", name, key, v)
+		}
+		rules[fmt.Sprint(name)] = time.Duration(days) * day
+	}
+	return nil
+}
+
+// Empty returns whether the policy keeps every event forever.
+func (p *Policy) Empty() bool {
+	if p.Default > 0 {
+		return false
+	}
+	for _, d := range p.Kinds {
+		if d > 0 {
+			return false
+		}
+	}
+	for _, d := range p.TargetTypes {
+		if d > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// queries returns one query for each rule in the policy, selecting the
+// finished events that expired at the given time.
+func (p *Policy) queries(now time.Time) []bson.M {
+	kinds := sortedKeys(p.Kinds)
+	targetTypes := sortedKeys(p.TargetTypes)
+	var queries []bson.M
+	for _, kind := range kinds {
+		if p.Kinds[kind] <= 0 {
+			continue
+		}
+		queries = append(queries, bson.M{
+			"kind.name": kind,
+			"running":   false,
+			"starttime": bson.M{"$lt": now.Add(-p.Kinds[kind])},
+		})
+	}
+	for _, targetType := range targetTypes {
+		if p.TargetTypes[targetType] <= 0 {
+			continue
+		}
+		queries = append(queries, bson.M{
+			"kind.name":   bson.M{"$nin": kinds},
+			"target.type": targetType,
+			"running":     false,
+			"starttime":   bson.M{"$lt": now.Add(-p.TargetTypes[targetType])},
+		})
+	}
+	if p.Default > 0 {
+		queries = append(queries, bson.M{
+			"kind.name":   bson.M{"$nin": kinds},
+			"target.type": bson.M{"$nin": targetTypes},
+			"running":     false,
+			"starttime":   bson.M{"$lt": now.Add(-p.Default)},
+		})
+	}
+	return queries
+}
+
+func sortedKeys(m map[string]time.Duration) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Prune removes the events expired according to the policy. When
+// archivePath is not empty, expired events are exported to a new archive
+// in that directory before being removed. It returns the number of removed
+// events.
+func Prune(policy *Policy, archivePath string) (int, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	queries := policy.queries(time.Now().UTC())
+	if len(queries) == 0 {
+		return 0, nil
+	}
+	query := bson.M{"$or": queries}
+	if archivePath == "" {
+		info, err := coll.RemoveAll(query)
+		if err != nil {
+			return 0, err
+		}
+		return info.Removed, nil
+	}
+	ids, err := archive(coll.Find(query).Iter(), archivePath)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > removeBatchSize {
+			n = removeBatchSize
+		}
+		info, err := coll.RemoveAll(bson.M{"_id": bson.M{"$in": ids[:n]}})
+		if err != nil {
+			return removed, err
+		}
+		removed += info.Removed
+		ids = ids[n:]
+	}
+	return removed, nil
+}
+
+const removeBatchSize = 1000
+
+type pruner struct {
+	policy      *Policy
+	archivePath string
+	interval    time.Duration
+	lease       *leader.Lease
+	done        chan struct{}
+	finished    chan struct{}
+}
+
+// Initialize starts the background pruner, if any retention is configured.
+func Initialize() error {
+	if prunerInstance != nil {
+		return errors.New("event pruner already initialized")
+	}
+	policy, err := LoadPolicy()
+	if err != nil {
+		return err
+	}
+	if policy.Empty() {
+		return nil
+	}
+	archivePath, _ := config.GetString("events:retention:archive-path")
+	interval, _ := config.GetInt("events:retention:interval")
+	if interval <= 0 {
+		interval = 3600
+	}
+	prunerInstance = &pruner{
+		policy:      policy,
+		archivePath: archivePath,
+		interval:    time.Duration(interval) * time.Second,
+		lease:       leader.NewLease("events-retention-pruner", 3*time.Duration(interval)*time.Second),
+		done:        make(chan struct{}),
+		finished:    make(chan struct{}),
+	}
+	go prunerInstance.run()
+	shutdown.Register(prunerInstance)
+	return nil
+}
+
+func (p *pruner) run() {
+	defer close(p.finished)
+	for {
+		isLeader, err := p.lease.Acquire()
+		if err != nil {
+			log.Errorf("[events retention] unable to acquire lease: %s", err)
+		} else if isLeader {
+			p.prune()
+		}
+		select {
+		case <-p.done:
+			return
+		case <-time.After(p.interval):
+		}
+	}
+}
+
+func (p *pruner) prune() {
+	removed, err := Prune(p.policy, p.archivePath)
+	if err != nil {
+		log.Errorf("[events retention] unable to prune events: %s", err)
+	} else if removed > 0 {
+		log.Debugf("[events retention] removed %d expired events", removed)
+	}
+}
+
+func (p *pruner) Shutdown() {
+	close(p.done)
+	<-p.finished
+	if err := p.lease.Release(); err != nil {
+		log.Errorf("[events retention] unable to release lease: %s", err)
+	}
+}
+
+func (p *pruner) String() string {
+	return "events retention pruner"
+}
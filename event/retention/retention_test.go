@@ -0,0 +1,115 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package retention
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) insertEvent(c *check.C, target event.Target, kind string, age time.Duration) *event.Event {
+	evt := &event.Event{}
+	evt.UniqueID = bson.NewObjectId()
+	evt.Target = target
+	evt.Kind = event.Kind{Type: event.KindTypeInternal, Name: kind}
+	evt.Owner = event.Owner{Type: event.OwnerTypeInternal}
+	evt.StartTime = time.Now().UTC().Add(-age)
+	evt.EndTime = evt.StartTime.Add(time.Minute)
+	evt.Allowed = event.Allowed(permission.PermAppReadEvents)
+	err := evt.RawInsert(map[string]interface{}{"units": 3}, nil, nil)
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func (s *S) remainingKinds(c *check.C) []string {
+	evts, err := event.List(&event.Filter{Sort: "kind.name"})
+	c.Assert(err, check.IsNil)
+	kinds := make([]string, len(evts))
+	for i := range evts {
+		kinds[i] = evts[i].Kind.Name
+	}
+	return kinds
+}
+
+func (s *S) TestLoadPolicy(c *check.C) {
+	config.Set("events:retention:default", 90)
+	config.Set("events:retention:kinds", map[interface{}]interface{}{"app.deploy": 365, "healer": 30})
+	config.Set("events:retention:target-types", map[interface{}]interface{}{"node": 7})
+	defer config.Unset("events:retention")
+	policy, err := LoadPolicy()
+	c.Assert(err, check.IsNil)
+	c.Assert(policy, check.DeepEquals, &Policy{
+		Default:     90 * day,
+		Kinds:       map[string]time.Duration{"app.deploy": 365 * day, "healer": 30 * day},
+		TargetTypes: map[string]time.Duration{"node": 7 * day},
+	})
+	c.Assert(policy.Empty(), check.Equals, false)
+}
+
+func (s *S) TestLoadPolicyEmpty(c *check.C) {
+	policy, err := LoadPolicy()
+	c.Assert(err, check.IsNil)
+	c.Assert(policy.Empty(), check.Equals, true)
+}
+
+func (s *S) TestLoadPolicyInvalid(c *check.C) {
+	config.Set("events:retention:kinds", map[interface{}]interface{}{"app.deploy": "forever"})
+	defer config.Unset("events:retention")
+	_, err := LoadPolicy()
+	c.Assert(err, check.ErrorMatches, `invalid retention for "app.deploy" in "events:retention:kinds": forever`)
+}
+
+func (s *S) TestPrune(c *check.C) {
+	app := event.Target{Type: event.TargetTypeApp, Value: "myapp"}
+	node := event.Target{Type: event.TargetTypeNode, Value: "http://10.0.0.1"}
+	s.insertEvent(c, app, "app.deploy", 40*day)
+	s.insertEvent(c, node, "healer", 40*day)
+	s.insertEvent(c, node, "healer", 10*day)
+	s.insertEvent(c, node, "node.update", 10*day)
+	s.insertEvent(c, node, "node.create", time.Hour)
+	s.insertEvent(c, app, "app.create", 100*day)
+	s.insertEvent(c, app, "app.update", 10*day)
+	policy := &Policy{
+		Default:     30 * day,
+		Kinds:       map[string]time.Duration{"app.deploy": 365 * day, "healer": 30 * day},
+		TargetTypes: map[string]time.Duration{"node": 7 * day},
+	}
+	removed, err := Prune(policy, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(removed, check.Equals, 3)
+	c.Assert(s.remainingKinds(c), check.DeepEquals, []string{"app.deploy", "app.update", "healer", "node.create"})
+}
+
+func (s *S) TestPruneKeepsRunningEvents(c *check.C) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeNode, Value: "http://10.0.0.1"},
+		InternalKind: "healer",
+		Allowed:      event.Allowed(permission.PermPoolReadEvents),
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	removed, err := Prune(&Policy{Kinds: map[string]time.Duration{"healer": time.Nanosecond}}, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(removed, check.Equals, 0)
+}
+
+func (s *S) TestPruneEmptyPolicy(c *check.C) {
+	s.insertEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, "app.deploy", 1000*day)
+	removed, err := Prune(&Policy{}, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(removed, check.Equals, 0)
+	c.Assert(s.remainingKinds(c), check.DeepEquals, []string{"app.deploy"})
+}
+
+func (s *S) TestInitializeEmptyPolicy(c *check.C) {
+	err := Initialize()
+	c.Assert(err, check.IsNil)
+	c.Assert(prunerInstance, check.IsNil)
+}
@@ -0,0 +1,183 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package stream publishes started and finished events to a pubsub queue,
+// allowing every tsuru API instance to push them to connected clients.
+package stream
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/queue"
+)
+
+const queueName = "events"
+
+var publisherInstance *publisher
+
+type publisher struct {
+	queue chan []byte
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// Initialize starts publishing every started and finished event to the
+// events pubsub queue.
+func Initialize() error {
+	if publisherInstance != nil {
+		return errors.New("event stream publisher already initialized")
+	}
+	queueSize, _ := config.GetInt("events:stream:queue-size")
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+	publisherInstance = newPublisher(queueSize)
+	publisherInstance.start()
+	event.AddStartNotifier(publisherInstance.enqueue)
+	event.AddDoneNotifier(publisherInstance.enqueue)
+	shutdown.Register(publisherInstance)
+	return nil
+}
+
+func newPublisher(queueSize int) *publisher {
+	return &publisher{
+		queue: make(chan []byte, queueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+func (p *publisher) start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for {
+			select {
+			case data := <-p.queue:
+				err := publish(data)
+				if err != nil {
+					log.Errorf("[events stream] unable to publish event: %s", err)
+				}
+			case <-p.done:
+				return
+			}
+		}
+	}()
+}
+
+func (p *publisher) enqueue(evt *event.Event) {
+	// The event is serialized right away because its owner keeps changing
+	// it after the notification.
+	data, err := json.Marshal(evt)
+	if err != nil {
+		log.Errorf("[events stream] unable to serialize event %s: %s", evt.UniqueID.Hex(), err)
+		return
+	}
+	select {
+	case p.queue <- data:
+	default:
+		log.Errorf("[events stream] queue is full, dropping event %s", evt.UniqueID.Hex())
+	}
+}
+
+// Shutdown stops publishing events. The queue is never closed because events
+// may still be started or finished during the shutdown.
+func (p *publisher) Shutdown() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+func (p *publisher) String() string {
+	return "events stream publisher"
+}
+
+// Publish synchronously sends the event to every listener.
+func Publish(evt *event.Event) error {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	return publish(data)
+}
+
+func publish(data []byte) error {
+	factory, err := queue.Factory()
+	if err != nil {
+		return err
+	}
+	pubSubQ, err := factory.PubSub(queueName)
+	if err != nil {
+		return err
+	}
+	return pubSubQ.Pub(data)
+}
+
+// Listener receives the events published by every tsuru API instance that
+// match a filter.
+type Listener struct {
+	c         <-chan *event.Event
+	q         queue.PubSubQ
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewListener subscribes to the events queue. Only events matching the
+// filter are sent to the channel returned by ListenChan, see
+// event.Filter.Matches for details.
+func NewListener(filter *event.Filter) (*Listener, error) {
+	factory, err := queue.Factory()
+	if err != nil {
+		return nil, err
+	}
+	pubSubQ, err := factory.PubSub(queueName)
+	if err != nil {
+		return nil, err
+	}
+	subChan, err := pubSubQ.Sub()
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan *event.Event, 10)
+	done := make(chan struct{})
+	go func() {
+		defer close(c)
+		for msg := range subChan {
+			evt := &event.Event{}
+			err := json.Unmarshal(msg, evt)
+			if err != nil {
+				log.Errorf("[events stream] unparsable event, ignoring: %s", string(msg))
+				continue
+			}
+			if !filter.Matches(evt) {
+				continue
+			}
+			select {
+			case c <- evt:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return &Listener{c: c, q: pubSubQ, done: done}, nil
+}
+
+func (l *Listener) ListenChan() <-chan *event.Event {
+	return l.c
+}
+
+// Close unsubscribes the listener from the events queue and closes the
+// channel returned by ListenChan. It's safe to call Close more than once.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.closeErr = l.q.UnSub()
+	})
+	return l.closeErr
+}
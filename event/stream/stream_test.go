@@ -0,0 +1,139 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stream
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func newEvent(c *check.C, appName string) *event.Event {
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: event.TargetTypeApp, Value: appName},
+		Kind:     permission.PermAppUpdateEnvSet,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: "me@tsuru.io"},
+		Allowed:  event.Allowed(permission.PermAppReadEvents, permission.Context(permission.CtxApp, appName)),
+	})
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func (s *S) TestListener(c *check.C) {
+	l, err := NewListener(&event.Filter{Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"}})
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	p := newPublisher(10)
+	p.start()
+	defer p.Shutdown()
+	other := newEvent(c, "otherapp")
+	evt := newEvent(c, "myapp")
+	p.enqueue(other)
+	p.enqueue(evt)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	p.enqueue(evt)
+	var received []*event.Event
+	timeout := time.After(5 * time.Second)
+	for len(received) < 2 {
+		select {
+		case e := <-l.ListenChan():
+			received = append(received, e)
+		case <-timeout:
+			c.Fatalf("timeout waiting for events, received: %#v", received)
+		}
+	}
+	c.Assert(received[0].UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(received[0].Running, check.Equals, true)
+	c.Assert(received[1].UniqueID, check.Equals, evt.UniqueID)
+	c.Assert(received[1].Running, check.Equals, false)
+}
+
+func (s *S) TestListenerPermissions(c *check.C) {
+	l, err := NewListener(&event.Filter{Permissions: []permission.Permission{
+		{Scheme: permission.PermAppReadEvents, Context: permission.Context(permission.CtxApp, "myapp")},
+	}})
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	p := newPublisher(10)
+	p.start()
+	defer p.Shutdown()
+	p.enqueue(newEvent(c, "otherapp"))
+	evt := newEvent(c, "myapp")
+	p.enqueue(evt)
+	select {
+	case e := <-l.ListenChan():
+		c.Assert(e.UniqueID, check.Equals, evt.UniqueID)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for event")
+	}
+}
+
+func (s *S) TestListenerClose(c *check.C) {
+	l, err := NewListener(&event.Filter{})
+	c.Assert(err, check.IsNil)
+	err = l.Close()
+	c.Assert(err, check.IsNil)
+	_, ok := <-l.ListenChan()
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestListenerCloseTwice(c *check.C) {
+	l, err := NewListener(&event.Filter{})
+	c.Assert(err, check.IsNil)
+	err = l.Close()
+	c.Assert(err, check.IsNil)
+	err = l.Close()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestListenerCloseWithoutConsumer(c *check.C) {
+	l, err := NewListener(&event.Filter{})
+	c.Assert(err, check.IsNil)
+	for i := 0; i < 15; i++ {
+		err = Publish(newEvent(c, "myapp"))
+		c.Assert(err, check.IsNil)
+	}
+	timeout := time.After(5 * time.Second)
+	for len(l.ListenChan()) < cap(l.ListenChan()) {
+		select {
+		case <-timeout:
+			c.Fatal("timeout waiting for events")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	err = l.Close()
+	c.Assert(err, check.IsNil)
+	for {
+		select {
+		case _, ok := <-l.ListenChan():
+			if !ok {
+				return
+			}
+		case <-timeout:
+			c.Fatal("timeout waiting for the listener channel to be closed")
+		}
+	}
+}
+
+func (s *S) TestPublisherQueueFull(c *check.C) {
+	p := newPublisher(1)
+	evt := newEvent(c, "myapp")
+	p.enqueue(evt)
+	p.enqueue(evt)
+	c.Assert(p.queue, check.HasLen, 1)
+}
+
+func (s *S) TestPublisherEnqueueAfterShutdown(c *check.C) {
+	p := newPublisher(1)
+	p.start()
+	p.Shutdown()
+	evt := newEvent(c, "myapp")
+	p.enqueue(evt)
+	p.enqueue(evt)
+	c.Assert(p.queue, check.HasLen, 1)
+}
@@ -0,0 +1,261 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	SignatureHeader = "X-Tsuru-Signature"
+	EventIDHeader   = "X-Tsuru-Event-Id"
+)
+
+var dispatcherInstance *dispatcher
+
+// Delivery records the result of sending an event to a webhook.
+type Delivery struct {
+	ID         bson.ObjectId `bson:"_id"`
+	Webhook    string
+	EventID    bson.ObjectId
+	EventKind  string
+	Time       time.Time
+	Attempts   int
+	StatusCode int
+	Success    bool
+	Error      string
+}
+
+type dispatcher struct {
+	client     *http.Client
+	maxRetries int
+	backoff    time.Duration
+	queue      chan []byte
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// Initialize starts the webhook workers and registers them to be notified
+// about every finished event.
+func Initialize() error {
+	if dispatcherInstance != nil {
+		return errors.New("webhook dispatcher already initialized")
+	}
+	workers, _ := config.GetInt("events:webhooks:workers")
+	if workers <= 0 {
+		workers = 5
+	}
+	queueSize, _ := config.GetInt("events:webhooks:queue-size")
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+	maxRetries, err := config.GetInt("events:webhooks:max-retries")
+	if err != nil {
+		maxRetries = 3
+	}
+	backoffSeconds, _ := config.GetInt("events:webhooks:retry-backoff")
+	if backoffSeconds <= 0 {
+		backoffSeconds = 1
+	}
+	dispatcherInstance = newDispatcher(queueSize, maxRetries, time.Duration(backoffSeconds)*time.Second)
+	dispatcherInstance.start(workers)
+	event.AddDoneNotifier(dispatcherInstance.enqueue)
+	shutdown.Register(dispatcherInstance)
+	return nil
+}
+
+func newDispatcher(queueSize, maxRetries int, backoff time.Duration) *dispatcher {
+	return &dispatcher{
+		client:     net.Dial5Full60ClientNoKeepAlive,
+		maxRetries: maxRetries,
+		backoff:    backoff,
+		queue:      make(chan []byte, queueSize),
+		done:       make(chan struct{}),
+	}
+}
+
+func (d *dispatcher) start(workers int) {
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for {
+				select {
+				case data := <-d.queue:
+					evt := &event.Event{}
+					err := json.Unmarshal(data, evt)
+					if err != nil {
+						log.Errorf("[webhooks] unable to parse queued event: %s", err)
+						continue
+					}
+					err = d.dispatch(evt)
+					if err != nil {
+						log.Errorf("[webhooks] unable to dispatch event %s: %s", evt.UniqueID.Hex(), err)
+					}
+				case <-d.done:
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (d *dispatcher) enqueue(evt *event.Event) {
+	// The event is serialized right away because its owner may keep changing
+	// it after the notification.
+	data, err := json.Marshal(evt)
+	if err != nil {
+		log.Errorf("[webhooks] unable to serialize event %s: %s", evt.UniqueID.Hex(), err)
+		return
+	}
+	select {
+	case d.queue <- data:
+	default:
+		log.Errorf("[webhooks] queue is full, dropping event %s", evt.UniqueID.Hex())
+	}
+}
+
+// Shutdown stops the workers after their current deliveries. The queue is
+// never closed because events may still finish during the shutdown, queued
+// events are discarded.
+func (d *dispatcher) Shutdown() {
+	close(d.done)
+	d.wg.Wait()
+}
+
+func (d *dispatcher) String() string {
+	return "webhook dispatcher"
+}
+
+func (d *dispatcher) dispatch(evt *event.Event) error {
+	webhooks, err := List(nil)
+	if err != nil {
+		return err
+	}
+	for i := range webhooks {
+		if !webhooks[i].Matches(evt) {
+			continue
+		}
+		delivery := d.deliver(&webhooks[i], evt)
+		err = saveDelivery(delivery)
+		if err != nil {
+			log.Errorf("[webhooks] unable to save delivery for webhook %q: %s", webhooks[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func (d *dispatcher) deliver(w *Webhook, evt *event.Event) *Delivery {
+	delivery := &Delivery{
+		ID:        bson.NewObjectId(),
+		Webhook:   w.Name,
+		EventID:   evt.UniqueID,
+		EventKind: evt.Kind.Name,
+	}
+	body, err := w.body(evt)
+	if err != nil {
+		delivery.Time = time.Now().UTC()
+		delivery.Error = err.Error()
+		return delivery
+	}
+	backoff := d.backoff
+	for delivery.Attempts <= d.maxRetries {
+		if delivery.Attempts > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		delivery.Attempts++
+		delivery.StatusCode, err = d.send(w, evt, body)
+		if err == nil {
+			delivery.Success = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+	}
+	delivery.Time = time.Now().UTC()
+	return delivery
+}
+
+func (d *dispatcher) send(w *Webhook, evt *event.Event, body []byte) (int, error) {
+	req, err := http.NewRequest(w.Method, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set(EventIDHeader, evt.UniqueID.Hex())
+	req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errors.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature sent in the X-Tsuru-Signature header, allowing
+// receivers to check the payload was sent by tsuru. It's the hex encoded
+// HMAC-SHA256 of the body, prefixed by "sha256=".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func saveDelivery(delivery *Delivery) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.WebhookDeliveries().Insert(delivery)
+}
+
+// ListDeliveries returns the last deliveries for the given webhook, most
+// recent first.
+func ListDeliveries(name string, limit int) ([]Delivery, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var deliveries []Delivery
+	query := conn.WebhookDeliveries().Find(bson.M{"webhook": name}).Sort("-time")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err = query.All(&deliveries)
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestDispatchDeliversMatchingWebhooks(c *check.C) {
+	var received []*http.Request
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r)
+		bodies = append(bodies, data)
+	}))
+	defer srv.Close()
+	err := Create(&Webhook{
+		Name:    "wh1",
+		URL:     srv.URL + "/hook",
+		Secret:  "mysecret",
+		Headers: map[string]string{"X-Custom": "abc"},
+		Body:    "{{.Target.Value}}",
+	})
+	c.Assert(err, check.IsNil)
+	err = Create(&Webhook{
+		Name:        "wh2",
+		URL:         srv.URL + "/other",
+		EventFilter: EventFilter{TargetTypes: []string{"node"}},
+	})
+	c.Assert(err, check.IsNil)
+	evt := newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, permission.PermAppDeploy, nil)
+	d := newDispatcher(10, 0, time.Millisecond)
+	err = d.dispatch(evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(received, check.HasLen, 1)
+	c.Assert(received[0].Method, check.Equals, "POST")
+	c.Assert(received[0].URL.Path, check.Equals, "/hook")
+	c.Assert(received[0].Header.Get("X-Custom"), check.Equals, "abc")
+	c.Assert(received[0].Header.Get(EventIDHeader), check.Equals, evt.UniqueID.Hex())
+	c.Assert(received[0].Header.Get(SignatureHeader), check.Equals, Sign("mysecret", []byte("myapp")))
+	c.Assert(string(bodies[0]), check.Equals, "myapp")
+	deliveries, err := ListDeliveries("wh1", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].Success, check.Equals, true)
+	c.Assert(deliveries[0].Attempts, check.Equals, 1)
+	c.Assert(deliveries[0].StatusCode, check.Equals, http.StatusOK)
+	c.Assert(deliveries[0].EventID, check.Equals, evt.UniqueID)
+	c.Assert(deliveries[0].EventKind, check.Equals, "app.deploy")
+	deliveries, err = ListDeliveries("wh2", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 0)
+}
+
+func (s *S) TestDispatchRetries(c *check.C) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	err := Create(&Webhook{Name: "wh1", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	evt := newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, permission.PermAppDeploy, nil)
+	d := newDispatcher(10, 3, time.Millisecond)
+	err = d.dispatch(evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(3))
+	deliveries, err := ListDeliveries("wh1", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].Success, check.Equals, true)
+	c.Assert(deliveries[0].Attempts, check.Equals, 3)
+}
+
+func (s *S) TestDispatchGivesUpAfterMaxRetries(c *check.C) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	err := Create(&Webhook{Name: "wh1", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	evt := newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, permission.PermAppDeploy, nil)
+	d := newDispatcher(10, 2, time.Millisecond)
+	err = d.dispatch(evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(3))
+	deliveries, err := ListDeliveries("wh1", 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(deliveries, check.HasLen, 1)
+	c.Assert(deliveries[0].Success, check.Equals, false)
+	c.Assert(deliveries[0].Attempts, check.Equals, 3)
+	c.Assert(deliveries[0].StatusCode, check.Equals, http.StatusInternalServerError)
+	c.Assert(deliveries[0].Error, check.Equals, "unexpected status code 500")
+}
+
+func (s *S) TestDispatcherWorkers(c *check.C) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(done)
+	}))
+	defer srv.Close()
+	err := Create(&Webhook{Name: "wh1", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	d := newDispatcher(10, 0, time.Millisecond)
+	d.start(1)
+	evt := newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, permission.PermAppDeploy, nil)
+	d.enqueue(evt)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for webhook delivery")
+	}
+	d.Shutdown()
+}
+
+func (s *S) TestDispatcherEnqueueSnapshotsEvent(c *check.C) {
+	received := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		received <- data
+	}))
+	defer srv.Close()
+	err := Create(&Webhook{Name: "wh1", URL: srv.URL})
+	c.Assert(err, check.IsNil)
+	d := newDispatcher(10, 0, time.Millisecond)
+	evt := newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, permission.PermAppDeploy, nil)
+	d.enqueue(evt)
+	evt.Target.Value = "otherapp"
+	d.start(1)
+	defer d.Shutdown()
+	select {
+	case data := <-received:
+		var delivered event.Event
+		err = json.Unmarshal(data, &delivered)
+		c.Assert(err, check.IsNil)
+		c.Assert(delivered.Target.Value, check.Equals, "myapp")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timeout waiting for webhook delivery")
+	}
+}
+
+func (s *S) TestDispatcherEnqueueAfterShutdown(c *check.C) {
+	d := newDispatcher(1, 0, time.Millisecond)
+	d.start(1)
+	d.Shutdown()
+	d.enqueue(&event.Event{})
+	d.enqueue(&event.Event{})
+	c.Assert(d.queue, check.HasLen, 1)
+}
+
+func (s *S) TestSign(c *check.C) {
+	c.Assert(Sign("secret", []byte("body")), check.Equals, "sha256=dc46983557fea127b43af721467eb9b3fde2338fe3e14f51952aa8478c13d355")
+}
@@ -0,0 +1,325 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package webhook implements the delivery of finished events to URLs
+// registered by users.
+package webhook
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrWebhookAlreadyExists = errors.New("webhook already exists")
+)
+
+type ErrValidation struct {
+	msg string
+}
+
+func (e *ErrValidation) Error() string {
+	return e.msg
+}
+
+// Webhook is a URL that receives a request every time a finished event
+// matches its filter. Webhooks owned by a team only receive events visible in
+// the context of that team, webhooks without a team owner receive every
+// matching event.
+type Webhook struct {
+	Name        string `bson:"_id"`
+	Description string
+	TeamOwner   string
+	EventFilter EventFilter
+	URL         string
+	Method      string
+	Headers     map[string]string
+	Body        string
+	Secret      string `json:",omitempty"`
+}
+
+const redactedValue = "xxxxx"
+
+// Redacted returns a copy of the webhook without its secret and with the
+// values of its headers, which often hold credentials, replaced by a
+// placeholder.
+func (w Webhook) Redacted() Webhook {
+	w.Secret = ""
+	if w.Headers == nil {
+		return w
+	}
+	headers := make(map[string]string, len(w.Headers))
+	for key := range w.Headers {
+		headers[key] = redactedValue
+	}
+	w.Headers = headers
+	return w
+}
+
+// EventFilter selects which events are sent to a webhook. Empty fields match
+// every event. KindNames are glob patterns, e.g. "app.update.*".
+type EventFilter struct {
+	TargetTypes  []string
+	TargetValues []string
+	KindNames    []string
+	SuccessOnly  bool
+	ErrorOnly    bool
+}
+
+func (w *Webhook) validate() error {
+	if w.Name == "" {
+		return &ErrValidation{msg: "webhook name is required"}
+	}
+	if w.URL == "" {
+		return &ErrValidation{msg: "webhook url is required"}
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ErrValidation{msg: fmt.Sprintf("invalid webhook url %q", w.URL)}
+	}
+	switch w.Method {
+	case "":
+		w.Method = "POST"
+	case "POST", "PUT", "PATCH":
+	default:
+		return &ErrValidation{msg: fmt.Sprintf("invalid webhook method %q", w.Method)}
+	}
+	if w.EventFilter.SuccessOnly && w.EventFilter.ErrorOnly {
+		return &ErrValidation{msg: "success only and error only filters are mutually exclusive"}
+	}
+	for _, kind := range w.EventFilter.KindNames {
+		if _, err = path.Match(kind, ""); err != nil {
+			return &ErrValidation{msg: fmt.Sprintf("invalid kind pattern %q", kind)}
+		}
+	}
+	if w.Body != "" {
+		if _, err = template.New("body").Parse(w.Body); err != nil {
+			return &ErrValidation{msg: fmt.Sprintf("invalid body template: %s", err)}
+		}
+	}
+	return nil
+}
+
+// Matches returns whether the event should be delivered to the webhook.
+func (w *Webhook) Matches(evt *event.Event) bool {
+	f := &w.EventFilter
+	if f.SuccessOnly && evt.Error != "" {
+		return false
+	}
+	if f.ErrorOnly && evt.Error == "" {
+		return false
+	}
+	if len(f.TargetTypes) > 0 && !contains(f.TargetTypes, string(evt.Target.Type)) {
+		return false
+	}
+	if len(f.TargetValues) > 0 && !contains(f.TargetValues, evt.Target.Value) {
+		return false
+	}
+	if len(f.KindNames) > 0 {
+		var found bool
+		for _, pattern := range f.KindNames {
+			if ok, _ := path.Match(pattern, evt.Kind.Name); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return w.canSee(evt)
+}
+
+// canSee checks whether the team owning the webhook is allowed to read the
+// event, using the permissions granted to the team members by the roles they
+// hold in the team. Webhooks without a team owner are created by admins and
+// see every event.
+func (w *Webhook) canSee(evt *event.Event) bool {
+	if w.TeamOwner == "" {
+		return true
+	}
+	scheme, err := permission.SafeGet(evt.Allowed.Scheme)
+	if err != nil || evt.Allowed.Scheme == "" {
+		return false
+	}
+	team := auth.Team{Name: w.TeamOwner}
+	perms, err := team.Permissions()
+	if err != nil {
+		log.Errorf("[webhooks] unable to load permissions of team %q: %s", w.TeamOwner, err)
+		return false
+	}
+	return permission.CheckFromPermList(perms, scheme, evt.Allowed.Contexts...)
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Create validates and stores a new webhook. A random secret is generated
+// when none is provided.
+func Create(w *Webhook) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	if w.Secret == "" {
+		w.Secret, err = generateSecret()
+		if err != nil {
+			return err
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Webhooks().Insert(w)
+	if mgo.IsDup(err) {
+		return ErrWebhookAlreadyExists
+	}
+	return err
+}
+
+// Update replaces an existing webhook, keeping its secret if the new one is
+// empty and the values of headers sent back redacted.
+func Update(w *Webhook) error {
+	err := w.validate()
+	if err != nil {
+		return err
+	}
+	old, err := Find(w.Name)
+	if err != nil {
+		return err
+	}
+	if w.Secret == "" {
+		w.Secret = old.Secret
+	}
+	for key, value := range w.Headers {
+		if oldValue, ok := old.Headers[key]; ok && value == redactedValue {
+			w.Headers[key] = oldValue
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Webhooks().UpdateId(w.Name, w)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+func Delete(name string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Webhooks().RemoveId(name)
+	if err == mgo.ErrNotFound {
+		return ErrWebhookNotFound
+	}
+	if err != nil {
+		return err
+	}
+	_, err = conn.WebhookDeliveries().RemoveAll(bson.M{"webhook": name})
+	return err
+}
+
+func Find(name string) (*Webhook, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var w Webhook
+	err = conn.Webhooks().FindId(name).One(&w)
+	if err == mgo.ErrNotFound {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// List returns the webhooks owned by the given teams. A nil teams slice
+// returns every webhook.
+func List(teams []string) ([]Webhook, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var query bson.M
+	if teams != nil {
+		query = bson.M{"teamowner": bson.M{"$in": teams}}
+	}
+	var webhooks []Webhook
+	err = conn.Webhooks().Find(query).Sort("_id").All(&webhooks)
+	if err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// body renders the request body. Templates are executed against the event
+// decoded from its JSON representation, a plain map, so they can only read
+// its fields.
+func (w *Webhook) body(evt *event.Event) ([]byte, error) {
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return nil, err
+	}
+	if w.Body == "" {
+		return data, nil
+	}
+	tpl, err := template.New("body").Parse(w.Body)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	err = json.Unmarshal(data, &values)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, values)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
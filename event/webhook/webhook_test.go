@@ -0,0 +1,201 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webhook
+
+import (
+	"errors"
+
+	"github.com/tsuru/tsuru/auth"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"gopkg.in/check.v1"
+)
+
+func newFinishedEvent(c *check.C, target event.Target, kind *permission.PermissionScheme, evtErr error, ctxs ...permission.PermissionContext) *event.Event {
+	evt, err := event.New(&event.Opts{
+		Target:   target,
+		Kind:     kind,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: "me@tsuru.io"},
+		Allowed:  event.Allowed(permission.PermAppReadEvents, ctxs...),
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(evtErr)
+	c.Assert(err, check.IsNil)
+	return evt
+}
+
+func (s *S) TestCreate(c *check.C) {
+	w := Webhook{Name: "wh1", URL: "http://example.com/hook", TeamOwner: "myteam"}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	c.Assert(w.Secret, check.HasLen, 64)
+	c.Assert(w.Method, check.Equals, "POST")
+	dbW, err := Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbW, check.DeepEquals, &w)
+}
+
+func (s *S) TestCreateDuplicated(c *check.C) {
+	w := Webhook{Name: "wh1", URL: "http://example.com/hook"}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	w = Webhook{Name: "wh1", URL: "http://example.com/hook2"}
+	err = Create(&w)
+	c.Assert(err, check.Equals, ErrWebhookAlreadyExists)
+}
+
+func (s *S) TestCreateValidation(c *check.C) {
+	tests := []struct {
+		w   Webhook
+		msg string
+	}{
+		{Webhook{URL: "http://a.com"}, "webhook name is required"},
+		{Webhook{Name: "x"}, "webhook url is required"},
+		{Webhook{Name: "x", URL: "ftp://a.com"}, `invalid webhook url "ftp://a.com"`},
+		{Webhook{Name: "x", URL: "http://a.com", Method: "GET"}, `invalid webhook method "GET"`},
+		{Webhook{Name: "x", URL: "http://a.com", EventFilter: EventFilter{SuccessOnly: true, ErrorOnly: true}}, "success only and error only filters are mutually exclusive"},
+		{Webhook{Name: "x", URL: "http://a.com", EventFilter: EventFilter{KindNames: []string{"app.["}}}, `invalid kind pattern "app.\["`},
+		{Webhook{Name: "x", URL: "http://a.com", Body: "{{.Kind"}, "invalid body template: .*"},
+	}
+	for _, tt := range tests {
+		err := Create(&tt.w)
+		c.Assert(err, check.FitsTypeOf, &ErrValidation{})
+		c.Assert(err, check.ErrorMatches, tt.msg)
+	}
+}
+
+func (s *S) TestUpdateKeepsSecret(c *check.C) {
+	w := Webhook{Name: "wh1", URL: "http://example.com/hook"}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	updated := Webhook{Name: "wh1", URL: "http://example.com/other"}
+	err = Update(&updated)
+	c.Assert(err, check.IsNil)
+	dbW, err := Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbW.URL, check.Equals, "http://example.com/other")
+	c.Assert(dbW.Secret, check.Equals, w.Secret)
+}
+
+func (s *S) TestUpdateKeepsRedactedHeaders(c *check.C) {
+	w := Webhook{Name: "wh1", URL: "http://example.com/hook", Headers: map[string]string{"Authorization": "Bearer abc"}}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	updated := w.Redacted()
+	updated.Headers["X-Team"] = "cobra"
+	err = Update(&updated)
+	c.Assert(err, check.IsNil)
+	dbW, err := Find("wh1")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbW.Headers, check.DeepEquals, map[string]string{"Authorization": "Bearer abc", "X-Team": "cobra"})
+}
+
+func (s *S) TestRedacted(c *check.C) {
+	w := Webhook{Name: "wh1", Secret: "abc", Headers: map[string]string{"Authorization": "Bearer abc"}}
+	redacted := w.Redacted()
+	c.Assert(redacted.Secret, check.Equals, "")
+	c.Assert(redacted.Headers, check.DeepEquals, map[string]string{"Authorization": "xxxxx"})
+	c.Assert(w.Headers["Authorization"], check.Equals, "Bearer abc")
+	c.Assert(Webhook{Name: "wh1"}.Redacted(), check.DeepEquals, Webhook{Name: "wh1"})
+}
+
+func (s *S) TestUpdateNotFound(c *check.C) {
+	err := Update(&Webhook{Name: "wh1", URL: "http://example.com/hook"})
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+}
+
+func (s *S) TestDelete(c *check.C) {
+	w := Webhook{Name: "wh1", URL: "http://example.com/hook"}
+	err := Create(&w)
+	c.Assert(err, check.IsNil)
+	err = Delete("wh1")
+	c.Assert(err, check.IsNil)
+	_, err = Find("wh1")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+	err = Delete("wh1")
+	c.Assert(err, check.Equals, ErrWebhookNotFound)
+}
+
+func (s *S) TestList(c *check.C) {
+	for _, w := range []Webhook{
+		{Name: "wh2", URL: "http://a.com", TeamOwner: "t2"},
+		{Name: "wh1", URL: "http://a.com", TeamOwner: "t1"},
+		{Name: "wh3", URL: "http://a.com"},
+	} {
+		err := Create(&w)
+		c.Assert(err, check.IsNil)
+	}
+	all, err := List(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(all, check.HasLen, 3)
+	c.Assert(all[0].Name, check.Equals, "wh1")
+	filtered, err := List([]string{"t2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(filtered, check.HasLen, 1)
+	c.Assert(filtered[0].Name, check.Equals, "wh2")
+}
+
+func (s *S) addTeamRole(c *check.C, team, roleName string, perms ...string) {
+	role, err := permission.NewRole(roleName, string(permission.CtxTeam), "")
+	c.Assert(err, check.IsNil)
+	err = role.AddPermissions(perms...)
+	c.Assert(err, check.IsNil)
+	err = s.conn.Users().Insert(auth.User{
+		Email: roleName + "@" + team + ".com",
+		Roles: []auth.RoleInstance{{Name: roleName, ContextValue: team}},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestMatches(c *check.C) {
+	s.addTeamRole(c, "myteam", "team-events", "app.read.events")
+	s.addTeamRole(c, "limitedteam", "team-deploy", "app.deploy")
+	teamCtx := permission.Context(permission.CtxTeam, "myteam")
+	limitedCtx := permission.Context(permission.CtxTeam, "limitedteam")
+	okEvt := newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, permission.PermAppUpdateEnvSet, nil, teamCtx, limitedCtx)
+	errEvt := newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "otherapp"}, permission.PermAppDeploy, errors.New("fail"))
+	tests := []struct {
+		w      Webhook
+		evt    *event.Event
+		result bool
+	}{
+		{Webhook{}, okEvt, true},
+		{Webhook{}, errEvt, true},
+		{Webhook{TeamOwner: "myteam"}, okEvt, true},
+		{Webhook{TeamOwner: "myteam"}, errEvt, false},
+		{Webhook{TeamOwner: "otherteam"}, okEvt, false},
+		{Webhook{TeamOwner: "limitedteam"}, okEvt, false},
+		{Webhook{EventFilter: EventFilter{SuccessOnly: true}}, okEvt, true},
+		{Webhook{EventFilter: EventFilter{SuccessOnly: true}}, errEvt, false},
+		{Webhook{EventFilter: EventFilter{ErrorOnly: true}}, okEvt, false},
+		{Webhook{EventFilter: EventFilter{ErrorOnly: true}}, errEvt, true},
+		{Webhook{EventFilter: EventFilter{TargetTypes: []string{"app"}}}, okEvt, true},
+		{Webhook{EventFilter: EventFilter{TargetTypes: []string{"node"}}}, okEvt, false},
+		{Webhook{EventFilter: EventFilter{TargetValues: []string{"myapp"}}}, okEvt, true},
+		{Webhook{EventFilter: EventFilter{TargetValues: []string{"myapp"}}}, errEvt, false},
+		{Webhook{EventFilter: EventFilter{KindNames: []string{"app.update.*"}}}, okEvt, true},
+		{Webhook{EventFilter: EventFilter{KindNames: []string{"app.update.*"}}}, errEvt, false},
+		{Webhook{EventFilter: EventFilter{KindNames: []string{"app.update.*", "app.deploy"}}}, errEvt, true},
+	}
+	for i, tt := range tests {
+		c.Check(tt.w.Matches(tt.evt), check.Equals, tt.result, check.Commentf("test %d", i))
+	}
+}
+
+func (s *S) TestBody(c *check.C) {
+	evt := newFinishedEvent(c, event.Target{Type: event.TargetTypeApp, Value: "myapp"}, permission.PermAppDeploy, nil)
+	w := Webhook{Body: `{"text": "{{.Kind.Name}} on {{.Target.Value}}"}`}
+	body, err := w.body(evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(body), check.Equals, `{"text": "app.deploy on myapp"}`)
+	w = Webhook{}
+	body, err = w.body(evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(body), check.Matches, `\{.*"Kind":\{"Type":"permission","Name":"app.deploy"\}.*`)
+	w = Webhook{Body: `{{.Abort}}`}
+	body, err = w.body(evt)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(body), check.Equals, "<no value>")
+}
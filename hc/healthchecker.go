@@ -8,6 +8,7 @@
 package hc
 
 import (
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -18,7 +19,10 @@ const HealthCheckOK = "WORKING"
 
 var ErrDisabledComponent = errors.New("disabled component")
 
-var checkers []healthChecker
+var (
+	checkers   []healthChecker
+	checkersMu sync.RWMutex
+)
 
 type healthChecker struct {
 	name  string
@@ -38,14 +42,20 @@ type Result struct {
 // added to this list can then be checked using the Check function.
 func AddChecker(name string, check func() error) {
 	checker := healthChecker{name: name, check: check}
+	checkersMu.Lock()
+	defer checkersMu.Unlock()
 	checkers = append(checkers, checker)
 }
 
 // Check check the status of all registered checkers and return a list of
 // results.
 func Check() []Result {
-	results := make([]Result, 0, len(checkers))
-	for _, checker := range checkers {
+	checkersMu.RLock()
+	registered := make([]healthChecker, len(checkers))
+	copy(registered, checkers)
+	checkersMu.RUnlock()
+	results := make([]Result, 0, len(registered))
+	for _, checker := range registered {
 		startTime := time.Now()
 		if err := checker.check(); err != nil && err != ErrDisabledComponent {
 			results = append(results, Result{
@@ -0,0 +1,70 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package leader elects a single API instance to run background workers,
+// like schedulers and collectors, that must not run concurrently in many
+// instances.
+package leader
+
+import (
+	"time"
+
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Lease elects a single API instance to run a worker, using a lease stored
+// in MongoDB. The lease is renewed by the leader on every run, and taken over
+// by other instances once it's not renewed for maxStale.
+type Lease struct {
+	name     string
+	id       bson.ObjectId
+	maxStale time.Duration
+}
+
+// NewLease returns the lease of the worker with the given name, which is
+// taken over by other instances when the leader doesn't renew it for
+// maxStale.
+func NewLease(name string, maxStale time.Duration) *Lease {
+	return &Lease{name: name, id: bson.NewObjectId(), maxStale: maxStale}
+}
+
+// Acquire takes or renews the lease, returning whether this instance is the
+// leader.
+func (l *Lease) Acquire() (bool, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	now := time.Now().UTC()
+	_, err = conn.Leaders().Upsert(bson.M{
+		"_id": l.name,
+		"$or": []bson.M{
+			{"owner": l.id},
+			{"update": bson.M{"$lt": now.Add(-l.maxStale)}},
+		},
+	}, bson.M{
+		"$set": bson.M{"owner": l.id, "update": now},
+	})
+	if mgo.IsDup(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Release gives up the lease, when held by this instance.
+func (l *Lease) Release() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Leaders().Remove(bson.M{"_id": l.name, "owner": l.id})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package leader
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestLease(c *check.C) {
+	l1 := NewLease("worker", time.Minute)
+	l2 := NewLease("worker", time.Minute)
+	leader, err := l1.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(leader, check.Equals, true)
+	leader, err = l2.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(leader, check.Equals, false)
+	leader, err = l1.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(leader, check.Equals, true)
+	err = l1.Release()
+	c.Assert(err, check.IsNil)
+	leader, err = l2.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(leader, check.Equals, true)
+}
+
+func (s *S) TestLeaseStale(c *check.C) {
+	l1 := NewLease("worker", time.Minute)
+	l2 := NewLease("worker", time.Minute)
+	leader, err := l1.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(leader, check.Equals, true)
+	err = s.conn.Leaders().UpdateId("worker", bson.M{"$set": bson.M{"update": time.Now().Add(-2 * time.Minute)}})
+	c.Assert(err, check.IsNil)
+	leader, err = l2.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(leader, check.Equals, true)
+	leader, err = l1.Acquire()
+	c.Assert(err, check.IsNil)
+	c.Assert(leader, check.Equals, false)
+}
@@ -0,0 +1,206 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metering samples the units of apps and the service instances
+// owned by teams, storing hourly usage rollups used for cost allocation.
+package metering
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/leader"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	KindUnit            = "unit"
+	KindServiceInstance = "service-instance"
+
+	defaultInterval = 5 * time.Minute
+)
+
+var samplerInstance *sampler
+
+// Record is the usage of a unit plan by an app, or of a service plan by a
+// service instance, during an hour. Hours is the number of unit-hours or
+// instance-hours used.
+type Record struct {
+	Hour     time.Time
+	Kind     string
+	Team     string
+	App      string `bson:",omitempty"`
+	Service  string `bson:",omitempty"`
+	Instance string `bson:",omitempty"`
+	Plan     string
+	Memory   int64 `bson:",omitempty"`
+	Swap     int64 `bson:",omitempty"`
+	CpuShare int   `bson:",omitempty"`
+	Hours    float64
+}
+
+type appUsage struct {
+	Name      string
+	TeamOwner string
+	Plan      struct {
+		Name     string `bson:"_id"`
+		Memory   int64
+		Swap     int64
+		CpuShare int
+	}
+	Quota struct {
+		InUse int
+	}
+}
+
+type serviceInstanceUsage struct {
+	Name        string
+	ServiceName string `bson:"service_name"`
+	PlanName    string `bson:"plan_name"`
+	TeamOwner   string
+}
+
+// Sample records the usage of units and service instances during the
+// sampling slot containing the given time, crediting the interval to the
+// hour of the slot. The slot is marked as sampled once its usage is recorded,
+// and Sample returns false, recording nothing, when the slot was already
+// sampled. Concurrent calls for the same slot are prevented by running the
+// sampler in a single API instance.
+func Sample(at time.Time, interval time.Duration) (bool, error) {
+	if interval <= 0 || interval > time.Hour || time.Hour%interval != 0 {
+		return false, errors.Errorf("invalid metering interval %s, it must divide an hour", interval)
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	slot := at.UTC().Truncate(interval)
+	sampled, err := conn.UsageSamples().FindId(slot).Count()
+	if err != nil {
+		return false, err
+	}
+	if sampled > 0 {
+		return false, nil
+	}
+	hour := slot.Truncate(time.Hour)
+	hours := interval.Hours()
+	coll := conn.Usage()
+	var apps []appUsage
+	err = conn.Apps().Find(bson.M{"quota.inuse": bson.M{"$gt": 0}}).
+		Select(bson.M{"name": 1, "teamowner": 1, "plan": 1, "quota": 1}).All(&apps)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range apps {
+		_, err = coll.Upsert(bson.M{
+			"hour": hour,
+			"kind": KindUnit,
+			"team": a.TeamOwner,
+			"app":  a.Name,
+			"plan": a.Plan.Name,
+		}, bson.M{
+			"$inc": bson.M{"hours": hours * float64(a.Quota.InUse)},
+			"$set": bson.M{"memory": a.Plan.Memory, "swap": a.Plan.Swap, "cpushare": a.Plan.CpuShare},
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	var instances []serviceInstanceUsage
+	err = conn.ServiceInstances().Find(nil).
+		Select(bson.M{"name": 1, "service_name": 1, "plan_name": 1, "teamowner": 1}).All(&instances)
+	if err != nil {
+		return false, err
+	}
+	for _, si := range instances {
+		_, err = coll.Upsert(bson.M{
+			"hour":     hour,
+			"kind":     KindServiceInstance,
+			"team":     si.TeamOwner,
+			"service":  si.ServiceName,
+			"instance": si.Name,
+			"plan":     si.PlanName,
+		}, bson.M{"$inc": bson.M{"hours": hours}})
+		if err != nil {
+			return false, err
+		}
+	}
+	err = conn.UsageSamples().Insert(bson.M{"_id": slot, "interval": interval.Seconds()})
+	if err != nil && !mgo.IsDup(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+type sampler struct {
+	interval time.Duration
+	lease    *leader.Lease
+	done     chan struct{}
+	finished chan struct{}
+}
+
+// Initialize starts the background sampler, when metering is enabled.
+func Initialize() error {
+	if samplerInstance != nil {
+		return errors.New("metering sampler already initialized")
+	}
+	if enabled, _ := config.GetBool("metering:enabled"); !enabled {
+		return nil
+	}
+	interval := defaultInterval
+	if seconds, _ := config.GetInt("metering:interval"); seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+	if interval > time.Hour || time.Hour%interval != 0 {
+		return errors.Errorf("invalid metering:interval %s, it must divide an hour", interval)
+	}
+	samplerInstance = &sampler{
+		interval: interval,
+		lease:    leader.NewLease("metering-sampler", 3*interval),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go samplerInstance.run()
+	shutdown.Register(samplerInstance)
+	return nil
+}
+
+func (s *sampler) run() {
+	defer close(s.finished)
+	for {
+		now := time.Now().UTC()
+		isLeader, err := s.lease.Acquire()
+		if err != nil {
+			log.Errorf("[metering] unable to acquire lease: %s", err)
+		} else if isLeader {
+			if _, err = Sample(now, s.interval); err != nil {
+				log.Errorf("[metering] unable to sample usage: %s", err)
+			}
+		}
+		next := now.Truncate(s.interval).Add(s.interval)
+		select {
+		case <-s.done:
+			return
+		case <-time.After(next.Sub(now)):
+		}
+	}
+}
+
+func (s *sampler) Shutdown() {
+	close(s.done)
+	<-s.finished
+	if err := s.lease.Release(); err != nil {
+		log.Errorf("[metering] unable to release lease: %s", err)
+	}
+}
+
+func (s *sampler) String() string {
+	return "metering sampler"
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metering
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) insertUsageData(c *check.C) {
+	err := s.conn.Apps().Insert(
+		bson.M{
+			"name":      "myapp",
+			"teamowner": "myteam",
+			"plan":      bson.M{"_id": "small", "memory": 512, "swap": 256, "cpushare": 100},
+			"quota":     bson.M{"limit": -1, "inuse": 3},
+		},
+		bson.M{
+			"name":      "stopped",
+			"teamowner": "myteam",
+			"plan":      bson.M{"_id": "small", "memory": 512},
+			"quota":     bson.M{"limit": -1, "inuse": 0},
+		},
+	)
+	c.Assert(err, check.IsNil)
+	err = s.conn.ServiceInstances().Insert(bson.M{
+		"name":         "mydb",
+		"service_name": "mysql",
+		"plan_name":    "medium",
+		"teamowner":    "otherteam",
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestSample(c *check.C) {
+	s.insertUsageData(c)
+	at := time.Date(2017, 6, 1, 10, 17, 0, 0, time.UTC)
+	sampled, err := Sample(at, 15*time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(sampled, check.Equals, true)
+	sampled, err = Sample(at.Add(15*time.Minute), 15*time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(sampled, check.Equals, true)
+	var records []Record
+	err = s.conn.Usage().Find(nil).Select(bson.M{"_id": 0}).Sort("kind").All(&records)
+	c.Assert(err, check.IsNil)
+	hour := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	c.Assert(records, check.HasLen, 2)
+	c.Assert(records[0].Hour.Equal(hour), check.Equals, true)
+	records[0].Hour, records[1].Hour = time.Time{}, time.Time{}
+	c.Assert(records, check.DeepEquals, []Record{
+		{Kind: KindServiceInstance, Team: "otherteam", Service: "mysql", Instance: "mydb", Plan: "medium", Hours: 0.5},
+		{Kind: KindUnit, Team: "myteam", App: "myapp", Plan: "small", Memory: 512, Swap: 256, CpuShare: 100, Hours: 1.5},
+	})
+}
+
+func (s *S) TestSampleSlotSampledOnce(c *check.C) {
+	s.insertUsageData(c)
+	at := time.Date(2017, 6, 1, 10, 17, 0, 0, time.UTC)
+	sampled, err := Sample(at, 5*time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(sampled, check.Equals, true)
+	sampled, err = Sample(at.Add(time.Minute), 5*time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(sampled, check.Equals, false)
+	var record Record
+	err = s.conn.Usage().Find(bson.M{"app": "myapp"}).One(&record)
+	c.Assert(err, check.IsNil)
+	c.Assert(record.Hours, check.Equals, 0.25)
+}
+
+func (s *S) TestSampleInvalidInterval(c *check.C) {
+	_, err := Sample(time.Now(), 7*time.Minute)
+	c.Assert(err, check.ErrorMatches, "invalid metering interval 7m0s, it must divide an hour")
+	_, err = Sample(time.Now(), 2*time.Hour)
+	c.Assert(err, check.NotNil)
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metering
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ReportFilter selects the usage included in a report. An empty team
+// includes every team, and the period includes hours starting at From and
+// before To.
+type ReportFilter struct {
+	Team string
+	From time.Time
+	To   time.Time
+}
+
+// ReportItem is the usage of a plan by an app or service instance during the
+// report period. Price is the configured price of an hour of the plan, and
+// Cost is the price of the used hours.
+type ReportItem struct {
+	Team     string  `json:"team"`
+	Kind     string  `json:"kind"`
+	App      string  `json:"app,omitempty"`
+	Service  string  `json:"service,omitempty"`
+	Instance string  `json:"instance,omitempty"`
+	Plan     string  `json:"plan"`
+	Memory   int64   `json:"memory,omitempty"`
+	Swap     int64   `json:"swap,omitempty"`
+	CpuShare int     `json:"cpushare,omitempty"`
+	Hours    float64 `json:"hours"`
+	Price    float64 `json:"price"`
+	Cost     float64 `json:"cost"`
+}
+
+// Price returns the configured price of an hour of the plan. Unit plan
+// prices are read from metering:prices:plans:<plan> and service plan prices
+// from metering:prices:services:<service>:<plan>. Plans without prices are
+// free.
+func Price(kind, service, plan string) float64 {
+	var price float64
+	if kind == KindServiceInstance {
+		price, _ = config.GetFloat("metering:prices:services:" + service + ":" + plan)
+	} else {
+		price, _ = config.GetFloat("metering:prices:plans:" + plan)
+	}
+	return price
+}
+
+// Report returns the usage of each plan by apps and service instances
+// matching the filter, sorted by team, kind, app, service, instance and plan.
+func Report(filter ReportFilter) ([]ReportItem, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	match := bson.M{"hour": bson.M{"$gte": filter.From.UTC(), "$lt": filter.To.UTC()}}
+	if filter.Team != "" {
+		match["team"] = filter.Team
+	}
+	var results []struct {
+		ID struct {
+			Team     string
+			Kind     string
+			App      string
+			Service  string
+			Instance string
+			Plan     string
+		} `bson:"_id"`
+		Memory   int64
+		Swap     int64
+		CpuShare int
+		Hours    float64
+	}
+	err = conn.Usage().Pipe([]bson.M{
+		{"$match": match},
+		{"$sort": bson.M{"hour": 1}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"team":     "$team",
+				"kind":     "$kind",
+				"app":      "$app",
+				"service":  "$service",
+				"instance": "$instance",
+				"plan":     "$plan",
+			},
+			"memory":   bson.M{"$last": "$memory"},
+			"swap":     bson.M{"$last": "$swap"},
+			"cpushare": bson.M{"$last": "$cpushare"},
+			"hours":    bson.M{"$sum": "$hours"},
+		}},
+		{"$sort": bson.D{
+			{Name: "_id.team", Value: 1},
+			{Name: "_id.kind", Value: 1},
+			{Name: "_id.app", Value: 1},
+			{Name: "_id.service", Value: 1},
+			{Name: "_id.instance", Value: 1},
+			{Name: "_id.plan", Value: 1},
+		}},
+	}).All(&results)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]ReportItem, len(results))
+	for i, r := range results {
+		items[i] = ReportItem{
+			Team:     r.ID.Team,
+			Kind:     r.ID.Kind,
+			App:      r.ID.App,
+			Service:  r.ID.Service,
+			Instance: r.ID.Instance,
+			Plan:     r.ID.Plan,
+			Memory:   r.Memory,
+			Swap:     r.Swap,
+			CpuShare: r.CpuShare,
+			Hours:    r.Hours,
+			Price:    Price(r.ID.Kind, r.ID.Service, r.ID.Plan),
+		}
+		items[i].Cost = items[i].Hours * items[i].Price
+	}
+	return items, nil
+}
+
+// WriteCSV writes the report items to w as CSV, with a header line.
+func WriteCSV(w io.Writer, items []ReportItem) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"team", "kind", "app", "service", "instance", "plan", "memory", "swap", "cpushare", "hours", "price", "cost"})
+	for _, item := range items {
+		writer.Write([]string{
+			item.Team,
+			item.Kind,
+			item.App,
+			item.Service,
+			item.Instance,
+			item.Plan,
+			strconv.FormatInt(item.Memory, 10),
+			strconv.FormatInt(item.Swap, 10),
+			strconv.Itoa(item.CpuShare),
+			strconv.FormatFloat(item.Hours, 'f', -1, 64),
+			strconv.FormatFloat(item.Price, 'f', -1, 64),
+			strconv.FormatFloat(item.Cost, 'f', -1, 64),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metering
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestPrice(c *check.C) {
+	config.Set("metering:prices:plans:small", 0.02)
+	config.Set("metering:prices:services:mysql:medium", 0.5)
+	defer config.Unset("metering:prices")
+	c.Assert(Price(KindUnit, "", "small"), check.Equals, 0.02)
+	c.Assert(Price(KindServiceInstance, "mysql", "medium"), check.Equals, 0.5)
+	c.Assert(Price(KindUnit, "", "large"), check.Equals, 0.0)
+}
+
+func (s *S) TestReport(c *check.C) {
+	config.Set("metering:prices:plans:small", 0.02)
+	config.Set("metering:prices:services:mysql:medium", 0.5)
+	defer config.Unset("metering:prices")
+	s.insertUsageData(c)
+	base := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		_, err := Sample(base.Add(time.Duration(i)*30*time.Minute), 30*time.Minute)
+		c.Assert(err, check.IsNil)
+	}
+	items, err := Report(ReportFilter{From: base, To: base.Add(2 * time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(items, check.DeepEquals, []ReportItem{
+		{Team: "myteam", Kind: KindUnit, App: "myapp", Plan: "small", Memory: 512, Swap: 256, CpuShare: 100, Hours: 6, Price: 0.02, Cost: 0.12},
+		{Team: "otherteam", Kind: KindServiceInstance, Service: "mysql", Instance: "mydb", Plan: "medium", Hours: 2, Price: 0.5, Cost: 1},
+	})
+	items, err = Report(ReportFilter{Team: "myteam", From: base, To: base.Add(time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(items, check.HasLen, 1)
+	c.Assert(items[0].Hours, check.Equals, 3.0)
+	items, err = Report(ReportFilter{From: base.Add(2 * time.Hour), To: base.Add(3 * time.Hour)})
+	c.Assert(err, check.IsNil)
+	c.Assert(items, check.HasLen, 0)
+}
+
+func (s *S) TestWriteCSV(c *check.C) {
+	var buf bytes.Buffer
+	err := WriteCSV(&buf, []ReportItem{
+		{Team: "myteam", Kind: KindUnit, App: "myapp", Plan: "small", Memory: 512, Hours: 1.5, Price: 0.02, Cost: 0.03},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "team,kind,app,service,instance,plan,memory,swap,cpushare,hours,price,cost\n"+
+		"myteam,unit,myapp,,,small,512,0,0,1.5,0.02,0.03\n")
+}
@@ -0,0 +1,181 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package permission
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var now = time.Now
+
+// Conditions restrict when the permissions of a role apply. TimeWindow is a
+// range of hours of the day, in UTC, using the HH:MM-HH:MM format, and may
+// span midnight. SourceCIDRs are the networks of the clients allowed to use
+// the permissions, and Pools are the pools where the permissions apply.
+// Empty conditions always hold.
+type Conditions struct {
+	TimeWindow  string   `json:"time_window,omitempty" bson:",omitempty"`
+	SourceCIDRs []string `json:"source_cidrs,omitempty" bson:",omitempty"`
+	Pools       []string `json:"pools,omitempty" bson:",omitempty"`
+}
+
+// SourceToken is implemented by tokens aware of the network address of the
+// client using them, used to evaluate the source conditions of roles.
+type SourceToken interface {
+	RemoteAddr() string
+}
+
+// IsEmpty returns whether the conditions have no restrictions.
+func (c *Conditions) IsEmpty() bool {
+	return c == nil || (c.TimeWindow == "" && len(c.SourceCIDRs) == 0 && len(c.Pools) == 0)
+}
+
+// Validate checks whether the time window and the networks of the conditions
+// are valid.
+func (c *Conditions) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.TimeWindow != "" {
+		if _, _, err := parseTimeWindow(c.TimeWindow); err != nil {
+			return err
+		}
+	}
+	for _, cidr := range c.SourceCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return errors.Errorf("invalid source CIDR %q", cidr)
+		}
+	}
+	return nil
+}
+
+func (c *Conditions) String() string {
+	var parts []string
+	if c.TimeWindow != "" {
+		parts = append(parts, "time "+c.TimeWindow)
+	}
+	if len(c.SourceCIDRs) > 0 {
+		parts = append(parts, "source "+strings.Join(c.SourceCIDRs, ","))
+	}
+	if len(c.Pools) > 0 {
+		parts = append(parts, "pool "+strings.Join(c.Pools, ","))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// match returns whether the conditions hold for a client with the given
+// source address acting on the contexts. Conditions that can't be evaluated,
+// like pools when no pool is among the contexts, are considered to hold
+// when unknown is true, which is the case for deny permissions.
+func (c *Conditions) match(source string, contexts []PermissionContext, unknown bool) bool {
+	if c == nil {
+		return true
+	}
+	if c.TimeWindow != "" {
+		start, end, err := parseTimeWindow(c.TimeWindow)
+		if err != nil {
+			return false
+		}
+		current := now().UTC()
+		minute := current.Hour()*60 + current.Minute()
+		if start <= end {
+			if minute < start || minute >= end {
+				return false
+			}
+		} else if minute < start && minute >= end {
+			return false
+		}
+	}
+	if len(c.SourceCIDRs) > 0 {
+		if source == "" {
+			if !unknown {
+				return false
+			}
+		} else if !matchSource(c.SourceCIDRs, source) {
+			return false
+		}
+	}
+	if len(c.Pools) > 0 {
+		pools := contextValues(contexts, CtxPool)
+		if len(pools) == 0 {
+			return unknown
+		}
+		if !matchAny(c.Pools, pools) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseTimeWindow(window string) (int, int, error) {
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return 0, 0, errors.Errorf("invalid time window %q, it must be in the HH:MM-HH:MM format", window)
+	}
+	var minutes [2]int
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, errors.Errorf("invalid time window %q, it must be in the HH:MM-HH:MM format", window)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	if minutes[0] == minutes[1] {
+		return 0, 0, errors.Errorf("invalid time window %q, start and end must differ", window)
+	}
+	return minutes[0], minutes[1], nil
+}
+
+func matchSource(cidrs []string, source string) bool {
+	host, _, err := net.SplitHostPort(source)
+	if err != nil {
+		host = source
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func contextValues(contexts []PermissionContext, ctxType contextType) []string {
+	var values []string
+	for _, ctx := range contexts {
+		if ctx.CtxType == ctxType {
+			values = append(values, ctx.Value)
+		}
+	}
+	return values
+}
+
+func matchAny(wanted, values []string) bool {
+	for _, v := range values {
+		for _, w := range wanted {
+			if v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TokenSource returns the network address of the client using the token,
+// when known.
+func TokenSource(token Token) string {
+	if st, ok := token.(SourceToken); ok {
+		return st.RemoteAddr()
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package permission
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type sourceUserToken struct {
+	userToken
+	remoteAddr string
+}
+
+func (t *sourceUserToken) RemoteAddr() string {
+	return t.remoteAddr
+}
+
+func (s *S) TestConditionsValidate(c *check.C) {
+	tests := []struct {
+		conditions *Conditions
+		err        string
+	}{
+		{nil, ""},
+		{&Conditions{}, ""},
+		{&Conditions{TimeWindow: "09:00-18:00", SourceCIDRs: []string{"10.0.0.0/8", "::1/128"}, Pools: []string{"prod"}}, ""},
+		{&Conditions{TimeWindow: "22:00-06:00"}, ""},
+		{&Conditions{TimeWindow: "9h-18h"}, `invalid time window "9h-18h", it must be in the HH:MM-HH:MM format`},
+		{&Conditions{TimeWindow: "09:00"}, `invalid time window "09:00", it must be in the HH:MM-HH:MM format`},
+		{&Conditions{TimeWindow: "09:00-09:00"}, `invalid time window "09:00-09:00", start and end must differ`},
+		{&Conditions{SourceCIDRs: []string{"10.0.0.1"}}, `invalid source CIDR "10.0.0.1"`},
+	}
+	for _, tt := range tests {
+		err := tt.conditions.Validate()
+		if tt.err == "" {
+			c.Assert(err, check.IsNil)
+		} else {
+			c.Assert(err, check.ErrorMatches, tt.err)
+		}
+	}
+}
+
+func (s *S) TestConditionsMatchTimeWindow(c *check.C) {
+	defer func() { now = time.Now }()
+	tests := []struct {
+		window   string
+		at       string
+		expected bool
+	}{
+		{"09:00-18:00", "08:59", false},
+		{"09:00-18:00", "09:00", true},
+		{"09:00-18:00", "17:59", true},
+		{"09:00-18:00", "18:00", false},
+		{"22:00-06:00", "23:30", true},
+		{"22:00-06:00", "05:59", true},
+		{"22:00-06:00", "12:00", false},
+	}
+	for _, tt := range tests {
+		at, err := time.Parse("15:04", tt.at)
+		c.Assert(err, check.IsNil)
+		now = func() time.Time { return at }
+		conditions := &Conditions{TimeWindow: tt.window}
+		c.Assert(conditions.match("", nil, false), check.Equals, tt.expected, check.Commentf("%s at %s", tt.window, tt.at))
+	}
+}
+
+func (s *S) TestConditionsMatchSource(c *check.C) {
+	conditions := &Conditions{SourceCIDRs: []string{"10.0.0.0/8"}}
+	c.Assert(conditions.match("10.1.2.3:51234", nil, false), check.Equals, true)
+	c.Assert(conditions.match("10.1.2.3", nil, false), check.Equals, true)
+	c.Assert(conditions.match("192.168.1.1:51234", nil, false), check.Equals, false)
+	c.Assert(conditions.match("", nil, false), check.Equals, false)
+	c.Assert(conditions.match("", nil, true), check.Equals, true)
+}
+
+func (s *S) TestConditionsMatchPools(c *check.C) {
+	conditions := &Conditions{Pools: []string{"dev", "staging"}}
+	c.Assert(conditions.match("", []PermissionContext{Context(CtxApp, "myapp"), Context(CtxPool, "dev")}, false), check.Equals, true)
+	c.Assert(conditions.match("", []PermissionContext{Context(CtxPool, "prod")}, false), check.Equals, false)
+	c.Assert(conditions.match("", []PermissionContext{Context(CtxTeam, "team1")}, false), check.Equals, false)
+	c.Assert(conditions.match("", []PermissionContext{Context(CtxTeam, "team1")}, true), check.Equals, true)
+}
+
+func (s *S) TestCheckDeny(c *check.C) {
+	t := &userToken{
+		permissions: []Permission{
+			{Scheme: PermApp, Context: Context(CtxTeam, "team1")},
+			{Scheme: PermAppUpdateEnv, Context: Context(CtxTeam, "team1"), Deny: true},
+			{Scheme: PermAll, Context: Context(CtxGlobal, "")},
+			{Scheme: PermAppDeploy, Context: Context(CtxTeam, "team2"), Deny: true},
+		},
+	}
+	c.Assert(Check(t, PermAppUpdateEnvSet, Context(CtxTeam, "team1")), check.Equals, false)
+	c.Assert(Check(t, PermAppUpdateEnv, Context(CtxTeam, "team1")), check.Equals, false)
+	c.Assert(Check(t, PermAppUpdateRestart, Context(CtxTeam, "team1")), check.Equals, true)
+	c.Assert(Check(t, PermAppDeploy, Context(CtxTeam, "team1")), check.Equals, true)
+	c.Assert(Check(t, PermAppDeploy, Context(CtxApp, "myapp"), Context(CtxTeam, "team2")), check.Equals, false)
+	c.Assert(Check(t, PermAppDeploy, Context(CtxApp, "myapp")), check.Equals, true)
+}
+
+func (s *S) TestCheckConditions(c *check.C) {
+	t := &sourceUserToken{
+		userToken: userToken{permissions: []Permission{
+			{Scheme: PermAppDeploy, Context: Context(CtxTeam, "team1"), Conditions: &Conditions{SourceCIDRs: []string{"10.0.0.0/8"}}},
+			{Scheme: PermAppUpdate, Context: Context(CtxTeam, "team1"), Conditions: &Conditions{Pools: []string{"dev"}}},
+			{Scheme: PermAppUpdateEnv, Context: Context(CtxTeam, "team1"), Deny: true, Conditions: &Conditions{SourceCIDRs: []string{"192.168.0.0/16"}}},
+		}},
+		remoteAddr: "10.0.0.1:51234",
+	}
+	c.Assert(Check(t, PermAppDeploy, Context(CtxTeam, "team1")), check.Equals, true)
+	c.Assert(Check(t, PermAppUpdateRestart, Context(CtxTeam, "team1"), Context(CtxPool, "dev")), check.Equals, true)
+	c.Assert(Check(t, PermAppUpdateRestart, Context(CtxTeam, "team1"), Context(CtxPool, "prod")), check.Equals, false)
+	c.Assert(Check(t, PermAppUpdateEnvSet, Context(CtxTeam, "team1"), Context(CtxPool, "dev")), check.Equals, true)
+	t.remoteAddr = "192.168.0.1:51234"
+	c.Assert(Check(t, PermAppDeploy, Context(CtxTeam, "team1")), check.Equals, false)
+	c.Assert(Check(t, PermAppUpdateEnvSet, Context(CtxTeam, "team1"), Context(CtxPool, "dev")), check.Equals, false)
+	c.Assert(CheckFromPermList(t.permissions, PermAppDeploy, Context(CtxTeam, "team1")), check.Equals, false)
+	c.Assert(CheckFromPermList(t.permissions, PermAppUpdateEnvSet, Context(CtxTeam, "team1"), Context(CtxPool, "dev")), check.Equals, false)
+}
+
+func (s *S) TestContextsFromListForPermissionDeny(c *check.C) {
+	perms := []Permission{
+		{Scheme: PermApp, Context: Context(CtxTeam, "team1")},
+		{Scheme: PermApp, Context: Context(CtxTeam, "team2")},
+		{Scheme: PermAppDeploy, Context: Context(CtxTeam, "team2"), Deny: true},
+		{Scheme: PermAppDeploy, Context: Context(CtxTeam, "team3"), Deny: true},
+	}
+	c.Assert(ContextsFromListForPermission(perms, PermAppDeploy), check.DeepEquals, []PermissionContext{Context(CtxTeam, "team1")})
+	c.Assert(ContextsFromListForPermission(perms, PermAppRead), check.DeepEquals, []PermissionContext{Context(CtxTeam, "team1"), Context(CtxTeam, "team2")})
+	perms = append(perms, Permission{Scheme: PermApp, Context: Context(CtxGlobal, ""), Deny: true})
+	c.Assert(ContextsFromListForPermission(perms, PermAppRead), check.HasLen, 0)
+}
+
+func (s *S) TestContextsForPermissionConditions(c *check.C) {
+	t := &sourceUserToken{
+		userToken: userToken{permissions: []Permission{
+			{Scheme: PermApp, Context: Context(CtxTeam, "team1"), Conditions: &Conditions{SourceCIDRs: []string{"10.0.0.0/8"}}},
+			{Scheme: PermApp, Context: Context(CtxTeam, "team2"), Conditions: &Conditions{Pools: []string{"dev"}}},
+			{Scheme: PermApp, Context: Context(CtxPool, "dev"), Conditions: &Conditions{Pools: []string{"dev"}}},
+			{Scheme: PermApp, Context: Context(CtxTeam, "team3"), Deny: true, Conditions: &Conditions{SourceCIDRs: []string{"192.168.0.0/16"}}},
+			{Scheme: PermApp, Context: Context(CtxTeam, "team3")},
+		}},
+		remoteAddr: "10.0.0.1:51234",
+	}
+	c.Assert(ContextsForPermission(t, PermAppRead), check.DeepEquals, []PermissionContext{
+		Context(CtxTeam, "team1"), Context(CtxPool, "dev"), Context(CtxTeam, "team3"),
+	})
+	t.remoteAddr = "192.168.0.1:51234"
+	c.Assert(ContextsForPermission(t, PermAppRead), check.DeepEquals, []PermissionContext{Context(CtxPool, "dev")})
+	c.Assert(ContextsFromListForPermission(t.permissions, PermAppRead), check.DeepEquals, []PermissionContext{Context(CtxPool, "dev")})
+}
+
+func (s *S) TestPermissionString(c *check.C) {
+	p := Permission{Scheme: PermAppDeploy, Context: Context(CtxTeam, "team1")}
+	c.Assert(p.String(), check.Equals, "app.deploy(team team1)")
+	p.Deny = true
+	p.Conditions = &Conditions{TimeWindow: "09:00-18:00", Pools: []string{"dev"}}
+	c.Assert(p.String(), check.Equals, "!app.deploy(team team1)[time 09:00-18:00; pool dev]")
+}
@@ -59,7 +59,8 @@ var (
 	}
 )
 
-func parseContext(ctx string) (contextType, error) {
+// ParseContext returns the context type with the given name.
+func ParseContext(ctx string) (contextType, error) {
 	for _, t := range ContextTypes {
 		if string(t) == ctx {
 			return t, nil
@@ -135,9 +136,14 @@ func (s *PermissionScheme) AllowedContexts() []contextType {
 	return contexts
 }
 
+// Permission grants the scheme in the context. Deny permissions override
+// the permissions granted in the same context, and permissions only apply
+// while their conditions hold.
 type Permission struct {
-	Scheme  *PermissionScheme
-	Context PermissionContext
+	Scheme     *PermissionScheme
+	Context    PermissionContext
+	Deny       bool
+	Conditions *Conditions
 }
 
 func (p *Permission) String() string {
@@ -145,7 +151,14 @@ func (p *Permission) String() string {
 	if value != "" {
 		value = " " + value
 	}
-	return fmt.Sprintf("%s(%s%s)", p.Scheme.FullName(), p.Context.CtxType, value)
+	str := fmt.Sprintf("%s(%s%s)", p.Scheme.FullName(), p.Context.CtxType, value)
+	if p.Deny {
+		str = "!" + str
+	}
+	if !p.Conditions.IsEmpty() {
+		str += "[" + p.Conditions.String() + "]"
+	}
+	return str
 }
 
 type Token interface {
@@ -167,31 +180,73 @@ func ListContextValues(t Token, scheme *PermissionScheme, failIfEmpty bool) ([]s
 	return values, nil
 }
 
+// ContextsFromListForPermission returns the contexts where the permissions
+// grant the scheme. The client is unknown, so permissions restricted to
+// source networks aren't granted. See ContextsForPermission.
 func ContextsFromListForPermission(perms []Permission, scheme *PermissionScheme, ctxTypes ...contextType) []PermissionContext {
+	return contextsFromList(perms, "", scheme, ctxTypes)
+}
+
+// ContextsForPermission returns the contexts where the token is granted the
+// scheme, used by list endpoints to filter resources. Permissions whose
+// conditions don't hold are ignored, and grants restricted to pools are only
+// listed in the contexts of those pools. Denies remove the contexts they
+// match, and a global deny removes every context. Denies in contexts
+// narrower than the granted ones, like a team deny along with a global grant,
+// can't be expressed as a list of contexts and are only enforced by Check.
+func ContextsForPermission(token Token, scheme *PermissionScheme, ctxTypes ...contextType) []PermissionContext {
+	perms, err := token.Permissions()
+	if err != nil {
+		return []PermissionContext{}
+	}
+	return contextsFromList(perms, TokenSource(token), scheme, ctxTypes)
+}
+
+func contextsFromList(perms []Permission, source string, scheme *PermissionScheme, ctxTypes []contextType) []PermissionContext {
+	var denied []PermissionContext
+	for _, perm := range perms {
+		if !perm.Deny || !perm.Scheme.IsParent(scheme) || !perm.Applies(source, perm.Context) {
+			continue
+		}
+		if perm.Context.CtxType == CtxGlobal {
+			return nil
+		}
+		denied = append(denied, perm.Context)
+	}
 	var contexts []PermissionContext
 	for _, perm := range perms {
-		if perm.Scheme.IsParent(scheme) {
-			if len(ctxTypes) > 0 {
-				for _, t := range ctxTypes {
-					if t == perm.Context.CtxType {
-						contexts = append(contexts, perm.Context)
-					}
+		if perm.Deny || !perm.Scheme.IsParent(scheme) || !perm.Applies(source, perm.Context) {
+			continue
+		}
+		if containsContext(denied, perm.Context) {
+			continue
+		}
+		if len(ctxTypes) > 0 {
+			for _, t := range ctxTypes {
+				if t == perm.Context.CtxType {
+					contexts = append(contexts, perm.Context)
 				}
-			} else {
-				contexts = append(contexts, perm.Context)
-
 			}
+		} else {
+			contexts = append(contexts, perm.Context)
 		}
 	}
 	return contexts
 }
 
-func ContextsForPermission(token Token, scheme *PermissionScheme, ctxTypes ...contextType) []PermissionContext {
-	perms, err := token.Permissions()
-	if err != nil {
-		return []PermissionContext{}
+func containsContext(contexts []PermissionContext, ctx PermissionContext) bool {
+	for _, c := range contexts {
+		if c == ctx {
+			return true
+		}
 	}
-	return ContextsFromListForPermission(perms, scheme, ctxTypes...)
+	return false
+}
+
+// Applies returns whether the conditions of the permission hold for a client
+// with the given source address acting on the contexts.
+func (p *Permission) Applies(source string, contexts ...PermissionContext) bool {
+	return p.Conditions.match(source, contexts, p.Deny)
 }
 
 func Check(token Token, scheme *PermissionScheme, contexts ...PermissionContext) bool {
@@ -199,20 +254,40 @@ func Check(token Token, scheme *PermissionScheme, contexts ...PermissionContext)
 	if err != nil {
 		return false
 	}
-	return CheckFromPermList(perms, scheme, contexts...)
+	return checkFromPermList(perms, TokenSource(token), scheme, contexts)
 }
 
+// CheckFromPermList checks whether the permissions grant the scheme in any of
+// the contexts. The client is unknown, so permissions restricted to source
+// networks aren't granted, while denies restricted to them apply.
 func CheckFromPermList(perms []Permission, scheme *PermissionScheme, contexts ...PermissionContext) bool {
+	return checkFromPermList(perms, "", scheme, contexts)
+}
+
+func checkFromPermList(perms []Permission, source string, scheme *PermissionScheme, contexts []PermissionContext) bool {
+	allowed := false
 	for _, perm := range perms {
-		if perm.Scheme.IsParent(scheme) {
-			if perm.Context.CtxType == CtxGlobal {
-				return true
-			}
-			for _, ctx := range contexts {
-				if ctx.CtxType == perm.Context.CtxType && ctx.Value == perm.Context.Value {
-					return true
-				}
-			}
+		if !perm.Scheme.IsParent(scheme) || !perm.matchContexts(contexts) {
+			continue
+		}
+		if !perm.Conditions.match(source, contexts, perm.Deny) {
+			continue
+		}
+		if perm.Deny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+func (p *Permission) matchContexts(contexts []PermissionContext) bool {
+	if p.Context.CtxType == CtxGlobal {
+		return true
+	}
+	for _, ctx := range contexts {
+		if ctx.CtxType == p.Context.CtxType && ctx.Value == p.Context.Value {
+			return true
 		}
 	}
 	return false
@@ -13,6 +13,9 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 ).add(
 	"app.update.description",
 	"app.update.log",
+	"app.update.log-sink.add",
+	"app.update.log-sink.remove",
+	"app.update.log-retention",
 	"app.update.pool",
 	"app.update.unit.add",
 	"app.update.unit.remove",
@@ -37,6 +40,12 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.unbind",
 	"app.update.certificate.set",
 	"app.update.certificate.unset",
+	"app.update.autoscale.set",
+	"app.update.autoscale.unset",
+	"app.update.autoscale.schedule.add",
+	"app.update.autoscale.schedule.remove",
+	"app.update.alert.set",
+	"app.update.alert.remove",
 	"app.deploy",
 	"app.deploy.archive-url",
 	"app.deploy.build",
@@ -51,12 +60,16 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.read.metric",
 	"app.read.log",
 	"app.read.certificate",
+	"app.read.autoscale",
+	"app.read.alert",
 	"app.delete",
 	"app.run",
 	"app.run.shell",
 	"app.admin.unlock",
 	"app.admin.routes",
 	"app.admin.quota",
+).addWithCtx(
+	"app.admin.alert-webhook", []contextType{},
 ).addWithCtx(
 	"node", []contextType{CtxPool},
 ).add(
@@ -90,7 +103,14 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"team.create", []contextType{},
 ).add(
 	"team.read.events",
+	"team.read.members",
+	"team.read.quota",
+	"team.read.usage",
+	"team.update.members.add",
+	"team.update.members.remove",
 	"team.delete",
+).addWithCtx(
+	"team.update.quota", []contextType{},
 ).addWithCtx(
 	"user", []contextType{CtxUser},
 ).addWithCtx(
@@ -98,10 +118,12 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 ).add(
 	"user.delete",
 	"user.read.events",
+	"user.read.permissions",
 	"user.update.token",
 	"user.update.quota",
 	"user.update.password",
 	"user.update.reset",
+	"user.update.two-factor",
 	"user.update.key.add",
 	"user.update.key.remove",
 ).addWithCtx(
@@ -136,6 +158,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"role.delete",
 	"role.read.events",
 	"role.update.assign",
+	"role.update.conditions",
 	"role.update.dissociate",
 	"role.update.permission.add",
 	"role.update.permission.remove",
@@ -182,4 +205,11 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"nodecontainer.delete",
 ).add(
 	"install.manage",
+).addWithCtx(
+	"webhook", []contextType{CtxTeam},
+).add(
+	"webhook.create",
+	"webhook.read",
+	"webhook.update",
+	"webhook.delete",
 )
@@ -81,11 +81,17 @@ type Role struct {
 	ContextType contextType `json:"context"`
 	Description string
 	SchemeNames []string `json:"scheme_names,omitempty"`
-	Events      []string `json:"events,omitempty"`
+	// DenySchemeNames are the permissions denied by the role, overriding the
+	// permissions granted by any role in the same context.
+	DenySchemeNames []string `json:"deny_scheme_names,omitempty" bson:",omitempty"`
+	// Conditions restrict when the allowed and denied permissions of the
+	// role apply.
+	Conditions *Conditions `json:"conditions,omitempty" bson:",omitempty"`
+	Events     []string    `json:"events,omitempty"`
 }
 
 func NewRole(name string, ctx string, description string) (Role, error) {
-	ctxType, err := parseContext(ctx)
+	ctxType, err := ParseContext(ctx)
 	if err != nil {
 		return Role{}, err
 	}
@@ -192,6 +198,15 @@ func DestroyRole(name string) error {
 }
 
 func (r *Role) AddPermissions(permNames ...string) error {
+	return r.addSchemeNames("schemenames", permNames)
+}
+
+// AddDenyPermissions adds permissions denied by the role.
+func (r *Role) AddDenyPermissions(permNames ...string) error {
+	return r.addSchemeNames("denyschemenames", permNames)
+}
+
+func (r *Role) addSchemeNames(field string, permNames []string) error {
 	for _, permName := range permNames {
 		if permName == "" {
 			return ErrInvalidPermissionName
@@ -222,41 +237,87 @@ func (r *Role) AddPermissions(permNames ...string) error {
 		return err
 	}
 	defer coll.Close()
-	err = coll.UpdateId(r.Name, bson.M{"$addToSet": bson.M{"schemenames": bson.M{"$each": permNames}}})
+	err = coll.UpdateId(r.Name, bson.M{"$addToSet": bson.M{field: bson.M{"$each": permNames}}})
+	if err != nil {
+		return err
+	}
+	return r.reloadSchemeNames()
+}
+
+func (r *Role) RemovePermissions(permNames ...string) error {
+	return r.removeSchemeNames("schemenames", permNames)
+}
+
+// RemoveDenyPermissions removes permissions denied by the role.
+func (r *Role) RemoveDenyPermissions(permNames ...string) error {
+	return r.removeSchemeNames("denyschemenames", permNames)
+}
+
+func (r *Role) removeSchemeNames(field string, permNames []string) error {
+	coll, err := rolesCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.UpdateId(r.Name, bson.M{"$pullAll": bson.M{field: permNames}})
 	if err != nil {
 		return err
 	}
+	return r.reloadSchemeNames()
+}
+
+func (r *Role) reloadSchemeNames() error {
 	dbRole, err := FindRole(r.Name)
 	if err != nil {
 		return err
 	}
 	r.SchemeNames = dbRole.SchemeNames
+	r.DenySchemeNames = dbRole.DenySchemeNames
 	return nil
 }
 
-func (r *Role) RemovePermissions(permNames ...string) error {
-	coll, err := rolesCollection()
+// SetConditions replaces the conditions of the role, empty conditions remove
+// every restriction.
+func (r *Role) SetConditions(conditions *Conditions) error {
+	err := conditions.Validate()
 	if err != nil {
 		return err
 	}
-	defer coll.Close()
-	err = coll.UpdateId(r.Name, bson.M{"$pullAll": bson.M{"schemenames": permNames}})
+	coll, err := rolesCollection()
 	if err != nil {
 		return err
 	}
-	dbRole, err := FindRole(r.Name)
+	defer coll.Close()
+	var update bson.M
+	if conditions.IsEmpty() {
+		conditions = nil
+		update = bson.M{"$unset": bson.M{"conditions": ""}}
+	} else {
+		update = bson.M{"$set": bson.M{"conditions": conditions}}
+	}
+	err = coll.UpdateId(r.Name, update)
+	if err == mgo.ErrNotFound {
+		return ErrRoleNotFound
+	}
 	if err != nil {
 		return err
 	}
-	r.SchemeNames = dbRole.SchemeNames
+	r.Conditions = conditions
 	return nil
 }
 
 func (r *Role) filterValidSchemes() PermissionSchemeList {
-	schemes := make(PermissionSchemeList, 0, len(r.SchemeNames))
-	sort.Strings(r.SchemeNames)
-	for i := 0; i < len(r.SchemeNames); i++ {
-		schemeName := r.SchemeNames[i]
+	r.DenySchemeNames, _ = validSchemes(r.DenySchemeNames)
+	var schemes PermissionSchemeList
+	r.SchemeNames, schemes = validSchemes(r.SchemeNames)
+	return schemes
+}
+
+func validSchemes(names []string) ([]string, PermissionSchemeList) {
+	schemes := make(PermissionSchemeList, 0, len(names))
+	sort.Strings(names)
+	for i := 0; i < len(names); i++ {
+		schemeName := names[i]
 		if schemeName == "*" {
 			schemeName = ""
 		}
@@ -264,25 +325,33 @@ func (r *Role) filterValidSchemes() PermissionSchemeList {
 		if scheme == nil {
 			// permission schemes might be removed or renamed, invalid entries
 			// in the database shouldn't be a problem.
-			r.SchemeNames = append(r.SchemeNames[:i], r.SchemeNames[i+1:]...)
+			names = append(names[:i], names[i+1:]...)
 			i--
 			continue
 		}
 		schemes = append(schemes, &scheme.PermissionScheme)
 	}
-	return schemes
+	return names, schemes
 }
 
 func (r *Role) PermissionsFor(contextValue string) []Permission {
 	schemes := r.filterValidSchemes()
-	permissions := make([]Permission, len(schemes))
-	for i, scheme := range schemes {
-		permissions[i] = Permission{
-			Scheme: scheme,
-			Context: PermissionContext{
-				CtxType: r.ContextType,
-				Value:   contextValue,
-			},
+	_, denySchemes := validSchemes(r.DenySchemeNames)
+	permissions := make([]Permission, 0, len(schemes)+len(denySchemes))
+	for i, list := range []PermissionSchemeList{schemes, denySchemes} {
+		for _, scheme := range list {
+			perm := Permission{
+				Scheme: scheme,
+				Context: PermissionContext{
+					CtxType: r.ContextType,
+					Value:   contextValue,
+				},
+				Deny: i == 1,
+			}
+			if !r.Conditions.IsEmpty() {
+				perm.Conditions = r.Conditions
+			}
+			permissions = append(permissions, perm)
 		}
 	}
 	return permissions
@@ -8,6 +8,7 @@ import (
 	"sort"
 
 	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func (s *S) TestNewRole(c *check.C) {
@@ -208,3 +209,77 @@ func (s *S) TestListRolesForEvent(c *check.C) {
 	c.Assert(roles, check.HasLen, 1)
 	c.Assert(roles[0].Name, check.Equals, "myrole2")
 }
+
+func (s *S) TestRoleAddDenyPermissions(c *check.C) {
+	r, err := NewRole("myrole", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r.AddPermissions("app")
+	c.Assert(err, check.IsNil)
+	err = r.AddDenyPermissions("app.update.env")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.SchemeNames, check.DeepEquals, []string{"app"})
+	c.Assert(r.DenySchemeNames, check.DeepEquals, []string{"app.update.env"})
+	err = r.AddDenyPermissions("app.invalid")
+	c.Assert(err, check.FitsTypeOf, &ErrPermissionNotFound{})
+	dbR, err := FindRole("myrole")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbR.DenySchemeNames, check.DeepEquals, []string{"app.update.env"})
+	perms := dbR.PermissionsFor("team1")
+	c.Assert(perms, check.DeepEquals, []Permission{
+		{Scheme: PermApp, Context: Context(CtxTeam, "team1")},
+		{Scheme: PermAppUpdateEnv, Context: Context(CtxTeam, "team1"), Deny: true},
+	})
+	c.Assert(CheckFromPermList(perms, PermAppUpdateEnvSet, Context(CtxTeam, "team1")), check.Equals, false)
+	c.Assert(CheckFromPermList(perms, PermAppDeploy, Context(CtxTeam, "team1")), check.Equals, true)
+	err = r.RemoveDenyPermissions("app.update.env")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.DenySchemeNames, check.HasLen, 0)
+	c.Assert(r.SchemeNames, check.DeepEquals, []string{"app"})
+}
+
+func (s *S) TestRoleSetConditions(c *check.C) {
+	r, err := NewRole("myrole", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r.AddPermissions("app.deploy")
+	c.Assert(err, check.IsNil)
+	conditions := &Conditions{TimeWindow: "09:00-18:00", Pools: []string{"dev"}}
+	err = r.SetConditions(conditions)
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Conditions, check.DeepEquals, conditions)
+	dbR, err := FindRole("myrole")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbR.Conditions, check.DeepEquals, conditions)
+	c.Assert(dbR.PermissionsFor("team1"), check.DeepEquals, []Permission{
+		{Scheme: PermAppDeploy, Context: Context(CtxTeam, "team1"), Conditions: conditions},
+	})
+	err = r.SetConditions(&Conditions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Conditions, check.IsNil)
+	dbR, err = FindRole("myrole")
+	c.Assert(err, check.IsNil)
+	c.Assert(dbR.Conditions, check.IsNil)
+}
+
+func (s *S) TestRoleSetConditionsInvalid(c *check.C) {
+	r, err := NewRole("myrole", "team", "")
+	c.Assert(err, check.IsNil)
+	err = r.SetConditions(&Conditions{SourceCIDRs: []string{"invalid"}})
+	c.Assert(err, check.ErrorMatches, `invalid source CIDR "invalid"`)
+	missing := Role{Name: "missing"}
+	err = missing.SetConditions(&Conditions{Pools: []string{"dev"}})
+	c.Assert(err, check.Equals, ErrRoleNotFound)
+}
+
+func (s *S) TestFindRoleWithoutDenyAndConditions(c *check.C) {
+	coll, err := rolesCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(bson.M{"_id": "legacy", "contexttype": "team", "schemenames": []string{"app.deploy"}})
+	c.Assert(err, check.IsNil)
+	r, err := FindRole("legacy")
+	c.Assert(err, check.IsNil)
+	c.Assert(r, check.DeepEquals, Role{Name: "legacy", ContextType: CtxTeam, SchemeNames: []string{"app.deploy"}})
+	c.Assert(r.PermissionsFor("team1"), check.DeepEquals, []Permission{
+		{Scheme: PermAppDeploy, Context: Context(CtxTeam, "team1")},
+	})
+}
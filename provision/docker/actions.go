@@ -22,6 +22,7 @@ import (
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/container"
 	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -39,6 +40,12 @@ type runContainerActionsArgs struct {
 	event            *event.Event
 }
 
+// TracingSpan returns the span of the operation handling the app, making the
+// pipelines children of it.
+func (args runContainerActionsArgs) TracingSpan() *tracing.Span {
+	return tracing.SpanOf(args.app)
+}
+
 type containersToAdd struct {
 	Quantity int
 	Status   provision.Status
@@ -57,6 +64,12 @@ type changeUnitsPipelineArgs struct {
 	event       *event.Event
 }
 
+// TracingSpan returns the span of the operation handling the app, making the
+// pipelines children of it.
+func (args changeUnitsPipelineArgs) TracingSpan() *tracing.Span {
+	return tracing.SpanOf(args.app)
+}
+
 type callbackFunc func(*container.Container, chan *container.Container) error
 
 type rollbackFunc func(*container.Container)
@@ -213,6 +226,7 @@ var createContainer = action.Action{
 			DestinationHosts: args.destinationHosts,
 			ProcessName:      args.processName,
 			Building:         building,
+			Span:             ctx.Span,
 		})
 		if err != nil {
 			log.Errorf("error on create container for app %s - %s", args.app.GetName(), err)
@@ -297,6 +311,7 @@ var startContainer = action.Action{
 			Provisioner: args.provisioner,
 			App:         args.app,
 			Deploy:      args.isDeploy,
+			Span:        ctx.Span,
 		})
 		if err != nil {
 			log.Errorf("error on start container %s - %s", c.ID, err)
@@ -391,6 +406,7 @@ var bindAndHealthcheck = action.Action{
 			if doHealthcheck && c.ProcessName == webProcessName {
 				err = runHealthcheck(c, writer)
 				if err != nil {
+					args.app.Log(err.Error(), provision.HealthcheckLogSource, c.ID)
 					return err
 				}
 			}
@@ -431,6 +447,13 @@ var bindAndHealthcheck = action.Action{
 	OnError: rollbackNotice,
 }
 
+// startRouterSpan starts the span tracing a call to the router of the app,
+// as part of the span of the action.
+func startRouterSpan(parent *tracing.Span, app provision.App, op string) *tracing.Span {
+	routerName, _ := app.GetRouterName()
+	return router.StartSpan(parent, routerName, op)
+}
+
 var addNewRoutes = action.Action{
 	Name: "add-new-routes",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
@@ -467,7 +490,9 @@ var addNewRoutes = action.Action{
 		if len(routesToAdd) == 0 {
 			return newContainers, nil
 		}
+		span := startRouterSpan(ctx.Span, args.app, "add routes")
 		err = r.AddRoutes(args.app.GetName(), routesToAdd)
+		span.Finish(err)
 		if err != nil {
 			r.RemoveRoutes(args.app.GetName(), routesToAdd)
 			return nil, err
@@ -548,7 +573,9 @@ var setRouterHealthcheck = action.Action{
 			msg = fmt.Sprintf("%s, Body: %s", msg, hcData.Body)
 		}
 		fmt.Fprintf(writer, "\n---- Setting router healthcheck (%s) ----\n", msg)
+		span := startRouterSpan(ctx.Span, args.app, "set healthcheck")
 		err = hcRouter.SetHealthcheck(args.app.GetName(), hcData)
+		span.Finish(err)
 		return newContainers, err
 	},
 	Backward: func(ctx action.BWContext) {
@@ -623,7 +650,9 @@ var removeOldRoutes = action.Action{
 		if len(routesToRemove) == 0 {
 			return
 		}
+		span := startRouterSpan(ctx.Span, args.app, "remove routes")
 		err = r.RemoveRoutes(args.app.GetName(), routesToRemove)
+		span.Finish(err)
 		if err != nil {
 			if !args.appDestroy {
 				r.AddRoutes(args.app.GetName(), routesToRemove)
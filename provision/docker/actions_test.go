@@ -1213,6 +1213,11 @@ func (s *S) TestBindAndHealthcheckForwardHealthcheckError(c *check.C) {
 	u2 := containers[1].AsUnit(fakeApp)
 	c.Assert(fakeApp.HasBind(&u1), check.Equals, false)
 	c.Assert(fakeApp.HasBind(&u2), check.Equals, false)
+	logs := fakeApp.Logs()
+	c.Assert(len(logs) > 0, check.Equals, true)
+	for _, l := range logs {
+		c.Assert(l, check.Matches, provision.HealthcheckLogSource+`.*healthcheck fail\(.*?\): wrong status code, expected 200, got: 404`)
+	}
 }
 
 func (s *S) TestBindAndHealthcheckForwardRestartError(c *check.C) {
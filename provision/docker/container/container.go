@@ -24,6 +24,7 @@ import (
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/dockercommon"
 	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -106,6 +107,9 @@ type CreateArgs struct {
 	ProcessName      string
 	Deploy           bool
 	Building         bool
+
+	// Span is the parent of the span tracing the creation, when traced.
+	Span *tracing.Span
 }
 
 func (c *Container) Create(args *CreateArgs) error {
@@ -173,7 +177,9 @@ func (c *Container) Create(args *CreateArgs) error {
 		ProcessName:   args.ProcessName,
 		ActionLimiter: args.Provisioner.ActionLimiter(),
 	}
+	span := startClusterSpan(args.Span, "create container", c)
 	addr, cont, err := args.Provisioner.Cluster().CreateContainerSchedulerOpts(opts, schedulerOpts, net.StreamInactivityTimeout, nodeList...)
+	span.Finish(err)
 	hostAddr := net.URLToHost(addr)
 	if schedulerOpts.LimiterDone != nil {
 		schedulerOpts.LimiterDone()
@@ -469,6 +475,9 @@ type StartArgs struct {
 	Provisioner DockerProvisioner
 	App         provision.App
 	Deploy      bool
+
+	// Span is the parent of the span tracing the start, when traced.
+	Span *tracing.Span
 }
 
 func (c *Container) hostConfig(app provision.App, isDeploy bool) (*docker.HostConfig, error) {
@@ -521,7 +530,9 @@ func (c *Container) hostConfig(app provision.App, isDeploy bool) (*docker.HostCo
 
 func (c *Container) Start(args *StartArgs) error {
 	done := args.Provisioner.ActionLimiter().Start(c.HostAddr)
+	span := startClusterSpan(args.Span, "start container", c)
 	err := args.Provisioner.Cluster().StartContainer(c.ID, nil)
+	span.Finish(err)
 	done()
 	if err != nil {
 		return err
@@ -0,0 +1,18 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package container
+
+import "github.com/tsuru/tsuru/tracing"
+
+// startClusterSpan starts a span for a call to the docker cluster as a child
+// of parent, when the call is part of a traced operation.
+func startClusterSpan(parent *tracing.Span, op string, c *Container) *tracing.Span {
+	span := parent.StartChild("docker " + op)
+	span.SetTag("app", c.AppName)
+	if c.ID != "" {
+		span.SetTag("container", c.ShortID())
+	}
+	return span
+}
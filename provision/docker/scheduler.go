@@ -46,6 +46,10 @@ func (s *segregatedScheduler) Schedule(c *cluster.Cluster, opts docker.CreateCon
 	if err != nil {
 		return cluster.Node{}, &container.SchedulerError{Base: err}
 	}
+	err = s.checkPoolReservations(a, nodes)
+	if err != nil {
+		return cluster.Node{}, &container.SchedulerError{Base: err}
+	}
 	nodes, err = s.filterByMemoryUsage(a, nodes, s.maxMemoryRatio, s.TotalMemoryMetadata)
 	if err != nil {
 		return cluster.Node{}, &container.SchedulerError{Base: err}
@@ -126,6 +130,83 @@ func (s *segregatedScheduler) filterByMemoryUsage(a *app.App, nodes []cluster.No
 	return nodeList, nil
 }
 
+// checkPoolReservations checks whether a new container of the app would use
+// the units or the memory of the pool reserved to other teams. The unit
+// capacity of the pool is the number of nodes multiplied by the max container
+// count of the pool auto scale rule, and the memory capacity is the memory of
+// its nodes multiplied by the max memory ratio. Each resource is only checked
+// when its capacity is configured.
+func (s *segregatedScheduler) checkPoolReservations(a *app.App, nodes []cluster.Node) error {
+	pool, err := provision.GetPoolByName(a.Pool)
+	if err != nil {
+		if err == provision.ErrPoolNotFound {
+			return nil
+		}
+		return err
+	}
+	hasReservations := false
+	for _, q := range pool.TeamQuotas {
+		hasReservations = hasReservations || (q.Team != a.TeamOwner && (q.Reserved.Units > 0 || q.Reserved.Memory > 0))
+	}
+	if !hasReservations {
+		return nil
+	}
+	capacity := provision.PoolResources{Units: -1, Memory: -1}
+	rule, _ := autoscale.AutoScaleRuleForMetadata(a.Pool)
+	if rule != nil && rule.MaxContainerCount > 0 {
+		capacity.Units = len(nodes) * rule.MaxContainerCount
+	}
+	hosts := make([]string, len(nodes))
+	for i := range nodes {
+		hosts[i] = net.URLToHost(nodes[i].Address)
+		if s.maxMemoryRatio == 0 || s.TotalMemoryMetadata == "" {
+			continue
+		}
+		totalMemory, _ := strconv.ParseFloat(nodes[i].Metadata[s.TotalMemoryMetadata], 64)
+		if capacity.Memory < 0 {
+			capacity.Memory = 0
+		}
+		capacity.Memory += int64(totalMemory * float64(s.maxMemoryRatio))
+	}
+	if capacity.Units < 0 && capacity.Memory < 0 {
+		return nil
+	}
+	containers, err := s.provisioner.ListContainers(bson.M{"hostaddr": bson.M{"$in": hosts}, "id": bson.M{"$nin": s.ignoredContainers}})
+	if err != nil {
+		return err
+	}
+	filter := &app.Filter{}
+	seen := make(map[string]bool)
+	for _, cont := range containers {
+		if !seen[cont.AppName] {
+			seen[cont.AppName] = true
+			filter.ExtraIn("name", cont.AppName)
+		}
+	}
+	apps := make(map[string]*app.App)
+	if len(seen) > 0 {
+		appList, err := app.List(filter)
+		if err != nil {
+			return err
+		}
+		for i := range appList {
+			apps[appList[i].Name] = &appList[i]
+		}
+	}
+	usage := make(map[string]provision.PoolResources)
+	for _, cont := range containers {
+		contApp, ok := apps[cont.AppName]
+		if !ok {
+			return app.ErrAppNotFound
+		}
+		teamUsage := usage[contApp.TeamOwner]
+		teamUsage.Units++
+		teamUsage.Memory += contApp.Plan.Memory
+		usage[contApp.TeamOwner] = teamUsage
+	}
+	return pool.CheckReservations(a.TeamOwner, usage, capacity, provision.PoolResources{Units: 1, Memory: a.Plan.Memory})
+}
+
 type nodeAggregate struct {
 	HostAddr string `bson:"_id"`
 	Count    int
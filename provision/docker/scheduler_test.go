@@ -18,6 +18,7 @@ import (
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/autoscale"
 	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/container"
 	"gopkg.in/check.v1"
@@ -242,6 +243,99 @@ func (s *S) TestSchedulerScheduleWithMemoryAwareness(c *check.C) {
 	c.Assert(node, check.DeepEquals, cluster.Node{})
 }
 
+func (s *S) TestSchedulerScheduleWithPoolReservations(c *check.C) {
+	a := app.App{Name: "skyrim", Plan: app.Plan{Memory: 60000}, Pool: "mypool", TeamOwner: "bethesda"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": a.Name})
+	segSched := segregatedScheduler{
+		maxMemoryRatio:      0.8,
+		TotalMemoryMetadata: "totalMemory",
+		provisioner:         s.p,
+	}
+	err = provision.AddPool(provision.AddPoolOptions{Name: "mypool"})
+	c.Assert(err, check.IsNil)
+	defer provision.RemovePool("mypool")
+	err = provision.SetPoolTeamQuota("mypool", provision.PoolTeamQuota{
+		Team:     "zenimax",
+		Limit:    provision.PoolResources{Units: -1, Memory: -1},
+		Reserved: provision.PoolResources{Memory: 100000},
+	})
+	c.Assert(err, check.IsNil)
+	server1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer server1.Stop()
+	server2, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer server2.Stop()
+	localURL := strings.Replace(server2.URL(), "127.0.0.1", "localhost", -1)
+	clusterInstance, err := cluster.New(&segSched, &cluster.MapStorage{},
+		cluster.Node{Address: server1.URL(), Metadata: map[string]string{
+			"totalMemory": "100000",
+			"pool":        "mypool",
+		}},
+		cluster.Node{Address: localURL, Metadata: map[string]string{
+			"totalMemory": "100000",
+			"pool":        "mypool",
+		}},
+	)
+	c.Assert(err, check.Equals, nil)
+	s.p.cluster = clusterInstance
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	defer contColl.RemoveAll(bson.M{"appname": "skyrim"})
+	opts := docker.CreateContainerOptions{Name: "unit1"}
+	node, err := segSched.Schedule(clusterInstance, opts, &container.SchedulerOpts{AppName: a.Name, ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	err = contColl.Insert(container.Container{ID: "unit1", Name: "unit1", AppName: a.Name, HostAddr: net.URLToHost(node.Address)})
+	c.Assert(err, check.IsNil)
+	opts = docker.CreateContainerOptions{Name: "unit2"}
+	node, err = segSched.Schedule(clusterInstance, opts, &container.SchedulerOpts{AppName: a.Name, ProcessName: "web"})
+	c.Assert(err, check.ErrorMatches, `.*Quota exceeded for memory of pool mypool not reserved to other teams\. Available: 0\. Requested: 60000\..*`)
+	c.Assert(node, check.DeepEquals, cluster.Node{})
+}
+
+func (s *S) TestSchedulerScheduleWithPoolUnitReservations(c *check.C) {
+	a := app.App{Name: "skyrim", Pool: "mypool", TeamOwner: "bethesda"}
+	err := s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": a.Name})
+	segSched := segregatedScheduler{provisioner: s.p}
+	err = provision.AddPool(provision.AddPoolOptions{Name: "mypool"})
+	c.Assert(err, check.IsNil)
+	defer provision.RemovePool("mypool")
+	err = provision.SetPoolTeamQuota("mypool", provision.PoolTeamQuota{
+		Team:     "zenimax",
+		Limit:    provision.PoolResources{Units: -1, Memory: -1},
+		Reserved: provision.PoolResources{Units: 2},
+	})
+	c.Assert(err, check.IsNil)
+	rule := autoscale.Rule{MetadataFilter: "mypool", Enabled: true, MaxContainerCount: 3}
+	err = rule.Update()
+	c.Assert(err, check.IsNil)
+	defer autoscale.DeleteRule("mypool")
+	server1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer server1.Stop()
+	clusterInstance, err := cluster.New(&segSched, &cluster.MapStorage{},
+		cluster.Node{Address: server1.URL(), Metadata: map[string]string{"pool": "mypool"}},
+	)
+	c.Assert(err, check.Equals, nil)
+	s.p.cluster = clusterInstance
+	contColl := s.p.Collection()
+	defer contColl.Close()
+	defer contColl.RemoveAll(bson.M{"appname": "skyrim"})
+	opts := docker.CreateContainerOptions{Name: "unit1"}
+	node, err := segSched.Schedule(clusterInstance, opts, &container.SchedulerOpts{AppName: a.Name, ProcessName: "web"})
+	c.Assert(err, check.IsNil)
+	err = contColl.Insert(container.Container{ID: "unit1", Name: "unit1", AppName: a.Name, HostAddr: net.URLToHost(node.Address)})
+	c.Assert(err, check.IsNil)
+	opts = docker.CreateContainerOptions{Name: "unit2"}
+	node, err = segSched.Schedule(clusterInstance, opts, &container.SchedulerOpts{AppName: a.Name, ProcessName: "web"})
+	c.Assert(err, check.ErrorMatches, `.*Quota exceeded for units of pool mypool not reserved to other teams\. Available: 0\. Requested: 1\..*`)
+	c.Assert(node, check.DeepEquals, cluster.Node{})
+}
+
 func (s *S) TestSchedulerScheduleWithMemoryAwarenessWithAutoScale(c *check.C) {
 	config.Set("docker:auto-scale:enabled", true)
 	defer config.Unset("docker:auto-scale:enabled")
@@ -0,0 +1,128 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+)
+
+const unitMetricsTimeout = 10 * time.Second
+
+// UnitsMetrics samples the resources used by the running containers of the
+// app, using the stats API of the docker nodes running them. Containers whose
+// stats can't be read are skipped.
+func (p *dockerProvisioner) UnitsMetrics(app provision.App) ([]provision.UnitMetrics, error) {
+	containers, err := p.listContainersByApp(app.GetName())
+	if err != nil {
+		return nil, err
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		metrics []provision.UnitMetrics
+	)
+	for i := range containers {
+		c := &containers[i]
+		if !c.Available() {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m, err := p.containerMetrics(c)
+			if err != nil {
+				log.Errorf("[unit metrics] unable to read stats of container %s: %s", c.ShortID(), err)
+				return
+			}
+			mu.Lock()
+			metrics = append(metrics, *m)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return metrics, nil
+}
+
+func (p *dockerProvisioner) containerMetrics(c *container.Container) (*provision.UnitMetrics, error) {
+	node, err := p.GetNodeByHost(c.HostAddr)
+	if err != nil {
+		return nil, err
+	}
+	client, err := node.Client()
+	if err != nil {
+		return nil, err
+	}
+	statsCh := make(chan *docker.Stats, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- client.Stats(docker.StatsOptions{
+			ID:      c.ID,
+			Stats:   statsCh,
+			Stream:  false,
+			Timeout: unitMetricsTimeout,
+		})
+	}()
+	stats := <-statsCh
+	err = <-errCh
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		return nil, errors.New("no stats returned by docker")
+	}
+	cont, err := p.Cluster().InspectContainer(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	m := unitMetricsFromStats(stats)
+	m.ID = c.ID
+	m.AppName = c.AppName
+	m.ProcessName = c.ProcessName
+	m.Restarts = cont.RestartCount
+	return &m, nil
+}
+
+// unitMetricsFromStats converts docker stats to unit metrics. CPU usage is
+// computed like the docker client does, from the difference between the
+// current and the previous CPU stats, and the page cache isn't accounted as
+// memory in use.
+func unitMetricsFromStats(stats *docker.Stats) provision.UnitMetrics {
+	m := provision.UnitMetrics{
+		Date:        stats.Read.UTC(),
+		MemoryLimit: stats.MemoryStats.Limit,
+	}
+	if m.Date.IsZero() {
+		m.Date = time.Now().UTC()
+	}
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemCPUUsage) - float64(stats.PreCPUStats.SystemCPUUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		cpus := len(stats.CPUStats.CPUUsage.PercpuUsage)
+		if cpus == 0 {
+			cpus = 1
+		}
+		m.CPU = cpuDelta / systemDelta * float64(cpus) * 100
+	}
+	m.Memory = stats.MemoryStats.Usage
+	if cache := stats.MemoryStats.Stats.Cache; cache < m.Memory {
+		m.Memory -= cache
+	}
+	if len(stats.Networks) == 0 {
+		m.NetworkRx = stats.Network.RxBytes
+		m.NetworkTx = stats.Network.TxBytes
+	}
+	for _, n := range stats.Networks {
+		m.NetworkRx += n.RxBytes
+		m.NetworkTx += n.TxBytes
+	}
+	return m
+}
@@ -0,0 +1,96 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/provisiontest"
+	"gopkg.in/check.v1"
+)
+
+func fakeContainerStats() docker.Stats {
+	var stats docker.Stats
+	stats.Read = time.Date(2017, 5, 10, 12, 0, 0, 0, time.UTC)
+	stats.PreCPUStats.CPUUsage.TotalUsage = 1000
+	stats.PreCPUStats.SystemCPUUsage = 10000
+	stats.CPUStats.CPUUsage.TotalUsage = 1500
+	stats.CPUStats.CPUUsage.PercpuUsage = []uint64{750, 750}
+	stats.CPUStats.SystemCPUUsage = 20000
+	stats.MemoryStats.Usage = 3000
+	stats.MemoryStats.Limit = 8000
+	stats.MemoryStats.Stats.Cache = 1000
+	stats.Networks = map[string]docker.NetworkStats{
+		"eth0": {RxBytes: 100, TxBytes: 50},
+		"eth1": {RxBytes: 10, TxBytes: 5},
+	}
+	return stats
+}
+
+func (s *S) TestUnitMetricsFromStats(c *check.C) {
+	stats := fakeContainerStats()
+	m := unitMetricsFromStats(&stats)
+	c.Assert(m, check.DeepEquals, provision.UnitMetrics{
+		Date:        time.Date(2017, 5, 10, 12, 0, 0, 0, time.UTC),
+		CPU:         10,
+		Memory:      2000,
+		MemoryLimit: 8000,
+		NetworkRx:   110,
+		NetworkTx:   55,
+	})
+}
+
+func (s *S) TestUnitMetricsFromStatsWithoutPreviousSample(c *check.C) {
+	var stats docker.Stats
+	stats.CPUStats.CPUUsage.TotalUsage = 1500
+	stats.CPUStats.SystemCPUUsage = 20000
+	stats.Network.RxBytes = 20
+	stats.Network.TxBytes = 30
+	m := unitMetricsFromStats(&stats)
+	c.Assert(m.CPU, check.Equals, 7.5)
+	c.Assert(m.NetworkRx, check.Equals, uint64(20))
+	c.Assert(m.NetworkTx, check.Equals, uint64(30))
+	c.Assert(m.Date.IsZero(), check.Equals, false)
+}
+
+func (s *S) TestUnitsMetrics(c *check.C) {
+	cont, err := s.newContainer(&newContainerOpts{AppName: "myapp", ProcessName: "web", Status: provision.StatusStarted.String()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	stopped, err := s.newContainer(&newContainerOpts{AppName: "myapp", ProcessName: "web", Status: provision.StatusStopped.String()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(stopped)
+	s.server.PrepareStats(cont.ID, func(string) docker.Stats {
+		return fakeContainerStats()
+	})
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, []provision.UnitMetrics{{
+		ID:          cont.ID,
+		AppName:     "myapp",
+		ProcessName: "web",
+		Date:        time.Date(2017, 5, 10, 12, 0, 0, 0, time.UTC),
+		CPU:         10,
+		Memory:      2000,
+		MemoryLimit: 8000,
+		NetworkRx:   110,
+		NetworkTx:   55,
+	}})
+}
+
+func (s *S) TestUnitsMetricsSkipsMissingContainers(c *check.C) {
+	cont, err := s.newContainer(&newContainerOpts{AppName: "myapp", ProcessName: "web", Status: provision.StatusStarted.String()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont)
+	err = s.p.Cluster().RemoveContainer(docker.RemoveContainerOptions{ID: cont.ID, Force: true})
+	c.Assert(err, check.IsNil)
+	a := provisiontest.NewFakeApp("myapp", "python", 0)
+	metrics, err := s.p.UnitsMetrics(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 0)
+}
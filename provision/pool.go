@@ -33,6 +33,7 @@ type Pool struct {
 	Name        string `bson:"_id"`
 	Default     bool
 	Provisioner string
+	TeamQuotas  []PoolTeamQuota `bson:",omitempty"`
 }
 
 type AddPoolOptions struct {
@@ -127,6 +128,10 @@ func (p *Pool) MarshalJSON() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	teamsUsage, err := p.TeamsQuotaUsage()
+	if err != nil {
+		return nil, err
+	}
 	result := make(map[string]interface{})
 	result["name"] = p.Name
 	result["public"] = teams.AllowsAll()
@@ -134,6 +139,9 @@ func (p *Pool) MarshalJSON() ([]byte, error) {
 	result["provisioner"] = p.Provisioner
 	result["teams"] = resolvedConstraints["team"]
 	result["allowed"] = resolvedConstraints
+	if len(teamsUsage) > 0 {
+		result["teamquotas"] = teamsUsage
+	}
 	return json.Marshal(&result)
 }
 
@@ -0,0 +1,229 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// PoolResources are the resources of a pool used by the apps of a team.
+// Memory is the sum of the plan memory, in bytes, of each unit. In limits,
+// negative values mean unlimited.
+type PoolResources struct {
+	Units  int
+	Memory int64
+}
+
+// PoolTeamQuota limits the resources used by a team in a pool, and reserves
+// resources of the pool to the team, which other teams aren't able to use.
+type PoolTeamQuota struct {
+	Team     string
+	Limit    PoolResources
+	Reserved PoolResources
+}
+
+// PoolTeamUsage reports the resources used by a team in a pool along with
+// the quota of the team.
+type PoolTeamUsage struct {
+	PoolTeamQuota `bson:",inline"`
+	InUse         PoolResources
+}
+
+// TeamQuota returns the quota of the team in the pool. Teams without a quota
+// are unlimited and have no reservations.
+func (p *Pool) TeamQuota(team string) PoolTeamQuota {
+	for _, q := range p.TeamQuotas {
+		if q.Team == team {
+			return q
+		}
+	}
+	return PoolTeamQuota{Team: team, Limit: PoolResources{Units: -1, Memory: -1}}
+}
+
+// TeamsUsage returns the resources used by the apps of each team in the
+// pool, keyed by the team owning the apps.
+func (p *Pool) TeamsUsage() (map[string]PoolResources, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	var results []struct {
+		Team   string `bson:"_id"`
+		Units  int
+		Memory int64
+	}
+	err = conn.Apps().Pipe([]bson.M{
+		{"$match": bson.M{"pool": p.Name}},
+		{"$group": bson.M{
+			"_id":    "$teamowner",
+			"units":  bson.M{"$sum": "$quota.inuse"},
+			"memory": bson.M{"$sum": bson.M{"$multiply": []interface{}{"$plan.memory", "$quota.inuse"}}},
+		}},
+	}).All(&results)
+	if err != nil {
+		return nil, err
+	}
+	usage := make(map[string]PoolResources, len(results))
+	for _, r := range results {
+		usage[r.Team] = PoolResources{Units: r.Units, Memory: r.Memory}
+	}
+	return usage, nil
+}
+
+// TeamsQuotaUsage returns the usage of each team with apps or a quota in the
+// pool, sorted by team name.
+func (p *Pool) TeamsQuotaUsage() ([]PoolTeamUsage, error) {
+	usage, err := p.TeamsUsage()
+	if err != nil {
+		return nil, err
+	}
+	teams := make([]string, 0, len(usage))
+	for team := range usage {
+		teams = append(teams, team)
+	}
+	for _, q := range p.TeamQuotas {
+		if _, ok := usage[q.Team]; !ok {
+			teams = append(teams, q.Team)
+		}
+	}
+	sort.Strings(teams)
+	result := make([]PoolTeamUsage, len(teams))
+	for i, team := range teams {
+		result[i] = PoolTeamUsage{PoolTeamQuota: p.TeamQuota(team), InUse: usage[team]}
+	}
+	return result, nil
+}
+
+// CheckTeamQuota checks whether the team may use the requested resources in
+// the pool without exceeding its limits, returning a
+// *quota.QuotaExceededError otherwise.
+func (p *Pool) CheckTeamQuota(team string, requested PoolResources) error {
+	q := p.TeamQuota(team)
+	if q.Limit.Units < 0 && q.Limit.Memory < 0 {
+		return nil
+	}
+	usage, err := p.TeamsUsage()
+	if err != nil {
+		return err
+	}
+	return checkPoolResources(
+		fmt.Sprintf("team %s in pool %s", team, p.Name),
+		q.Limit, usage[team], requested,
+	)
+}
+
+// CheckReservations checks whether the team may use the requested resources
+// in the pool without using the resources reserved to other teams. The usage
+// of each team and the capacity of the pool are informed by provisioners,
+// negative capacities are not checked.
+func (p *Pool) CheckReservations(team string, usage map[string]PoolResources, capacity, requested PoolResources) error {
+	var available PoolResources
+	var total PoolResources
+	for _, inUse := range usage {
+		total.Units += inUse.Units
+		total.Memory += inUse.Memory
+	}
+	available.Units = capacity.Units - total.Units
+	available.Memory = capacity.Memory - total.Memory
+	for _, q := range p.TeamQuotas {
+		if q.Team == team {
+			continue
+		}
+		inUse := usage[q.Team]
+		if q.Reserved.Units > inUse.Units {
+			available.Units -= q.Reserved.Units - inUse.Units
+		}
+		if q.Reserved.Memory > inUse.Memory {
+			available.Memory -= q.Reserved.Memory - inUse.Memory
+		}
+	}
+	if capacity.Units < 0 {
+		available.Units = -1
+	}
+	if capacity.Memory < 0 {
+		available.Memory = -1
+	}
+	return checkPoolResources(
+		fmt.Sprintf("pool %s not reserved to other teams", p.Name),
+		available, PoolResources{}, requested,
+	)
+}
+
+func checkPoolResources(description string, limit, inUse, requested PoolResources) error {
+	if limit.Units >= 0 && requested.Units > 0 && inUse.Units+requested.Units > limit.Units {
+		return &quota.QuotaExceededError{
+			Resource:  "units of " + description,
+			Available: availableResource(int64(limit.Units), int64(inUse.Units)),
+			Requested: uint(requested.Units),
+		}
+	}
+	if limit.Memory >= 0 && requested.Memory > 0 && inUse.Memory+requested.Memory > limit.Memory {
+		return &quota.QuotaExceededError{
+			Resource:  "memory of " + description,
+			Available: availableResource(limit.Memory, inUse.Memory),
+			Requested: uint(requested.Memory),
+		}
+	}
+	return nil
+}
+
+func availableResource(limit, inUse int64) uint {
+	if inUse >= limit {
+		return 0
+	}
+	return uint(limit - inUse)
+}
+
+// SetPoolTeamQuota sets the quota of a team in the pool. Negative limits mean
+// the resource is unlimited, and quotas without limits and reservations are
+// removed.
+func SetPoolTeamQuota(poolName string, q PoolTeamQuota) error {
+	if q.Team == "" {
+		return errors.New("Team is required.")
+	}
+	if q.Limit.Units < 0 {
+		q.Limit.Units = -1
+	}
+	if q.Limit.Memory < 0 {
+		q.Limit.Memory = -1
+	}
+	if q.Reserved.Units < 0 || q.Reserved.Memory < 0 {
+		return errors.New("Reservations can't be negative.")
+	}
+	if (q.Limit.Units >= 0 && q.Reserved.Units > q.Limit.Units) || (q.Limit.Memory >= 0 && q.Reserved.Memory > q.Limit.Memory) {
+		return errors.New("Reservations can't be greater than limits.")
+	}
+	pool, err := GetPoolByName(poolName)
+	if err != nil {
+		return err
+	}
+	quotas := make([]PoolTeamQuota, 0, len(pool.TeamQuotas)+1)
+	for _, existing := range pool.TeamQuotas {
+		if existing.Team != q.Team {
+			quotas = append(quotas, existing)
+		}
+	}
+	if q.Limit.Units >= 0 || q.Limit.Memory >= 0 || q.Reserved.Units > 0 || q.Reserved.Memory > 0 {
+		quotas = append(quotas, q)
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Pools().UpdateId(poolName, bson.M{"$set": bson.M{"teamquotas": quotas}})
+	if err == mgo.ErrNotFound {
+		return ErrPoolNotFound
+	}
+	return err
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package provision
+
+import (
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) insertPoolApp(c *check.C, name, pool, team string, units int, memory int64) {
+	err := s.storage.Apps().Insert(bson.M{
+		"name":      name,
+		"pool":      pool,
+		"teamowner": team,
+		"plan":      bson.M{"_id": "small", "memory": memory},
+		"quota":     bson.M{"limit": -1, "inuse": units},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestPoolTeamQuotaDefault(c *check.C) {
+	p := Pool{Name: "pool1"}
+	c.Assert(p.TeamQuota("ateam"), check.DeepEquals, PoolTeamQuota{
+		Team:  "ateam",
+		Limit: PoolResources{Units: -1, Memory: -1},
+	})
+}
+
+func (s *S) TestSetPoolTeamQuota(c *check.C) {
+	err := AddPool(AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = SetPoolTeamQuota("pool1", PoolTeamQuota{
+		Team:     "ateam",
+		Limit:    PoolResources{Units: 10, Memory: -10},
+		Reserved: PoolResources{Units: 2},
+	})
+	c.Assert(err, check.IsNil)
+	err = SetPoolTeamQuota("pool1", PoolTeamQuota{Team: "test", Limit: PoolResources{Units: 5, Memory: -1}})
+	c.Assert(err, check.IsNil)
+	p, err := GetPoolByName("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.TeamQuotas, check.DeepEquals, []PoolTeamQuota{
+		{Team: "ateam", Limit: PoolResources{Units: 10, Memory: -1}, Reserved: PoolResources{Units: 2}},
+		{Team: "test", Limit: PoolResources{Units: 5, Memory: -1}},
+	})
+	err = SetPoolTeamQuota("pool1", PoolTeamQuota{Team: "ateam", Limit: PoolResources{Units: -1, Memory: -1}})
+	c.Assert(err, check.IsNil)
+	p, err = GetPoolByName("pool1")
+	c.Assert(err, check.IsNil)
+	c.Assert(p.TeamQuotas, check.DeepEquals, []PoolTeamQuota{
+		{Team: "test", Limit: PoolResources{Units: 5, Memory: -1}},
+	})
+}
+
+func (s *S) TestSetPoolTeamQuotaInvalid(c *check.C) {
+	err := AddPool(AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	err = SetPoolTeamQuota("pool1", PoolTeamQuota{Limit: PoolResources{Units: 1}})
+	c.Assert(err, check.ErrorMatches, "Team is required.")
+	err = SetPoolTeamQuota("pool1", PoolTeamQuota{Team: "ateam", Limit: PoolResources{Units: 1, Memory: -1}, Reserved: PoolResources{Units: 2}})
+	c.Assert(err, check.ErrorMatches, "Reservations can't be greater than limits.")
+	err = SetPoolTeamQuota("pool1", PoolTeamQuota{Team: "ateam", Reserved: PoolResources{Units: -2}})
+	c.Assert(err, check.ErrorMatches, "Reservations can't be negative.")
+	err = SetPoolTeamQuota("unknown", PoolTeamQuota{Team: "ateam", Limit: PoolResources{Units: 1}})
+	c.Assert(err, check.Equals, ErrPoolNotFound)
+}
+
+func (s *S) TestPoolTeamsQuotaUsage(c *check.C) {
+	s.insertPoolApp(c, "app1", "pool1", "ateam", 2, 512)
+	s.insertPoolApp(c, "app2", "pool1", "ateam", 1, 1024)
+	s.insertPoolApp(c, "app3", "pool1", "test", 3, 256)
+	s.insertPoolApp(c, "app4", "pool2", "ateam", 5, 256)
+	p := Pool{Name: "pool1", TeamQuotas: []PoolTeamQuota{
+		{Team: "pteam", Limit: PoolResources{Units: 4, Memory: -1}},
+		{Team: "ateam", Limit: PoolResources{Units: 10, Memory: -1}, Reserved: PoolResources{Units: 3}},
+	}}
+	usage, err := p.TeamsQuotaUsage()
+	c.Assert(err, check.IsNil)
+	c.Assert(usage, check.DeepEquals, []PoolTeamUsage{
+		{
+			PoolTeamQuota: PoolTeamQuota{Team: "ateam", Limit: PoolResources{Units: 10, Memory: -1}, Reserved: PoolResources{Units: 3}},
+			InUse:         PoolResources{Units: 3, Memory: 2048},
+		},
+		{
+			PoolTeamQuota: PoolTeamQuota{Team: "pteam", Limit: PoolResources{Units: 4, Memory: -1}},
+		},
+		{
+			PoolTeamQuota: PoolTeamQuota{Team: "test", Limit: PoolResources{Units: -1, Memory: -1}},
+			InUse:         PoolResources{Units: 3, Memory: 768},
+		},
+	})
+}
+
+func (s *S) TestPoolCheckTeamQuota(c *check.C) {
+	s.insertPoolApp(c, "app1", "pool1", "ateam", 2, 512)
+	p := Pool{Name: "pool1", TeamQuotas: []PoolTeamQuota{
+		{Team: "ateam", Limit: PoolResources{Units: 4, Memory: 2048}},
+	}}
+	err := p.CheckTeamQuota("ateam", PoolResources{Units: 2, Memory: 1024})
+	c.Assert(err, check.IsNil)
+	err = p.CheckTeamQuota("ateam", PoolResources{Units: 3, Memory: 1536})
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: "units of team ateam in pool pool1", Available: 2, Requested: 3})
+	p.TeamQuotas[0].Limit.Units = -1
+	err = p.CheckTeamQuota("ateam", PoolResources{Units: 3, Memory: 1536})
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: "memory of team ateam in pool pool1", Available: 1024, Requested: 1536})
+	err = p.CheckTeamQuota("test", PoolResources{Units: 100, Memory: 1 << 40})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestPoolCheckReservations(c *check.C) {
+	p := Pool{Name: "pool1", TeamQuotas: []PoolTeamQuota{
+		{Team: "ateam", Limit: PoolResources{Units: -1, Memory: -1}, Reserved: PoolResources{Memory: 4096}},
+	}}
+	usage := map[string]PoolResources{
+		"ateam": {Units: 1, Memory: 1024},
+		"test":  {Units: 2, Memory: 2048},
+	}
+	capacity := PoolResources{Units: -1, Memory: 8192}
+	err := p.CheckReservations("test", usage, capacity, PoolResources{Units: 1, Memory: 2048})
+	c.Assert(err, check.IsNil)
+	err = p.CheckReservations("test", usage, capacity, PoolResources{Units: 1, Memory: 4096})
+	c.Assert(err, check.DeepEquals, &quota.QuotaExceededError{Resource: "memory of pool pool1 not reserved to other teams", Available: 2048, Requested: 4096})
+	err = p.CheckReservations("ateam", usage, capacity, PoolResources{Units: 1, Memory: 4096})
+	c.Assert(err, check.IsNil)
+}
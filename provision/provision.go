@@ -133,6 +133,10 @@ const (
 	StatusAsleep = Status("asleep")
 )
 
+// HealthcheckLogSource is the source of the app log entries written by
+// provisioners when the healthcheck of a unit fails.
+const HealthcheckLogSource = "healthcheck"
+
 // Unit represents a provision unit. Can be a machine, container or anything
 // IP-addressable.
 type Unit struct {
@@ -350,6 +354,30 @@ type MetricsProvisioner interface {
 	MetricEnvs(App) map[string]string
 }
 
+// UnitMetrics is a sample of the resources used by a unit. CPU is the usage
+// in percent of one CPU, and the network and restart counters are cumulative
+// since the unit was created.
+type UnitMetrics struct {
+	ID          string    `json:"id"`
+	AppName     string    `json:"app"`
+	ProcessName string    `json:"process"`
+	Date        time.Time `json:"date"`
+	CPU         float64   `json:"cpu"`
+	Memory      uint64    `json:"memory"`
+	MemoryLimit uint64    `json:"memorylimit,omitempty"`
+	NetworkRx   uint64    `json:"networkrx"`
+	NetworkTx   uint64    `json:"networktx"`
+	Restarts    int       `json:"restarts"`
+}
+
+// UnitMetricsProvisioner is a provisioner that samples the resources used by
+// units.
+type UnitMetricsProvisioner interface {
+	// UnitsMetrics returns a sample of the resources used by each running
+	// unit of the app.
+	UnitsMetrics(App) ([]UnitMetrics, error)
+}
+
 // ShellProvisioner is a provisioner that allows opening a shell to existing
 // units.
 type ShellProvisioner interface {
@@ -661,6 +661,34 @@ func (p *FakeProvisioner) MetricEnvs(app provision.App) map[string]string {
 	}
 }
 
+// UnitsMetrics returns a sample for each unit of the app in the fake
+// provisioner, using the number of restarts of its process.
+func (p *FakeProvisioner) UnitsMetrics(app provision.App) ([]provision.UnitMetrics, error) {
+	if err := p.getError("UnitsMetrics"); err != nil {
+		return nil, err
+	}
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	pApp := p.apps[app.GetName()]
+	metrics := make([]provision.UnitMetrics, 0, len(pApp.units))
+	for _, u := range pApp.units {
+		if u.Status != provision.StatusStarted {
+			continue
+		}
+		metrics = append(metrics, provision.UnitMetrics{
+			ID:          u.ID,
+			AppName:     u.AppName,
+			ProcessName: u.ProcessName,
+			Date:        time.Now().UTC(),
+			CPU:         10,
+			Memory:      64 * 1024 * 1024,
+			MemoryLimit: uint64(app.GetMemory()),
+			Restarts:    pApp.restarts[u.ProcessName],
+		})
+	}
+	return metrics, nil
+}
+
 // Restarts returns the number of restarts for a given app.
 func (p *FakeProvisioner) Restarts(a provision.App, process string) int {
 	p.mut.RLock()
@@ -21,8 +21,14 @@ func (q *Quota) Unlimited() bool {
 type QuotaExceededError struct {
 	Requested uint
 	Available uint
+	// Resource optionally describes the exhausted resource, like "units of
+	// team myteam".
+	Resource string
 }
 
 func (err *QuotaExceededError) Error() string {
+	if err.Resource != "" {
+		return fmt.Sprintf("Quota exceeded for %s. Available: %d. Requested: %d.", err.Resource, err.Available, err.Requested)
+	}
 	return fmt.Sprintf("Quota exceeded. Available: %d. Requested: %d.", err.Available, err.Requested)
 }
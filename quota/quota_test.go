@@ -21,6 +21,11 @@ func (Suite) TestQuotaExceededError(c *check.C) {
 	c.Assert(err.Error(), check.Equals, "Quota exceeded. Available: 9. Requested: 10.")
 }
 
+func (Suite) TestQuotaExceededErrorWithResource(c *check.C) {
+	err := QuotaExceededError{Requested: 2, Available: 1, Resource: "units of team myteam"}
+	c.Assert(err.Error(), check.Equals, "Quota exceeded for units of team myteam. Available: 1. Requested: 2.")
+}
+
 func (Suite) TestQuotaUnlimited(c *check.C) {
 	var q Quota
 	q.Limit = -1
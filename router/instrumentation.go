@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/tsuru/tracing"
 )
 
 var (
@@ -27,6 +28,8 @@ func init() {
 	prometheus.MustRegister(requestErrors)
 }
 
+// InstrumentRequest records the latency and the errors of a request to the
+// router. The returned function must be called when the request finishes.
 func InstrumentRequest(routerName string) func(error) {
 	begin := time.Now()
 	return func(err error) {
@@ -36,3 +39,11 @@ func InstrumentRequest(routerName string) func(error) {
 		}
 	}
 }
+
+// StartSpan starts a span, child of the span of the operation calling the
+// router, tracing the call. The span must be finished when the call returns.
+func StartSpan(parent *tracing.Span, routerName, op string) *tracing.Span {
+	span := parent.StartChild("router " + op)
+	span.SetTag("router", routerName)
+	return span
+}
@@ -6,8 +6,10 @@ package router
 
 import (
 	"errors"
+	"path/filepath"
 
 	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/tracing"
 	"gopkg.in/check.v1"
 )
 
@@ -262,3 +264,19 @@ func (s *S) TestRouteError(c *check.C) {
 	err = &RouterError{Op: "del", Err: errors.New("Fatal error.")}
 	c.Assert(err.Error(), check.Equals, "[router del] Fatal error.")
 }
+
+func (s *S) TestStartSpan(c *check.C) {
+	config.Set("tracing:exporter", "file")
+	config.Set("tracing:file:path", filepath.Join(c.MkDir(), "spans.json"))
+	defer config.Unset("tracing")
+	err := tracing.Initialize()
+	c.Assert(err, check.IsNil)
+	defer tracing.Stop()
+	c.Assert(StartSpan(nil, "galeb", "add backend"), check.IsNil)
+	parent := tracing.StartRemoteSpan("POST /apps", "", "req-1")
+	span := StartSpan(parent, "galeb", "add backend")
+	c.Assert(span.Name, check.Equals, "router add backend")
+	c.Assert(span.ParentID, check.Equals, parent.SpanID)
+	c.Assert(span.RequestID, check.Equals, "req-1")
+	c.Assert(span.Tags, check.DeepEquals, map[string]string{"router": "galeb"})
+}
@@ -45,6 +45,7 @@ func (s *BindSuite) SetUpSuite(c *check.C) {
 
 func (s *BindSuite) SetUpTest(c *check.C) {
 	routertest.FakeRouter.Reset()
+	resetBreakers()
 	dbtest.ClearAllCollections(s.conn.Apps().Database)
 	s.user = auth.User{Email: "sad-but-true@metallica.com"}
 	s.user.Create()
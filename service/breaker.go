@@ -0,0 +1,115 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+)
+
+const (
+	defaultBreakerMaxFailures = 5
+	defaultBreakerOpenTime    = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned by calls to a service API while its circuit
+// breaker is open, i.e. after the API failed too many consecutive requests.
+// Calls fail fast instead of waiting for the HTTP timeout.
+type ErrCircuitOpen struct {
+	Service    string
+	Failures   int
+	RetryAfter time.Duration
+}
+
+func (e *ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("service %q is unavailable: its API failed %d consecutive requests, next attempt in %s",
+		e.Service, e.Failures, e.RetryAfter)
+}
+
+type circuitBreaker struct {
+	sync.Mutex
+	service   string
+	failures  int
+	openUntil time.Time
+}
+
+var breakers = struct {
+	sync.Mutex
+	m map[string]*circuitBreaker
+}{m: map[string]*circuitBreaker{}}
+
+func breakerFor(service string) *circuitBreaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+	b, ok := breakers.m[service]
+	if !ok {
+		b = &circuitBreaker{service: service}
+		breakers.m[service] = b
+	}
+	return b
+}
+
+func resetBreakers() {
+	breakers.Lock()
+	defer breakers.Unlock()
+	breakers.m = map[string]*circuitBreaker{}
+}
+
+func breakerConfig() (int, time.Duration) {
+	maxFailures, _ := config.GetInt("services:circuit-breaker:max-failures")
+	if maxFailures <= 0 {
+		maxFailures = defaultBreakerMaxFailures
+	}
+	openTime := defaultBreakerOpenTime
+	if seconds, _ := config.GetInt("services:circuit-breaker:open-time"); seconds > 0 {
+		openTime = time.Duration(seconds) * time.Second
+	}
+	return maxFailures, openTime
+}
+
+// allow returns an error if the circuit is open. Once the open period is
+// over, a single request is allowed through to probe the service API, the
+// circuit remains open for everyone else until that request finishes.
+func (b *circuitBreaker) allow() error {
+	b.Lock()
+	defer b.Unlock()
+	maxFailures, openTime := breakerConfig()
+	if b.failures < maxFailures {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(b.openUntil) {
+		return &ErrCircuitOpen{Service: b.service, Failures: b.failures, RetryAfter: b.openUntil.Sub(now)}
+	}
+	b.openUntil = now.Add(openTime)
+	return nil
+}
+
+func (b *circuitBreaker) success() {
+	b.Lock()
+	defer b.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+func (b *circuitBreaker) failure() {
+	b.Lock()
+	defer b.Unlock()
+	maxFailures, openTime := breakerConfig()
+	b.failures++
+	if b.failures >= maxFailures {
+		b.openUntil = time.Now().Add(openTime)
+	}
+}
+
+func (b *circuitBreaker) isOpen() bool {
+	b.Lock()
+	defer b.Unlock()
+	maxFailures, _ := breakerConfig()
+	return b.failures >= maxFailures
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestCircuitBreakerOpensAfterMaxFailures(c *check.C) {
+	config.Set("services:circuit-breaker:max-failures", 2)
+	defer config.Unset("services:circuit-breaker:max-failures")
+	b := breakerFor("mysql")
+	c.Assert(b.allow(), check.IsNil)
+	b.failure()
+	c.Assert(b.allow(), check.IsNil)
+	c.Assert(b.isOpen(), check.Equals, false)
+	b.failure()
+	c.Assert(b.isOpen(), check.Equals, true)
+	err := b.allow()
+	c.Assert(err, check.FitsTypeOf, &ErrCircuitOpen{})
+	e := err.(*ErrCircuitOpen)
+	c.Assert(e.Service, check.Equals, "mysql")
+	c.Assert(e.Failures, check.Equals, 2)
+	c.Assert(e.RetryAfter > 0, check.Equals, true)
+}
+
+func (s *S) TestCircuitBreakerAllowsSingleProbeAfterOpenTime(c *check.C) {
+	config.Set("services:circuit-breaker:max-failures", 1)
+	defer config.Unset("services:circuit-breaker:max-failures")
+	b := breakerFor("mysql")
+	b.failure()
+	c.Assert(b.allow(), check.NotNil)
+	b.openUntil = time.Now().Add(-time.Second)
+	c.Assert(b.allow(), check.IsNil)
+	c.Assert(b.allow(), check.NotNil)
+	b.success()
+	c.Assert(b.isOpen(), check.Equals, false)
+	c.Assert(b.allow(), check.IsNil)
+}
+
+func (s *S) TestCircuitBreakerIsPerService(c *check.C) {
+	config.Set("services:circuit-breaker:max-failures", 1)
+	defer config.Unset("services:circuit-breaker:max-failures")
+	breakerFor("mysql").failure()
+	c.Assert(breakerFor("mysql").allow(), check.NotNil)
+	c.Assert(breakerFor("mongodb").allow(), check.IsNil)
+}
+
+func (s *S) TestClientFailsFastWhenCircuitIsOpen(c *check.C) {
+	config.Set("services:circuit-breaker:max-failures", 1)
+	defer config.Unset("services:circuit-breaker:max-failures")
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer ts.Close()
+	breakerFor("mysql").failure()
+	client := &Client{serviceName: "mysql", endpoint: ts.URL}
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql"}
+	err := client.Create(&instance, "me@tsuru.io", "")
+	c.Assert(err, check.ErrorMatches, `(?s).*service "mysql" is unavailable.*`)
+	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(0))
+}
+
+func (s *S) TestClientServerErrorsOpenCircuit(c *check.C) {
+	config.Set("services:circuit-breaker:max-failures", 2)
+	defer config.Unset("services:circuit-breaker:max-failures")
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	client := &Client{serviceName: "mysql", endpoint: ts.URL}
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql"}
+	err := client.Destroy(&instance, "")
+	c.Assert(err, check.NotNil)
+	err = client.Destroy(&instance, "")
+	c.Assert(err, check.NotNil)
+	err = client.Destroy(&instance, "")
+	c.Assert(err, check.FitsTypeOf, &ErrCircuitOpen{})
+	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(2))
+}
+
+func (s *S) TestClientTransportErrorsOpenCircuit(c *check.C) {
+	config.Set("services:circuit-breaker:max-failures", 2)
+	defer config.Unset("services:circuit-breaker:max-failures")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := ts.URL
+	ts.Close()
+	client := &Client{serviceName: "mysql", endpoint: url}
+	instance := ServiceInstance{Name: "my-mysql", ServiceName: "mysql"}
+	err := client.Destroy(&instance, "")
+	c.Assert(err, check.NotNil)
+	err = client.Destroy(&instance, "")
+	c.Assert(err, check.NotNil)
+	err = client.Destroy(&instance, "")
+	c.Assert(err, check.FitsTypeOf, &ErrCircuitOpen{})
+}
@@ -93,11 +93,21 @@ func (c *Client) issueRequest(path, method string, params map[string][]string) (
 	}
 	req.SetBasicAuth(c.username, c.password)
 	req.Close = true
+	breaker := breakerFor(c.serviceName)
+	if err = breaker.allow(); err != nil {
+		requestErrors.WithLabelValues(c.serviceName).Inc()
+		return nil, err
+	}
 	t0 := time.Now()
 	resp, err := net.Dial5Full300ClientNoKeepAlive.Do(req)
 	requestLatencies.WithLabelValues(c.serviceName).Observe(time.Since(t0).Seconds())
 	if err != nil {
 		requestErrors.WithLabelValues(c.serviceName).Inc()
+		breaker.failure()
+	} else if resp.StatusCode >= http.StatusInternalServerError {
+		breaker.failure()
+	} else {
+		breaker.success()
 	}
 	return resp, err
 }
@@ -0,0 +1,188 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/log"
+)
+
+const (
+	EndpointStatusUp      = "up"
+	EndpointStatusDown    = "down"
+	EndpointStatusUnknown = "unknown"
+)
+
+var endpointMonitorInstance *endpointMonitor
+
+type endpointMonitor struct {
+	interval time.Duration
+	client   *http.Client
+	done     chan bool
+	mu       sync.RWMutex
+	results  map[string]error
+	checkers map[string]bool
+}
+
+// InitializeEndpointMonitor starts a background routine that periodically
+// checks the production endpoint of every registered service. Results are
+// exposed through the hc package and feed the circuit breaker used by the
+// service API client.
+func InitializeEndpointMonitor() error {
+	if endpointMonitorInstance != nil {
+		return errors.New("endpoint monitor already initialized")
+	}
+	enabled, _ := config.GetBool("services:healthcheck:enabled")
+	if !enabled {
+		return nil
+	}
+	intervalSeconds, _ := config.GetInt("services:healthcheck:interval")
+	if intervalSeconds <= 0 {
+		intervalSeconds = 60
+	}
+	timeoutSeconds, _ := config.GetInt("services:healthcheck:timeout")
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = 10
+	}
+	endpointMonitorInstance = newEndpointMonitor(time.Duration(intervalSeconds)*time.Second, time.Duration(timeoutSeconds)*time.Second)
+	shutdown.Register(endpointMonitorInstance)
+	go endpointMonitorInstance.run()
+	return nil
+}
+
+func newEndpointMonitor(interval, timeout time.Duration) *endpointMonitor {
+	return &endpointMonitor{
+		interval: interval,
+		client:   &http.Client{Timeout: timeout},
+		done:     make(chan bool),
+		results:  map[string]error{},
+		checkers: map[string]bool{},
+	}
+}
+
+// EndpointStatus returns the status of the production endpoint of the given
+// service, as seen by the endpoint monitor and the circuit breaker.
+func EndpointStatus(serviceName string) string {
+	if breakerFor(serviceName).isOpen() {
+		return EndpointStatusDown
+	}
+	if endpointMonitorInstance == nil {
+		return EndpointStatusUnknown
+	}
+	endpointMonitorInstance.mu.RLock()
+	defer endpointMonitorInstance.mu.RUnlock()
+	err, ok := endpointMonitorInstance.results[serviceName]
+	if !ok {
+		return EndpointStatusUnknown
+	}
+	if err != nil {
+		return EndpointStatusDown
+	}
+	return EndpointStatusUp
+}
+
+func (m *endpointMonitor) Shutdown() {
+	m.done <- true
+}
+
+func (m *endpointMonitor) String() string {
+	return "service endpoint monitor"
+}
+
+func (m *endpointMonitor) run() {
+	for {
+		err := m.checkAll()
+		if err != nil {
+			log.Errorf("[service endpoint monitor] %s", err)
+		}
+		select {
+		case <-m.done:
+			return
+		case <-time.After(m.interval):
+		}
+	}
+}
+
+func (m *endpointMonitor) checkAll() error {
+	services, err := GetServicesByFilter(nil)
+	if err != nil {
+		return err
+	}
+	results := make(map[string]error, len(services))
+	for i := range services {
+		s := &services[i]
+		err = m.checkService(s)
+		breaker := breakerFor(s.Name)
+		if err != nil {
+			breaker.failure()
+		} else {
+			breaker.success()
+		}
+		results[s.Name] = err
+		m.registerChecker(s.Name)
+	}
+	m.mu.Lock()
+	m.results = results
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *endpointMonitor) checkService(s *Service) error {
+	client, err := s.getClient("production")
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(client.endpoint, "/") + "/resources/plans"
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(client.username, client.password)
+	req.Close = true
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return errors.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+	}
+	return nil
+}
+
+func (m *endpointMonitor) registerChecker(serviceName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.checkers[serviceName] {
+		return
+	}
+	m.checkers[serviceName] = true
+	hc.AddChecker("Service "+serviceName, func() error {
+		return m.healthCheck(serviceName)
+	})
+}
+
+// healthCheck reports the last result for the service. Services removed
+// after their checker was registered are reported as disabled components.
+func (m *endpointMonitor) healthCheck(serviceName string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	err, ok := m.results[serviceName]
+	if !ok {
+		return hc.ErrDisabledComponent
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/hc"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestEndpointMonitorCheckAll(c *check.C) {
+	okServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Path, check.Equals, "/resources/plans")
+		w.Write([]byte("[]"))
+	}))
+	defer okServer.Close()
+	failServer := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer failServer.Close()
+	srvc := Service{Name: "mongodb", Endpoint: map[string]string{"production": okServer.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	srvc = Service{Name: "mysql", Endpoint: map[string]string{"production": failServer.URL}}
+	err = srvc.Create()
+	c.Assert(err, check.IsNil)
+	m := newEndpointMonitor(time.Minute, time.Second)
+	err = m.checkAll()
+	c.Assert(err, check.IsNil)
+	c.Assert(m.healthCheck("mongodb"), check.IsNil)
+	c.Assert(m.healthCheck("mysql"), check.ErrorMatches, "unexpected status code 500 from .*")
+	c.Assert(m.healthCheck("redis"), check.Equals, hc.ErrDisabledComponent)
+	c.Assert(m.checkers, check.DeepEquals, map[string]bool{"mongodb": true, "mysql": true})
+}
+
+func (s *S) TestEndpointMonitorFailuresOpenCircuit(c *check.C) {
+	config.Set("services:circuit-breaker:max-failures", 2)
+	defer config.Unset("services:circuit-breaker:max-failures")
+	failServer := httptest.NewServer(http.HandlerFunc(failHandler))
+	defer failServer.Close()
+	srvc := Service{Name: "mysql", Endpoint: map[string]string{"production": failServer.URL}}
+	err := srvc.Create()
+	c.Assert(err, check.IsNil)
+	m := newEndpointMonitor(time.Minute, time.Second)
+	err = m.checkAll()
+	c.Assert(err, check.IsNil)
+	c.Assert(breakerFor("mysql").isOpen(), check.Equals, false)
+	err = m.checkAll()
+	c.Assert(err, check.IsNil)
+	c.Assert(breakerFor("mysql").isOpen(), check.Equals, true)
+}
+
+func (s *S) TestEndpointStatus(c *check.C) {
+	config.Set("services:circuit-breaker:max-failures", 1)
+	defer config.Unset("services:circuit-breaker:max-failures")
+	c.Assert(EndpointStatus("mongodb"), check.Equals, EndpointStatusUnknown)
+	old := endpointMonitorInstance
+	defer func() { endpointMonitorInstance = old }()
+	endpointMonitorInstance = newEndpointMonitor(time.Minute, time.Second)
+	endpointMonitorInstance.results["mongodb"] = nil
+	c.Assert(EndpointStatus("mongodb"), check.Equals, EndpointStatusUp)
+	c.Assert(EndpointStatus("redis"), check.Equals, EndpointStatusUnknown)
+	breakerFor("mongodb").failure()
+	c.Assert(EndpointStatus("mongodb"), check.Equals, EndpointStatusDown)
+}
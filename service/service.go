@@ -174,6 +174,7 @@ type ServiceModel struct {
 	Service   string   `json:"service"`
 	Instances []string `json:"instances"`
 	Plans     []string `json:"plans"`
+	Status    string   `json:"status,omitempty"`
 }
 
 // Proxy is a proxy between tsuru and the service.
@@ -314,6 +314,11 @@ func CreateServiceInstance(instance ServiceInstance, service *Service, user *aut
 	if instance.TeamOwner == "" {
 		return ErrTeamMandatory
 	}
+	releaseQuota, err := auth.ReserveTeamQuota(instance.TeamOwner, auth.TeamResources{ServiceInstances: 1})
+	if err != nil {
+		return err
+	}
+	defer releaseQuota()
 	instance.Teams = []string{instance.TeamOwner}
 	actions := []*action.Action{&createServiceInstance, &insertServiceInstance}
 	pipeline := action.NewPipeline(actions...)
@@ -65,6 +65,7 @@ func (s *S) SetUpSuite(c *check.C) {
 
 func (s *S) SetUpTest(c *check.C) {
 	routertest.FakeRouter.Reset()
+	resetBreakers()
 	dbtest.ClearAllCollectionsExcept(s.conn.Apps().Database, []string{"users", "tokens", "teams"})
 }
 
@@ -0,0 +1,362 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/api/shutdown"
+	"github.com/tsuru/tsuru/log"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+const (
+	defaultQueueSize = 10000
+	defaultBatchSize = 100
+	flushInterval    = time.Second
+
+	defaultServiceName = "tsuru"
+)
+
+var (
+	exporterFactories = map[string]ExporterFactory{
+		"file":   newFileExporter,
+		"zipkin": newZipkinExporter,
+	}
+
+	tracerMu     sync.RWMutex
+	tracer       *spanQueue
+	registerOnce sync.Once
+
+	spansExported = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tsuru_tracing_spans_exported_total",
+		Help: "The number of spans sent to the tracing exporter.",
+	})
+
+	spansDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tsuru_tracing_spans_dropped_total",
+		Help: "The number of spans dropped because the tracing queue was full.",
+	})
+
+	spansErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "tsuru_tracing_spans_errors_total",
+		Help: "The number of spans not exported due to errors.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(spansExported)
+	prometheus.MustRegister(spansDropped)
+	prometheus.MustRegister(spansErrors)
+}
+
+// Exporter sends finished spans to a tracing backend. Export is called with
+// batches of spans, from a single goroutine.
+type Exporter interface {
+	Export(spans []*Span) error
+	Close() error
+}
+
+// ExporterFactory creates an exporter from the tracing settings.
+type ExporterFactory func() (Exporter, error)
+
+// RegisterExporter registers a new kind of exporter, selected by the
+// tracing:exporter setting.
+func RegisterExporter(name string, factory ExporterFactory) {
+	exporterFactories[name] = factory
+}
+
+// Exporters returns the names of the available exporters.
+func Exporters() []string {
+	names := make([]string, 0, len(exporterFactories))
+	for name := range exporterFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enabled returns whether spans are being recorded.
+func Enabled() bool {
+	tracerMu.RLock()
+	defer tracerMu.RUnlock()
+	return tracer != nil
+}
+
+// Initialize starts exporting spans with the exporter set in the
+// tracing:exporter setting. Tracing is disabled when the setting is empty.
+func Initialize() error {
+	name, _ := config.GetString("tracing:exporter")
+	if name == "" {
+		return nil
+	}
+	factory, ok := exporterFactories[name]
+	if !ok {
+		return errors.Errorf("invalid tracing:exporter %q, it must be one of %v", name, Exporters())
+	}
+	exporter, err := factory()
+	if err != nil {
+		return err
+	}
+	size, _ := config.GetInt("tracing:queue-size")
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	batch, _ := config.GetInt("tracing:batch-size")
+	if batch <= 0 {
+		batch = defaultBatchSize
+	}
+	q := &spanQueue{
+		exporter: exporter,
+		batch:    batch,
+		ch:       make(chan *Span, size),
+		finished: make(chan struct{}),
+	}
+	go q.run()
+	tracerMu.Lock()
+	previous := tracer
+	tracer = q
+	tracerMu.Unlock()
+	if previous != nil {
+		previous.Shutdown()
+	}
+	registerOnce.Do(func() {
+		shutdown.Register(tracerShutdown{})
+	})
+	return nil
+}
+
+// Stop disables tracing, waiting until the spans already finished are
+// exported.
+func Stop() {
+	tracerMu.Lock()
+	q := tracer
+	tracer = nil
+	tracerMu.Unlock()
+	if q != nil {
+		q.Shutdown()
+	}
+}
+
+// tracerShutdown exports pending spans before the API exits.
+type tracerShutdown struct{}
+
+func (tracerShutdown) Shutdown() {
+	Stop()
+}
+
+func (tracerShutdown) String() string {
+	return "tracing exporter"
+}
+
+func export(s *Span) {
+	tracerMu.RLock()
+	defer tracerMu.RUnlock()
+	if tracer == nil {
+		return
+	}
+	select {
+	case tracer.ch <- s:
+	default:
+		spansDropped.Inc()
+	}
+}
+
+// spanQueue sends finished spans to the exporter in batches, dropping spans
+// when the exporter can't keep up and the queue is full.
+type spanQueue struct {
+	exporter Exporter
+	batch    int
+	ch       chan *Span
+	finished chan struct{}
+	once     sync.Once
+}
+
+func (q *spanQueue) run() {
+	defer close(q.finished)
+	t := time.NewTimer(flushInterval)
+	defer t.Stop()
+	spans := make([]*Span, 0, q.batch)
+	for {
+		flush := false
+		closed := false
+		select {
+		case s, ok := <-q.ch:
+			if !ok {
+				closed = true
+				flush = len(spans) > 0
+				break
+			}
+			spans = append(spans, s)
+			flush = len(spans) >= q.batch
+		case <-t.C:
+			flush = len(spans) > 0
+			t.Reset(flushInterval)
+		}
+		if flush {
+			err := q.exporter.Export(spans)
+			if err != nil {
+				log.Errorf("[tracing] unable to export %d spans: %s", len(spans), err)
+				spansErrors.Add(float64(len(spans)))
+			} else {
+				spansExported.Add(float64(len(spans)))
+			}
+			spans = make([]*Span, 0, q.batch)
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// Shutdown stops the queue, once it's no longer the active tracer, waiting
+// for pending spans to be exported.
+func (q *spanQueue) Shutdown() {
+	q.once.Do(func() {
+		close(q.ch)
+		<-q.finished
+		if err := q.exporter.Close(); err != nil {
+			log.Errorf("[tracing] unable to close exporter: %s", err)
+		}
+	})
+}
+
+// zipkinExporter posts spans, in the Zipkin v2 JSON format, to the Zipkin
+// endpoint set in the tracing:zipkin:url setting, like
+// http://zipkin:9411/api/v2/spans.
+type zipkinExporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+func newZipkinExporter() (Exporter, error) {
+	url, _ := config.GetString("tracing:zipkin:url")
+	if url == "" {
+		return nil, errors.New("tracing:zipkin:url is mandatory for the zipkin exporter")
+	}
+	serviceName, _ := config.GetString("tracing:zipkin:service-name")
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	return &zipkinExporter{url: url, serviceName: serviceName, client: tsuruNet.Dial5Full60ClientNoKeepAlive}, nil
+}
+
+func (e *zipkinExporter) toZipkin(s *Span) zipkinSpan {
+	tags := make(map[string]string, len(s.Tags)+2)
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	if s.RequestID != "" {
+		tags["request.id"] = s.RequestID
+	}
+	if s.Error != "" {
+		tags["error"] = s.Error
+	}
+	duration := int64(s.Duration / time.Microsecond)
+	if duration < 1 {
+		duration = 1
+	}
+	return zipkinSpan{
+		TraceID:       s.TraceID,
+		ID:            s.SpanID,
+		ParentID:      s.ParentID,
+		Name:          s.Name,
+		Timestamp:     s.Start.UnixNano() / int64(time.Microsecond),
+		Duration:      duration,
+		LocalEndpoint: zipkinEndpoint{ServiceName: e.serviceName},
+		Tags:          tags,
+	}
+}
+
+func (e *zipkinExporter) Export(spans []*Span) error {
+	zipkinSpans := make([]zipkinSpan, len(spans))
+	for i, s := range spans {
+		zipkinSpans[i] = e.toZipkin(s)
+	}
+	data, err := json.Marshal(zipkinSpans)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rsp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return errors.Errorf("invalid response %d: %s", rsp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (e *zipkinExporter) Close() error {
+	return nil
+}
+
+// fileExporter appends spans, one JSON document per line, to the file set in
+// the tracing:file:path setting. It's mostly useful in tests and
+// development environments.
+type fileExporter struct {
+	file *os.File
+	enc  *json.Encoder
+}
+
+func newFileExporter() (Exporter, error) {
+	path, _ := config.GetString("tracing:file:path")
+	if path == "" {
+		return nil, errors.New("tracing:file:path is mandatory for the file exporter")
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileExporter{file: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (e *fileExporter) Export(spans []*Span) error {
+	for _, s := range spans {
+		err := e.enc.Encode(s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *fileExporter) Close() error {
+	return e.file.Close()
+}
@@ -0,0 +1,139 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package tracing records spans describing the time spent by tsuru in API
+// requests and action pipelines, exporting them to a tracing backend, like
+// Zipkin.
+//
+// Spans are passed explicitly: children are started with the StartChild
+// method of the parent span. The span of API requests is stored in the
+// request context, and the span of pipelines is passed to actions in their
+// contexts. All functions are no-ops returning nil spans when tracing is
+// disabled, and methods of nil spans do nothing, returning nil children.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var traceparentRegexp = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// Span is a timed operation in a trace. Spans are created by StartSpan,
+// StartRemoteSpan and StartChild, and exported when finished.
+type Span struct {
+	TraceID   string            `json:"traceid"`
+	SpanID    string            `json:"spanid"`
+	ParentID  string            `json:"parentid,omitempty"`
+	Name      string            `json:"name"`
+	RequestID string            `json:"requestid,omitempty"`
+	Start     time.Time         `json:"start"`
+	Duration  time.Duration     `json:"duration"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Error     string            `json:"error,omitempty"`
+
+	mu       sync.Mutex
+	finished bool
+}
+
+// StartSpan starts the root span of a new trace.
+func StartSpan(name string) *Span {
+	if !Enabled() {
+		return nil
+	}
+	return newSpan(name, newID(16), "", "")
+}
+
+// StartRemoteSpan starts the root span of the operations of tsuru in a
+// trace, continuing the trace described by the traceparent header, in the
+// W3C trace context format, when it's valid.
+func StartRemoteSpan(name, traceparent, requestID string) *Span {
+	if !Enabled() {
+		return nil
+	}
+	if parts := traceparentRegexp.FindStringSubmatch(traceparent); parts != nil {
+		return newSpan(name, parts[1], parts[2], requestID)
+	}
+	return newSpan(name, newID(16), "", requestID)
+}
+
+func newSpan(name, traceID, parentID, requestID string) *Span {
+	return &Span{
+		TraceID:   traceID,
+		SpanID:    newID(8),
+		ParentID:  parentID,
+		Name:      name,
+		RequestID: requestID,
+		Start:     time.Now().UTC(),
+	}
+}
+
+// StartChild starts a span child of the span, returning nil when the span is
+// nil, so operations are only traced as part of a traced parent.
+func (s *Span) StartChild(name string) *Span {
+	if s == nil || !Enabled() {
+		return nil
+	}
+	return newSpan(name, s.TraceID, s.SpanID, s.RequestID)
+}
+
+// Carrier is implemented by values carrying the span of the operation they
+// are part of, like apps handled in API requests.
+type Carrier interface {
+	TracingSpan() *Span
+}
+
+// SpanOf returns the span carried by v, which may be a span or a Carrier. It
+// returns nil when v carries no span.
+func SpanOf(v interface{}) *Span {
+	switch s := v.(type) {
+	case *Span:
+		return s
+	case Carrier:
+		return s.TracingSpan()
+	}
+	return nil
+}
+
+// SetTag sets a tag describing the span.
+func (s *Span) SetTag(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Tags == nil {
+		s.Tags = make(map[string]string)
+	}
+	s.Tags[key] = value
+}
+
+// Finish ends the span, recording the error of the operation, if any, and
+// sends it to the exporter. Calling Finish more than once has no effect.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.finished {
+		s.mu.Unlock()
+		return
+	}
+	s.finished = true
+	s.Duration = time.Since(s.Start)
+	if err != nil {
+		s.Error = err.Error()
+	}
+	s.mu.Unlock()
+	export(s)
+}
+
+func newID(size int) string {
+	b := make([]byte, size)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
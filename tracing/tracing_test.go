@@ -0,0 +1,205 @@
+// Copyright 2017 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tsuru/config"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	path string
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	s.path = filepath.Join(c.MkDir(), "spans.json")
+	config.Set("tracing:exporter", "file")
+	config.Set("tracing:file:path", s.path)
+	err := Initialize()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	Stop()
+	config.Unset("tracing")
+}
+
+func (s *S) exported(c *check.C) []*Span {
+	Stop()
+	f, err := os.Open(s.path)
+	c.Assert(err, check.IsNil)
+	defer f.Close()
+	var spans []*Span
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span Span
+		err = json.Unmarshal(scanner.Bytes(), &span)
+		c.Assert(err, check.IsNil)
+		spans = append(spans, &span)
+	}
+	c.Assert(scanner.Err(), check.IsNil)
+	return spans
+}
+
+func (s *S) TestStartSpanFinish(c *check.C) {
+	span := StartSpan("deploy")
+	c.Assert(span, check.NotNil)
+	span.SetTag("app", "myapp")
+	span.Finish(errors.New("something went wrong"))
+	span.Finish(nil)
+	spans := s.exported(c)
+	c.Assert(spans, check.HasLen, 1)
+	c.Assert(spans[0].Name, check.Equals, "deploy")
+	c.Assert(spans[0].TraceID, check.HasLen, 32)
+	c.Assert(spans[0].SpanID, check.HasLen, 16)
+	c.Assert(spans[0].ParentID, check.Equals, "")
+	c.Assert(spans[0].Tags, check.DeepEquals, map[string]string{"app": "myapp"})
+	c.Assert(spans[0].Error, check.Equals, "something went wrong")
+}
+
+func (s *S) TestStartChild(c *check.C) {
+	root := StartRemoteSpan("GET /apps", "", "req-1")
+	child := root.StartChild("pipeline")
+	grandchild := child.StartChild("mongodb insert")
+	grandchild.Finish(nil)
+	child.Finish(nil)
+	root.Finish(nil)
+	spans := s.exported(c)
+	c.Assert(spans, check.HasLen, 3)
+	c.Assert(spans[0].Name, check.Equals, "mongodb insert")
+	c.Assert(spans[0].ParentID, check.Equals, child.SpanID)
+	c.Assert(spans[1].Name, check.Equals, "pipeline")
+	c.Assert(spans[1].ParentID, check.Equals, root.SpanID)
+	c.Assert(spans[2].Name, check.Equals, "GET /apps")
+	for _, span := range spans {
+		c.Assert(span.TraceID, check.Equals, root.TraceID)
+		c.Assert(span.RequestID, check.Equals, "req-1")
+	}
+}
+
+func (s *S) TestStartChildNilParent(c *check.C) {
+	var root *Span
+	c.Assert(root.StartChild("mongodb insert"), check.IsNil)
+}
+
+type spanCarrier struct {
+	span *Span
+}
+
+func (c spanCarrier) TracingSpan() *Span {
+	return c.span
+}
+
+func (s *S) TestSpanOf(c *check.C) {
+	span := StartSpan("root")
+	c.Assert(SpanOf(span), check.Equals, span)
+	c.Assert(SpanOf(spanCarrier{span: span}), check.Equals, span)
+	c.Assert(SpanOf(spanCarrier{}), check.IsNil)
+	c.Assert(SpanOf("myapp"), check.IsNil)
+	c.Assert(SpanOf(nil), check.IsNil)
+}
+
+func (s *S) TestStartSpanIsRoot(c *check.C) {
+	root := StartSpan("root")
+	other := StartSpan("other")
+	c.Assert(other.ParentID, check.Equals, "")
+	c.Assert(other.TraceID, check.Not(check.Equals), root.TraceID)
+}
+
+func (s *S) TestStartRemoteSpanTraceparent(c *check.C) {
+	span := StartRemoteSpan("GET /apps", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "")
+	c.Assert(span.TraceID, check.Equals, "0af7651916cd43dd8448eb211c80319c")
+	c.Assert(span.ParentID, check.Equals, "b7ad6b7169203331")
+	span = StartRemoteSpan("GET /apps", "invalid", "")
+	c.Assert(span.TraceID, check.HasLen, 32)
+	c.Assert(span.ParentID, check.Equals, "")
+}
+
+func (s *S) TestDisabled(c *check.C) {
+	Stop()
+	c.Assert(Enabled(), check.Equals, false)
+	span := StartSpan("root")
+	c.Assert(span, check.IsNil)
+	c.Assert(span.StartChild("child"), check.IsNil)
+	span.SetTag("a", "b")
+	span.Finish(nil)
+	c.Assert(StartRemoteSpan("GET /", "", ""), check.IsNil)
+}
+
+func (s *S) TestInitializeInvalidExporter(c *check.C) {
+	config.Set("tracing:exporter", "jaeger")
+	err := Initialize()
+	c.Assert(err, check.ErrorMatches, `invalid tracing:exporter "jaeger", it must be one of \[file zipkin\]`)
+	config.Set("tracing:exporter", "zipkin")
+	err = Initialize()
+	c.Assert(err, check.ErrorMatches, "tracing:zipkin:url is mandatory for the zipkin exporter")
+}
+
+func (s *S) TestZipkinExporter(c *check.C) {
+	var received []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.Header.Get("Content-Type"), check.Equals, "application/json")
+		data, _ := ioutil.ReadAll(r.Body)
+		var spans []map[string]interface{}
+		c.Check(json.Unmarshal(data, &spans), check.IsNil)
+		received = append(received, spans...)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	config.Set("tracing:exporter", "zipkin")
+	config.Set("tracing:zipkin:url", srv.URL)
+	config.Set("tracing:zipkin:service-name", "tsuru-api")
+	err := Initialize()
+	c.Assert(err, check.IsNil)
+	root := StartRemoteSpan("GET /apps", "", "req-1")
+	child := root.StartChild("pipeline")
+	child.SetTag("app", "myapp")
+	child.Finish(errors.New("failed"))
+	root.Finish(nil)
+	Stop()
+	c.Assert(received, check.HasLen, 2)
+	c.Assert(received[0]["traceId"], check.Equals, root.TraceID)
+	c.Assert(received[0]["id"], check.Equals, child.SpanID)
+	c.Assert(received[0]["parentId"], check.Equals, root.SpanID)
+	c.Assert(received[0]["name"], check.Equals, "pipeline")
+	c.Assert(received[0]["timestamp"], check.Equals, float64(child.Start.UnixNano()/1000))
+	c.Assert(received[0]["duration"].(float64) > 0, check.Equals, true)
+	c.Assert(received[0]["localEndpoint"], check.DeepEquals, map[string]interface{}{"serviceName": "tsuru-api"})
+	c.Assert(received[0]["tags"], check.DeepEquals, map[string]interface{}{
+		"app":        "myapp",
+		"error":      "failed",
+		"request.id": "req-1",
+	})
+	c.Assert(received[1]["name"], check.Equals, "GET /apps")
+	_, hasParent := received[1]["parentId"]
+	c.Assert(hasParent, check.Equals, false)
+}
+
+func (s *S) TestZipkinExporterInvalidResponse(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "full", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	e := &zipkinExporter{url: srv.URL, serviceName: "tsuru", client: http.DefaultClient}
+	err := e.Export([]*Span{{Name: "a"}})
+	c.Assert(err, check.ErrorMatches, "invalid response 503: full")
+}